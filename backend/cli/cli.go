@@ -0,0 +1,72 @@
+// Package cli implements the backend's command line interface. Every command
+// shares the same configuration and database connection.
+package cli
+
+import (
+	"csci361/config"
+	"csci361/database"
+	"fmt"
+	"os"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// app holds what every command needs.
+type app struct {
+	cfg *config.Config
+	db  *gorm.DB
+}
+
+type command struct {
+	usage string
+	run   func(a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"serve":                 {"serve [--migrate=false]           start the HTTP server", runServe},
+	"migrate":               {"migrate up|down|status            manage the database schema", runMigrate},
+	"seed":                  {"seed --profile demo               load sample data", runSeed},
+	"create-user":           {"create-user --email --role ...    create a user account", runCreateUser},
+	"create-platform-admin": {"create-platform-admin --email    bootstrap the first platform admin", runCreatePlatformAdmin},
+	"rotate-jwt-secret":     {"rotate-jwt-secret [--env-file]    issue a new JWT secret and sign everyone out", runRotateJWTSecret},
+}
+
+// Run executes the command named by args[0]. Without arguments it serves.
+func Run(args []string) error {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return nil
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	cfg := config.Load()
+	db := database.Initialize(cfg)
+
+	return cmd.run(&app{cfg: cfg, db: db}, args)
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: main <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"csci361/config"
+	"csci361/database"
+	"csci361/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestApp(t *testing.T) *app {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	return &app{cfg: &config.Config{JWTSecret: "test-secret"}, db: db}
+}
+
+func TestSeedDemoIsIdempotent(t *testing.T) {
+	a := newTestApp(t)
+
+	for i := 0; i < 2; i++ {
+		if err := runSeed(a, []string{"--profile", "demo"}); err != nil {
+			t.Fatalf("seed run %d: %v", i+1, err)
+		}
+	}
+
+	counts := map[string]int64{}
+	for name, model := range map[string]interface{}{
+		"suppliers": &models.Supplier{},
+		"users":     &models.User{},
+		"products":  &models.Product{},
+		"orders":    &models.Order{},
+	} {
+		var n int64
+		a.db.Model(model).Count(&n)
+		counts[name] = n
+	}
+
+	want := map[string]int64{"suppliers": 1, "users": 5, "products": 5, "orders": 1}
+	for name, n := range want {
+		if counts[name] != n {
+			t.Errorf("%s: got %d, want %d", name, counts[name], n)
+		}
+	}
+
+	if err := runSeed(a, []string{"--profile", "unknown"}); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestCreateUserStaffNeedsExistingSupplier(t *testing.T) {
+	a := newTestApp(t)
+
+	if err := runCreateUser(a, []string{"--email", "sales@example.com", "--role", "sales", "--supplier-id", "42"}); err == nil {
+		t.Fatal("expected an error for a missing supplier")
+	}
+
+	if err := runCreateUser(a, []string{"--email", "owner@example.com", "--role", "owner", "--company", "Steppe Foods", "--password", "password123"}); err != nil {
+		t.Fatalf("create owner: %v", err)
+	}
+
+	var owner models.User
+	a.db.Where("email = ?", "owner@example.com").First(&owner)
+	if owner.SupplierID == nil {
+		t.Fatal("owner is not linked to a supplier")
+	}
+
+	if err := runCreateUser(a, []string{"--email", "sales@example.com", "--role", "sales", "--supplier-id", "1"}); err != nil {
+		t.Fatalf("create sales: %v", err)
+	}
+
+	if err := runCreateUser(a, []string{"--email", "owner@example.com", "--role", "consumer"}); err == nil {
+		t.Fatal("expected an error for a duplicate email")
+	}
+}
+
+func TestCreatePlatformAdminOnlyBootstrapsOnce(t *testing.T) {
+	a := newTestApp(t)
+
+	if err := runCreatePlatformAdmin(a, []string{"--email", "root@example.com"}); err != nil {
+		t.Fatalf("first admin: %v", err)
+	}
+	if err := runCreatePlatformAdmin(a, []string{"--email", "second@example.com"}); err == nil {
+		t.Fatal("expected the second bootstrap to fail")
+	}
+
+	var entry models.AuditLog
+	if err := a.db.Where("action = ?", models.AuditPlatformAdminCreated).First(&entry).Error; err != nil || entry.ActorID != nil {
+		t.Fatalf("expected an audit entry without actor, got %+v (%v)", entry, err)
+	}
+}
+
+func TestRotateJWTSecretRewritesEnvFile(t *testing.T) {
+	a := newTestApp(t)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	os.WriteFile(envFile, []byte("PORT=5000\nJWT_SECRET=old\n"), 0600)
+
+	if err := runRotateJWTSecret(a, []string{"--env-file", envFile}); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	data, _ := os.ReadFile(envFile)
+	content := string(data)
+	if !strings.HasPrefix(content, "PORT=5000\nJWT_SECRET=") || strings.Contains(content, "JWT_SECRET=old") {
+		t.Fatalf("secret was not replaced: %q", content)
+	}
+}
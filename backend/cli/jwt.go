@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"crypto/rand"
+	"csci361/models"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// runRotateJWTSecret generates a new signing secret, optionally writes it to
+// an env file and revokes every session. Tokens signed with the old secret
+// stop working once the server restarts with the new one.
+func runRotateJWTSecret(a *app, args []string) error {
+	fs := flag.NewFlagSet("rotate-jwt-secret", flag.ContinueOnError)
+	envFile := fs.String("env-file", "", "env file whose JWT_SECRET is replaced (prints the secret if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 48)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+
+	if *envFile != "" {
+		if err := setEnvValue(*envFile, "JWT_SECRET", secret); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote new JWT_SECRET to %s\n", *envFile)
+	} else {
+		fmt.Printf("JWT_SECRET=%s\n", secret)
+	}
+
+	result := a.db.Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	fmt.Printf("Revoked %d sessions. Restart the server to apply the new secret.\n", result.RowsAffected)
+	return nil
+}
+
+// setEnvValue replaces KEY=... in an env file, appending it if missing.
+func setEnvValue(path, key, value string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+
+	found := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), key+"=") {
+			lines[i] = key + "=" + value
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, key+"="+value)
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"csci361/database"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+func runMigrate(a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status")
+	}
+
+	migrator, err := database.NewMigrator(a.db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return nil
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return errors.New("--steps must be at least 1")
+		}
+
+		rolledBack, err := migrator.Down(*steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-32s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate action %q", args[0])
+}
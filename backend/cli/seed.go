@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"csci361/models"
+	"csci361/money"
+	"flag"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// demoOwnerEmail identifies the demo data set; seeding is skipped when it exists.
+const demoOwnerEmail = "owner@demo.scp.local"
+
+var seedProfiles = map[string]func(db *gorm.DB, password string) error{
+	"demo": seedDemo,
+}
+
+func runSeed(a *app, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	profile := fs.String("profile", "demo", "data set to load (demo)")
+	password := fs.String("password", "password123", "password for every seeded account")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	seed, ok := seedProfiles[*profile]
+	if !ok {
+		return fmt.Errorf("unknown seed profile %q", *profile)
+	}
+
+	return seed(a.db, *password)
+}
+
+// seedDemo loads one verified supplier with staff, products, linked
+// consumers, an order and a chat. It does nothing if the data already exists.
+func seedDemo(db *gorm.DB, password string) error {
+	var existing int64
+	db.Model(&models.User{}).Where("email = ?", demoOwnerEmail).Count(&existing)
+	if existing > 0 {
+		fmt.Println("Demo data already present, nothing to do")
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		categories := map[string]*models.Category{}
+		for _, name := range []string{"Vegetables", "Dairy", "Bakery", "Beverages"} {
+			category := models.Category{Name: name, IsActive: true}
+			if err := tx.Where("name = ?", name).FirstOrCreate(&category).Error; err != nil {
+				return err
+			}
+			categories[name] = &category
+		}
+
+		supplier := models.Supplier{
+			CompanyName:             "Steppe Fresh Foods",
+			City:                    "Astana",
+			Country:                 "Kazakhstan",
+			Description:             "Wholesale produce and dairy for restaurants",
+			IsVerified:              true,
+			IsActive:                true,
+			VerificationRequestedAt: &now,
+		}
+		if err := tx.Create(&supplier).Error; err != nil {
+			return err
+		}
+
+		newUser := func(email, role, firstName, lastName string, supplierID *uint) (models.User, error) {
+			user := models.User{
+				Email:           email,
+				Password:        string(hash),
+				Role:            role,
+				SupplierID:      supplierID,
+				FirstName:       firstName,
+				LastName:        lastName,
+				IsActive:        true,
+				EmailVerifiedAt: &now,
+			}
+			return user, tx.Create(&user).Error
+		}
+
+		owner, err := newUser(demoOwnerEmail, models.RoleOwner, "Aida", "Nurlanova", &supplier.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := newUser("admin@demo.scp.local", models.RoleAdmin, "Bolat", "Serikov", &supplier.ID); err != nil {
+			return err
+		}
+		sales, err := newUser("sales@demo.scp.local", models.RoleSales, "Dana", "Akhmetova", &supplier.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&supplier).Update("owner_id", owner.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.Subscription{
+			SupplierID:   supplier.ID,
+			PlanName:     models.DefaultPlanName,
+			Status:       "active",
+			StartDate:    now,
+			Currency:     "KZT",
+			BillingCycle: "monthly",
+		}).Error; err != nil {
+			return err
+		}
+
+		products := []models.Product{
+			{Name: "Potatoes", SKU: "DEMO-VEG-001", Price: money.FromFloat(180), Unit: "kg", Stock: 500, CategoryID: categories["Vegetables"].ID},
+			{Name: "Tomatoes", SKU: "DEMO-VEG-002", Price: money.FromFloat(650), Unit: "kg", Stock: 200, CategoryID: categories["Vegetables"].ID},
+			{Name: "Milk 3.2%", SKU: "DEMO-DAI-001", Price: money.FromFloat(420), Unit: "liter", Stock: 300, CategoryID: categories["Dairy"].ID},
+			{Name: "Kurt", SKU: "DEMO-DAI-002", Price: money.FromFloat(2500), Unit: "kg", Stock: 40, CategoryID: categories["Dairy"].ID},
+			{Name: "Baursak", SKU: "DEMO-BAK-001", Price: money.FromFloat(90), Unit: "piece", Stock: 1000, CategoryID: categories["Bakery"].ID},
+		}
+		for i := range products {
+			products[i].SupplierID = supplier.ID
+			products[i].IsActive = true
+			if err := tx.Create(&products[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		var consumers []models.Consumer
+		for _, c := range []struct{ email, first, last string }{
+			{"consumer@demo.scp.local", "Yerlan", "Tokayev"},
+			{"cafe@demo.scp.local", "Madina", "Zhunusova"},
+		} {
+			user, err := newUser(c.email, models.RoleConsumer, c.first, c.last, nil)
+			if err != nil {
+				return err
+			}
+			consumer := models.Consumer{UserID: user.ID}
+			if err := tx.Create(&consumer).Error; err != nil {
+				return err
+			}
+			consumers = append(consumers, consumer)
+		}
+
+		if err := tx.Create(&[]models.ConsumerSupplierLink{
+			{SupplierID: supplier.ID, ConsumerID: consumers[0].ID, Status: "approved", RequestedAt: now, ApprovedAt: &now},
+			{SupplierID: supplier.ID, ConsumerID: consumers[1].ID, Status: "pending", RequestedAt: now},
+		}).Error; err != nil {
+			return err
+		}
+
+		items := []models.OrderItem{
+			{ProductID: products[0].ID, Quantity: 20, UnitPrice: products[0].Price, Total: products[0].Price.Mul(20)},
+			{ProductID: products[2].ID, Quantity: 10, UnitPrice: products[2].Price, Total: products[2].Price.Mul(10)},
+		}
+		order := models.Order{
+			SupplierID: supplier.ID,
+			ConsumerID: consumers[0].ID,
+			Status:     "pending",
+			Total:      items[0].Total + items[1].Total,
+			OrderDate:  now,
+			OrderItems: items,
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.OrderStatusHistory{
+			OrderID:   order.ID,
+			ToStatus:  order.Status,
+			ActorID:   &consumers[0].UserID,
+			ActorRole: models.RoleConsumer,
+		}).Error; err != nil {
+			return err
+		}
+
+		chat := models.Chat{SupplierID: supplier.ID, ConsumerID: consumers[0].ID, Status: "active"}
+		if err := tx.Create(&chat).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&[]models.Message{
+			{ChatID: chat.ID, SenderID: consumers[0].UserID, Content: "Hello! Can you deliver on Friday morning?", MessageType: "text"},
+			{ChatID: chat.ID, SenderID: sales.ID, Content: "Yes, Friday before 10:00 works for us.", MessageType: "text"},
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Demo data loaded. Log in as %s, admin@demo.scp.local, sales@demo.scp.local or consumer@demo.scp.local\n", demoOwnerEmail)
+	return nil
+}
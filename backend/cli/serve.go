@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+	"csci361/database"
+	"csci361/middleware"
+	"csci361/routes"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// shutdownTimeout is how long requests in flight get to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+func runServe(a *app, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	migrate := fs.Bool("migrate", true, "apply migrations before starting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *migrate {
+		database.Migrate(a.db)
+	}
+
+	// Initialize Gin router
+	if a.cfg.Environment == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	r := gin.Default()
+
+	// CORS configuration
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = []string{"http://localhost:3000", "https://*.vercel.app"}
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"}
+	corsConfig.AllowCredentials = true
+	r.Use(cors.New(corsConfig))
+
+	// Global middleware
+	r.Use(middleware.RequestLogger())
+	r.Use(middleware.ErrorHandler())
+
+	// Health check endpoint
+	r.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "healthy",
+			"service": "supply-chain-platform",
+			"version": "1.0.0",
+		})
+	})
+
+	// Initialize routes
+	scheduler := routes.Initialize(r, a.db, a.cfg)
+
+	// Background jobs stop when the server is asked to shut down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		if a.cfg.StandingOrderInterval > 0 {
+			scheduler.Run(ctx, a.cfg.StandingOrderInterval)
+		}
+	}()
+
+	// Start server
+	srv := &http.Server{Addr: ":" + a.cfg.Port, Handler: r}
+	served := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", a.cfg.Port)
+		served <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		stop()
+		<-jobs
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+
+	// Let a standing order run in progress finish
+	<-jobs
+	return err
+}
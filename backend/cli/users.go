@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"crypto/rand"
+	"csci361/models"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func runCreateUser(a *app, args []string) error {
+	fs := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	email := fs.String("email", "", "email address (required)")
+	role := fs.String("role", models.RoleConsumer, "consumer, owner, admin or sales")
+	password := fs.String("password", "", "password, at least 8 characters (generated if empty)")
+	supplierID := fs.Uint("supplier-id", 0, "supplier the staff member belongs to (admin, sales)")
+	company := fs.String("company", "", "company name of the new supplier (owner)")
+	firstName := fs.String("first-name", "", "first name")
+	lastName := fs.String("last-name", "", "last name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return errors.New("--email is required")
+	}
+
+	user := models.User{
+		Email:     *email,
+		Role:      *role,
+		FirstName: *firstName,
+		LastName:  *lastName,
+		IsActive:  true,
+	}
+
+	switch *role {
+	case models.RoleConsumer:
+	case models.RoleOwner:
+		if *company == "" {
+			return errors.New("--company is required for owners")
+		}
+	case models.RoleAdmin, models.RoleSales:
+		if *supplierID == 0 {
+			return errors.New("--supplier-id is required for admin and sales")
+		}
+		var supplier models.Supplier
+		if err := a.db.First(&supplier, *supplierID).Error; err != nil {
+			return fmt.Errorf("supplier %d not found", *supplierID)
+		}
+		id := supplier.ID
+		user.SupplierID = &id
+	case models.RolePlatformAdmin:
+		return errors.New("use create-platform-admin to create platform admins")
+	default:
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	plain, generated, err := hashNewPassword(&user, *password)
+	if err != nil {
+		return err
+	}
+
+	// Accounts created by an operator are trusted
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureEmailFree(tx, user.Email); err != nil {
+			return err
+		}
+
+		switch user.Role {
+		case models.RoleOwner:
+			supplier := models.Supplier{CompanyName: *company, IsActive: true}
+			if err := tx.Create(&supplier).Error; err != nil {
+				return err
+			}
+			user.SupplierID = &supplier.ID
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&supplier).Update("owner_id", user.ID).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.Subscription{
+				SupplierID:   supplier.ID,
+				PlanName:     models.DefaultPlanName,
+				Status:       "active",
+				StartDate:    now,
+				Currency:     "KZT",
+				BillingCycle: "monthly",
+			}).Error
+
+		case models.RoleConsumer:
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.Consumer{UserID: user.ID}).Error
+
+		default:
+			return tx.Create(&user).Error
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s %s (id %d)\n", user.Role, user.Email, user.ID)
+	if generated {
+		fmt.Printf("Generated password: %s\n", plain)
+	}
+	return nil
+}
+
+// runCreatePlatformAdmin bootstraps the first platform administrator. Further
+// admins are managed through the /platform/admins endpoints.
+//
+// The password is read from --password or PLATFORM_ADMIN_PASSWORD. If neither
+// is set a random password is generated and printed once.
+func runCreatePlatformAdmin(a *app, args []string) error {
+	fs := flag.NewFlagSet("create-platform-admin", flag.ContinueOnError)
+	email := fs.String("email", "", "admin email address (required)")
+	password := fs.String("password", os.Getenv("PLATFORM_ADMIN_PASSWORD"), "admin password, at least 8 characters")
+	firstName := fs.String("first-name", "Platform", "admin first name")
+	lastName := fs.String("last-name", "Admin", "admin last name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return errors.New("--email is required")
+	}
+
+	var existing int64
+	a.db.Model(&models.User{}).Where("role = ?", models.RolePlatformAdmin).Count(&existing)
+	if existing > 0 {
+		return errors.New("a platform admin already exists; use the /platform/admins endpoints to add more")
+	}
+
+	admin := models.User{
+		Email:     *email,
+		Role:      models.RolePlatformAdmin,
+		FirstName: *firstName,
+		LastName:  *lastName,
+		IsActive:  true,
+	}
+
+	plain, generated, err := hashNewPassword(&admin, *password)
+	if err != nil {
+		return err
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureEmailFree(tx, admin.Email); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&admin).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.AuditLog{
+			Action:     models.AuditPlatformAdminCreated,
+			TargetType: "user",
+			TargetID:   admin.ID,
+			Details:    admin.Email + " (bootstrapped from the command line)",
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created platform admin %s (id %d)\n", admin.Email, admin.ID)
+	if generated {
+		fmt.Printf("Generated password: %s\n", plain)
+	}
+	return nil
+}
+
+// hashNewPassword sets the user's password hash. An empty password is
+// replaced by a random one, which is returned so it can be shown once.
+func hashNewPassword(user *models.User, password string) (string, bool, error) {
+	generated := false
+	if password == "" {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return "", false, err
+		}
+		password = base64.RawURLEncoding.EncodeToString(buf)
+		generated = true
+	}
+	if len(password) < 8 {
+		return "", false, errors.New("password must be at least 8 characters")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", false, err
+	}
+
+	user.Password = string(hash)
+	return password, generated, nil
+}
+
+func ensureEmailFree(db *gorm.DB, email string) error {
+	var count int64
+	if err := db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("user %s already exists", email)
+	}
+	return nil
+}
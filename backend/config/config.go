@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,7 +18,18 @@ type Config struct {
 	AWSSecretKey   string
 	AWSRegion      string
 	S3Bucket       string
+	FrontendURL    string
+	MailDriver     string
+	MailFrom       string
+	MailDir        string
 	AllowedOrigins []string
+	// WSBackplane is how WebSocket events reach the other instances:
+	// "memory" for a single instance or "postgres" for LISTEN/NOTIFY
+	WSBackplane  string
+	BaseCurrency string // currency analytics reports amounts in
+	// StandingOrderInterval is how often due standing orders are placed; 0
+	// turns the scheduler off
+	StandingOrderInterval time.Duration
 }
 
 func Load() *Config {
@@ -34,11 +47,28 @@ func Load() *Config {
 		AWSSecretKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		AWSRegion:    getEnv("AWS_REGION", "us-east-1"),
 		S3Bucket:     getEnv("S3_BUCKET", "scp-platform-uploads"),
-		AllowedOrigins: []string{
-			getEnv("FRONTEND_URL", "http://localhost:3000"),
-		},
+		FrontendURL:  getEnv("FRONTEND_URL", "http://localhost:3000"),
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@scp-platform.local"),
+		MailDir:      getEnv("MAIL_DIR", "tmp/mail"),
+		BaseCurrency: getEnv("BASE_CURRENCY", "KZT"),
+		WSBackplane:  getEnv("WS_BACKPLANE", "memory"),
 	}
 
+	// Origins browsers may open WebSockets from, comma separated
+	for _, origin := range strings.Split(getEnv("ALLOWED_ORIGINS", cfg.FrontendURL), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+		}
+	}
+
+	interval, err := time.ParseDuration(getEnv("STANDING_ORDER_INTERVAL", "1m"))
+	if err != nil {
+		log.Printf("Invalid STANDING_ORDER_INTERVAL, using 1m: %v", err)
+		interval = time.Minute
+	}
+	cfg.StandingOrderInterval = interval
+
 	return cfg
 }
 
@@ -19,31 +19,73 @@ func Initialize(cfg *config.Config) *gorm.DB {
 	return db
 }
 
+// schema lists every model, parents before children. The versioned SQL
+// migrations are the source of truth for PostgreSQL; this list is only used
+// by AutoMigrate.
+var schema = []interface{}{
+	&models.Supplier{},
+	&models.User{},
+	&models.Session{},
+	&models.UserToken{},
+	&models.MFARecoveryCode{},
+	&models.Invitation{},
+	&models.AuditLog{},
+	&models.Consumer{},
+	&models.ConsumerSupplierLink{},
+	&models.Category{},
+	&models.Product{},
+	&models.PriceList{},
+	&models.PriceListItem{},
+	&models.Discount{},
+	&models.Order{},
+	&models.OrderItem{},
+	&models.OrderStatusHistory{},
+	&models.StandingOrder{},
+	&models.StandingOrderItem{},
+	&models.StandingOrderRun{},
+	&models.Shipment{},
+	&models.ShipmentItem{},
+	&models.Chat{},
+	&models.Message{},
+	&models.MessageAttachment{},
+	&models.Incident{},
+	&models.IncidentLog{},
+	&models.ReturnRequest{},
+	&models.ReturnItem{},
+	&models.CreditNote{},
+	&models.Invoice{},
+	&models.InvoiceLine{},
+	&models.InvoiceTax{},
+	&models.InvoiceSequence{},
+	&models.Subscription{},
+	&models.Analytics{},
+	&models.ExchangeRate{},
+	&models.Notification{},
+}
+
+// Migrate applies every pending versioned migration. Replicas starting at the
+// same time wait for each other instead of racing.
 func Migrate(db *gorm.DB) {
 	log.Println("Running database migrations...")
 
-	err := db.AutoMigrate(
-		&models.Supplier{},
-		&models.User{},
-		&models.Consumer{},
-		&models.ConsumerSupplierLink{},
-		&models.Category{},
-		&models.Product{},
-		&models.Order{},
-		&models.OrderItem{},
-		&models.Chat{},
-		&models.Message{},
-		&models.MessageAttachment{},
-		&models.Incident{},
-		&models.IncidentLog{},
-		&models.Subscription{},
-		&models.Analytics{},
-		&models.Notification{},
-	)
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
 
+	applied, err := migrator.Up()
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	for _, migration := range applied {
+		log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+	}
 	log.Println("Database migrations completed successfully")
 }
+
+// AutoMigrate creates the schema straight from the models. It is meant for
+// tests running on SQLite, where the PostgreSQL migrations do not apply.
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(schema...)
+}
@@ -0,0 +1,23 @@
+ALTER TABLE suppliers DROP CONSTRAINT fk_suppliers_owner;
+
+DROP TABLE notifications;
+DROP TABLE analytics;
+DROP TABLE subscriptions;
+DROP TABLE incident_logs;
+DROP TABLE incidents;
+DROP TABLE message_attachments;
+DROP TABLE messages;
+DROP TABLE chats;
+DROP TABLE order_items;
+DROP TABLE orders;
+DROP TABLE products;
+DROP TABLE categories;
+DROP TABLE consumer_supplier_links;
+DROP TABLE consumers;
+DROP TABLE audit_logs;
+DROP TABLE invitations;
+DROP TABLE mfa_recovery_codes;
+DROP TABLE user_tokens;
+DROP TABLE sessions;
+DROP TABLE users;
+DROP TABLE suppliers;
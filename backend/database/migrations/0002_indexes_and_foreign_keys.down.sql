@@ -0,0 +1,34 @@
+ALTER TABLE audit_logs DROP CONSTRAINT fk_audit_logs_actor,
+    ADD CONSTRAINT fk_audit_logs_actor FOREIGN KEY (actor_id) REFERENCES users(id);
+ALTER TABLE mfa_recovery_codes DROP CONSTRAINT fk_mfa_recovery_codes_user,
+    ADD CONSTRAINT fk_mfa_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE user_tokens DROP CONSTRAINT fk_user_tokens_user,
+    ADD CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE sessions DROP CONSTRAINT fk_sessions_user,
+    ADD CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE incident_logs DROP CONSTRAINT fk_incidents_logs,
+    ADD CONSTRAINT fk_incidents_logs FOREIGN KEY (incident_id) REFERENCES incidents(id);
+ALTER TABLE message_attachments DROP CONSTRAINT fk_messages_attachments,
+    ADD CONSTRAINT fk_messages_attachments FOREIGN KEY (message_id) REFERENCES messages(id);
+ALTER TABLE order_items DROP CONSTRAINT fk_orders_order_items,
+    ADD CONSTRAINT fk_orders_order_items FOREIGN KEY (order_id) REFERENCES orders(id);
+
+DROP INDEX idx_notifications_user_unread;
+DROP INDEX idx_analytics_supplier_date;
+DROP INDEX idx_incident_logs_incident_id;
+DROP INDEX idx_incidents_consumer_id;
+DROP INDEX idx_incidents_supplier_status;
+DROP INDEX idx_message_attachments_message_id;
+DROP INDEX idx_messages_chat_created;
+DROP INDEX idx_chats_consumer_id;
+DROP INDEX idx_chats_supplier_id;
+DROP INDEX idx_order_items_product_id;
+DROP INDEX idx_order_items_order_id;
+DROP INDEX idx_orders_consumer_id;
+DROP INDEX idx_orders_supplier_status;
+DROP INDEX idx_products_category_id;
+DROP INDEX idx_products_supplier_id;
+DROP INDEX idx_users_supplier_id;
+DROP INDEX idx_consumers_user_id;
+DROP INDEX idx_consumer_supplier_links_supplier_status;
+DROP INDEX idx_consumer_supplier_links_pair;
@@ -0,0 +1,54 @@
+-- A consumer can have only one link per supplier. Keep the most relevant row
+-- of any duplicates: approved first, then the most recently updated.
+DELETE FROM consumer_supplier_links
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (
+            PARTITION BY consumer_id, supplier_id
+            ORDER BY (status = 'approved') DESC, updated_at DESC, id DESC
+        ) AS rank
+        FROM consumer_supplier_links
+    ) ranked
+    WHERE rank > 1
+);
+CREATE UNIQUE INDEX idx_consumer_supplier_links_pair ON consumer_supplier_links (consumer_id, supplier_id);
+CREATE INDEX idx_consumer_supplier_links_supplier_status ON consumer_supplier_links (supplier_id, status);
+
+-- One consumer profile per user
+CREATE UNIQUE INDEX idx_consumers_user_id ON consumers (user_id);
+
+-- Foreign key columns used for tenant scoping and lookups
+CREATE INDEX idx_users_supplier_id ON users (supplier_id);
+CREATE INDEX idx_products_supplier_id ON products (supplier_id);
+CREATE INDEX idx_products_category_id ON products (category_id);
+CREATE INDEX idx_orders_supplier_status ON orders (supplier_id, status);
+CREATE INDEX idx_orders_consumer_id ON orders (consumer_id);
+CREATE INDEX idx_order_items_order_id ON order_items (order_id);
+CREATE INDEX idx_order_items_product_id ON order_items (product_id);
+CREATE INDEX idx_chats_supplier_id ON chats (supplier_id);
+CREATE INDEX idx_chats_consumer_id ON chats (consumer_id);
+CREATE INDEX idx_messages_chat_created ON messages (chat_id, created_at);
+CREATE INDEX idx_message_attachments_message_id ON message_attachments (message_id);
+CREATE INDEX idx_incidents_supplier_status ON incidents (supplier_id, status);
+CREATE INDEX idx_incidents_consumer_id ON incidents (consumer_id);
+CREATE INDEX idx_incident_logs_incident_id ON incident_logs (incident_id);
+CREATE INDEX idx_analytics_supplier_date ON analytics (supplier_id, "date");
+CREATE INDEX idx_notifications_user_unread ON notifications (user_id, is_read);
+
+-- Rows that only make sense together with their parent are deleted with it
+ALTER TABLE order_items DROP CONSTRAINT fk_orders_order_items,
+    ADD CONSTRAINT fk_orders_order_items FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE;
+ALTER TABLE message_attachments DROP CONSTRAINT fk_messages_attachments,
+    ADD CONSTRAINT fk_messages_attachments FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE incident_logs DROP CONSTRAINT fk_incidents_logs,
+    ADD CONSTRAINT fk_incidents_logs FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE;
+ALTER TABLE sessions DROP CONSTRAINT fk_sessions_user,
+    ADD CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE user_tokens DROP CONSTRAINT fk_user_tokens_user,
+    ADD CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE mfa_recovery_codes DROP CONSTRAINT fk_mfa_recovery_codes_user,
+    ADD CONSTRAINT fk_mfa_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- Audit entries outlive the admin who made them
+ALTER TABLE audit_logs DROP CONSTRAINT fk_audit_logs_actor,
+    ADD CONSTRAINT fk_audit_logs_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL;
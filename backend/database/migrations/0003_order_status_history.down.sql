@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_analytics_supplier_date_metric;
+DROP TABLE IF EXISTS order_status_histories;
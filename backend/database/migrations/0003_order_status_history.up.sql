@@ -0,0 +1,21 @@
+CREATE TABLE order_status_histories (
+    id bigserial,
+    order_id bigint NOT NULL,
+    from_status text,
+    to_status text NOT NULL,
+    actor_id bigint,
+    actor_role text,
+    reason text,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_orders_status_history FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_order_status_histories_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_order_status_histories_order_id ON order_status_histories (order_id);
+
+-- Orders placed before the history existed start with their current status.
+INSERT INTO order_status_histories (order_id, to_status, created_at)
+SELECT id, status, created_at FROM orders WHERE deleted_at IS NULL;
+
+-- Daily metrics written by the analytics event subscriber
+CREATE UNIQUE INDEX idx_analytics_supplier_date_metric ON analytics (supplier_id, "date", metric_type);
@@ -0,0 +1 @@
+ALTER TABLE order_status_histories ADD COLUMN details text;
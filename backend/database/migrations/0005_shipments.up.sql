@@ -0,0 +1,40 @@
+CREATE TABLE shipments (
+    id bigserial,
+    uuid text NOT NULL,
+    order_id bigint NOT NULL,
+    supplier_id bigint NOT NULL,
+    status text NOT NULL,
+    carrier text,
+    tracking_number text,
+    notes text,
+    created_by_id bigint,
+    dispatched_at timestamptz,
+    delivered_at timestamptz,
+    received_by text,
+    confirmed_at timestamptz,
+    receipt_notes text,
+    incident_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_orders_shipments FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_shipments_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_shipments_created_by FOREIGN KEY (created_by_id) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_shipments_incident FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX idx_shipments_uuid ON shipments (uuid);
+CREATE INDEX idx_shipments_order_id ON shipments (order_id);
+
+CREATE TABLE shipment_items (
+    id bigserial,
+    shipment_id bigint NOT NULL,
+    order_item_id bigint NOT NULL,
+    quantity bigint NOT NULL CHECK (quantity > 0),
+    received_quantity bigint,
+    damaged_quantity bigint DEFAULT 0,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_shipments_items FOREIGN KEY (shipment_id) REFERENCES shipments(id) ON DELETE CASCADE,
+    CONSTRAINT fk_shipment_items_order_item FOREIGN KEY (order_item_id) REFERENCES order_items(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_shipment_items_shipment_id ON shipment_items (shipment_id);
+CREATE INDEX idx_shipment_items_order_item_id ON shipment_items (order_item_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS credit_notes;
+DROP TABLE IF EXISTS return_items;
+DROP TABLE IF EXISTS return_requests;
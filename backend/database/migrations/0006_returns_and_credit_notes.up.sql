@@ -0,0 +1,66 @@
+CREATE TABLE return_requests (
+    id bigserial,
+    uuid text NOT NULL,
+    order_id bigint NOT NULL,
+    supplier_id bigint NOT NULL,
+    consumer_id bigint NOT NULL,
+    incident_id bigint,
+    status text NOT NULL,
+    reason text,
+    decision_note text,
+    requested_by_id bigint NOT NULL,
+    decided_by_id bigint,
+    decided_at timestamptz,
+    received_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_return_requests_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_return_requests_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_return_requests_consumer FOREIGN KEY (consumer_id) REFERENCES consumers(id),
+    CONSTRAINT fk_return_requests_incident FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE SET NULL,
+    CONSTRAINT fk_return_requests_requested_by FOREIGN KEY (requested_by_id) REFERENCES users(id),
+    CONSTRAINT fk_return_requests_decided_by FOREIGN KEY (decided_by_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX idx_return_requests_uuid ON return_requests (uuid);
+CREATE INDEX idx_return_requests_order_id ON return_requests (order_id);
+CREATE INDEX idx_return_requests_supplier_id ON return_requests (supplier_id);
+CREATE INDEX idx_return_requests_consumer_id ON return_requests (consumer_id);
+
+CREATE TABLE return_items (
+    id bigserial,
+    return_request_id bigint NOT NULL,
+    order_item_id bigint NOT NULL,
+    quantity bigint NOT NULL CHECK (quantity > 0),
+    unit_price decimal NOT NULL,
+    total decimal NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_return_requests_items FOREIGN KEY (return_request_id) REFERENCES return_requests(id) ON DELETE CASCADE,
+    CONSTRAINT fk_return_items_order_item FOREIGN KEY (order_item_id) REFERENCES order_items(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_return_items_return_request_id ON return_items (return_request_id);
+CREATE INDEX idx_return_items_order_item_id ON return_items (order_item_id);
+
+CREATE TABLE credit_notes (
+    id bigserial,
+    number text NOT NULL,
+    return_request_id bigint NOT NULL,
+    order_id bigint NOT NULL,
+    supplier_id bigint NOT NULL,
+    consumer_id bigint NOT NULL,
+    amount decimal NOT NULL,
+    currency text DEFAULT 'KZT',
+    issued_by_id bigint,
+    issued_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_return_requests_credit_note FOREIGN KEY (return_request_id) REFERENCES return_requests(id) ON DELETE CASCADE,
+    CONSTRAINT fk_credit_notes_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_credit_notes_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_credit_notes_consumer FOREIGN KEY (consumer_id) REFERENCES consumers(id),
+    CONSTRAINT fk_credit_notes_issued_by FOREIGN KEY (issued_by_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX idx_credit_notes_number ON credit_notes (number);
+CREATE UNIQUE INDEX idx_credit_notes_return_request_id ON credit_notes (return_request_id);
+CREATE INDEX idx_credit_notes_supplier_issued_at ON credit_notes (supplier_id, issued_at);
+CREATE INDEX idx_credit_notes_consumer_id ON credit_notes (consumer_id);
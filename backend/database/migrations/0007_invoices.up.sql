@@ -0,0 +1,68 @@
+ALTER TABLE suppliers ADD COLUMN vat_rate decimal DEFAULT 12;
+
+CREATE TABLE invoice_sequences (
+    supplier_id bigint NOT NULL,
+    last_number bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (supplier_id),
+    CONSTRAINT fk_invoice_sequences_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE
+);
+
+CREATE TABLE invoices (
+    id bigserial,
+    uuid text NOT NULL,
+    supplier_id bigint NOT NULL,
+    sequence bigint NOT NULL,
+    number text NOT NULL,
+    order_id bigint NOT NULL,
+    consumer_id bigint NOT NULL,
+    status text NOT NULL,
+    currency text DEFAULT 'KZT',
+    subtotal decimal NOT NULL,
+    tax_total decimal NOT NULL,
+    total decimal NOT NULL,
+    supplier_name text,
+    supplier_license text,
+    supplier_address text,
+    consumer_name text,
+    consumer_email text,
+    consumer_phone text,
+    issued_at timestamptz NOT NULL,
+    voided_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_invoices_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_orders_invoice FOREIGN KEY (order_id) REFERENCES orders(id),
+    CONSTRAINT fk_invoices_consumer FOREIGN KEY (consumer_id) REFERENCES consumers(id)
+);
+CREATE UNIQUE INDEX idx_invoices_uuid ON invoices (uuid);
+CREATE UNIQUE INDEX idx_invoices_supplier_sequence ON invoices (supplier_id, sequence);
+CREATE UNIQUE INDEX idx_invoices_order_id ON invoices (order_id);
+CREATE INDEX idx_invoices_consumer_id ON invoices (consumer_id);
+CREATE INDEX idx_invoices_supplier_issued_at ON invoices (supplier_id, issued_at);
+
+CREATE TABLE invoice_lines (
+    id bigserial,
+    invoice_id bigint NOT NULL,
+    order_item_id bigint,
+    description text,
+    sku text,
+    unit text,
+    quantity bigint NOT NULL,
+    unit_price decimal NOT NULL,
+    total decimal NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_invoices_lines FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_invoice_lines_invoice_id ON invoice_lines (invoice_id);
+
+CREATE TABLE invoice_taxes (
+    id bigserial,
+    invoice_id bigint NOT NULL,
+    name text,
+    rate decimal,
+    base decimal,
+    amount decimal,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_invoices_taxes FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_invoice_taxes_invoice_id ON invoice_taxes (invoice_id);
@@ -0,0 +1,4 @@
+ALTER TABLE consumer_supplier_links DROP COLUMN IF EXISTS price_list_id;
+DROP TABLE IF EXISTS discounts;
+DROP TABLE IF EXISTS price_list_items;
+DROP TABLE IF EXISTS price_lists;
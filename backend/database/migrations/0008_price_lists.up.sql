@@ -0,0 +1,49 @@
+CREATE TABLE price_lists (
+    id bigserial,
+    supplier_id bigint NOT NULL,
+    name text NOT NULL,
+    description text,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_price_lists_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_price_lists_supplier_id ON price_lists (supplier_id);
+
+CREATE TABLE price_list_items (
+    id bigserial,
+    price_list_id bigint NOT NULL,
+    product_id bigint NOT NULL,
+    min_quantity bigint NOT NULL DEFAULT 1 CHECK (min_quantity > 0),
+    price decimal NOT NULL CHECK (price >= 0),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_price_lists_items FOREIGN KEY (price_list_id) REFERENCES price_lists(id) ON DELETE CASCADE,
+    CONSTRAINT fk_price_list_items_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_price_list_items_break ON price_list_items (price_list_id, product_id, min_quantity);
+
+CREATE TABLE discounts (
+    id bigserial,
+    supplier_id bigint NOT NULL,
+    name text NOT NULL,
+    type text NOT NULL CHECK (type IN ('percent', 'fixed')),
+    value decimal NOT NULL,
+    product_id bigint,
+    price_list_id bigint,
+    min_quantity bigint DEFAULT 1,
+    starts_at timestamptz,
+    ends_at timestamptz,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_discounts_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE,
+    CONSTRAINT fk_discounts_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+    CONSTRAINT fk_discounts_price_list FOREIGN KEY (price_list_id) REFERENCES price_lists(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_discounts_supplier_id ON discounts (supplier_id);
+
+ALTER TABLE consumer_supplier_links ADD COLUMN price_list_id bigint;
+ALTER TABLE consumer_supplier_links ADD CONSTRAINT fk_consumer_supplier_links_price_list
+    FOREIGN KEY (price_list_id) REFERENCES price_lists(id) ON DELETE SET NULL;
@@ -0,0 +1,27 @@
+DROP TABLE IF EXISTS exchange_rates;
+
+DELETE FROM analytics WHERE currency NOT IN ('', 'KZT');
+UPDATE analytics SET currency = 'KZT' WHERE currency = '';
+DROP INDEX IF EXISTS idx_analytics_supplier_date_metric;
+CREATE UNIQUE INDEX idx_analytics_supplier_date_metric ON analytics (supplier_id, "date", metric_type);
+ALTER TABLE analytics ALTER COLUMN currency DROP NOT NULL;
+ALTER TABLE analytics ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE price_list_items ALTER COLUMN price TYPE decimal;
+ALTER TABLE invoice_taxes ALTER COLUMN amount TYPE decimal;
+ALTER TABLE invoice_taxes ALTER COLUMN base TYPE decimal;
+ALTER TABLE invoice_lines ALTER COLUMN total TYPE decimal;
+ALTER TABLE invoice_lines ALTER COLUMN unit_price TYPE decimal;
+ALTER TABLE invoices ALTER COLUMN total TYPE decimal;
+ALTER TABLE invoices ALTER COLUMN tax_total TYPE decimal;
+ALTER TABLE invoices ALTER COLUMN subtotal TYPE decimal;
+ALTER TABLE credit_notes ALTER COLUMN amount TYPE decimal;
+ALTER TABLE return_items ALTER COLUMN total TYPE decimal;
+ALTER TABLE return_items ALTER COLUMN unit_price TYPE decimal;
+ALTER TABLE subscriptions ALTER COLUMN price TYPE decimal;
+ALTER TABLE order_items ALTER COLUMN total TYPE decimal;
+ALTER TABLE order_items ALTER COLUMN unit_price TYPE decimal;
+ALTER TABLE orders ALTER COLUMN total TYPE decimal;
+ALTER TABLE products ALTER COLUMN price TYPE decimal;
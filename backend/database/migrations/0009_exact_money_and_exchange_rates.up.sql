@@ -0,0 +1,39 @@
+-- Money is stored exactly, with two decimal places.
+ALTER TABLE products ALTER COLUMN price TYPE numeric(20,2) USING round(price, 2);
+ALTER TABLE orders ALTER COLUMN total TYPE numeric(20,2) USING round(total, 2);
+ALTER TABLE order_items ALTER COLUMN unit_price TYPE numeric(20,2) USING round(unit_price, 2);
+ALTER TABLE order_items ALTER COLUMN total TYPE numeric(20,2) USING round(total, 2);
+ALTER TABLE subscriptions ALTER COLUMN price TYPE numeric(20,2) USING round(price, 2);
+ALTER TABLE return_items ALTER COLUMN unit_price TYPE numeric(20,2) USING round(unit_price, 2);
+ALTER TABLE return_items ALTER COLUMN total TYPE numeric(20,2) USING round(total, 2);
+ALTER TABLE credit_notes ALTER COLUMN amount TYPE numeric(20,2) USING round(amount, 2);
+ALTER TABLE invoices ALTER COLUMN subtotal TYPE numeric(20,2) USING round(subtotal, 2);
+ALTER TABLE invoices ALTER COLUMN tax_total TYPE numeric(20,2) USING round(tax_total, 2);
+ALTER TABLE invoices ALTER COLUMN total TYPE numeric(20,2) USING round(total, 2);
+ALTER TABLE invoice_lines ALTER COLUMN unit_price TYPE numeric(20,2) USING round(unit_price, 2);
+ALTER TABLE invoice_lines ALTER COLUMN total TYPE numeric(20,2) USING round(total, 2);
+ALTER TABLE invoice_taxes ALTER COLUMN base TYPE numeric(20,2) USING round(base, 2);
+ALTER TABLE invoice_taxes ALTER COLUMN amount TYPE numeric(20,2) USING round(amount, 2);
+ALTER TABLE price_list_items ALTER COLUMN price TYPE numeric(20,2) USING round(price, 2);
+
+ALTER TABLE products ADD COLUMN currency text NOT NULL DEFAULT 'KZT';
+
+-- Amount metrics are kept per currency; counters have no currency.
+UPDATE analytics SET currency = '' WHERE metric_type LIKE 'orders\_%' OR metric_type = 'returns_received';
+UPDATE analytics SET currency = 'KZT' WHERE currency IS NULL;
+ALTER TABLE analytics ALTER COLUMN currency SET DEFAULT '';
+ALTER TABLE analytics ALTER COLUMN currency SET NOT NULL;
+DROP INDEX IF EXISTS idx_analytics_supplier_date_metric;
+CREATE UNIQUE INDEX idx_analytics_supplier_date_metric ON analytics (supplier_id, "date", metric_type, currency);
+
+CREATE TABLE exchange_rates (
+    id bigserial,
+    currency text NOT NULL,
+    base_currency text NOT NULL,
+    rate numeric(20,10) NOT NULL CHECK (rate > 0),
+    effective_date date NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX idx_exchange_rates_pair_date ON exchange_rates (currency, base_currency, effective_date);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_orders_supplier_delivery_date;
+ALTER TABLE orders DROP COLUMN IF EXISTS delivery_date;
+
+ALTER TABLE suppliers DROP COLUMN IF EXISTS timezone;
+ALTER TABLE suppliers DROP COLUMN IF EXISTS cutoff_days_before;
+ALTER TABLE suppliers DROP COLUMN IF EXISTS order_cutoff;
+ALTER TABLE suppliers DROP COLUMN IF EXISTS delivery_days;
+ALTER TABLE suppliers DROP COLUMN IF EXISTS min_order_value;
+
+ALTER TABLE products DROP COLUMN IF EXISTS max_order_quantity;
+ALTER TABLE products DROP COLUMN IF EXISTS order_multiple;
+ALTER TABLE products DROP COLUMN IF EXISTS min_order_quantity;
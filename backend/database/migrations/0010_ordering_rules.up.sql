@@ -0,0 +1,12 @@
+ALTER TABLE products ADD COLUMN min_order_quantity bigint DEFAULT 0 CHECK (min_order_quantity >= 0);
+ALTER TABLE products ADD COLUMN order_multiple bigint DEFAULT 0 CHECK (order_multiple >= 0);
+ALTER TABLE products ADD COLUMN max_order_quantity bigint DEFAULT 0 CHECK (max_order_quantity >= 0);
+
+ALTER TABLE suppliers ADD COLUMN min_order_value numeric(20,2) DEFAULT 0;
+ALTER TABLE suppliers ADD COLUMN delivery_days text;
+ALTER TABLE suppliers ADD COLUMN order_cutoff text;
+ALTER TABLE suppliers ADD COLUMN cutoff_days_before bigint DEFAULT 1;
+ALTER TABLE suppliers ADD COLUMN timezone text DEFAULT 'Asia/Almaty';
+
+ALTER TABLE orders ADD COLUMN delivery_date date;
+CREATE INDEX idx_orders_supplier_delivery_date ON orders (supplier_id, delivery_date);
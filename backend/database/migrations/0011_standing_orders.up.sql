@@ -0,0 +1,47 @@
+CREATE TABLE standing_orders (
+    id bigserial,
+    consumer_id bigint NOT NULL,
+    supplier_id bigint NOT NULL,
+    name text NOT NULL,
+    notes text,
+    schedule text NOT NULL,
+    timezone text DEFAULT 'Asia/Almaty',
+    status text NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused')),
+    skip_unavailable boolean DEFAULT true,
+    next_run_at timestamptz,
+    last_run_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_standing_orders_consumer FOREIGN KEY (consumer_id) REFERENCES consumers(id) ON DELETE CASCADE,
+    CONSTRAINT fk_standing_orders_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_standing_orders_consumer_id ON standing_orders (consumer_id);
+CREATE INDEX idx_standing_orders_next_run_at ON standing_orders (next_run_at);
+CREATE INDEX idx_standing_orders_deleted_at ON standing_orders (deleted_at);
+
+CREATE TABLE standing_order_items (
+    id bigserial,
+    standing_order_id bigint NOT NULL,
+    product_id bigint NOT NULL,
+    quantity bigint NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_standing_orders_items FOREIGN KEY (standing_order_id) REFERENCES standing_orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_standing_order_items_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_standing_order_items_standing_order_id ON standing_order_items (standing_order_id);
+
+CREATE TABLE standing_order_runs (
+    id bigserial,
+    standing_order_id bigint NOT NULL,
+    scheduled_for timestamptz NOT NULL,
+    status text NOT NULL CHECK (status IN ('placed', 'partial', 'failed', 'skipped')),
+    order_id bigint,
+    message text,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_standing_order_runs_standing_order FOREIGN KEY (standing_order_id) REFERENCES standing_orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_standing_order_runs_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_standing_order_runs_standing_order_id ON standing_order_runs (standing_order_id);
@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN client_key varchar(64);
+CREATE UNIQUE INDEX idx_messages_sender_client_key ON messages (sender_id, client_key);
@@ -0,0 +1,10 @@
+-- Events of the PostgreSQL WebSocket backplane. NOTIFY payloads are limited to
+-- 8000 bytes, so replicas only notify each other of the ID of an event stored
+-- here; rows are deleted once every replica has had time to read them.
+CREATE TABLE ws_events (
+    id bigserial,
+    payload text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+CREATE INDEX idx_ws_events_created_at ON ws_events (created_at);
@@ -0,0 +1,4 @@
+UPDATE discounts SET value = amount WHERE type = 'fixed';
+
+ALTER TABLE discounts DROP COLUMN IF EXISTS currency;
+ALTER TABLE discounts DROP COLUMN IF EXISTS amount;
@@ -0,0 +1,10 @@
+-- Fixed discounts take an exact amount in one currency; value is only the
+-- percentage of percent discounts.
+ALTER TABLE discounts ADD COLUMN amount numeric(20,2) NOT NULL DEFAULT 0;
+ALTER TABLE discounts ADD COLUMN currency text NOT NULL DEFAULT '';
+
+UPDATE discounts
+SET amount = round(value, 2),
+    value = 0,
+    currency = COALESCE((SELECT currency FROM products WHERE products.id = discounts.product_id), 'KZT')
+WHERE type = 'fixed';
@@ -0,0 +1,3 @@
+ALTER TABLE analytics ALTER COLUMN value DROP NOT NULL;
+ALTER TABLE analytics ALTER COLUMN value DROP DEFAULT;
+ALTER TABLE analytics ALTER COLUMN value TYPE decimal;
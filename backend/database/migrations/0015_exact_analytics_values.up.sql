@@ -0,0 +1,5 @@
+-- Daily metrics add exact amounts; counters are whole numbers.
+UPDATE analytics SET value = 0 WHERE value IS NULL;
+ALTER TABLE analytics ALTER COLUMN value TYPE numeric(20,2) USING round(value, 2);
+ALTER TABLE analytics ALTER COLUMN value SET DEFAULT 0;
+ALTER TABLE analytics ALTER COLUMN value SET NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE suppliers DROP COLUMN IF EXISTS min_order_currency;
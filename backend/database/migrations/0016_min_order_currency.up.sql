@@ -0,0 +1,3 @@
+-- The minimum order value is kept in its own currency; orders in another
+-- currency are converted at the exchange rates before comparing.
+ALTER TABLE suppliers ADD COLUMN min_order_currency text DEFAULT 'KZT';
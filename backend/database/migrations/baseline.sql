@@ -0,0 +1,104 @@
+-- Brings a database created by the AutoMigrate-based startup, from before
+-- versioned migrations, up to 0001_initial_schema before that migration is
+-- recorded as applied. Such a database may have been created by any earlier
+-- build, so every table, column and constraint is only added if missing.
+
+ALTER TABLE suppliers
+    ADD COLUMN IF NOT EXISTS owner_id bigint,
+    ADD COLUMN IF NOT EXISTS require_mfa boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS verification_requested_at timestamptz;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified_at timestamptz,
+    ADD COLUMN IF NOT EXISTS mfa_secret text,
+    ADD COLUMN IF NOT EXISTS mfa_enabled_at timestamptz,
+    ADD COLUMN IF NOT EXISTS mfa_last_step bigint;
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id bigserial,
+    uuid text NOT NULL,
+    user_id bigint NOT NULL,
+    token_id text NOT NULL,
+    user_agent text,
+    ip_address text,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_uuid ON sessions (uuid);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id bigserial,
+    user_id bigint NOT NULL,
+    purpose text NOT NULL,
+    token_hash text NOT NULL,
+    attempts bigint DEFAULT 0,
+    expires_at timestamptz,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_tokens_token_hash ON user_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens (user_id);
+-- Builds before two-factor authentication created the table without it
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS attempts bigint DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id bigserial,
+    user_id bigint NOT NULL,
+    code_hash text NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_mfa_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial,
+    supplier_id bigint NOT NULL,
+    invited_by_id bigint NOT NULL,
+    email text NOT NULL,
+    role text NOT NULL,
+    token_hash text NOT NULL,
+    status text DEFAULT 'pending',
+    expires_at timestamptz,
+    accepted_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_invitations_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_invitations_invited_by FOREIGN KEY (invited_by_id) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_token_hash ON invitations (token_hash);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
+CREATE INDEX IF NOT EXISTS idx_invitations_supplier_id ON invitations (supplier_id);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id bigserial,
+    actor_id bigint,
+    action text NOT NULL,
+    target_type text,
+    target_id bigint,
+    details text,
+    ip_address text,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_audit_logs_actor FOREIGN KEY (actor_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs (actor_id);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_suppliers_owner') THEN
+        ALTER TABLE suppliers ADD CONSTRAINT fk_suppliers_owner FOREIGN KEY (owner_id) REFERENCES users(id);
+    END IF;
+END
+$$;
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the PostgreSQL advisory lock held while migrating, so
+// replicas that start at the same time apply migrations one after another.
+const migrationLockKey = 361_0001
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of the up script
+}
+
+// SchemaMigration is a row of the schema_migrations table.
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	Checksum  string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// MigrationStatus describes whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// baselineFile is the optional script that brings a database created before
+// versioned migrations up to the first migration; see baseline.
+const baselineFile = "baseline.sql"
+
+// Migrator applies and rolls back versioned migrations.
+type Migrator struct {
+	db          *gorm.DB
+	migrations  []Migration
+	baselineSQL string
+}
+
+// NewMigrator returns a migrator for the migrations embedded in the binary.
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return NewMigratorFS(db, sub)
+}
+
+// NewMigratorFS returns a migrator for the NNNN_name.up.sql and
+// NNNN_name.down.sql files at the root of fsys, and its baseline.sql if
+// there is one.
+func NewMigratorFS(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	baselineSQL, err := fs.ReadFile(fsys, baselineFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, baselineSQL: string(baselineSQL)}, nil
+}
+
+// Up applies every pending migration in order and returns the ones applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(func(conn *gorm.DB) error {
+		done, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		if err := m.baseline(conn, done); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if row, ok := done[migration.Version]; ok {
+				if row.Checksum != migration.Checksum {
+					return fmt.Errorf("migration %04d_%s was modified after it was applied", migration.Version, migration.Name)
+				}
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					Checksum:  migration.Checksum,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations and
+// returns the ones rolled back.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var rolledBack []Migration
+
+	err := m.locked(func(conn *gorm.DB) error {
+		done, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rollback %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	done := map[int64]SchemaMigration{}
+	if m.db.Migrator().HasTable(&SchemaMigration{}) {
+		var err error
+		if done, err = m.applied(m.db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if row, ok := done[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// locked runs fn on a single connection that holds the migration lock.
+func (m *Migrator) locked(fn func(conn *gorm.DB) error) error {
+	return m.db.Connection(func(conn *gorm.DB) error {
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+				return err
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+		}
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func (m *Migrator) applied(conn *gorm.DB) (map[int64]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := conn.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// baseline records the initial migration as applied on databases that were
+// created by the AutoMigrate-based startup used before versioned migrations.
+// Those builds created less than the initial migration does, so the baseline
+// script first adds whatever is missing.
+func (m *Migrator) baseline(conn *gorm.DB, done map[int64]SchemaMigration) error {
+	if len(done) > 0 || len(m.migrations) == 0 || m.migrations[0].Version != 1 || !conn.Migrator().HasTable("users") {
+		return nil
+	}
+
+	initial := m.migrations[0]
+	row := SchemaMigration{
+		Version:   initial.Version,
+		Name:      initial.Name,
+		Checksum:  initial.Checksum,
+		AppliedAt: time.Now(),
+	}
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if m.baselineSQL != "" {
+			if err := tx.Exec(m.baselineSQL).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&row).Error
+	})
+	if err != nil {
+		return fmt.Errorf("baseline %04d_%s: %w", initial.Version, initial.Name, err)
+	}
+
+	log.Printf("Existing schema found, recorded migration %04d_%s as applied", initial.Version, initial.Name)
+	done[row.Version] = row
+	return nil
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %04d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
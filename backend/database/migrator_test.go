@@ -0,0 +1,270 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	return db
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT NOT NULL);")},
+		"0001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"0002_add_color.up.sql":        {Data: []byte("ALTER TABLE widgets ADD COLUMN color TEXT;")},
+		"0002_add_color.down.sql":      {Data: []byte("ALTER TABLE widgets DROP COLUMN color;")},
+		"README.md":                    {Data: []byte("ignored")},
+	}
+}
+
+func TestMigratorUpDownStatus(t *testing.T) {
+	db := openSQLite(t)
+
+	migrator, err := NewMigratorFS(db, testMigrations())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil || len(applied) != 2 || applied[0].Version != 1 || applied[1].Version != 2 {
+		t.Fatalf("up: got %+v (%v)", applied, err)
+	}
+	if !db.Migrator().HasColumn("widgets", "color") {
+		t.Fatal("expected widgets.color after up")
+	}
+
+	if applied, err := migrator.Up(); err != nil || len(applied) != 0 {
+		t.Fatalf("second up should be a no-op, got %+v (%v)", applied, err)
+	}
+
+	rolledBack, err := migrator.Down(1)
+	if err != nil || len(rolledBack) != 1 || rolledBack[0].Version != 2 {
+		t.Fatalf("down: got %+v (%v)", rolledBack, err)
+	}
+	if db.Migrator().HasColumn("widgets", "color") {
+		t.Fatal("expected widgets.color to be dropped")
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Fatalf("unexpected status: %+v", statuses)
+	}
+
+	if _, err := migrator.Down(5); err != nil || db.Migrator().HasTable("widgets") {
+		t.Fatalf("expected every migration to be rolled back (%v)", err)
+	}
+}
+
+func TestMigratorRejectsEditedMigration(t *testing.T) {
+	db := openSQLite(t)
+
+	migrator, _ := NewMigratorFS(db, testMigrations())
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	edited := testMigrations()
+	edited["0002_add_color.up.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE widgets ADD COLUMN colour TEXT;")}
+	migrator, _ = NewMigratorFS(db, edited)
+
+	if _, err := migrator.Up(); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+}
+
+func TestMigratorFailedMigrationIsNotRecorded(t *testing.T) {
+	db := openSQLite(t)
+
+	broken := testMigrations()
+	broken["0003_broken.up.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE missing ADD COLUMN x TEXT;")}
+	broken["0003_broken.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	migrator, _ := NewMigratorFS(db, broken)
+
+	applied, err := migrator.Up()
+	if err == nil || len(applied) != 2 {
+		t.Fatalf("expected 0003 to fail after two migrations, got %+v (%v)", applied, err)
+	}
+
+	var count int64
+	db.Model(&SchemaMigration{}).Where("version = ?", 3).Count(&count)
+	if count != 0 {
+		t.Fatal("failed migration was recorded as applied")
+	}
+}
+
+func TestMigratorBaselinesSchemaCreatedBeforeMigrations(t *testing.T) {
+	db := openSQLite(t)
+
+	// An older build created users and a widgets table without a name
+	db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)")
+	db.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY)")
+
+	broken := testMigrations()
+	broken["baseline.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE missing ADD COLUMN name TEXT;")}
+	migrator, _ := NewMigratorFS(db, broken)
+	if _, err := migrator.Up(); err == nil {
+		t.Fatal("expected a failing baseline script to stop the migration")
+	}
+	var count int64
+	db.Model(&SchemaMigration{}).Count(&count)
+	if count != 0 {
+		t.Fatal("migration was recorded although the baseline script failed")
+	}
+
+	fsys := testMigrations()
+	fsys["baseline.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE widgets ADD COLUMN name TEXT;")}
+	migrator, _ = NewMigratorFS(db, fsys)
+
+	applied, err := migrator.Up()
+	if err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("expected only 0002 to run after the baseline, got %+v (%v)", applied, err)
+	}
+	if !db.Migrator().HasColumn("widgets", "name") || !db.Migrator().HasColumn("widgets", "color") {
+		t.Fatal("expected the baseline script and 0002 to complete widgets")
+	}
+	db.Model(&SchemaMigration{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected both migrations to be recorded, got %d", count)
+	}
+}
+
+func TestLoadMigrationsNeedsBothDirections(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_only_up.up.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := loadMigrations(fsys); err == nil {
+		t.Fatal("expected an error for a missing down script")
+	}
+
+	if migrator, err := NewMigrator(nil); err != nil || len(migrator.migrations) == 0 || migrator.migrations[0].Version != 1 {
+		t.Fatalf("embedded migrations did not load: %v", err)
+	}
+}
+
+// TestEmbeddedMigrationsPostgres runs the real migrations up, down and up
+// again against PostgreSQL and checks the result matches the models. Set
+// TEST_DATABASE_URL to a disposable database to run it.
+func TestEmbeddedMigrationsPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if _, err := migrator.Down(len(migrator.migrations)); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if db.Migrator().HasTable("users") {
+		t.Fatal("expected down to drop every table")
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up again: %v", err)
+	}
+
+	expectSchemaMatchesModels(t, db)
+}
+
+// TestEmbeddedMigrationsUpgradeAutoMigrateSchema starts from the schema the
+// oldest AutoMigrate-based build created and migrates it to the latest
+// version, keeping its data. Set TEST_DATABASE_URL to a disposable database
+// to run it.
+func TestEmbeddedMigrationsUpgradeAutoMigrateSchema(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	original, err := os.ReadFile(filepath.Join("testdata", "automigrate_schema.sql"))
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	if err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public").Error; err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if err := db.Exec(string(original)).Error; err != nil {
+		t.Fatalf("create original schema: %v", err)
+	}
+	if err := db.Exec(`INSERT INTO suppliers (uuid, company_name) VALUES ('s-1', 'Old Supplier');
+		INSERT INTO users (uuid, email, password, role, supplier_id) VALUES ('u-1', 'owner@example.com', 'x', 'owner', 1)`).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) != len(migrator.migrations)-1 {
+		t.Fatalf("expected every migration after 0001 to run, got %d", len(applied))
+	}
+
+	expectSchemaMatchesModels(t, db)
+
+	var email string
+	db.Raw("SELECT email FROM users WHERE uuid = 'u-1'").Scan(&email)
+	if email != "owner@example.com" {
+		t.Fatal("existing users were lost in the upgrade")
+	}
+}
+
+// expectSchemaMatchesModels fails for every table or column of the models
+// the database lacks.
+func expectSchemaMatchesModels(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	for _, model := range schema {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		if !db.Migrator().HasTable(stmt.Schema.Table) {
+			t.Errorf("table %s is missing", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(stmt.Schema.Table, field.DBName) {
+				t.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+-- The schema AutoMigrate created before any of the backlog changes, used to
+-- test upgrading a database created by the oldest builds.
+
+CREATE TABLE suppliers (
+    id bigserial,
+    uuid text NOT NULL,
+    company_name text NOT NULL,
+    business_license text,
+    address text,
+    city text,
+    country text,
+    postal_code text,
+    description text,
+    website text,
+    is_verified boolean DEFAULT false,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX idx_suppliers_deleted_at ON suppliers (deleted_at);
+CREATE UNIQUE INDEX idx_suppliers_uuid ON suppliers (uuid);
+
+CREATE TABLE users (
+    id bigserial,
+    uuid text NOT NULL,
+    email text NOT NULL,
+    password text NOT NULL,
+    role text NOT NULL,
+    supplier_id bigint,
+    first_name text,
+    last_name text,
+    phone text,
+    avatar text,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_suppliers_users FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+);
+CREATE UNIQUE INDEX idx_users_uuid ON users (uuid);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+CREATE TABLE consumers (
+    id bigserial,
+    uuid text NOT NULL,
+    user_id bigint NOT NULL,
+    preferences text,
+    gender text,
+    date_of_birth timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_consumers_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_consumers_deleted_at ON consumers (deleted_at);
+CREATE UNIQUE INDEX idx_consumers_uuid ON consumers (uuid);
+
+CREATE TABLE consumer_supplier_links (
+    id bigserial,
+    supplier_id bigint NOT NULL,
+    consumer_id bigint NOT NULL,
+    status text DEFAULT 'pending',
+    requested_at timestamptz,
+    approved_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_consumer_supplier_links_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_consumer_supplier_links_consumer FOREIGN KEY (consumer_id) REFERENCES consumers(id)
+);
+
+CREATE TABLE categories (
+    id bigserial,
+    name text NOT NULL,
+    description text,
+    parent_id bigint,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_categories_children FOREIGN KEY (parent_id) REFERENCES categories(id)
+);
+CREATE UNIQUE INDEX idx_categories_name ON categories (name);
+
+CREATE TABLE products (
+    id bigserial,
+    uuid text NOT NULL,
+    supplier_id bigint NOT NULL,
+    category_id bigint NOT NULL,
+    name text NOT NULL,
+    description text,
+    sku text,
+    price decimal NOT NULL,
+    unit text,
+    stock bigint DEFAULT 0,
+    min_stock bigint DEFAULT 0,
+    images text,
+    is_active boolean DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_suppliers_products FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_categories_products FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+CREATE INDEX idx_products_deleted_at ON products (deleted_at);
+CREATE UNIQUE INDEX idx_products_sku ON products (sku);
+CREATE UNIQUE INDEX idx_products_uuid ON products (uuid);
+
+CREATE TABLE orders (
+    id bigserial,
+    uuid text NOT NULL,
+    supplier_id bigint NOT NULL,
+    consumer_id bigint NOT NULL,
+    status text DEFAULT 'pending',
+    total decimal NOT NULL,
+    currency text DEFAULT 'KZT',
+    notes text,
+    order_date timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_consumers_orders FOREIGN KEY (consumer_id) REFERENCES consumers(id),
+    CONSTRAINT fk_suppliers_orders FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+);
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at);
+CREATE UNIQUE INDEX idx_orders_uuid ON orders (uuid);
+
+CREATE TABLE order_items (
+    id bigserial,
+    order_id bigint NOT NULL,
+    product_id bigint NOT NULL,
+    quantity bigint NOT NULL,
+    unit_price decimal NOT NULL,
+    total decimal NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_orders_order_items FOREIGN KEY (order_id) REFERENCES orders(id),
+    CONSTRAINT fk_products_order_items FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE chats (
+    id bigserial,
+    uuid text NOT NULL,
+    supplier_id bigint NOT NULL,
+    consumer_id bigint NOT NULL,
+    status text DEFAULT 'active',
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_chats_consumer FOREIGN KEY (consumer_id) REFERENCES consumers(id),
+    CONSTRAINT fk_chats_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+);
+CREATE UNIQUE INDEX idx_chats_uuid ON chats (uuid);
+
+CREATE TABLE messages (
+    id bigserial,
+    uuid text NOT NULL,
+    chat_id bigint NOT NULL,
+    sender_id bigint NOT NULL,
+    content text,
+    message_type text DEFAULT 'text',
+    is_read boolean DEFAULT false,
+    read_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_messages_sender FOREIGN KEY (sender_id) REFERENCES users(id),
+    CONSTRAINT fk_chats_messages FOREIGN KEY (chat_id) REFERENCES chats(id)
+);
+CREATE UNIQUE INDEX idx_messages_uuid ON messages (uuid);
+
+CREATE TABLE message_attachments (
+    id bigserial,
+    message_id bigint NOT NULL,
+    file_name text NOT NULL,
+    file_url text NOT NULL,
+    file_type text,
+    file_size bigint,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_messages_attachments FOREIGN KEY (message_id) REFERENCES messages(id)
+);
+
+CREATE TABLE incidents (
+    id bigserial,
+    uuid text NOT NULL,
+    consumer_id bigint NOT NULL,
+    supplier_id bigint NOT NULL,
+    order_id bigint,
+    chat_id bigint NOT NULL,
+    title text NOT NULL,
+    description text,
+    priority text DEFAULT 'medium',
+    status text DEFAULT 'open',
+    assigned_to bigint,
+    resolved_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_incidents_consumer FOREIGN KEY (consumer_id) REFERENCES consumers(id),
+    CONSTRAINT fk_incidents_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+    CONSTRAINT fk_incidents_order FOREIGN KEY (order_id) REFERENCES orders(id),
+    CONSTRAINT fk_incidents_chat FOREIGN KEY (chat_id) REFERENCES chats(id),
+    CONSTRAINT fk_incidents_assigned_user FOREIGN KEY (assigned_to) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX idx_incidents_uuid ON incidents (uuid);
+
+CREATE TABLE incident_logs (
+    id bigserial,
+    incident_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    action text NOT NULL,
+    old_value text,
+    new_value text,
+    notes text,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_incident_logs_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_incidents_logs FOREIGN KEY (incident_id) REFERENCES incidents(id)
+);
+
+CREATE TABLE subscriptions (
+    id bigserial,
+    supplier_id bigint NOT NULL,
+    plan_name text NOT NULL,
+    status text DEFAULT 'active',
+    start_date timestamptz,
+    end_date timestamptz,
+    price decimal,
+    currency text DEFAULT 'KZT',
+    billing_cycle text DEFAULT 'monthly',
+    features text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_suppliers_subscription FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+);
+CREATE UNIQUE INDEX idx_subscriptions_supplier_id ON subscriptions (supplier_id);
+
+CREATE TABLE analytics (
+    id bigserial,
+    supplier_id bigint NOT NULL,
+    "date" timestamptz,
+    metric_type text NOT NULL,
+    value decimal,
+    currency text,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_analytics_supplier FOREIGN KEY (supplier_id) REFERENCES suppliers(id)
+);
+CREATE INDEX idx_analytics_date ON analytics ("date");
+
+CREATE TABLE notifications (
+    id bigserial,
+    user_id bigint NOT NULL,
+    title text NOT NULL,
+    content text,
+    type text NOT NULL,
+    is_read boolean DEFAULT false,
+    read_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_notifications_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
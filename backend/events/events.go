@@ -0,0 +1,79 @@
+package events
+
+import (
+	"csci361/money"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	OrderCreated       = "order.created"
+	OrderUpdated       = "order.updated"
+	OrderStatusChanged = "order.status_changed"
+	ReturnRequested    = "return.requested"
+	ReturnDecided      = "return.decided"
+	ReturnReceived     = "return.received"
+)
+
+// Event is something that happened in the domain that other parts of the
+// system (notifications, analytics, live updates) may react to.
+type Event struct {
+	Type       string
+	SupplierID uint
+	ConsumerID uint
+	OrderID    uint
+	ReturnID   uint
+	ActorID    *uint
+	ActorRole  string
+	FromStatus string
+	ToStatus   string
+	Reason     string
+	Amount     money.Amount
+	Currency   string
+	OccurredAt time.Time
+}
+
+// Handler reacts to a published event.
+type Handler func(Event) error
+
+// Bus delivers events to the handlers subscribed to their type. Handlers run
+// synchronously in the publisher's goroutine; a failing handler is logged and
+// does not stop the others.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewBus creates an empty event bus.
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe registers h for events of the given type.
+func (b *Bus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+// Publish delivers each event to its subscribers. Publish only after the
+// change the events describe has been committed.
+func (b *Bus) Publish(evts ...Event) {
+	for _, evt := range evts {
+		if evt.OccurredAt.IsZero() {
+			evt.OccurredAt = time.Now()
+		}
+
+		b.mu.RLock()
+		handlers := b.handlers[evt.Type]
+		b.mu.RUnlock()
+
+		for _, h := range handlers {
+			if err := h(evt); err != nil {
+				log.Printf("Event %s handler failed: %v", evt.Type, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"gorm.io/gorm"
+)
+
+// Object-level access scopes. Handlers that load a row by an ID taken from the
+// request apply one of these so that rows of another tenant look exactly like
+// missing rows (404) instead of being readable or writable.
+
+// ownedBySupplier restricts a query to rows that belong to the given supplier.
+func ownedBySupplier(supplierID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("supplier_id = ?", supplierID)
+	}
+}
+
+// ownedByConsumer restricts a query to rows that belong to the given consumer.
+func ownedByConsumer(consumerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("consumer_id = ?", consumerID)
+	}
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"csci361/mailer"
+	"csci361/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+
+	// maxUserTokensPerHour limits how many emails of one purpose a user can trigger.
+	maxUserTokensPerHour = 3
+)
+
+var (
+	errTooManyTokenRequests = errors.New("too many token requests")
+	errInvalidUserToken     = errors.New("invalid or expired token")
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPassword emails a password reset link
+// @Summary Forgot password
+// @Description Email a password reset link. The response does not reveal whether the email is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Account email"
+// @Success 200 {object} map[string]string
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ? AND is_active = ?", req.Email, true).
+		First(&user).Error; err == nil {
+		token, err := h.issueUserToken(user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+		switch {
+		case err == errTooManyTokenRequests:
+			log.Printf("Password reset rate limit reached for user %d", user.ID)
+		case err != nil:
+			log.Printf("Failed to issue password reset token for user %d: %v", user.ID, err)
+		default:
+			if err := h.mailer.Send(mailer.Message{
+				To:      user.Email,
+				Subject: "Reset your password",
+				Body: fmt.Sprintf("Someone requested a password reset for your account.\n\nReset your password: %s/auth/reset-password?token=%s\n\nThis link expires in 1 hour. If you did not request it, you can ignore this email.",
+					h.cfg.FrontendURL, token),
+			}); err != nil {
+				log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using a reset token
+// @Summary Reset password
+// @Description Set a new password using a token from the reset email. All sessions are signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var userToken models.UserToken
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		userToken, err = consumeUserToken(tx, req.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		// Other reset links sent before this one stop working
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userToken.UserID, models.TokenPurposePasswordReset).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		// The reset link proves ownership of the address as well
+		if err := tx.Model(&models.User{}).Where("id = ?", userToken.UserID).Updates(map[string]interface{}{
+			"password":          string(hashedPassword),
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		}).Error; err != nil {
+			return err
+		}
+
+		return revokeUserSessions(tx, userToken.UserID)
+	})
+
+	if err == errInvalidUserToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	h.live.DisconnectUser(userToken.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// VerifyEmail confirms the user's email address
+// @Summary Verify email
+// @Description Confirm an email address using the token from the verification email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/verify-email [post]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, req.Token, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", userToken.UserID).
+			Update("email_verified_at", time.Now()).Error
+	})
+
+	if err == errInvalidUserToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification emails a new verification link to the current user
+// @Summary Resend verification email
+// @Description Send a new email verification link to the authenticated user
+// @Tags auth
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /auth/verify-email/resend [post]
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	err := h.sendVerificationEmail(user)
+	if err == errTooManyTokenRequests {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// Helper functions
+
+// sendVerificationEmail issues a verification token and emails it to the user.
+func (h *AuthHandler) sendVerificationEmail(user models.User) error {
+	token, err := h.issueUserToken(user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Welcome! Please confirm your email address: %s/auth/verify-email?token=%s\n\nThis link expires in 48 hours.",
+			h.cfg.FrontendURL, token),
+	})
+}
+
+// issueUserToken stores a new hashed token for the user and returns the raw
+// value to be emailed. At most maxUserTokensPerHour tokens of one purpose can
+// be issued per user per hour.
+func (h *AuthHandler) issueUserToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	var recent int64
+	h.db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, time.Now().Add(-time.Hour)).
+		Count(&recent)
+	if recent >= maxUserTokensPerHour {
+		return "", errTooManyTokenRequests
+	}
+
+	return createUserToken(h.db, userID, purpose, ttl)
+}
+
+// createUserToken stores a new hashed token for the user and returns the raw value.
+func createUserToken(db *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	userToken := models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := db.Create(&userToken).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeUserToken marks a valid token as used and returns it. A token can be
+// consumed only once, even by concurrent requests.
+func consumeUserToken(tx *gorm.DB, token, purpose string) (models.UserToken, error) {
+	var userToken models.UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&userToken).Error; err != nil {
+		return userToken, errInvalidUserToken
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", userToken.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return userToken, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return userToken, errInvalidUserToken
+	}
+
+	return userToken, nil
+}
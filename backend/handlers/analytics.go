@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"csci361/models"
+	"csci361/money"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,11 +12,16 @@ import (
 )
 
 type AnalyticsHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	baseCurrency string
 }
 
-func NewAnalyticsHandler(db *gorm.DB) *AnalyticsHandler {
-	return &AnalyticsHandler{db: db}
+// NewAnalyticsHandler reports amounts in baseCurrency, KZT if empty.
+func NewAnalyticsHandler(db *gorm.DB, baseCurrency string) *AnalyticsHandler {
+	if baseCurrency == "" {
+		baseCurrency = money.KZT
+	}
+	return &AnalyticsHandler{db: db, baseCurrency: baseCurrency}
 }
 
 type DashboardResponse struct {
@@ -25,19 +32,28 @@ type DashboardResponse struct {
 }
 
 type ProductStats struct {
-	ProductID   uint    `json:"product_id"`
-	ProductName string  `json:"product_name"`
-	TotalSold   int     `json:"total_sold"`
-	Revenue     float64 `json:"revenue"`
+	ProductID   uint         `json:"product_id"`
+	ProductName string       `json:"product_name"`
+	TotalSold   int          `json:"total_sold"`
+	Revenue     money.Amount `json:"revenue"`
+	Currency    string       `json:"currency"` // Currency of the product
 }
 
+// KPIResponse amounts are in Currency, the base currency. Orders in
+// currencies without an exchange rate are left out and listed in
+// MissingRates.
 type KPIResponse struct {
-	OrderCount        int64   `json:"order_count"`
-	GMV               float64 `json:"gmv"`
-	AverageOrderValue float64 `json:"average_order_value"`
-	ActiveConsumers   int64   `json:"active_consumers"`
-	PendingIncidents  int64   `json:"pending_incidents"`
-	ResolvedIncidents int64   `json:"resolved_incidents"`
+	OrderCount        int64                   `json:"order_count"`
+	Currency          string                  `json:"currency"`
+	GMV               money.Amount            `json:"gmv"`
+	GMVByCurrency     map[string]money.Amount `json:"gmv_by_currency"`
+	Returns           money.Amount            `json:"returns"`
+	NetGMV            money.Amount            `json:"net_gmv"`
+	AverageOrderValue money.Amount            `json:"average_order_value"`
+	MissingRates      []string                `json:"missing_rates,omitempty"`
+	ActiveConsumers   int64                   `json:"active_consumers"`
+	PendingIncidents  int64                   `json:"pending_incidents"`
+	ResolvedIncidents int64                   `json:"resolved_incidents"`
 }
 
 // GetDashboard returns dashboard analytics
@@ -50,35 +66,28 @@ type KPIResponse struct {
 // @Success 200 {object} DashboardResponse
 // @Router /admin/analytics [get]
 func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	period := c.DefaultQuery("period", "month")
 	startDate := h.getStartDate(period)
 
 	// Get summary statistics
 	var orderCount int64
-	var totalGMV float64
 
 	h.db.Model(&models.Order{}).
 		Where("supplier_id = ? AND order_date >= ?", supplierID, startDate).
 		Count(&orderCount)
 
-	h.db.Model(&models.Order{}).
-		Where("supplier_id = ? AND order_date >= ? AND status != ?", supplierID, startDate, "cancelled").
-		Select("COALESCE(SUM(total), 0)").
-		Scan(&totalGMV)
+	gmv := sumByCurrency(h.db.Model(&models.Order{}).
+		Where("supplier_id = ? AND order_date >= ? AND status != ?", supplierID, startDate, "cancelled"), "total")
 
-	avgOrderValue := float64(0)
-	if orderCount > 0 {
-		avgOrderValue = totalGMV / float64(orderCount)
-	}
+	// Credit notes issued for received returns reduce GMV
+	rates := h.newConverter(time.Now())
+	totalGMV := rates.toBase(gmv)
+	returns := rates.toBase(h.creditedAmount(supplierID, startDate, time.Now()))
 
 	// Get active consumers count
 	var activeConsumers int64
@@ -118,8 +127,13 @@ func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
 		TopProducts:  topProducts,
 		KPIs: KPIResponse{
 			OrderCount:        orderCount,
+			Currency:          h.baseCurrency,
 			GMV:               totalGMV,
-			AverageOrderValue: avgOrderValue,
+			GMVByCurrency:     byCurrency(gmv),
+			Returns:           returns,
+			NetGMV:            totalGMV - returns,
+			AverageOrderValue: totalGMV.Div(orderCount),
+			MissingRates:      rates.missing(),
 			ActiveConsumers:   activeConsumers,
 			PendingIncidents:  pendingIncidents,
 			ResolvedIncidents: resolvedIncidents,
@@ -140,40 +154,35 @@ func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Router /admin/analytics/kpis [get]
 func (h *AnalyticsHandler) GetKPIs(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	startDateStr := c.DefaultQuery("start_date", time.Now().AddDate(0, -1, 0).Format("2006-01-02"))
 	endDateStr := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
 
 	startDate, _ := time.Parse("2006-01-02", startDateStr)
 	endDate, _ := time.Parse("2006-01-02", endDateStr)
 
-	// Order metrics
+	// Order metrics, converted at the rates in effect at the end of the period
 	var orderCount int64
-	var totalRevenue, cancelledRevenue float64
 
 	h.db.Model(&models.Order{}).
 		Where("supplier_id = ? AND order_date BETWEEN ? AND ?", supplierID, startDate, endDate).
 		Count(&orderCount)
 
-	h.db.Model(&models.Order{}).
+	rates := h.newConverter(endDate)
+	revenue := sumByCurrency(h.db.Model(&models.Order{}).
 		Where("supplier_id = ? AND order_date BETWEEN ? AND ? AND status != ?",
-			supplierID, startDate, endDate, "cancelled").
-		Select("COALESCE(SUM(total), 0)").
-		Scan(&totalRevenue)
+			supplierID, startDate, endDate, "cancelled"), "total")
+	totalRevenue := rates.toBase(revenue)
 
-	h.db.Model(&models.Order{}).
+	cancelledRevenue := rates.toBase(sumByCurrency(h.db.Model(&models.Order{}).
 		Where("supplier_id = ? AND order_date BETWEEN ? AND ? AND status = ?",
-			supplierID, startDate, endDate, "cancelled").
-		Select("COALESCE(SUM(total), 0)").
-		Scan(&cancelledRevenue)
+			supplierID, startDate, endDate, "cancelled"), "total"))
+
+	returns := rates.toBase(h.creditedAmount(supplierID, startDate, endDate))
 
 	// Reorder rate calculation
 	var repeatCustomers int64
@@ -213,22 +222,22 @@ func (h *AnalyticsHandler) GetKPIs(c *gin.Context) {
 			FROM messages
 			WHERE chat_id = c.id
 			AND sender_id IN (
-				SELECT id FROM users WHERE role IN ('sales', 'admin', 'owner')
+				SELECT id FROM users WHERE supplier_id = ?
 			)
 		)
-	`, supplierID).Scan(&avgResponseTime)
+	`, supplierID, supplierID).Scan(&avgResponseTime)
 
 	c.JSON(http.StatusOK, gin.H{
 		"order_metrics": gin.H{
-			"total_orders":      orderCount,
-			"total_revenue":     totalRevenue,
-			"cancelled_revenue": cancelledRevenue,
-			"average_order_value": func() float64 {
-				if orderCount > 0 {
-					return totalRevenue / float64(orderCount)
-				}
-				return 0
-			}(),
+			"currency":            h.baseCurrency,
+			"total_orders":        orderCount,
+			"total_revenue":       totalRevenue,
+			"revenue_by_currency": byCurrency(revenue),
+			"cancelled_revenue":   cancelledRevenue,
+			"returns":             returns,
+			"net_revenue":         totalRevenue - returns,
+			"average_order_value": totalRevenue.Div(orderCount),
+			"missing_rates":       rates.missing(),
 		},
 		"customer_metrics": gin.H{
 			"total_customers":  totalCustomers,
@@ -256,15 +265,11 @@ func (h *AnalyticsHandler) GetKPIs(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Router /owner/reports/complaints [get]
 func (h *AnalyticsHandler) GetComplaintsReport(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	startDateStr := c.Query("start_date")
 	endDateStr := c.Query("end_date")
 
@@ -327,17 +332,17 @@ func (h *AnalyticsHandler) GetPlatformAnalytics(c *gin.Context) {
 	var totalSuppliers, activeSuppliers, verifiedSuppliers int64
 	var totalConsumers int64
 	var totalOrders int64
-	var totalRevenue float64
 
 	h.db.Model(&models.Supplier{}).Count(&totalSuppliers)
 	h.db.Model(&models.Supplier{}).Where("is_active = ?", true).Count(&activeSuppliers)
 	h.db.Model(&models.Supplier{}).Where("is_verified = ?", true).Count(&verifiedSuppliers)
 	h.db.Model(&models.Consumer{}).Count(&totalConsumers)
 	h.db.Model(&models.Order{}).Count(&totalOrders)
-	h.db.Model(&models.Order{}).
-		Where("status != ?", "cancelled").
-		Select("COALESCE(SUM(total), 0)").
-		Scan(&totalRevenue)
+
+	rates := h.newConverter(time.Now())
+	revenue := sumByCurrency(h.db.Model(&models.Order{}).Where("status != ?", "cancelled"), "total")
+	totalRevenue := rates.toBase(revenue)
+	totalReturns := rates.toBase(sumByCurrency(h.db.Model(&models.CreditNote{}), "amount"))
 
 	c.JSON(http.StatusOK, gin.H{
 		"suppliers": gin.H{
@@ -349,8 +354,13 @@ func (h *AnalyticsHandler) GetPlatformAnalytics(c *gin.Context) {
 			"total": totalConsumers,
 		},
 		"orders": gin.H{
-			"total":   totalOrders,
-			"revenue": totalRevenue,
+			"total":               totalOrders,
+			"currency":            h.baseCurrency,
+			"revenue":             totalRevenue,
+			"revenue_by_currency": byCurrency(revenue),
+			"returns":             totalReturns,
+			"net_revenue":         totalRevenue - totalReturns,
+			"missing_rates":       rates.missing(),
 		},
 		"generated_at": time.Now(),
 	})
@@ -380,18 +390,116 @@ func (h *AnalyticsHandler) getTopProducts(supplierID uint, startDate time.Time)
 		SELECT 
 			p.id as product_id,
 			p.name as product_name,
-			SUM(oi.quantity) as total_sold,
-			SUM(oi.total) as revenue
+			p.currency as currency,
+			SUM(oi.quantity - COALESCE(r.quantity, 0)) as total_sold,
+			SUM(oi.total - COALESCE(r.total, 0)) as revenue
 		FROM products p
 		INNER JOIN order_items oi ON p.id = oi.product_id
 		INNER JOIN orders o ON oi.order_id = o.id
+		LEFT JOIN (
+			SELECT ri.order_item_id, SUM(ri.quantity) as quantity, SUM(ri.total) as total
+			FROM return_items ri
+			INNER JOIN return_requests rr ON ri.return_request_id = rr.id
+			WHERE rr.status = 'received'
+			GROUP BY ri.order_item_id
+		) r ON r.order_item_id = oi.id
 		WHERE p.supplier_id = ?
 		AND o.order_date >= ?
 		AND o.status != 'cancelled'
-		GROUP BY p.id, p.name
+		GROUP BY p.id, p.name, p.currency
 		ORDER BY revenue DESC
 		LIMIT 10
 	`, supplierID, startDate).Scan(&stats)
 
 	return stats
 }
+
+// creditedAmount sums the credit notes a supplier issued in a period.
+func (h *AnalyticsHandler) creditedAmount(supplierID uint, startDate, endDate time.Time) []currencyTotal {
+	return sumByCurrency(h.db.Model(&models.CreditNote{}).
+		Where("supplier_id = ? AND issued_at BETWEEN ? AND ?", supplierID, startDate, endDate), "amount")
+}
+
+// currencyTotal is the sum of an amount column in one currency.
+type currencyTotal struct {
+	Currency string
+	Amount   money.Amount
+}
+
+// sumByCurrency sums column over the rows of query, per currency.
+func sumByCurrency(query *gorm.DB, column string) []currencyTotal {
+	var totals []currencyTotal
+	query.Select("currency, COALESCE(SUM(" + column + "), 0) as amount").
+		Group("currency").
+		Scan(&totals)
+	return totals
+}
+
+func byCurrency(totals []currencyTotal) map[string]money.Amount {
+	amounts := make(map[string]money.Amount, len(totals))
+	for _, total := range totals {
+		amounts[total.Currency] += total.Amount
+	}
+	return amounts
+}
+
+// currencyConverter converts amounts into the base currency at the exchange
+// rates in effect on one date, and remembers currencies it had no rate for.
+type currencyConverter struct {
+	h       *AnalyticsHandler
+	date    time.Time
+	rates   map[string]float64
+	unknown map[string]bool
+}
+
+func (h *AnalyticsHandler) newConverter(date time.Time) *currencyConverter {
+	return &currencyConverter{
+		h:       h,
+		date:    date.UTC(),
+		rates:   map[string]float64{h.baseCurrency: 1},
+		unknown: map[string]bool{},
+	}
+}
+
+// toBase sums totals in the base currency, leaving out currencies without a
+// rate. Each currency is converted once, so rounding happens once per
+// currency.
+func (cc *currencyConverter) toBase(totals []currencyTotal) money.Amount {
+	var sum money.Amount
+	for _, total := range totals {
+		if rate, ok := cc.rate(total.Currency); ok {
+			sum += total.Amount.Scale(rate)
+		}
+	}
+	return sum
+}
+
+func (cc *currencyConverter) rate(currency string) (float64, bool) {
+	if rate, ok := cc.rates[currency]; ok {
+		return rate, true
+	}
+	if cc.unknown[currency] {
+		return 0, false
+	}
+
+	var rate models.ExchangeRate
+	if err := cc.h.db.Where("currency = ? AND base_currency = ? AND effective_date <= ?",
+		currency, cc.h.baseCurrency, cc.date).
+		Order("effective_date DESC").
+		First(&rate).Error; err != nil {
+		cc.unknown[currency] = true
+		return 0, false
+	}
+	cc.rates[currency] = rate.Rate
+	return rate.Rate, true
+}
+
+// missing lists the currencies that could not be converted.
+func (cc *currencyConverter) missing() []string {
+	var currencies []string
+	for currency := range cc.unknown {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
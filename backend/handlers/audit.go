@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"csci361/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordAudit stores an audit log entry for an action taken by the caller.
+// Pass the transaction that performs the action so both are committed together.
+func recordAudit(tx *gorm.DB, c *gin.Context, action, targetType string, targetID uint, details string) error {
+	entry := models.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+		IPAddress:  c.ClientIP(),
+	}
+
+	if userID, exists := c.Get("user_id"); exists {
+		actorID := userID.(uint)
+		entry.ActorID = &actorID
+	}
+
+	return tx.Create(&entry).Error
+}
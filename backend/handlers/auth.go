@@ -2,33 +2,45 @@ package handlers
 
 import (
 	"csci361/config"
+	"csci361/mailer"
+	"csci361/middleware"
 	"csci361/models"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 7 * 24 * time.Hour
+	wsTicketTTL     = time.Minute
+)
+
 type AuthHandler struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db     *gorm.DB
+	cfg    *config.Config
+	mailer mailer.Mailer
+	live   LivePublisher
 }
 
-func NewAuthHandler(db *gorm.DB, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{db: db, cfg: cfg}
+func NewAuthHandler(db *gorm.DB, cfg *config.Config, m mailer.Mailer, live LivePublisher) *AuthHandler {
+	return &AuthHandler{db: db, cfg: cfg, mailer: m, live: live}
 }
 
 type RegisterRequest struct {
 	Email       string `json:"email" binding:"required,email"`
 	Password    string `json:"password" binding:"required,min=8"`
-	Role        string `json:"role" binding:"required,oneof=consumer sales admin owner"`
+	Role        string `json:"role" binding:"required,oneof=consumer owner"` // admin and sales join through invitations
 	FirstName   string `json:"first_name" binding:"required"`
 	LastName    string `json:"last_name" binding:"required"`
 	Phone       string `json:"phone"`
-	CompanyName string `json:"company_name"` // Required for supplier roles
+	CompanyName string `json:"company_name"` // Required for owners
 }
 
 type LoginRequest struct {
@@ -41,6 +53,9 @@ type AuthResponse struct {
 	RefreshToken string      `json:"refresh_token"`
 	User         models.User `json:"user"`
 	ExpiresIn    int64       `json:"expires_in"`
+	// MFAEnrollmentRequired is set when the user's supplier requires MFA and
+	// the user has not enrolled yet; supplier routes stay closed until they do.
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -50,6 +65,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if req.Role == models.RoleOwner && req.CompanyName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Company name is required for supplier roles"})
+		return
+	}
+
 	var existingUser models.User
 	if err := h.db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User already exists"})
@@ -72,42 +92,58 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		IsActive:  true,
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
-	}
-
-	if req.Role == models.RoleSales || req.Role == models.RoleAdmin || req.Role == models.RoleOwner {
-		if req.CompanyName == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Company name is required for supplier roles"})
-			return
+	// User, supplier, owner link and subscription are created together or not at all
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if req.Role == models.RoleOwner {
+			supplier := models.Supplier{
+				CompanyName: req.CompanyName,
+				IsActive:    true,
+			}
+			if err := tx.Create(&supplier).Error; err != nil {
+				return err
+			}
+
+			user.SupplierID = &supplier.ID
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&supplier).Update("owner_id", user.ID).Error; err != nil {
+				return err
+			}
+
+			subscription := models.Subscription{
+				SupplierID:   supplier.ID,
+				PlanName:     models.DefaultPlanName,
+				Status:       "active",
+				StartDate:    time.Now(),
+				Currency:     "KZT",
+				BillingCycle: "monthly",
+			}
+			return tx.Create(&subscription).Error
 		}
 
-		supplier := models.Supplier{
-			CompanyName: req.CompanyName,
-			IsActive:    true,
+		if err := tx.Create(&user).Error; err != nil {
+			return err
 		}
 
-		if err := h.db.Create(&supplier).Error; err != nil {
-			h.db.Delete(&user)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create supplier"})
-			return
-		}
-	}
-
-	if req.Role == models.RoleConsumer {
 		consumer := models.Consumer{
 			UserID: user.ID,
 		}
+		return tx.Create(&consumer).Error
+	})
 
-		if err := h.db.Create(&consumer).Error; err != nil {
-			h.db.Delete(&user)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create consumer"})
-			return
-		}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		return
 	}
 
-	token, refreshToken, expiresIn, err := h.generateTokens(user.ID, user.Email, user.Role)
+	// New accounts stay unverified until the emailed link is opened
+	if err := h.sendVerificationEmail(user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	token, refreshToken, expiresIn, err := h.startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 		return
@@ -141,7 +177,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, refreshToken, expiresIn, err := h.generateTokens(user.ID, user.Email, user.Role)
+	// Enrolled users finish logging in through /auth/mfa/verify
+	if user.MFAEnabledAt != nil {
+		h.startMFAChallenge(c, user)
+		return
+	}
+
+	token, refreshToken, expiresIn, err := h.startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 		return
@@ -150,13 +192,17 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	user.Password = ""
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		User:         user,
-		ExpiresIn:    expiresIn,
+		Token:                 token,
+		RefreshToken:          refreshToken,
+		User:                  user,
+		ExpiresIn:             expiresIn,
+		MFAEnrollmentRequired: supplierRequiresMFA(h.db, user),
 	})
 }
 
+// RefreshToken exchanges a refresh token for a new token pair. Each refresh
+// token can be used once; presenting an already rotated token revokes the
+// whole session.
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req struct {
 		RefreshToken string `json:"refresh_token" binding:"required"`
@@ -167,40 +213,141 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	claims := &jwt.MapClaims{}
-	token, err := jwt.ParseWithClaims(req.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(h.cfg.JWTSecret), nil
-	})
+	claims, err := middleware.ParseToken(req.RefreshToken, h.cfg.JWTSecret)
+	if err != nil || claims.TokenType != middleware.TokenTypeRefresh {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
 
-	if err != nil || !token.Valid {
+	var session models.Session
+	if err := h.db.Where("uuid = ? AND user_id = ?", claims.SessionID, claims.UserID).First(&session).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	userID, _ := (*claims)["user_id"].(float64)
-	email, _ := (*claims)["email"].(string)
-	role, _ := (*claims)["role"].(string)
+	now := time.Now()
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or been revoked"})
+		return
+	}
+
+	if session.TokenID != claims.ID {
+		h.revokeSession(session)
+		log.Printf("Refresh token reuse detected for session %s (user %d)", session.UUID, session.UserID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ? AND is_active = ?", session.UserID, true).First(&user).Error; err != nil {
+		h.revokeSession(session)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is inactive or does not exist"})
+		return
+	}
 
-	newToken, _, expiresIn, err := h.generateTokens(uint(userID), email, role)
+	// Rotate; the token_id guard ensures concurrent refreshes cannot both win
+	newTokenID := uuid.New().String()
+	result := h.db.Model(&models.Session{}).
+		Where("id = ? AND token_id = ? AND revoked_at IS NULL", session.ID, claims.ID).
+		Updates(map[string]interface{}{
+			"token_id":     newTokenID,
+			"last_used_at": now,
+			"expires_at":   now.Add(refreshTokenTTL),
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		h.revokeSession(session)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	}
+	session.TokenID = newTokenID
+
+	token, refreshToken, expiresIn, err := h.generateTokens(user, session)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token":      newToken,
-		"expires_in": expiresIn,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    expiresIn,
 	})
 }
 
-func (h *AuthHandler) generateTokens(userID uint, email, role string) (string, string, int64, error) {
-	accessExpiresIn := int64(3600)
-	accessClaims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"role":    role,
-		"exp":     time.Now().Unix() + accessExpiresIn,
-		"iat":     time.Now().Unix(),
+// Logout revokes the caller's current session
+// @Summary Logout
+// @Description Revoke the current session and its refresh token, and close its WebSocket connections
+// @Tags auth
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID, _ := c.Get("session_id")
+
+	if err := h.db.Model(&models.Session{}).
+		Where("uuid = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	h.live.DisconnectSession(sessionID.(string))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes every session of the caller
+// @Summary Logout from all devices
+// @Description Revoke all sessions and refresh tokens of the current user
+// @Tags auth
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Router /auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	if err := revokeUserSessions(h.db, userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	h.live.DisconnectUser(userID.(uint))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
+// startSession records a new session for the user and issues its first token pair.
+func (h *AuthHandler) startSession(c *gin.Context, user models.User) (string, string, int64, error) {
+	session := models.Session{
+		UserID:    user.ID,
+		TokenID:   uuid.New().String(),
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+
+	if err := h.db.Create(&session).Error; err != nil {
+		return "", "", 0, err
+	}
+
+	return h.generateTokens(user, session)
+}
+
+func (h *AuthHandler) generateTokens(user models.User, session models.Session) (string, string, int64, error) {
+	now := time.Now()
+
+	accessClaims := middleware.Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		TokenType: middleware.TokenTypeAccess,
+		SessionID: session.UUID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
 	}
 
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
@@ -209,12 +356,15 @@ func (h *AuthHandler) generateTokens(userID uint, email, role string) (string, s
 		return "", "", 0, err
 	}
 
-	refreshClaims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"role":    role,
-		"exp":     time.Now().Unix() + 604800,
-		"iat":     time.Now().Unix(),
+	refreshClaims := middleware.Claims{
+		UserID:    user.ID,
+		TokenType: middleware.TokenTypeRefresh,
+		SessionID: session.UUID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.TokenID,
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
 	}
 
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
@@ -223,5 +373,58 @@ func (h *AuthHandler) generateTokens(userID uint, email, role string) (string, s
 		return "", "", 0, err
 	}
 
-	return accessTokenString, refreshTokenString, accessExpiresIn, nil
+	return accessTokenString, refreshTokenString, int64(accessTokenTTL.Seconds()), nil
+}
+
+// IssueWebSocketTicket returns a short-lived ticket to open a WebSocket with
+// @Summary Issue WebSocket ticket
+// @Description Browsers cannot send an Authorization header when opening a WebSocket, so the connection is opened with a ticket passed as the ticket query parameter instead. Tickets expire after a minute and belong to the caller's session.
+// @Tags chat
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Router /ws/ticket [post]
+func (h *AuthHandler) IssueWebSocketTicket(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	sessionID, _ := c.Get("session_id")
+	now := time.Now()
+
+	claims := middleware.Claims{
+		UserID:    userID.(uint),
+		Role:      role.(string),
+		TokenType: middleware.TokenTypeWebSocket,
+		SessionID: sessionID.(string),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(wsTicketTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	ticket, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(h.cfg.JWTSecret))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue ticket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_in": int64(wsTicketTTL.Seconds()),
+	})
+}
+
+// revokeSession revokes a session and closes its WebSocket connections.
+func (h *AuthHandler) revokeSession(session models.Session) {
+	h.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", session.ID).
+		Update("revoked_at", time.Now())
+	h.live.DisconnectSession(session.UUID)
+}
+
+// revokeUserSessions revokes every active session of a user.
+func revokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
 }
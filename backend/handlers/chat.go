@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"csci361/models"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,19 +12,31 @@ import (
 )
 
 type ChatHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	chats *ChatService
 }
 
-func NewChatHandler(db *gorm.DB) *ChatHandler {
-	return &ChatHandler{db: db}
+func NewChatHandler(db *gorm.DB, chats *ChatService) *ChatHandler {
+	return &ChatHandler{db: db, chats: chats}
 }
 
 type SendMessageRequest struct {
-	ChatID      uint   `json:"chat_id" binding:"required"`
-	Content     string `json:"content" binding:"required"`
-	MessageType string `json:"message_type,omitempty"`
+	Content     string `json:"content" binding:"required,max=4000"` // maxMessageLength characters
+	MessageType string `json:"message_type,omitempty" binding:"omitempty,oneof=text image audio document"`
+	ClientKey   string `json:"client_key,omitempty" binding:"omitempty,max=64"` // idempotency key chosen by the client
 }
 
+// MarkReadRequest marks the other side's messages read up to UpToID, or all
+// of them if it is omitted.
+type MarkReadRequest struct {
+	UpToID *uint `json:"up_to_id"`
+}
+
+const (
+	defaultMessagePage = 50
+	maxMessagePage     = 100
+)
+
 // GetConsumerChats returns consumer's chat conversations
 // @Summary Get consumer chats
 // @Description Get all chat conversations for authenticated consumer
@@ -73,22 +86,11 @@ func (h *ChatHandler) GetConsumerChats(c *gin.Context) {
 // @Failure 401 {object} map[string]string
 // @Router /sales/chats [get]
 func (h *ChatHandler) GetSupplierChats(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	// Get supplier ID from user (assuming user belongs to supplier)
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	var chats []models.Chat
 	err := h.db.Where("supplier_id = ?", supplierID).
 		Preload("Consumer").
@@ -108,78 +110,103 @@ func (h *ChatHandler) GetSupplierChats(c *gin.Context) {
 
 // GetChatMessages returns messages for a specific chat
 // @Summary Get chat messages
-// @Description Get messages for a specific chat conversation
+// @Description Get a page of messages of a chat the caller takes part in, oldest first. Without a cursor the latest messages are returned; before pages back to older messages and after fetches newer ones. Reading does not mark messages read.
 // @Tags chat
 // @Produce json
 // @Security BearerAuth
 // @Param chat_id path int true "Chat ID"
-// @Param page query int false "Page number"
-// @Param limit query int false "Items per page"
+// @Param before query int false "Only messages with a lower ID"
+// @Param after query int false "Only messages with a higher ID"
+// @Param limit query int false "Messages per page (max 100)"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Router /chats/{chat_id}/messages [get]
 func (h *ChatHandler) GetChatMessages(c *gin.Context) {
-	chatID, err := strconv.ParseUint(c.Param("chat_id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+	chat, _, ok := h.findChat(c)
+	if !ok {
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	offset := (page - 1) * limit
-
-	var messages []models.Message
-	var total int64
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultMessagePage)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > maxMessagePage {
+		limit = maxMessagePage
+	}
 
-	// Check if user has access to this chat
-	userID, _ := c.Get("user_id")
-	if !h.hasAccessToChat(uint(chatID), userID.(uint)) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	before, after := c.Query("before"), c.Query("after")
+	if before != "" && after != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use either before or after, not both"})
 		return
 	}
 
-	h.db.Model(&models.Message{}).Where("chat_id = ?", chatID).Count(&total)
-	err = h.db.Where("chat_id = ?", chatID).
+	query := h.db.Where("chat_id = ?", chat.ID).
 		Preload("Sender").
-		Preload("Attachments").
-		Order("created_at DESC").
-		Offset(offset).
-		Limit(limit).
-		Find(&messages).Error
+		Preload("Attachments")
+
+	// Page back from the newest message unless newer messages are asked for
+	order := "id DESC"
+	switch {
+	case after != "":
+		afterID, err := strconv.ParseUint(after, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid after cursor"})
+			return
+		}
+		query, order = query.Where("id > ?", afterID), "id ASC"
+	case before != "":
+		beforeID, err := strconv.ParseUint(before, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before cursor"})
+			return
+		}
+		query = query.Where("id < ?", beforeID)
+	}
 
-	if err != nil {
+	// Fetch one more than asked for to know whether there are more
+	var messages []models.Message
+	if err := query.Order(order).Limit(limit + 1).Find(&messages).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
 		return
 	}
 
-	// Mark messages as read if user is not the sender
-	h.markMessagesAsRead(uint(chatID), userID.(uint))
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if after == "" {
+		// Newest were fetched first; hand them back oldest first
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"messages":    messages,
-		"total":       total,
-		"page":        page,
-		"limit":       limit,
-		"total_pages": (int(total) + limit - 1) / limit,
+		"messages": messages,
+		"has_more": hasMore,
+		"limit":    limit,
 	})
 }
 
 // SendMessage sends a new message in a chat
 // @Summary Send message
-// @Description Send a new message in a chat conversation
+// @Description Send a new message in a chat the caller takes part in. A client_key the caller used before returns the message it posted with 200 instead of posting it again.
 // @Tags chat
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Param chat_id path int true "Chat ID"
 // @Param request body SendMessageRequest true "Message content"
+// @Success 200 {object} models.Message
 // @Success 201 {object} models.Message
 // @Failure 400 {object} map[string]string
-// @Router /chats/messages [post]
+// @Failure 409 {object} map[string]string
+// @Router /chats/{chat_id}/messages [post]
 func (h *ChatHandler) SendMessage(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	chat, _, ok := h.findChat(c)
+	if !ok {
 		return
 	}
 
@@ -189,35 +216,69 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Check if user has access to this chat
-	if !h.hasAccessToChat(req.ChatID, userID.(uint)) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	userID, _ := c.Get("user_id")
+
+	message, created, err := h.chats.Send(chat, userID.(uint), req)
+	switch err {
+	case nil:
+	case errEmptyMessage:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message content is required"})
+		return
+	case errMessageTooLong:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Messages may be at most %d characters", maxMessageLength)})
+		return
+	case errClientKeyReused:
+		c.JSON(http.StatusConflict, gin.H{"error": "client_key was already used in another chat"})
+		return
+	case errChatArchived:
+		c.JSON(http.StatusConflict, gin.H{"error": "Chat is archived"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
 		return
 	}
 
-	// Create message
-	message := models.Message{
-		ChatID:      req.ChatID,
-		SenderID:    userID.(uint),
-		Content:     req.Content,
-		MessageType: req.MessageType,
+	if !created {
+		c.JSON(http.StatusOK, message)
+		return
 	}
+	c.JSON(http.StatusCreated, message)
+}
 
-	if message.MessageType == "" {
-		message.MessageType = "text"
+// MarkChatRead marks the other side's messages as read
+// @Summary Mark messages read
+// @Description Mark the messages the other side of a chat sent as read, up to up_to_id or all of them
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param chat_id path int true "Chat ID"
+// @Param request body MarkReadRequest false "Last message read"
+// @Success 200 {object} map[string]interface{}
+// @Router /chats/{chat_id}/read [post]
+func (h *ChatHandler) MarkChatRead(c *gin.Context) {
+	chat, consumerUserID, ok := h.findChat(c)
+	if !ok {
+		return
 	}
 
-	if err := h.db.Create(&message).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
-		return
+	var req MarkReadRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	// Load message with relationships
-	h.db.Preload("Sender").Preload("Attachments").First(&message, message.ID)
+	userID, _ := c.Get("user_id")
 
-	// TODO: Send message via WebSocket to connected clients
+	marked, err := h.chats.MarkRead(chat, consumerUserID, userID.(uint), req.UpToID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark messages read"})
+		return
+	}
 
-	c.JSON(http.StatusCreated, message)
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
 }
 
 // EscalateChat escalates a chat to admin level
@@ -225,12 +286,17 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 // @Description Escalate chat conversation to admin level
 // @Tags chat
 // @Security BearerAuth
-// @Param chat_id path int true "Chat ID"
+// @Param id path int true "Chat ID"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
-// @Router /sales/chats/{chat_id}/escalate [post]
+// @Router /sales/chats/{id}/escalate [post]
 func (h *ChatHandler) EscalateChat(c *gin.Context) {
-	chatID, err := strconv.ParseUint(c.Param("chat_id"), 10, 32)
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
 		return
@@ -238,14 +304,14 @@ func (h *ChatHandler) EscalateChat(c *gin.Context) {
 
 	userID, _ := c.Get("user_id")
 
-	// Check if user has access to this chat
-	if !h.hasAccessToChat(uint(chatID), userID.(uint)) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	var chat models.Chat
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&chat, uint(chatID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
 		return
 	}
 
 	// Update chat status to escalated
-	if err := h.db.Model(&models.Chat{}).Where("id = ?", chatID).Update("status", "escalated").Error; err != nil {
+	if err := h.db.Model(&chat).Update("status", "escalated").Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to escalate chat"})
 		return
 	}
@@ -257,7 +323,7 @@ func (h *ChatHandler) EscalateChat(c *gin.Context) {
 		Content:     "Chat has been escalated to admin level",
 		MessageType: "system",
 	}
-	h.db.Create(&systemMessage)
+	h.chats.post(&systemMessage)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Chat escalated successfully"})
 }
@@ -268,23 +334,22 @@ func (h *ChatHandler) EscalateChat(c *gin.Context) {
 // @Tags chat
 // @Produce json
 // @Security BearerAuth
-// @Param supplier_id query int false "Filter by supplier ID"
 // @Param start_date query string false "Start date (YYYY-MM-DD)"
 // @Param end_date query string false "End date (YYYY-MM-DD)"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Router /owner/reports/transcripts [get]
 func (h *ChatHandler) ExportTranscripts(c *gin.Context) {
-	supplierIDStr := c.Query("supplier_id")
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	startDateStr := c.Query("start_date")
 	endDateStr := c.Query("end_date")
 
-	query := h.db.Model(&models.Chat{}).Preload("Messages").Preload("Consumer").Preload("Supplier")
-
-	if supplierIDStr != "" {
-		supplierID, _ := strconv.ParseUint(supplierIDStr, 10, 32)
-		query = query.Where("supplier_id = ?", supplierID)
-	}
+	query := h.db.Model(&models.Chat{}).Preload("Messages").Preload("Consumer").Preload("Supplier").
+		Where("supplier_id = ?", supplierID)
 
 	if startDateStr != "" && endDateStr != "" {
 		startDate, _ := time.Parse("2006-01-02", startDateStr)
@@ -307,29 +372,42 @@ func (h *ChatHandler) ExportTranscripts(c *gin.Context) {
 
 // Helper functions
 
-func (h *ChatHandler) hasAccessToChat(chatID, userID uint) bool {
+// findChat loads the chat in the URL if the caller takes part in it: as its
+// consumer, or as staff of its supplier. It also returns the user ID of the
+// chat's consumer. Otherwise it writes the response and returns false; chats
+// of others are reported as not found.
+func (h *ChatHandler) findChat(c *gin.Context) (models.Chat, uint, bool) {
 	var chat models.Chat
-	if err := h.db.First(&chat, chatID).Error; err != nil {
-		return false
+
+	chatID, err := strconv.ParseUint(c.Param("chat_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return chat, 0, false
 	}
 
-	// Check if user is consumer in this chat
-	var consumer models.Consumer
-	if err := h.db.Where("user_id = ? AND id = ?", userID, chat.ConsumerID).First(&consumer).Error; err == nil {
-		return true
+	if err := h.db.First(&chat, uint(chatID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return chat, 0, false
 	}
 
-	// Check if user belongs to supplier in this chat
-	// TODO: Implement supplier-user relationship check
+	var consumer models.Consumer
+	if err := h.db.Select("id", "user_id").First(&consumer, chat.ConsumerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return chat, 0, false
+	}
 
-	return false
-}
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	member := false
+	if role == models.RoleConsumer {
+		member = consumer.UserID == userID.(uint)
+	} else if supplierID, ok := c.Get("supplier_id"); ok {
+		member = supplierID.(uint) == chat.SupplierID
+	}
+	if !member {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return chat, 0, false
+	}
 
-func (h *ChatHandler) markMessagesAsRead(chatID, userID uint) {
-	h.db.Model(&models.Message{}).
-		Where("chat_id = ? AND sender_id != ? AND is_read = ?", chatID, userID, false).
-		Updates(map[string]interface{}{
-			"is_read": true,
-			"read_at": time.Now(),
-		})
+	return chat, consumer.UserID, true
 }
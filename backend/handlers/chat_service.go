@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"csci361/models"
+	ws "csci361/websocket"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// maxClientKeyLength is the longest idempotency key a client may send.
+const maxClientKeyLength = 64
+
+// maxMessageLength is the most characters a message may have.
+const maxMessageLength = 4000
+
+var (
+	errChatArchived       = errors.New("chat is archived")
+	errEmptyMessage       = errors.New("message content is required")
+	errMessageTooLong     = errors.New("message content is too long")
+	errInvalidMessageType = errors.New("invalid message type")
+	errInvalidClientKey   = errors.New("invalid client key")
+	errClientKeyReused    = errors.New("client key was used in another chat")
+)
+
+// messageTypes are the message types members may send.
+var messageTypes = map[string]bool{"text": true, "image": true, "audio": true, "document": true}
+
+// ChatService posts and reads chat messages and tells the chat's connected
+// clients about it. The REST API and the WebSocket both go through it, so
+// a message is stored and delivered the same way whichever way it came in.
+// It expects membership of the chat to have been checked.
+type ChatService struct {
+	db        *gorm.DB
+	publisher LivePublisher
+}
+
+func NewChatService(db *gorm.DB, publisher LivePublisher) *ChatService {
+	return &ChatService{db: db, publisher: publisher}
+}
+
+// Send posts a message from a member of the chat. If the sender used the
+// client key before, the message it posted is returned instead and created
+// is false, so a retried send is stored and delivered once.
+func (s *ChatService) Send(chat models.Chat, senderID uint, req SendMessageRequest) (message models.Message, created bool, err error) {
+	if req.MessageType == "" {
+		req.MessageType = "text"
+	}
+	switch {
+	case strings.TrimSpace(req.Content) == "":
+		return message, false, errEmptyMessage
+	case utf8.RuneCountInString(req.Content) > maxMessageLength:
+		return message, false, errMessageTooLong
+	case !messageTypes[req.MessageType]:
+		return message, false, errInvalidMessageType
+	case len(req.ClientKey) > maxClientKeyLength:
+		return message, false, errInvalidClientKey
+	}
+
+	if req.ClientKey != "" {
+		if existing, err := s.sentWithKey(chat, senderID, req.ClientKey); err != gorm.ErrRecordNotFound {
+			return existing, false, err
+		}
+	}
+
+	if chat.Status == "archived" {
+		return message, false, errChatArchived
+	}
+
+	message = models.Message{
+		ChatID:      chat.ID,
+		SenderID:    senderID,
+		Content:     req.Content,
+		MessageType: req.MessageType,
+	}
+	if req.ClientKey != "" {
+		message.ClientKey = &req.ClientKey
+	}
+
+	if err := s.post(&message); err != nil {
+		// A retry may have got there first
+		if req.ClientKey != "" {
+			if existing, err := s.sentWithKey(chat, senderID, req.ClientKey); err == nil {
+				return existing, false, nil
+			}
+		}
+		return message, false, err
+	}
+	return message, true, nil
+}
+
+// MarkRead marks the messages the other side of the chat sent as read, up to
+// upToID or all of them, and returns how many were marked. The consumer
+// reads what staff wrote and staff read what the consumer wrote.
+func (s *ChatService) MarkRead(chat models.Chat, consumerUserID, readerID uint, upToID *uint) (int64, error) {
+	query := s.db.Model(&models.Message{}).Where("chat_id = ? AND is_read = ?", chat.ID, false)
+	if readerID == consumerUserID {
+		query = query.Where("sender_id != ?", consumerUserID)
+	} else {
+		query = query.Where("sender_id = ?", consumerUserID)
+	}
+	if upToID != nil {
+		query = query.Where("id <= ?", *upToID)
+	}
+
+	result := query.Updates(map[string]interface{}{
+		"is_read": true,
+		"read_at": time.Now(),
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		data := map[string]interface{}{"marked": result.RowsAffected}
+		if upToID != nil {
+			data["up_to_id"] = *upToID
+		}
+		s.publisher.PublishToChat(chat.ID, ws.Event{Event: ws.EventMessageRead, UserID: readerID, Data: data})
+	}
+	return result.RowsAffected, nil
+}
+
+// Typing tells the chat that a member started or stopped typing.
+func (s *ChatService) Typing(chat models.Chat, userID uint, isTyping bool) {
+	s.publisher.PublishToChat(chat.ID, ws.Event{
+		Event:  ws.EventTyping,
+		UserID: userID,
+		Data:   map[string]bool{"is_typing": isTyping},
+	})
+}
+
+// post stores a message and delivers it to the chat.
+func (s *ChatService) post(message *models.Message) error {
+	if err := s.db.Create(message).Error; err != nil {
+		return err
+	}
+
+	// Load message with relationships
+	s.db.Preload("Sender").Preload("Attachments").First(message, message.ID)
+
+	s.publisher.PublishToChat(message.ChatID, ws.Event{
+		Event:  ws.EventMessageCreated,
+		UserID: message.SenderID,
+		Data:   message,
+	})
+	return nil
+}
+
+// sentWithKey returns the message the sender posted with a client key.
+func (s *ChatService) sentWithKey(chat models.Chat, senderID uint, key string) (models.Message, error) {
+	var message models.Message
+	err := s.db.Where("sender_id = ? AND client_key = ?", senderID, key).
+		Preload("Sender").
+		Preload("Attachments").
+		First(&message).Error
+	if err == nil && message.ChatID != chat.ID {
+		return message, errClientKeyReused
+	}
+	return message, err
+}
@@ -185,19 +185,16 @@ func (h *ConsumerHandler) RemoveLink(c *gin.Context) {
 // @Success 200 {array} models.ConsumerSupplierLink
 // @Router /sales/consumers [get]
 func (h *ConsumerHandler) GetLinkedConsumers(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	var links []models.ConsumerSupplierLink
 	err := h.db.Where("supplier_id = ? AND status = ?", supplierID, "approved").
 		Preload("Consumer").
 		Preload("Consumer.User").
+		Preload("PriceList").
 		Order("approved_at DESC").
 		Find(&links).Error
 
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentSupplierID returns the supplier resolved for the caller by
+// middleware.TenantMiddleware. If none is present it writes a 403 response
+// and returns false, so handlers can simply return.
+func currentSupplierID(c *gin.Context) (uint, bool) {
+	supplierID, exists := c.Get("supplier_id")
+	if !exists {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not linked to a supplier"})
+		return 0, false
+	}
+
+	return supplierID.(uint), true
+}
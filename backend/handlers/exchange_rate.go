@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"csci361/models"
+	"csci361/money"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExchangeRateHandler struct {
+	db           *gorm.DB
+	baseCurrency string
+}
+
+// NewExchangeRateHandler manages rates into baseCurrency, KZT if empty.
+func NewExchangeRateHandler(db *gorm.DB, baseCurrency string) *ExchangeRateHandler {
+	if baseCurrency == "" {
+		baseCurrency = money.KZT
+	}
+	return &ExchangeRateHandler{db: db, baseCurrency: baseCurrency}
+}
+
+// ExchangeRateRequest sets how much one unit of Currency is worth in the base
+// currency from EffectiveDate (YYYY-MM-DD, today if empty).
+type ExchangeRateRequest struct {
+	Currency      string  `json:"currency" binding:"required"`
+	Rate          float64 `json:"rate" binding:"required,gt=0"`
+	EffectiveDate string  `json:"effective_date"`
+}
+
+// GetExchangeRates lists exchange rates
+// @Summary Get exchange rates
+// @Description List exchange rates into the base currency, newest first (platform admin only)
+// @Tags platform
+// @Produce json
+// @Security BearerAuth
+// @Param currency query string false "Filter by currency"
+// @Success 200 {object} map[string]interface{}
+// @Router /platform/exchange-rates [get]
+func (h *ExchangeRateHandler) GetExchangeRates(c *gin.Context) {
+	query := h.db.Where("base_currency = ?", h.baseCurrency)
+	if currency := c.Query("currency"); currency != "" {
+		query = query.Where("currency = ?", currency)
+	}
+
+	var rates []models.ExchangeRate
+	if err := query.Order("effective_date DESC, currency").Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"base_currency": h.baseCurrency,
+		"rates":         rates,
+	})
+}
+
+// SetExchangeRate records an exchange rate
+// @Summary Set exchange rate
+// @Description Set the rate of a currency into the base currency from a date, replacing any rate for that date. The change is audited (platform admin only).
+// @Tags platform
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ExchangeRateRequest true "Exchange rate"
+// @Success 200 {object} models.ExchangeRate
+// @Failure 400 {object} map[string]string
+// @Router /platform/exchange-rates [put]
+func (h *ExchangeRateHandler) SetExchangeRate(c *gin.Context) {
+	var req ExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !money.Supported(req.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "currencies": money.Currencies()})
+		return
+	}
+	if req.Currency == h.baseCurrency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The base currency has no exchange rate"})
+		return
+	}
+
+	effective := time.Now().UTC().Truncate(24 * time.Hour)
+	if req.EffectiveDate != "" {
+		date, err := time.Parse("2006-01-02", req.EffectiveDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "effective_date must be YYYY-MM-DD"})
+			return
+		}
+		effective = date
+	}
+
+	rate := models.ExchangeRate{
+		Currency:      req.Currency,
+		BaseCurrency:  h.baseCurrency,
+		Rate:          req.Rate,
+		EffectiveDate: effective,
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "currency"}, {Name: "base_currency"}, {Name: "effective_date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+		}).Create(&rate).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("currency = ? AND base_currency = ? AND effective_date = ?",
+			rate.Currency, rate.BaseCurrency, rate.EffectiveDate).First(&rate).Error; err != nil {
+			return err
+		}
+
+		details := fmt.Sprintf("1 %s = %s %s from %s", rate.Currency,
+			strconv.FormatFloat(rate.Rate, 'f', -1, 64), rate.BaseCurrency, rate.EffectiveDate.Format("2006-01-02"))
+		return recordAudit(tx, c, models.AuditExchangeRateSet, "exchange_rate", rate.ID, details)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rate)
+}
+
+// convertCurrency converts amount between currencies at the rates in effect
+// on date. Rates are kept against a base currency, so both currencies need a
+// rate against the same base unless one of them is that base. It reports
+// whether such rates exist.
+func convertCurrency(db *gorm.DB, amount money.Amount, from, to string, date time.Time) (money.Amount, bool) {
+	if from == to {
+		return amount, true
+	}
+
+	rate := func(currency, base string) (float64, bool) {
+		if currency == base {
+			return 1, true
+		}
+		var rate models.ExchangeRate
+		if err := db.Where("currency = ? AND base_currency = ? AND effective_date <= ?", currency, base, date.UTC()).
+			Order("effective_date DESC").
+			First(&rate).Error; err != nil {
+			return 0, false
+		}
+		return rate.Rate, true
+	}
+
+	var bases []string
+	db.Model(&models.ExchangeRate{}).Where("currency IN ?", []string{from, to}).Distinct().Pluck("base_currency", &bases)
+	for _, base := range bases {
+		fromRate, ok := rate(from, base)
+		if !ok {
+			continue
+		}
+		if toRate, ok := rate(to, base); ok {
+			return amount.Scale(fromRate / toRate), true
+		}
+	}
+	return 0, false
+}
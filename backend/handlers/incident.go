@@ -65,6 +65,23 @@ func (h *IncidentHandler) CreateIncident(c *gin.Context) {
 		return
 	}
 
+	// The chat and the optional order must belong to this consumer and supplier
+	var chat models.Chat
+	if err := h.db.Scopes(ownedByConsumer(consumer.ID), ownedBySupplier(req.SupplierID)).
+		First(&chat, req.ChatID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return
+	}
+
+	if req.OrderID != nil {
+		var order models.Order
+		if err := h.db.Scopes(ownedByConsumer(consumer.ID), ownedBySupplier(req.SupplierID)).
+			First(&order, *req.OrderID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+	}
+
 	// Create incident
 	incident := models.Incident{
 		ConsumerID:  consumer.ID,
@@ -114,15 +131,11 @@ func (h *IncidentHandler) CreateIncident(c *gin.Context) {
 // @Failure 401 {object} map[string]string
 // @Router /sales/incidents [get]
 func (h *IncidentHandler) GetSupplierIncidents(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	query := h.db.Where("supplier_id = ?", supplierID)
 
 	// Apply filters
@@ -161,6 +174,11 @@ func (h *IncidentHandler) GetSupplierIncidents(c *gin.Context) {
 // @Failure 401 {object} map[string]string
 // @Router /admin/incidents [get]
 func (h *IncidentHandler) GetAllIncidents(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	offset := (page - 1) * limit
@@ -168,8 +186,9 @@ func (h *IncidentHandler) GetAllIncidents(c *gin.Context) {
 	var incidents []models.Incident
 	var total int64
 
-	h.db.Model(&models.Incident{}).Count(&total)
-	err := h.db.Offset(offset).
+	h.db.Model(&models.Incident{}).Where("supplier_id = ?", supplierID).Count(&total)
+	err := h.db.Where("supplier_id = ?", supplierID).
+		Offset(offset).
 		Limit(limit).
 		Preload("Consumer").
 		Preload("Consumer.User").
@@ -206,6 +225,11 @@ func (h *IncidentHandler) GetAllIncidents(c *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Router /sales/incidents/{id} [put]
 func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	incidentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
@@ -221,11 +245,20 @@ func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
 	}
 
 	var incident models.Incident
-	if err := h.db.First(&incident, uint(incidentID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&incident, uint(incidentID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
 		return
 	}
 
+	// Assignees must work for the same supplier
+	if req.AssignedTo != nil {
+		var assignedUser models.User
+		if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&assignedUser, *req.AssignedTo).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assigned user not found"})
+			return
+		}
+	}
+
 	// Store old values for logging
 	oldStatus := incident.Status
 	oldPriority := incident.Priority
@@ -270,6 +303,11 @@ func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Router /admin/incidents/{id}/assign [put]
 func (h *IncidentHandler) AssignIncident(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	incidentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
@@ -289,14 +327,14 @@ func (h *IncidentHandler) AssignIncident(c *gin.Context) {
 	}
 
 	var incident models.Incident
-	if err := h.db.First(&incident, uint(incidentID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&incident, uint(incidentID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
 		return
 	}
 
-	// Verify assigned user exists
+	// Verify assigned user exists and works for the same supplier
 	var assignedUser models.User
-	if err := h.db.First(&assignedUser, req.AssignedTo).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&assignedUser, req.AssignedTo).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Assigned user not found"})
 		return
 	}
@@ -331,6 +369,11 @@ func (h *IncidentHandler) AssignIncident(c *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Router /admin/incidents/{id}/resolve [put]
 func (h *IncidentHandler) ResolveIncident(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	incidentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
@@ -349,7 +392,7 @@ func (h *IncidentHandler) ResolveIncident(c *gin.Context) {
 	}
 
 	var incident models.Incident
-	if err := h.db.First(&incident, uint(incidentID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&incident, uint(incidentID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
 		return
 	}
@@ -378,13 +421,16 @@ func (h *IncidentHandler) ResolveIncident(c *gin.Context) {
 // @Tags incidents
 // @Produce json
 // @Security BearerAuth
-// @Param supplier_id query int false "Filter by supplier ID"
 // @Param start_date query string false "Start date (YYYY-MM-DD)"
 // @Param end_date query string false "End date (YYYY-MM-DD)"
 // @Success 200 {object} map[string]interface{}
 // @Router /owner/reports/incidents [get]
 func (h *IncidentHandler) ExportIncidents(c *gin.Context) {
-	supplierIDStr := c.Query("supplier_id")
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	startDateStr := c.Query("start_date")
 	endDateStr := c.Query("end_date")
 
@@ -393,12 +439,8 @@ func (h *IncidentHandler) ExportIncidents(c *gin.Context) {
 		Preload("Consumer.User").
 		Preload("Supplier").
 		Preload("AssignedUser").
-		Preload("Logs")
-
-	if supplierIDStr != "" {
-		supplierID, _ := strconv.ParseUint(supplierIDStr, 10, 32)
-		query = query.Where("supplier_id = ?", supplierID)
-	}
+		Preload("Logs").
+		Where("supplier_id = ?", supplierID)
 
 	if startDateStr != "" && endDateStr != "" {
 		startDate, _ := time.Parse("2006-01-02", startDateStr)
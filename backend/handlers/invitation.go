@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"csci361/config"
+	"csci361/mailer"
+	"csci361/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// invitationTTL is how long an invitation link stays valid.
+const invitationTTL = 7 * 24 * time.Hour
+
+var errInvalidInvitation = errors.New("invalid invitation")
+
+type InvitationHandler struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	mailer mailer.Mailer
+}
+
+func NewInvitationHandler(db *gorm.DB, cfg *config.Config, m mailer.Mailer) *InvitationHandler {
+	return &InvitationHandler{db: db, cfg: cfg, mailer: m}
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=admin sales"`
+}
+
+type AcceptInvitationRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Password  string `json:"password" binding:"required,min=8"`
+	FirstName string `json:"first_name" binding:"required"`
+	LastName  string `json:"last_name" binding:"required"`
+	Phone     string `json:"phone"`
+}
+
+// CreateInvitation invites a staff member to the caller's supplier
+// @Summary Invite staff member
+// @Description Invite an email address to join the supplier as admin or sales (admin/owner only)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateInvitationRequest true "Invitation details"
+// @Success 201 {object} models.Invitation
+// @Failure 400 {object} map[string]string
+// @Router /admin/invitations [post]
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	var existingUser models.User
+	if err := h.db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User already exists"})
+		return
+	}
+
+	var pending int64
+	h.db.Model(&models.Invitation{}).
+		Where("supplier_id = ? AND email = ? AND status = ? AND expires_at > ?", supplierID, req.Email, "pending", time.Now()).
+		Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation already pending for this email"})
+		return
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation token"})
+		return
+	}
+
+	invitation := models.Invitation{
+		SupplierID:  supplierID,
+		InvitedByID: userID.(uint),
+		Email:       req.Email,
+		Role:        req.Role,
+		TokenHash:   tokenHash,
+		Status:      "pending",
+		ExpiresAt:   time.Now().Add(invitationTTL),
+	}
+
+	if err := h.db.Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	var supplier models.Supplier
+	h.db.First(&supplier, supplierID)
+
+	if err := h.mailer.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", supplier.CompanyName),
+		Body: fmt.Sprintf("You have been invited to join %s as %s.\n\nAccept the invitation: %s/auth/invitation?token=%s\n\nThis link expires on %s.",
+			supplier.CompanyName, invitation.Role, h.cfg.FrontendURL, token, invitation.ExpiresAt.Format(time.RFC1123)),
+	}); err != nil {
+		log.Printf("Failed to send invitation %d: %v", invitation.ID, err)
+	}
+
+	h.db.Preload("InvitedBy").First(&invitation, invitation.ID)
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// GetInvitations returns invitations of the caller's supplier
+// @Summary Get invitations
+// @Description Get staff invitations of the supplier (admin/owner only)
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status"
+// @Success 200 {array} models.Invitation
+// @Router /admin/invitations [get]
+func (h *InvitationHandler) GetInvitations(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	query := h.db.Scopes(ownedBySupplier(supplierID))
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var invitations []models.Invitation
+	err := query.Preload("InvitedBy").
+		Order("created_at DESC").
+		Find(&invitations).Error
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation revokes a pending invitation
+// @Summary Revoke invitation
+// @Description Revoke a pending staff invitation (admin/owner only)
+// @Tags users
+// @Security BearerAuth
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /admin/invitations/{id} [delete]
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	invitationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	var invitation models.Invitation
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&invitation, uint(invitationID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	if invitation.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation already " + invitation.Status})
+		return
+	}
+
+	invitation.Status = "revoked"
+	if err := h.db.Save(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// AcceptInvitation creates the invited user's account
+// @Summary Accept invitation
+// @Description Accept a staff invitation, set a password and join the supplier
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body AcceptInvitationRequest true "Invitation token and account details"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Router /auth/invitations/accept [post]
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var user models.User
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		if err := tx.Where("token_hash = ?", hashToken(req.Token)).First(&invitation).Error; err != nil {
+			return errInvalidInvitation
+		}
+
+		// Claim the invitation; the status guard makes it single-use under concurrency
+		now := time.Now()
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND status = ? AND expires_at > ?", invitation.ID, "pending", now).
+			Updates(map[string]interface{}{
+				"status":      "accepted",
+				"accepted_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidInvitation
+		}
+
+		var existingUser models.User
+		if err := tx.Where("email = ?", invitation.Email).First(&existingUser).Error; err == nil {
+			return errInvalidInvitation
+		}
+
+		// The invitation link was delivered to this address, so it counts as verified
+		user = models.User{
+			Email:           invitation.Email,
+			Password:        string(hashedPassword),
+			Role:            invitation.Role,
+			SupplierID:      &invitation.SupplierID,
+			FirstName:       req.FirstName,
+			LastName:        req.LastName,
+			Phone:           req.Phone,
+			IsActive:        true,
+			EmailVerifiedAt: &now,
+		}
+		return tx.Create(&user).Error
+	})
+
+	if err == errInvalidInvitation {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	user.Password = ""
+	c.JSON(http.StatusCreated, user)
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"csci361/models"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InvoiceHandler struct {
+	db *gorm.DB
+}
+
+func NewInvoiceHandler(db *gorm.DB) *InvoiceHandler {
+	return &InvoiceHandler{db: db}
+}
+
+// GetConsumerInvoices returns the consumer's invoices
+// @Summary Get my invoices
+// @Description List invoices issued to the authenticated consumer
+// @Tags invoices
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Invoice
+// @Router /consumer/invoices [get]
+func (h *InvoiceHandler) GetConsumerInvoices(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	h.listInvoices(c, ownedByConsumer(consumer.ID))
+}
+
+// DownloadConsumerInvoice returns one of the consumer's invoices as a PDF
+// @Summary Download my invoice
+// @Description Download an invoice issued to the authenticated consumer as a PDF
+// @Tags invoices
+// @Produce application/pdf
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Success 200 {file} file
+// @Router /consumer/invoices/{id}/pdf [get]
+func (h *InvoiceHandler) DownloadConsumerInvoice(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	h.downloadInvoice(c, ownedByConsumer(consumer.ID))
+}
+
+// GetSupplierInvoices returns the supplier's invoices
+// @Summary Get invoices
+// @Description List invoices issued by the supplier
+// @Tags invoices
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (issued/void)"
+// @Param start_date query string false "Issued on or after (YYYY-MM-DD)"
+// @Param end_date query string false "Issued on or before (YYYY-MM-DD)"
+// @Success 200 {array} models.Invoice
+// @Router /sales/invoices [get]
+func (h *InvoiceHandler) GetSupplierInvoices(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	h.listInvoices(c, ownedBySupplier(supplierID))
+}
+
+// DownloadSupplierInvoice returns one of the supplier's invoices as a PDF
+// @Summary Download invoice
+// @Description Download an invoice issued by the supplier as a PDF
+// @Tags invoices
+// @Produce application/pdf
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Success 200 {file} file
+// @Router /sales/invoices/{id}/pdf [get]
+func (h *InvoiceHandler) DownloadSupplierInvoice(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	h.downloadInvoice(c, ownedBySupplier(supplierID))
+}
+
+// ExportInvoices returns every invoice of a period as PDFs in a ZIP archive
+// @Summary Export invoices
+// @Description Download all invoices issued in a period as a ZIP of PDFs with a CSV summary (owner only)
+// @Tags invoices
+// @Produce application/zip
+// @Security BearerAuth
+// @Param start_date query string true "Start date (YYYY-MM-DD)"
+// @Param end_date query string true "End date (YYYY-MM-DD), inclusive"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Router /owner/reports/invoices [get]
+func (h *InvoiceHandler) ExportInvoices(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", c.Query("start_date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date is required (YYYY-MM-DD)"})
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", c.Query("end_date"))
+	if err != nil || endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date is required (YYYY-MM-DD) and may not precede start_date"})
+		return
+	}
+
+	var invoices []models.Invoice
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).
+		Where("issued_at >= ? AND issued_at < ?", startDate, endDate.AddDate(0, 0, 1)).
+		Preload("Lines").
+		Preload("Taxes").
+		Order("sequence").
+		Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoices"})
+		return
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	summary, _ := archive.Create("invoices.csv")
+	rows := csv.NewWriter(summary)
+	rows.Write([]string{"number", "issued_at", "status", "order_id", "consumer", "currency", "subtotal", "tax", "total"})
+	for _, invoice := range invoices {
+		rows.Write([]string{
+			invoice.Number,
+			invoice.IssuedAt.Format(time.RFC3339),
+			invoice.Status,
+			strconv.FormatUint(uint64(invoice.OrderID), 10),
+			invoice.ConsumerName,
+			invoice.Currency,
+			invoice.Subtotal.String(),
+			invoice.TaxTotal.String(),
+			invoice.Total.String(),
+		})
+
+		file, err := archive.Create(invoice.Number + ".pdf")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoices"})
+			return
+		}
+		renderInvoicePDF(invoice).WriteTo(file)
+	}
+	rows.Flush()
+
+	if err := archive.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export invoices"})
+		return
+	}
+
+	filename := fmt.Sprintf("invoices_%s_%s.zip", startDate.Format("20060102"), endDate.Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// Helper functions
+
+func (h *InvoiceHandler) currentConsumer(c *gin.Context) (models.Consumer, bool) {
+	userID, _ := c.Get("user_id")
+
+	var consumer models.Consumer
+	if err := h.db.Where("user_id = ?", userID).First(&consumer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+		return consumer, false
+	}
+	return consumer, true
+}
+
+func (h *InvoiceHandler) listInvoices(c *gin.Context, scope func(*gorm.DB) *gorm.DB) {
+	query := h.db.Scopes(scope)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if startDate, err := time.Parse("2006-01-02", c.Query("start_date")); err == nil {
+		query = query.Where("issued_at >= ?", startDate)
+	}
+	if endDate, err := time.Parse("2006-01-02", c.Query("end_date")); err == nil {
+		query = query.Where("issued_at < ?", endDate.AddDate(0, 0, 1))
+	}
+
+	var invoices []models.Invoice
+	if err := query.Preload("Lines").Preload("Taxes").Order("issued_at DESC").Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoices)
+}
+
+func (h *InvoiceHandler) downloadInvoice(c *gin.Context, scope func(*gorm.DB) *gorm.DB) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var invoice models.Invoice
+	if err := h.db.Scopes(scope).Preload("Lines").Preload("Taxes").First(&invoice, uint(invoiceID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Number+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", renderInvoicePDF(invoice).Bytes())
+}
+
+// issueInvoice creates the invoice of an order unless it already has one.
+// It must run in the transaction that confirms the order so the invoice
+// number is only used if the confirmation commits.
+func issueInvoice(tx *gorm.DB, orderID uint) (*models.Invoice, error) {
+	var existing models.Invoice
+	err := tx.Where("order_id = ?", orderID).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var order models.Order
+	if err := tx.Preload("OrderItems").
+		Preload("OrderItems.Product").
+		Preload("Supplier").
+		Preload("Consumer").
+		Preload("Consumer.User").
+		First(&order, orderID).Error; err != nil {
+		return nil, err
+	}
+
+	sequence, err := nextInvoiceSequence(tx, order.SupplierID)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := models.Invoice{
+		SupplierID:      order.SupplierID,
+		Sequence:        sequence,
+		Number:          fmt.Sprintf("INV-%06d", sequence),
+		OrderID:         order.ID,
+		ConsumerID:      order.ConsumerID,
+		Status:          models.InvoiceStatusIssued,
+		Currency:        order.Currency,
+		SupplierName:    order.Supplier.CompanyName,
+		SupplierLicense: order.Supplier.BusinessLicense,
+		SupplierAddress: joinNonEmpty(order.Supplier.Address, order.Supplier.City, order.Supplier.PostalCode, order.Supplier.Country),
+		ConsumerName:    strings.TrimSpace(order.Consumer.User.FirstName + " " + order.Consumer.User.LastName),
+		ConsumerEmail:   order.Consumer.User.Email,
+		ConsumerPhone:   order.Consumer.User.Phone,
+		IssuedAt:        time.Now(),
+	}
+
+	for _, item := range order.OrderItems {
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			OrderItemID: item.ID,
+			Description: item.Product.Name,
+			SKU:         item.Product.SKU,
+			Unit:        item.Product.Unit,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Total:       item.Total,
+		})
+		invoice.Total += item.Total
+	}
+
+	// Catalog prices include VAT, so the tax is the included share of the total.
+	rate := order.Supplier.VATRate
+	if rate > 0 {
+		invoice.TaxTotal = invoice.Total.Scale(rate / (100 + rate))
+		invoice.Taxes = []models.InvoiceTax{{
+			Name:   fmt.Sprintf("VAT %s%%", strconv.FormatFloat(rate, 'f', -1, 64)),
+			Rate:   rate,
+			Base:   invoice.Total - invoice.TaxTotal,
+			Amount: invoice.TaxTotal,
+		}}
+	}
+	invoice.Subtotal = invoice.Total - invoice.TaxTotal
+
+	if err := tx.Create(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// voidInvoice marks the invoice of a cancelled order void. Its number stays
+// used so the sequence has no gaps.
+func voidInvoice(tx *gorm.DB, orderID uint) error {
+	return tx.Model(&models.Invoice{}).
+		Where("order_id = ? AND status = ?", orderID, models.InvoiceStatusIssued).
+		Updates(map[string]interface{}{"status": models.InvoiceStatusVoid, "voided_at": time.Now()}).Error
+}
+
+// nextInvoiceSequence takes the supplier's next invoice number. The sequence
+// row stays locked until the transaction ends, so concurrent invoices wait
+// and a rolled-back invoice gives its number back.
+func nextInvoiceSequence(tx *gorm.DB, supplierID uint) (int64, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.InvoiceSequence{SupplierID: supplierID}).Error; err != nil {
+		return 0, err
+	}
+
+	if err := tx.Model(&models.InvoiceSequence{}).
+		Where("supplier_id = ?", supplierID).
+		Update("last_number", gorm.Expr("last_number + 1")).Error; err != nil {
+		return 0, err
+	}
+
+	var sequence models.InvoiceSequence
+	if err := tx.Where("supplier_id = ?", supplierID).First(&sequence).Error; err != nil {
+		return 0, err
+	}
+	return sequence.LastNumber, nil
+}
+
+func joinNonEmpty(parts ...string) string {
+	kept := parts[:0]
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"csci361/models"
+	"csci361/money"
+	"csci361/pdf"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Layout of the invoice page, in points from the top-left corner.
+const (
+	invoiceLeft   = 40.0
+	invoiceRight  = pdf.PageWidth - 40
+	invoiceBottom = pdf.PageHeight - 60
+	invoiceLine   = 16.0
+)
+
+// renderInvoicePDF lays out an invoice: header with both parties, the lines
+// table (continued on further pages if needed), then tax and totals.
+func renderInvoicePDF(invoice models.Invoice) *pdf.Document {
+	doc := pdf.New("Invoice " + invoice.Number)
+	doc.AddPage()
+
+	y := 60.0
+	doc.Text(invoiceLeft, y, 20, true, "INVOICE")
+	doc.TextRight(invoiceRight, y, 12, true, invoice.Number)
+	y += invoiceLine
+	doc.TextRight(invoiceRight, y, 10, false, "Issued "+invoice.IssuedAt.Format("2006-01-02"))
+	y += invoiceLine
+	doc.TextRight(invoiceRight, y, 10, false, fmt.Sprintf("Order #%d", invoice.OrderID))
+	if invoice.Status == models.InvoiceStatusVoid {
+		y += invoiceLine
+		doc.TextRight(invoiceRight, y, 12, true, "VOID")
+	}
+
+	y += 2 * invoiceLine
+	doc.Text(invoiceLeft, y, 10, true, "Supplier")
+	doc.Text(320, y, 10, true, "Bill to")
+	supplier := []string{invoice.SupplierName, invoice.SupplierAddress}
+	if invoice.SupplierLicense != "" {
+		supplier = append(supplier, "License: "+invoice.SupplierLicense)
+	}
+	consumer := []string{invoice.ConsumerName, invoice.ConsumerEmail, invoice.ConsumerPhone}
+	for i := 0; i < len(supplier) || i < len(consumer); i++ {
+		y += 14
+		if i < len(supplier) {
+			doc.Text(invoiceLeft, y, 10, false, supplier[i])
+		}
+		if i < len(consumer) {
+			doc.Text(320, y, 10, false, consumer[i])
+		}
+	}
+
+	header := func() {
+		y += 2 * invoiceLine
+		doc.Text(invoiceLeft, y, 9, true, "Description")
+		doc.Text(300, y, 9, true, "SKU")
+		doc.TextRight(410, y, 9, true, "Qty")
+		doc.TextRight(480, y, 9, true, "Unit price")
+		doc.TextRight(invoiceRight, y, 9, true, "Amount")
+		y += 6
+		doc.Line(invoiceLeft, y, invoiceRight, y)
+	}
+	header()
+
+	for _, line := range invoice.Lines {
+		if y+invoiceLine > invoiceBottom {
+			doc.AddPage()
+			y = 40
+			header()
+		}
+		y += invoiceLine
+		quantity := strconv.Itoa(line.Quantity)
+		if line.Unit != "" {
+			quantity += " " + line.Unit
+		}
+		doc.Text(invoiceLeft, y, 9, false, truncate(line.Description, 48))
+		doc.Text(300, y, 9, false, truncate(line.SKU, 16))
+		doc.TextRight(410, y, 9, false, quantity)
+		doc.TextRight(480, y, 9, false, formatAmount(line.UnitPrice))
+		doc.TextRight(invoiceRight, y, 9, false, formatAmount(line.Total))
+	}
+
+	if y+(4+float64(len(invoice.Taxes)))*invoiceLine > invoiceBottom {
+		doc.AddPage()
+		y = 40
+	}
+	y += 8
+	doc.Line(invoiceLeft, y, invoiceRight, y)
+
+	total := func(label, amount string, bold bool) {
+		y += invoiceLine
+		doc.TextRight(480, y, 10, bold, label)
+		doc.TextRight(invoiceRight, y, 10, bold, amount)
+	}
+	total("Subtotal", formatAmount(invoice.Subtotal), false)
+	for _, tax := range invoice.Taxes {
+		total(fmt.Sprintf("%s on %s", tax.Name, formatAmount(tax.Base)), formatAmount(tax.Amount), false)
+	}
+	total("Total "+invoice.Currency, formatAmount(invoice.Total), true)
+	if len(invoice.Taxes) > 0 {
+		y += 2 * invoiceLine
+		doc.Text(invoiceLeft, y, 8, false, "Prices include VAT.")
+	}
+
+	return doc
+}
+
+// formatAmount renders an amount with two decimals and thousands separators.
+func formatAmount(amount money.Amount) string {
+	s := amount.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	whole, fraction := s[:len(s)-3], s[len(s)-3:]
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return sign + grouped.String() + fraction
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
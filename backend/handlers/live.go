@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"csci361/models"
+	ws "csci361/websocket"
+
+	"gorm.io/gorm"
+)
+
+// LivePublisher pushes events to the WebSocket connections subscribed to a
+// chat, of a user, or of a supplier's staff, and closes a user's or a
+// session's connections once they may no longer receive them.
+type LivePublisher interface {
+	PublishToChat(chatID uint, event ws.Event)
+	PublishToUser(userID uint, event ws.Event)
+	PublishToSupplier(supplierID uint, event ws.Event)
+	DisconnectUser(userID uint)
+	DisconnectSession(sessionID string)
+}
+
+// saveNotifications stores notifications and pushes each to its user.
+func saveNotifications(db *gorm.DB, live LivePublisher, notifications ...models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := db.Create(&notifications).Error; err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		live.PublishToUser(notification.UserID, ws.Event{Event: ws.EventNotification, Data: notification})
+	}
+	return nil
+}
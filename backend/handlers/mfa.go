@@ -0,0 +1,525 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"csci361/models"
+	"csci361/totp"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaIssuer       = "SCP Platform"
+	mfaChallengeTTL = 5 * time.Minute
+
+	// maxMFAAttempts is how many wrong codes a login challenge accepts before it is discarded.
+	maxMFAAttempts = 5
+	// maxMFAFailuresPerHour is how many wrong codes a user can enter across
+	// all their login challenges before MFA login is locked for the hour.
+	maxMFAFailuresPerHour = 10
+	recoveryCodeCount     = 10
+)
+
+var (
+	errInvalidMFACode     = errors.New("invalid authentication code")
+	errTooManyMFAFailures = errors.New("too many failed authentication codes")
+)
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// VerifyMFA completes a two-step login
+// @Summary Verify MFA challenge
+// @Description Exchange the MFA token returned by login and a TOTP or recovery code for a token pair
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body VerifyMFARequest true "MFA token and code"
+// @Success 200 {object} AuthResponse
+// @Failure 401 {object} map[string]string
+// @Router /auth/mfa/verify [post]
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req VerifyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either a code or a recovery code"})
+		return
+	}
+
+	var challenge models.UserToken
+	if err := h.db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+		hashToken(req.MFAToken), models.TokenPurposeMFAChallenge, time.Now()).
+		First(&challenge).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "MFA challenge is invalid or has expired"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ? AND is_active = ?", challenge.UserID, true).First(&user).Error; err != nil || user.MFAEnabledAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "MFA challenge is invalid or has expired"})
+		return
+	}
+
+	if err := checkMFAFailures(h.db, user.ID); err != nil {
+		if err == errTooManyMFAFailures {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		}
+		return
+	}
+
+	// Count the attempt before checking the code so that parallel guesses
+	// cannot get past the limits; a correct code takes it back
+	result := h.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL AND attempts < ?", challenge.ID, maxMFAAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "MFA challenge is invalid or has expired"})
+		return
+	}
+
+	var err error
+	if req.RecoveryCode != "" {
+		err = useRecoveryCode(h.db, user.ID, req.RecoveryCode)
+	} else {
+		err = checkTOTP(h.db, user, req.Code)
+	}
+
+	if err == errInvalidMFACode {
+		// Too many wrong guesses burn the challenge; the user has to log in again
+		h.db.Model(&models.UserToken{}).
+			Where("id = ? AND attempts >= ? AND used_at IS NULL", challenge.ID, maxMFAAttempts).
+			Update("used_at", time.Now())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	result = h.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Updates(map[string]interface{}{
+			"used_at":  time.Now(),
+			"attempts": gorm.Expr("attempts - 1"),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "MFA challenge is invalid or has expired"})
+		return
+	}
+
+	token, refreshToken, expiresIn, err := h.startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+
+	user.Password = ""
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         user,
+		ExpiresIn:    expiresIn,
+	})
+}
+
+// SetupMFA starts TOTP enrollment
+// @Summary Set up MFA
+// @Description Generate a new TOTP secret and provisioning URI. MFA is enabled only after the first code is confirmed.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/mfa/setup [post]
+func (h *AuthHandler) SetupMFA(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.MFAEnabledAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := h.db.Model(&user).Updates(map[string]interface{}{
+		"mfa_secret":    secret,
+		"mfa_last_step": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(mfaIssuer, user.Email, secret),
+	})
+}
+
+// EnableMFA confirms TOTP enrollment
+// @Summary Enable MFA
+// @Description Confirm enrollment with a code from the authenticator app and receive recovery codes
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Authenticator code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /auth/mfa/enable [post]
+func (h *AuthHandler) EnableMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.MFAEnabledAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.MFASecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment first"})
+		return
+	}
+
+	var codes []string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkTOTP(tx, user, req.Code); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Update("mfa_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+
+	if err == errInvalidMFACode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns off TOTP for the current user
+// @Summary Disable MFA
+// @Description Disable two-factor authentication. Requires the password and a current code.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body DisableMFARequest true "Password and authenticator code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /auth/mfa/disable [post]
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	var req DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.MFAEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if supplierRequiresMFA(h.db, user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your organization requires two-factor authentication"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkTOTP(tx, user, req.Code); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"mfa_secret":     "",
+			"mfa_enabled_at": nil,
+			"mfa_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error
+	})
+
+	if err == errInvalidMFACode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+// @Summary Regenerate recovery codes
+// @Description Invalidate all recovery codes and issue a new set. Requires a current code.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Authenticator code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /auth/mfa/recovery-codes [post]
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.MFAEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	var codes []string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkTOTP(tx, user, req.Code); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+
+	if err == errInvalidMFACode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Helper functions
+
+// startMFAChallenge issues the short-lived token a user exchanges for a
+// session once they provide a second factor, unless the user is locked out
+// after too many wrong codes.
+func (h *AuthHandler) startMFAChallenge(c *gin.Context, user models.User) {
+	if err := checkMFAFailures(h.db, user.ID); err != nil {
+		if err == errTooManyMFAFailures {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA challenge"})
+		}
+		return
+	}
+
+	token, err := createUserToken(h.db, user.ID, models.TokenPurposeMFAChallenge, mfaChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_in":   int64(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// checkMFAFailures returns errTooManyMFAFailures once the user has entered
+// maxMFAFailuresPerHour wrong codes against login challenges started in the
+// last hour, so logging in again does not reset the count.
+func checkMFAFailures(db *gorm.DB, userID uint) error {
+	var failures int64
+	if err := db.Model(&models.UserToken{}).
+		Select("COALESCE(SUM(attempts), 0)").
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, models.TokenPurposeMFAChallenge, time.Now().Add(-time.Hour)).
+		Scan(&failures).Error; err != nil {
+		return err
+	}
+	if failures >= maxMFAFailuresPerHour {
+		return errTooManyMFAFailures
+	}
+	return nil
+}
+
+// checkTOTP validates a code against the user's secret and records its time
+// step, so the same code cannot be accepted twice.
+func checkTOTP(db *gorm.DB, user models.User, code string) error {
+	if user.MFASecret == "" {
+		return errInvalidMFACode
+	}
+
+	step, ok := totp.Validate(user.MFASecret, code, time.Now())
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	result := db.Model(&models.User{}).
+		Where("id = ? AND mfa_last_step < ?", user.ID, step).
+		Update("mfa_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidMFACode
+	}
+
+	return nil
+}
+
+// useRecoveryCode consumes one of the user's unused recovery codes.
+func useRecoveryCode(db *gorm.DB, userID uint, code string) error {
+	result := db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidMFACode
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and returns a fresh set.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		recoveryCode := models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}
+		if err := tx.Create(&recoveryCode).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCode returns a random code formatted as xxxxx-xxxxx.
+func newRecoveryCode() (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, len(buf))
+	for i, b := range buf {
+		code[i] = alphabet[b&31]
+	}
+	return string(code[:5]) + "-" + string(code[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// supplierRequiresMFA reports whether the user's supplier requires staff to
+// use two-factor authentication.
+func supplierRequiresMFA(db *gorm.DB, user models.User) bool {
+	if user.SupplierID == nil {
+		return false
+	}
+
+	var count int64
+	db.Model(&models.Supplier{}).Where("id = ? AND require_mfa = ?", *user.SupplierID, true).Count(&count)
+	return count > 0
+}
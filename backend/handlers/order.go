@@ -1,42 +1,115 @@
 package handlers
 
 import (
+	"csci361/events"
 	"csci361/models"
+	"csci361/money"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderHandler struct {
-	db *gorm.DB
+	db  *gorm.DB
+	bus *events.Bus
 }
 
-func NewOrderHandler(db *gorm.DB) *OrderHandler {
-	return &OrderHandler{db: db}
+func NewOrderHandler(db *gorm.DB, bus *events.Bus) *OrderHandler {
+	return &OrderHandler{db: db, bus: bus}
+}
+
+// OrderLineRequest is one product and quantity of an order request.
+type OrderLineRequest struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"required,min=1"`
 }
 
 type CreateOrderRequest struct {
-	SupplierID uint `json:"supplier_id" binding:"required"`
-	Items      []struct {
-		ProductID uint    `json:"product_id" binding:"required"`
-		Quantity  int     `json:"quantity" binding:"required,min=1"`
-		UnitPrice float64 `json:"unit_price" binding:"required"`
-	} `json:"items" binding:"required,min=1"`
-	Notes string `json:"notes"`
+	SupplierID   uint               `json:"supplier_id" binding:"required"`
+	Items        []OrderLineRequest `json:"items" binding:"required,min=1,dive"`
+	Notes        string             `json:"notes"`
+	DeliveryDate string             `json:"delivery_date"` // YYYY-MM-DD; the next open delivery day if empty
+}
+
+// UpdateOrderRequest replaces the lines of a pending order.
+type UpdateOrderRequest struct {
+	Items  []OrderLineRequest `json:"items" binding:"required,min=1,dive"`
+	Notes  *string            `json:"notes"`
+	Reason string             `json:"reason"`
+}
+
+// Order line error codes returned when an order cannot be placed.
+const (
+	lineProductNotFound = "product_not_found"
+	lineWrongSupplier   = "wrong_supplier"
+	lineInactive        = "product_inactive"
+	lineOutOfStock      = "out_of_stock"
+	lineDuplicate       = "duplicate_product"
+	lineCurrency        = "currency_mismatch"
+	lineBelowMinimum    = "below_min_quantity"
+	lineNotMultiple     = "not_pack_multiple"
+	lineAboveMaximum    = "above_max_quantity"
+)
+
+// OrderLineError explains why one item of an order request was rejected.
+type OrderLineError struct {
+	Index     int    `json:"index"`
+	ProductID uint   `json:"product_id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Available *int   `json:"available,omitempty"`
+	// The product's ordering constraint that was broken
+	MinQuantity *int `json:"min_quantity,omitempty"`
+	Multiple    *int `json:"order_multiple,omitempty"`
+	MaxQuantity *int `json:"max_quantity,omitempty"`
 }
 
+// Delivery date error codes.
+const (
+	deliveryInvalid    = "invalid_delivery_date"
+	deliveryNotServed  = "not_delivery_day"
+	deliveryCutoffPast = "delivery_cutoff_passed"
+)
+
+// orderRejection explains why an order cannot be placed as requested: the
+// lines that cannot be ordered, a total below the supplier's minimum, or a
+// delivery date that is not open. It is sent to the client with a 422.
+type orderRejection struct {
+	Message          string               `json:"error"`
+	Code             string               `json:"code,omitempty"`
+	Lines            []OrderLineError     `json:"lines,omitempty"`
+	MinOrderValue    *money.Amount        `json:"min_order_value,omitempty"`
+	MinOrderCurrency string               `json:"min_order_currency,omitempty"`
+	Total            *money.Amount        `json:"total,omitempty"`
+	Currency         string               `json:"currency,omitempty"`
+	OrderBy          *time.Time           `json:"order_by,omitempty"`
+	NextDelivery     *models.DeliverySlot `json:"next_delivery,omitempty"`
+}
+
+var (
+	errOrderLinesRejected = errors.New("order lines rejected")
+	errBelowMinimumOrder  = errors.New("order total below minimum order value")
+	errNoMinimumOrderRate = errors.New("no exchange rate for the minimum order value")
+	errNotLinked          = errors.New("consumer is not linked to the supplier")
+)
+
 // CreateOrder creates a new order
 // @Summary Create order
-// @Description Create a new order (consumer only)
+// @Description Create a new order (consumer only). Prices come from the catalog and stock is reserved.
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param request body CreateOrderRequest true "Order details"
 // @Success 201 {object} models.Order
+// @Failure 422 {object} map[string]interface{}
 // @Router /consumer/orders [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -58,46 +131,23 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Verify consumer is linked to supplier
-	var link models.ConsumerSupplierLink
-	if err := h.db.Where("consumer_id = ? AND supplier_id = ? AND status = ?",
-		consumer.ID, req.SupplierID, "approved").First(&link).Error; err != nil {
+	actorID := userID.(uint)
+	order, rejection, err := placeOrder(h.db, h.bus, consumer, req, &actorID, models.RoleConsumer, time.Now())
+	switch err {
+	case nil:
+	case errNotLinked:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Not linked to this supplier"})
 		return
-	}
-
-	// Calculate order total
-	var total float64
-	for _, item := range req.Items {
-		total += item.UnitPrice * float64(item.Quantity)
-	}
-
-	// Create order
-	order := models.Order{
-		ConsumerID: consumer.ID,
-		SupplierID: req.SupplierID,
-		Status:     "pending",
-		Total:      total,
-		Currency:   "KZT",
-		Notes:      req.Notes,
-		OrderDate:  time.Now(),
-	}
-
-	if err := h.db.Create(&order).Error; err != nil {
+	case gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
-
-	// Create order items
-	for _, item := range req.Items {
-		orderItem := models.OrderItem{
-			OrderID:   order.ID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			UnitPrice: item.UnitPrice,
-			Total:     item.UnitPrice * float64(item.Quantity),
-		}
-		h.db.Create(&orderItem)
+	if rejection != nil {
+		c.JSON(http.StatusUnprocessableEntity, rejection)
+		return
 	}
 
 	// Load order with relationships
@@ -162,15 +212,11 @@ func (h *OrderHandler) GetConsumerOrders(c *gin.Context) {
 // @Success 200 {array} models.Order
 // @Router /sales/orders [get]
 func (h *OrderHandler) GetAllOrders(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	query := h.db.Where("supplier_id = ?", supplierID)
 
 	// Apply status filter
@@ -209,8 +255,10 @@ func (h *OrderHandler) GetSupplierOrders(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	offset := (page - 1) * limit
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
 
 	var orders []models.Order
 	var total int64
@@ -242,16 +290,22 @@ func (h *OrderHandler) GetSupplierOrders(c *gin.Context) {
 
 // UpdateOrderStatus updates order status
 // @Summary Update order status
-// @Description Update order status (sales/admin only)
+// @Description Confirm or cancel an order (supplier staff). Allowed moves: pending -> confirmed|cancelled, confirmed -> cancelled. Shipping statuses are derived from shipments.
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Order ID"
-// @Param request body map[string]string true "New status"
+// @Param request body map[string]string true "New status and optional reason"
 // @Success 200 {object} models.Order
+// @Failure 409 {object} map[string]interface{}
 // @Router /sales/orders/{id}/status [put]
 func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
@@ -259,7 +313,8 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status" binding:"required,oneof=pending confirmed shipped delivered cancelled"`
+		Status string `json:"status" binding:"required,oneof=pending confirmed partially_shipped shipped delivered cancelled"`
+		Reason string `json:"reason"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -267,16 +322,18 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
+	if models.IsShipmentStatus(req.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Shipping statuses follow from the order's shipments; create a shipment or record its delivery instead"})
+		return
+	}
+
 	var order models.Order
-	if err := h.db.First(&order, uint(orderID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&order, uint(orderID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
-	order.Status = req.Status
-
-	if err := h.db.Save(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+	if !h.changeOrderStatus(c, &order, req.Status, req.Reason) {
 		return
 	}
 
@@ -289,3 +346,727 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 
 	c.JSON(http.StatusOK, order)
 }
+
+// UpdateOrder changes the lines of a pending order
+// @Summary Update pending order
+// @Description Replace the items of a pending order (consumer only). Totals are recomputed and stock reservations adjusted; lines already in the order keep their price.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Param request body UpdateOrderRequest true "New order lines"
+// @Success 200 {object} models.Order
+// @Failure 409 {object} map[string]interface{}
+// @Failure 422 {object} map[string]interface{}
+// @Router /consumer/orders/{id} [put]
+func (h *OrderHandler) UpdateOrder(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req UpdateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, ok := callerOrderScope(h.db, c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Scopes(scope).First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var lineErrors []OrderLineError
+	var summary string
+	var supplier models.Supplier
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the order so it cannot be confirmed halfway through the edit.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusPending {
+			return errOrderNotEditable
+		}
+
+		var current []models.OrderItem
+		if err := tx.Where("order_id = ?", order.ID).Preload("Product").Find(&current).Error; err != nil {
+			return err
+		}
+
+		book, err := loadPriceBook(tx, order.SupplierID, order.ConsumerID, time.Now())
+		if err != nil {
+			return err
+		}
+
+		items, rejected, err := reserveOrderLines(tx, &order, req.Items, current, book)
+		if err != nil {
+			return err
+		}
+		if len(rejected) > 0 {
+			lineErrors = rejected
+			return errOrderLinesRejected
+		}
+
+		if err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderItem{}).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].OrderID = order.ID
+		}
+		if err := tx.Create(&items).Error; err != nil {
+			return err
+		}
+
+		oldTotal := order.Total
+		order.Total = orderTotal(items)
+		if err := tx.First(&supplier, order.SupplierID).Error; err != nil {
+			return err
+		}
+		if err := checkMinimumOrder(tx, supplier, order, time.Now()); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"total": order.Total}
+		if req.Notes != nil {
+			updates["notes"] = *req.Notes
+		}
+		if err := tx.Model(&order).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		summary = describeOrderChanges(tx, current, items, oldTotal, order.Total)
+		actorID := userID.(uint)
+		return tx.Create(&models.OrderStatusHistory{
+			OrderID:    order.ID,
+			FromStatus: order.Status,
+			ToStatus:   order.Status,
+			ActorID:    &actorID,
+			ActorRole:  models.RoleConsumer,
+			Reason:     req.Reason,
+			Details:    summary,
+		}).Error
+	})
+
+	switch err {
+	case nil:
+	case errOrderNotEditable:
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending orders can be changed", "status": order.Status})
+		return
+	case errOrderLinesRejected:
+		c.JSON(http.StatusUnprocessableEntity, linesRejected(lineErrors))
+		return
+	case errBelowMinimumOrder, errNoMinimumOrderRate:
+		c.JSON(http.StatusUnprocessableEntity, belowMinimumOrder(supplier, order, err))
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+
+	actorID := userID.(uint)
+	h.bus.Publish(events.Event{
+		Type:       events.OrderUpdated,
+		SupplierID: order.SupplierID,
+		ConsumerID: order.ConsumerID,
+		OrderID:    order.ID,
+		ActorID:    &actorID,
+		ActorRole:  models.RoleConsumer,
+		ToStatus:   order.Status,
+		Reason:     summary,
+		Amount:     order.Total,
+		Currency:   order.Currency,
+	})
+
+	h.db.Preload("OrderItems").Preload("OrderItems.Product").
+		Preload("Supplier").First(&order, order.ID)
+
+	c.JSON(http.StatusOK, order)
+}
+
+// CancelOrder cancels a pending order
+// @Summary Cancel order
+// @Description Cancel a pending order (consumer only). Reserved stock is released.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Param request body map[string]string true "Cancellation reason"
+// @Success 200 {object} models.Order
+// @Failure 409 {object} map[string]interface{}
+// @Router /consumer/orders/{id}/cancel [post]
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, ok := callerOrderScope(h.db, c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Scopes(scope).First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if !h.changeOrderStatus(c, &order, models.OrderStatusCancelled, req.Reason) {
+		return
+	}
+
+	h.db.Preload("OrderItems").Preload("OrderItems.Product").
+		Preload("Supplier").First(&order, order.ID)
+
+	c.JSON(http.StatusOK, order)
+}
+
+// GetOrderHistory returns the status history of an order
+// @Summary Get order status history
+// @Description List every status change of an order, oldest first
+// @Tags orders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Success 200 {array} models.OrderStatusHistory
+// @Router /sales/orders/{id}/history [get]
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	scope, ok := callerOrderScope(h.db, c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Scopes(scope).First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var history []models.OrderStatusHistory
+	if err := h.db.Where("order_id = ?", order.ID).
+		Preload("Actor").
+		Order("created_at ASC, id ASC").
+		Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// Helper functions
+
+// callerOrderScope restricts order queries to the caller: a consumer sees
+// their own orders, supplier staff see their supplier's orders.
+func callerOrderScope(db *gorm.DB, c *gin.Context) (func(*gorm.DB) *gorm.DB, bool) {
+	role, _ := c.Get("role")
+	if role == models.RoleConsumer {
+		userID, _ := c.Get("user_id")
+		var consumer models.Consumer
+		if err := db.Where("user_id = ?", userID).First(&consumer).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+			return nil, false
+		}
+		return ownedByConsumer(consumer.ID), true
+	}
+
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return nil, false
+	}
+	return ownedBySupplier(supplierID), true
+}
+
+// changeOrderStatus applies a status transition for the caller and publishes
+// the resulting event. On failure it writes the error response and returns
+// false.
+func (h *OrderHandler) changeOrderStatus(c *gin.Context, order *models.Order, to, reason string) bool {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var evt events.Event
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		evt, err = transitionOrder(tx, order, to, userID.(uint), role.(string), reason)
+		return err
+	})
+
+	switch err {
+	case nil:
+	case models.ErrInvalidOrderTransition, errOrderStatusChanged:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Cannot change order from " + order.Status + " to " + to,
+			"status":  order.Status,
+			"allowed": order.NextStatuses(role.(string)),
+		})
+		return false
+	case models.ErrOrderTransitionForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to change this order to " + to})
+		return false
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		return false
+	}
+
+	h.bus.Publish(evt)
+	return true
+}
+
+var (
+	errOrderStatusChanged = errors.New("order status changed concurrently")
+	errOrderNotEditable   = errors.New("order is no longer pending")
+)
+
+// transitionOrder moves order to status `to` inside tx, writes the history
+// entry and puts the stock of cancelled orders back. The returned event must
+// be published after the transaction commits.
+func transitionOrder(tx *gorm.DB, order *models.Order, to string, actorID uint, role, reason string) (events.Event, error) {
+	if err := order.CanTransition(to, role); err != nil {
+		return events.Event{}, err
+	}
+
+	from := order.Status
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, from).
+		Update("status", to)
+	if result.Error != nil {
+		return events.Event{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Someone else moved the order first; report its current status.
+		tx.Select("status").First(order, order.ID)
+		return events.Event{}, errOrderStatusChanged
+	}
+
+	if to == models.OrderStatusCancelled {
+		var items []models.OrderItem
+		if err := tx.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+			return events.Event{}, err
+		}
+		for _, item := range items {
+			if err := tx.Model(&models.Product{}).
+				Where("id = ?", item.ProductID).
+				Update("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+				return events.Event{}, err
+			}
+		}
+	}
+
+	if err := tx.Create(&models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    &actorID,
+		ActorRole:  role,
+		Reason:     reason,
+	}).Error; err != nil {
+		return events.Event{}, err
+	}
+
+	// Confirmed orders are invoiced; delivered ones too if they were
+	// confirmed before invoicing existed.
+	switch to {
+	case models.OrderStatusConfirmed, models.OrderStatusDelivered:
+		if _, err := issueInvoice(tx, order.ID); err != nil {
+			return events.Event{}, err
+		}
+	case models.OrderStatusCancelled:
+		if err := voidInvoice(tx, order.ID); err != nil {
+			return events.Event{}, err
+		}
+	}
+
+	order.Status = to
+	return events.Event{
+		Type:       events.OrderStatusChanged,
+		SupplierID: order.SupplierID,
+		ConsumerID: order.ConsumerID,
+		OrderID:    order.ID,
+		ActorID:    &actorID,
+		ActorRole:  role,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		Amount:     order.Total,
+		Currency:   order.Currency,
+	}, nil
+}
+
+// reserveOrderLines prices the requested lines of order from the consumer's
+// price book and reserves stock for them. All lines must be priced in the
+// order's currency; a new order, with no currency yet, takes the currency of
+// its first line.
+// current holds the lines the order already has (nil for a new order): they
+// are repriced but never above their earlier unit price, only the difference
+// in quantity is reserved, and stock of dropped lines is released.
+// Products are locked in ID order so concurrent orders cannot deadlock or
+// oversell the same product. Lines that cannot be ordered are returned as
+// OrderLineErrors and nothing is changed.
+func reserveOrderLines(tx *gorm.DB, order *models.Order, lines []OrderLineRequest, current []models.OrderItem, book models.PriceBook) ([]models.OrderItem, []OrderLineError, error) {
+	reserved := map[uint]int{}
+	unitPrices := map[uint]money.Amount{}
+	for _, item := range current {
+		reserved[item.ProductID] += item.Quantity
+		unitPrices[item.ProductID] = item.UnitPrice
+	}
+
+	productIDs := make([]uint, 0, len(lines)+len(reserved))
+	for _, line := range lines {
+		productIDs = append(productIDs, line.ProductID)
+	}
+	for productID := range reserved {
+		productIDs = append(productIDs, productID)
+	}
+
+	var products []models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", productIDs).
+		Order("id").
+		Find(&products).Error; err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[uint]*models.Product, len(products))
+	for i := range products {
+		byID[products[i].ID] = &products[i]
+	}
+
+	var items []models.OrderItem
+	var lineErrors []OrderLineError
+	delta := map[uint]int{}
+	seen := map[uint]bool{}
+	for i, line := range lines {
+		product := byID[line.ProductID]
+		extra := line.Quantity - reserved[line.ProductID]
+		lineErr := OrderLineError{Index: i, ProductID: line.ProductID}
+
+		switch {
+		case seen[line.ProductID]:
+			lineErr.Code, lineErr.Message = lineDuplicate, "Product appears more than once in the order"
+		case product == nil:
+			lineErr.Code, lineErr.Message = lineProductNotFound, "Product not found"
+		case product.SupplierID != order.SupplierID:
+			lineErr.Code, lineErr.Message = lineWrongSupplier, "Product belongs to another supplier"
+		case order.Currency != "" && product.Currency != order.Currency:
+			lineErr.Code, lineErr.Message = lineCurrency, fmt.Sprintf("Product is priced in %s, the order in %s", product.Currency, order.Currency)
+		case extra > 0 && !product.IsActive:
+			lineErr.Code, lineErr.Message = lineInactive, "Product is not available"
+		case line.Quantity < product.MinOrderQuantity:
+			lineErr.Code, lineErr.MinQuantity = lineBelowMinimum, &product.MinOrderQuantity
+			lineErr.Message = fmt.Sprintf("At least %d must be ordered", product.MinOrderQuantity)
+		case product.OrderMultiple > 1 && line.Quantity%product.OrderMultiple != 0:
+			lineErr.Code, lineErr.Multiple = lineNotMultiple, &product.OrderMultiple
+			lineErr.Message = fmt.Sprintf("Sold in packs of %d", product.OrderMultiple)
+		case product.MaxOrderQuantity > 0 && line.Quantity > product.MaxOrderQuantity:
+			lineErr.Code, lineErr.MaxQuantity = lineAboveMaximum, &product.MaxOrderQuantity
+			lineErr.Message = fmt.Sprintf("At most %d may be ordered", product.MaxOrderQuantity)
+		case extra > product.Stock:
+			available := product.Stock + reserved[line.ProductID]
+			lineErr.Code, lineErr.Message, lineErr.Available = lineOutOfStock, "Not enough stock", &available
+		}
+		seen[line.ProductID] = true
+
+		if lineErr.Code != "" {
+			lineErrors = append(lineErrors, lineErr)
+			continue
+		}
+		order.Currency = product.Currency
+
+		unitPrice := book.Quote(*product, line.Quantity).UnitPrice
+		if earlier, ok := unitPrices[product.ID]; ok && earlier < unitPrice {
+			unitPrice = earlier
+		}
+		items = append(items, models.OrderItem{
+			ProductID: product.ID,
+			Quantity:  line.Quantity,
+			UnitPrice: unitPrice,
+			Total:     unitPrice.Mul(line.Quantity),
+		})
+		delta[product.ID] = extra
+	}
+
+	if len(lineErrors) > 0 {
+		return nil, lineErrors, nil
+	}
+
+	for productID, quantity := range reserved {
+		if !seen[productID] {
+			delta[productID] = -quantity
+		}
+	}
+
+	for productID, quantity := range delta {
+		if quantity == 0 {
+			continue
+		}
+		if err := tx.Model(&models.Product{}).
+			Where("id = ?", productID).
+			Update("stock", gorm.Expr("stock - ?", quantity)).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return items, nil, nil
+}
+
+// placeOrder creates an order for consumer as requested: the consumer must be
+// linked to the supplier, prices come from the catalog and stock is reserved,
+// all in one transaction. Consumers and standing orders both place orders
+// this way. A rejection explains why the order cannot be placed; nothing is
+// saved then.
+func placeOrder(db *gorm.DB, bus *events.Bus, consumer models.Consumer, req CreateOrderRequest, actorID *uint, actorRole string, now time.Time) (models.Order, *orderRejection, error) {
+	order := models.Order{
+		ConsumerID: consumer.ID,
+		SupplierID: req.SupplierID,
+		Status:     models.OrderStatusPending,
+		Notes:      req.Notes,
+		OrderDate:  now,
+	}
+
+	// Verify consumer is linked to supplier
+	var link models.ConsumerSupplierLink
+	if err := db.Where("consumer_id = ? AND supplier_id = ? AND status = ?",
+		consumer.ID, req.SupplierID, "approved").First(&link).Error; err != nil {
+		return order, nil, errNotLinked
+	}
+
+	var supplier models.Supplier
+	if err := db.First(&supplier, req.SupplierID).Error; err != nil {
+		return order, nil, err
+	}
+
+	deliveryDate, rejection := chooseDeliveryDate(supplier, req.DeliveryDate, now)
+	if rejection != nil {
+		return order, rejection, nil
+	}
+	order.DeliveryDate = deliveryDate
+
+	var lineErrors []OrderLineError
+	err := db.Transaction(func(tx *gorm.DB) error {
+		book, err := loadPriceBook(tx, req.SupplierID, consumer.ID, now)
+		if err != nil {
+			return err
+		}
+
+		items, rejected, err := reserveOrderLines(tx, &order, req.Items, nil, book)
+		if err != nil {
+			return err
+		}
+		if len(rejected) > 0 {
+			lineErrors = rejected
+			return errOrderLinesRejected
+		}
+
+		order.OrderItems = items
+		order.Total = orderTotal(items)
+		if err := checkMinimumOrder(tx, supplier, order, now); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OrderStatusHistory{
+			OrderID:   order.ID,
+			ToStatus:  order.Status,
+			ActorID:   actorID,
+			ActorRole: actorRole,
+		}).Error
+	})
+
+	switch err {
+	case nil:
+	case errOrderLinesRejected:
+		return order, linesRejected(lineErrors), nil
+	case errBelowMinimumOrder, errNoMinimumOrderRate:
+		return order, belowMinimumOrder(supplier, order, err), nil
+	default:
+		return order, nil, err
+	}
+
+	bus.Publish(events.Event{
+		Type:       events.OrderCreated,
+		SupplierID: order.SupplierID,
+		ConsumerID: order.ConsumerID,
+		OrderID:    order.ID,
+		ActorID:    actorID,
+		ActorRole:  actorRole,
+		ToStatus:   order.Status,
+		Amount:     order.Total,
+		Currency:   order.Currency,
+	})
+	return order, nil, nil
+}
+
+// chooseDeliveryDate checks the delivery date requested for an order placed
+// at now. Suppliers with delivery days only deliver on them, and only while
+// orders for the day are open; without a requested date the next open
+// delivery day is taken.
+func chooseDeliveryDate(supplier models.Supplier, requested string, now time.Time) (*time.Time, *orderRejection) {
+	var next *models.DeliverySlot
+	if slot, ok := supplier.UpcomingDelivery(now); ok {
+		next = &slot
+	}
+
+	if requested == "" {
+		if next == nil {
+			return nil, nil
+		}
+		date, _ := time.Parse("2006-01-02", next.Date)
+		return &date, nil
+	}
+
+	date, err := time.Parse("2006-01-02", requested)
+	if err != nil {
+		return nil, &orderRejection{Message: "delivery_date must be YYYY-MM-DD", Code: deliveryInvalid, NextDelivery: next}
+	}
+	local := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, supplier.Location())
+
+	if !supplier.SchedulesDeliveries() {
+		if !now.Before(local.AddDate(0, 0, 1)) {
+			return nil, &orderRejection{Message: "delivery_date is in the past", Code: deliveryInvalid}
+		}
+		return &date, nil
+	}
+	if !supplier.DeliversOn(local) {
+		return nil, &orderRejection{
+			Message:      "The supplier does not deliver on " + local.Weekday().String(),
+			Code:         deliveryNotServed,
+			NextDelivery: next,
+		}
+	}
+	if orderBy := supplier.OrderBy(local); !now.Before(orderBy) {
+		return nil, &orderRejection{
+			Message:      "Orders for this delivery date closed",
+			Code:         deliveryCutoffPast,
+			OrderBy:      &orderBy,
+			NextDelivery: next,
+		}
+	}
+	return &date, nil
+}
+
+func linesRejected(lines []OrderLineError) *orderRejection {
+	return &orderRejection{Message: "Some items cannot be ordered", Lines: lines}
+}
+
+// belowMinimumOrder explains an errBelowMinimumOrder or errNoMinimumOrderRate
+// from checkMinimumOrder.
+func belowMinimumOrder(supplier models.Supplier, order models.Order, err error) *orderRejection {
+	rejection := &orderRejection{
+		Message:          "Order total is below the supplier's minimum order value",
+		Code:             "below_min_order_value",
+		MinOrderValue:    &supplier.MinOrderValue,
+		MinOrderCurrency: supplier.MinOrderCurrency,
+		Total:            &order.Total,
+		Currency:         order.Currency,
+	}
+	if err == errNoMinimumOrderRate {
+		rejection.Message = fmt.Sprintf("No exchange rate from %s to %s to check the minimum order value", order.Currency, supplier.MinOrderCurrency)
+		rejection.Code = "min_order_value_unconvertible"
+	}
+	return rejection
+}
+
+// checkMinimumOrder returns errBelowMinimumOrder if the order total, converted
+// into the currency of the supplier's minimum at the rates in effect at now,
+// is below the minimum, or errNoMinimumOrderRate if there is no rate to
+// convert it with.
+func checkMinimumOrder(db *gorm.DB, supplier models.Supplier, order models.Order, now time.Time) error {
+	if supplier.MinOrderValue <= 0 {
+		return nil
+	}
+	currency := supplier.MinOrderCurrency
+	if currency == "" {
+		currency = money.KZT
+	}
+	total, ok := convertCurrency(db, order.Total, order.Currency, currency, now)
+	if !ok {
+		return errNoMinimumOrderRate
+	}
+	if total < supplier.MinOrderValue {
+		return errBelowMinimumOrder
+	}
+	return nil
+}
+
+func orderTotal(items []models.OrderItem) money.Amount {
+	var total money.Amount
+	for _, item := range items {
+		total += item.Total
+	}
+	return total
+}
+
+// describeOrderChanges summarises how the lines of an order changed, e.g.
+// "Potatoes 20 -> 25; Milk removed; total 5600.00 -> 6500.00".
+func describeOrderChanges(tx *gorm.DB, before, after []models.OrderItem, oldTotal, newTotal money.Amount) string {
+	oldQty := map[uint]int{}
+	names := map[uint]string{}
+	for _, item := range before {
+		oldQty[item.ProductID] += item.Quantity
+		names[item.ProductID] = item.Product.Name
+	}
+
+	var added []uint
+	for _, item := range after {
+		if _, ok := names[item.ProductID]; !ok {
+			added = append(added, item.ProductID)
+		}
+	}
+	if len(added) > 0 {
+		var products []models.Product
+		tx.Select("id", "name").Where("id IN ?", added).Find(&products)
+		for _, product := range products {
+			names[product.ID] = product.Name
+		}
+	}
+
+	var changes []string
+	newQty := map[uint]bool{}
+	for _, item := range after {
+		newQty[item.ProductID] = true
+		old, had := oldQty[item.ProductID]
+		switch {
+		case !had:
+			changes = append(changes, fmt.Sprintf("%s added (%d)", names[item.ProductID], item.Quantity))
+		case old != item.Quantity:
+			changes = append(changes, fmt.Sprintf("%s %d -> %d", names[item.ProductID], old, item.Quantity))
+		}
+	}
+	for _, item := range before {
+		if !newQty[item.ProductID] {
+			changes = append(changes, names[item.ProductID]+" removed")
+			newQty[item.ProductID] = true
+		}
+	}
+	changes = append(changes, fmt.Sprintf("total %s -> %s", oldTotal, newTotal))
+
+	return strings.Join(changes, "; ")
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"csci361/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errLastPlatformAdmin     = errors.New("cannot deactivate the last platform admin")
+	errPlatformAdminInactive = errors.New("platform admin is already deactivated")
+)
+
+type PlatformHandler struct {
+	db   *gorm.DB
+	live LivePublisher
+}
+
+func NewPlatformHandler(db *gorm.DB, live LivePublisher) *PlatformHandler {
+	return &PlatformHandler{db: db, live: live}
+}
+
+type CreatePlatformAdminRequest struct {
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required,min=8"`
+	FirstName string `json:"first_name" binding:"required"`
+	LastName  string `json:"last_name" binding:"required"`
+}
+
+// GetPlatformAdmins lists platform administrators
+// @Summary Get platform admins
+// @Description List all platform administrator accounts (platform admin only)
+// @Tags platform
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.User
+// @Router /platform/admins [get]
+func (h *PlatformHandler) GetPlatformAdmins(c *gin.Context) {
+	var admins []models.User
+	if err := h.db.Where("role = ?", models.RolePlatformAdmin).Order("created_at ASC").Find(&admins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch platform admins"})
+		return
+	}
+
+	c.JSON(http.StatusOK, admins)
+}
+
+// CreatePlatformAdmin adds another platform administrator
+// @Summary Create platform admin
+// @Description Create a new platform administrator account (platform admin only)
+// @Tags platform
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreatePlatformAdminRequest true "Platform admin details"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Router /platform/admins [post]
+func (h *PlatformHandler) CreatePlatformAdmin(c *gin.Context) {
+	var req CreatePlatformAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existingUser models.User
+	if err := h.db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User already exists"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	admin := models.User{
+		Email:     req.Email,
+		Password:  string(hashedPassword),
+		Role:      models.RolePlatformAdmin,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		IsActive:  true,
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&admin).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditPlatformAdminCreated, "user", admin.ID, admin.Email)
+	})
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create platform admin"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, admin)
+}
+
+// DeactivatePlatformAdmin deactivates a platform administrator
+// @Summary Deactivate platform admin
+// @Description Deactivate a platform administrator and sign them out. The last active admin cannot be removed.
+// @Tags platform
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /platform/admins/{id} [delete]
+func (h *PlatformHandler) DeactivatePlatformAdmin(c *gin.Context) {
+	adminID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if uint(adminID) == userID.(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot deactivate your own account"})
+		return
+	}
+
+	var admin models.User
+	if err := h.db.Where("role = ?", models.RolePlatformAdmin).First(&admin, uint(adminID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Platform admin not found"})
+		return
+	}
+
+	if !admin.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Platform admin is already deactivated"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock every active admin so concurrent deactivations run one after
+		// the other and each sees who the previous ones left active
+		var active []models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("role = ? AND is_active = ?", models.RolePlatformAdmin, true).
+			Order("id").Find(&active).Error; err != nil {
+			return err
+		}
+		stillActive := false
+		for _, other := range active {
+			if other.ID == admin.ID {
+				stillActive = true
+			}
+		}
+		if !stillActive {
+			return errPlatformAdminInactive
+		}
+		if len(active) == 1 {
+			return errLastPlatformAdmin
+		}
+
+		if err := tx.Model(&admin).Update("is_active", false).Error; err != nil {
+			return err
+		}
+
+		if err := revokeUserSessions(tx, admin.ID); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, c, models.AuditPlatformAdminDeactivated, "user", admin.ID, admin.Email)
+	})
+
+	if err == errLastPlatformAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot deactivate the last platform admin"})
+		return
+	}
+	if err == errPlatformAdminInactive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Platform admin is already deactivated"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate platform admin"})
+		return
+	}
+	h.live.DisconnectUser(admin.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Platform admin deactivated successfully"})
+}
+
+// GetAuditLogs returns the platform audit trail
+// @Summary Get audit logs
+// @Description Get audit log entries, newest first (platform admin only)
+// @Tags platform
+// @Produce json
+// @Security BearerAuth
+// @Param action query string false "Filter by action"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{}
+// @Router /platform/audit-logs [get]
+func (h *PlatformHandler) GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := h.db.Model(&models.AuditLog{})
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var logs []models.AuditLog
+	if err := query.Preload("Actor").
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"audit_logs": logs,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
@@ -0,0 +1,615 @@
+package handlers
+
+import (
+	"csci361/models"
+	"csci361/money"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PricingHandler struct {
+	db *gorm.DB
+}
+
+func NewPricingHandler(db *gorm.DB) *PricingHandler {
+	return &PricingHandler{db: db}
+}
+
+// PriceListItemRequest is the price of a product from MinQuantity units up.
+type PriceListItemRequest struct {
+	ProductID   uint          `json:"product_id" binding:"required"`
+	MinQuantity int           `json:"min_quantity" binding:"omitempty,min=1"`
+	Price       *money.Amount `json:"price" binding:"required,min=0"`
+}
+
+type PriceListRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	IsActive    *bool                  `json:"is_active"`
+	Items       []PriceListItemRequest `json:"items" binding:"dive"`
+}
+
+type DiscountRequest struct {
+	Name        string        `json:"name" binding:"required"`
+	Type        string        `json:"type" binding:"required,oneof=percent fixed"`
+	Value       float64       `json:"value" binding:"omitempty,gt=0,max=100"` // percent discounts
+	Amount      *money.Amount `json:"amount" binding:"omitempty,gt=0"`        // fixed discounts
+	Currency    string        `json:"currency"`                               // of Amount; defaults to the product's
+	ProductID   *uint         `json:"product_id"`
+	PriceListID *uint         `json:"price_list_id"`
+	MinQuantity int           `json:"min_quantity" binding:"omitempty,min=1"`
+	StartsAt    *time.Time    `json:"starts_at"`
+	EndsAt      *time.Time    `json:"ends_at"`
+	IsActive    *bool         `json:"is_active"`
+}
+
+var errPricingRule = errors.New("invalid pricing rule")
+
+// GetPriceLists returns the supplier's price lists
+// @Summary Get price lists
+// @Description List the supplier's price lists with their items (admin only)
+// @Tags pricing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PriceList
+// @Router /admin/price-lists [get]
+func (h *PricingHandler) GetPriceLists(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	var lists []models.PriceList
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("product_id, min_quantity") }).
+		Order("name").
+		Find(&lists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price lists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lists)
+}
+
+// CreatePriceList creates a price list
+// @Summary Create price list
+// @Description Create a price list with per-product prices and quantity breaks (admin only)
+// @Tags pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body PriceListRequest true "Price list"
+// @Success 201 {object} models.PriceList
+// @Failure 400 {object} map[string]string
+// @Router /admin/price-lists [post]
+func (h *PricingHandler) CreatePriceList(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	var req PriceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list := models.PriceList{SupplierID: supplierID, Name: req.Name, Description: req.Description, IsActive: true}
+	if req.IsActive != nil {
+		list.IsActive = *req.IsActive
+	}
+
+	var message string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		items, msg := h.priceListItems(tx, supplierID, req.Items)
+		if msg != "" {
+			message = msg
+			return errPricingRule
+		}
+		list.Items = items
+		if err := tx.Create(&list).Error; err != nil {
+			return err
+		}
+		// GORM skips false on create because of the column default
+		return tx.Model(&list).Update("is_active", list.IsActive).Error
+	})
+
+	switch err {
+	case nil:
+	case errPricingRule:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create price list"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, list)
+}
+
+// UpdatePriceList replaces a price list
+// @Summary Update price list
+// @Description Replace the name, status and items of a price list (admin only)
+// @Tags pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Price list ID"
+// @Param request body PriceListRequest true "Price list"
+// @Success 200 {object} models.PriceList
+// @Failure 400 {object} map[string]string
+// @Router /admin/price-lists/{id} [put]
+func (h *PricingHandler) UpdatePriceList(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	list, ok := h.findPriceList(c, supplierID)
+	if !ok {
+		return
+	}
+
+	var req PriceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{"name": req.Name, "description": req.Description}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+
+	var message string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		items, msg := h.priceListItems(tx, supplierID, req.Items)
+		if msg != "" {
+			message = msg
+			return errPricingRule
+		}
+		if err := tx.Model(&list).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("price_list_id = ?", list.ID).Delete(&models.PriceListItem{}).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].PriceListID = list.ID
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+
+	switch err {
+	case nil:
+	case errPricingRule:
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update price list"})
+		return
+	}
+
+	h.db.Preload("Items").First(&list, list.ID)
+
+	c.JSON(http.StatusOK, list)
+}
+
+// DeletePriceList deletes a price list
+// @Summary Delete price list
+// @Description Delete a price list. Consumers it was assigned to go back to catalog prices and discounts limited to it are removed (admin only).
+// @Tags pricing
+// @Security BearerAuth
+// @Param id path int true "Price list ID"
+// @Success 200 {object} map[string]string
+// @Router /admin/price-lists/{id} [delete]
+func (h *PricingHandler) DeletePriceList(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	list, ok := h.findPriceList(c, supplierID)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ConsumerSupplierLink{}).
+			Where("price_list_id = ?", list.ID).
+			Update("price_list_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("price_list_id = ?", list.ID).Delete(&models.Discount{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("price_list_id = ?", list.ID).Delete(&models.PriceListItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&list).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete price list"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price list deleted successfully"})
+}
+
+// AssignPriceList sets the price list of a linked consumer
+// @Summary Assign price list
+// @Description Assign a price list to a consumer link, or clear it with null to use catalog prices (admin only)
+// @Tags pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Consumer link ID"
+// @Param request body map[string]interface{} true "price_list_id"
+// @Success 200 {object} models.ConsumerSupplierLink
+// @Router /admin/consumer-links/{id}/price-list [put]
+func (h *PricingHandler) AssignPriceList(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+
+	var req struct {
+		PriceListID *uint `json:"price_list_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var link models.ConsumerSupplierLink
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&link, uint(linkID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+
+	if req.PriceListID != nil {
+		var list models.PriceList
+		if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&list, *req.PriceListID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Price list not found"})
+			return
+		}
+	}
+
+	if err := h.db.Model(&link).Update("price_list_id", req.PriceListID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign price list"})
+		return
+	}
+
+	h.db.Preload("Consumer").Preload("Consumer.User").Preload("PriceList").First(&link, link.ID)
+
+	c.JSON(http.StatusOK, link)
+}
+
+// GetDiscounts returns the supplier's discounts
+// @Summary Get discounts
+// @Description List the supplier's discounts and promotions (admin only)
+// @Tags pricing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Discount
+// @Router /admin/discounts [get]
+func (h *PricingHandler) GetDiscounts(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	var discounts []models.Discount
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).Order("created_at DESC").Find(&discounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch discounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, discounts)
+}
+
+// CreateDiscount creates a discount or promotion
+// @Summary Create discount
+// @Description Create a percentage or fixed discount, optionally limited to a product, a price list, a minimum quantity or a time window (admin only)
+// @Tags pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body DiscountRequest true "Discount"
+// @Success 201 {object} models.Discount
+// @Failure 400 {object} map[string]string
+// @Router /admin/discounts [post]
+func (h *PricingHandler) CreateDiscount(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	var req DiscountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	discount := models.Discount{SupplierID: supplierID, IsActive: true}
+	if msg := h.applyDiscountRequest(supplierID, req, &discount); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&discount).Error; err != nil {
+			return err
+		}
+		// GORM skips false on create because of the column default
+		return tx.Model(&discount).Update("is_active", discount.IsActive).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create discount"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, discount)
+}
+
+// UpdateDiscount replaces a discount
+// @Summary Update discount
+// @Description Replace the settings of a discount (admin only)
+// @Tags pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Discount ID"
+// @Param request body DiscountRequest true "Discount"
+// @Success 200 {object} models.Discount
+// @Failure 400 {object} map[string]string
+// @Router /admin/discounts/{id} [put]
+func (h *PricingHandler) UpdateDiscount(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	discount, ok := h.findDiscount(c, supplierID)
+	if !ok {
+		return
+	}
+
+	var req DiscountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := h.applyDiscountRequest(supplierID, req, &discount); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := h.db.Select("*").Omit("id", "supplier_id", "created_at").Updates(&discount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update discount"})
+		return
+	}
+
+	c.JSON(http.StatusOK, discount)
+}
+
+// DeleteDiscount deletes a discount
+// @Summary Delete discount
+// @Description Delete a discount (admin only)
+// @Tags pricing
+// @Security BearerAuth
+// @Param id path int true "Discount ID"
+// @Success 200 {object} map[string]string
+// @Router /admin/discounts/{id} [delete]
+func (h *PricingHandler) DeleteDiscount(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	discount, ok := h.findDiscount(c, supplierID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(&discount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete discount"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Discount deleted successfully"})
+}
+
+// Helper functions
+
+func (h *PricingHandler) findPriceList(c *gin.Context, supplierID uint) (models.PriceList, bool) {
+	var list models.PriceList
+
+	listID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price list ID"})
+		return list, false
+	}
+
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&list, uint(listID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price list not found"})
+		return list, false
+	}
+	return list, true
+}
+
+func (h *PricingHandler) findDiscount(c *gin.Context, supplierID uint) (models.Discount, bool) {
+	var discount models.Discount
+
+	discountID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid discount ID"})
+		return discount, false
+	}
+
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&discount, uint(discountID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Discount not found"})
+		return discount, false
+	}
+	return discount, true
+}
+
+// priceListItems validates requested items: every product must be the
+// supplier's and each product may have one price per minimum quantity.
+func (h *PricingHandler) priceListItems(tx *gorm.DB, supplierID uint, requested []PriceListItemRequest) ([]models.PriceListItem, string) {
+	productIDs := make([]uint, 0, len(requested))
+	for _, item := range requested {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	var owned int64
+	if len(productIDs) > 0 {
+		tx.Model(&models.Product{}).
+			Where("id IN ? AND supplier_id = ?", productIDs, supplierID).
+			Distinct("id").
+			Count(&owned)
+	}
+
+	items := make([]models.PriceListItem, 0, len(requested))
+	seen := map[[2]int]bool{}
+	for _, item := range requested {
+		if item.MinQuantity == 0 {
+			item.MinQuantity = 1
+		}
+		key := [2]int{int(item.ProductID), item.MinQuantity}
+		if seen[key] {
+			return nil, "Each product may have one price per minimum quantity"
+		}
+		seen[key] = true
+
+		items = append(items, models.PriceListItem{
+			ProductID:   item.ProductID,
+			MinQuantity: item.MinQuantity,
+			Price:       *item.Price,
+		})
+	}
+
+	distinct := map[uint]bool{}
+	for _, id := range productIDs {
+		distinct[id] = true
+	}
+	if int(owned) != len(distinct) {
+		return nil, "Price list contains products of another supplier or unknown products"
+	}
+
+	return items, ""
+}
+
+// applyDiscountRequest validates req and copies it onto discount.
+func (h *PricingHandler) applyDiscountRequest(supplierID uint, req DiscountRequest, discount *models.Discount) string {
+	if req.Type == models.DiscountTypePercent && req.Value == 0 {
+		return "A percentage discount needs a value between 0 and 100"
+	}
+	if req.Type == models.DiscountTypeFixed && req.Amount == nil {
+		return "A fixed discount needs an amount"
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return "ends_at must be after starts_at"
+	}
+	currency := req.Currency
+	if req.ProductID != nil {
+		var product models.Product
+		if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&product, *req.ProductID).Error; err != nil {
+			return "Product not found"
+		}
+		if currency == "" {
+			currency = product.Currency
+		}
+		if req.Type == models.DiscountTypeFixed && currency != product.Currency {
+			return "A fixed discount must be in the product's currency"
+		}
+	}
+	if currency == "" {
+		currency = money.KZT
+	}
+	if req.Type == models.DiscountTypeFixed && !money.Supported(currency) {
+		return "Unsupported currency"
+	}
+	if req.PriceListID != nil {
+		var list models.PriceList
+		if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&list, *req.PriceListID).Error; err != nil {
+			return "Price list not found"
+		}
+	}
+
+	discount.Name = req.Name
+	discount.Type = req.Type
+	discount.Value, discount.Amount, discount.Currency = 0, 0, ""
+	if req.Type == models.DiscountTypePercent {
+		discount.Value = req.Value
+	} else {
+		discount.Amount = *req.Amount
+		discount.Currency = currency
+	}
+	discount.ProductID = req.ProductID
+	discount.PriceListID = req.PriceListID
+	discount.MinQuantity = req.MinQuantity
+	if discount.MinQuantity == 0 {
+		discount.MinQuantity = 1
+	}
+	discount.StartsAt = req.StartsAt
+	discount.EndsAt = req.EndsAt
+	if req.IsActive != nil {
+		discount.IsActive = *req.IsActive
+	}
+	return ""
+}
+
+// loadPriceBook collects the pricing rules that apply to a consumer buying
+// from a supplier at time at: the items of the price list assigned to their
+// link, if it is active, and the discounts running at that time.
+func loadPriceBook(db *gorm.DB, supplierID, consumerID uint, at time.Time) (models.PriceBook, error) {
+	book := models.PriceBook{At: at}
+
+	var link models.ConsumerSupplierLink
+	err := db.Where("supplier_id = ? AND consumer_id = ?", supplierID, consumerID).First(&link).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return book, err
+	}
+
+	if link.PriceListID != nil {
+		var list models.PriceList
+		err := db.Preload("Items").Where("is_active = ?", true).First(&list, *link.PriceListID).Error
+		switch err {
+		case nil:
+			book.PriceListID = &list.ID
+			book.Items = list.Items
+		case gorm.ErrRecordNotFound:
+		default:
+			return book, err
+		}
+	}
+
+	query := db.Where("supplier_id = ? AND is_active = ?", supplierID, true).
+		Where("(starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", at, at)
+	if book.PriceListID != nil {
+		query = query.Where("price_list_id IS NULL OR price_list_id = ?", *book.PriceListID)
+	} else {
+		query = query.Where("price_list_id IS NULL")
+	}
+	if err := query.Find(&book.Discounts).Error; err != nil {
+		return book, err
+	}
+
+	return book, nil
+}
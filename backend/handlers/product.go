@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"csci361/models"
+	"csci361/money"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -41,14 +43,14 @@ func (h *ProductHandler) GetCategories(c *gin.Context) {
 
 // CreateCategory creates a new product category
 // @Summary Create category
-// @Description Create a new product category (admin only)
-// @Tags products
+// @Description Create a new product category; categories are shared by every supplier (platform admin only)
+// @Tags platform
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param request body models.Category true "Category details"
 // @Success 201 {object} models.Category
-// @Router /admin/categories [post]
+// @Router /platform/categories [post]
 func (h *ProductHandler) CreateCategory(c *gin.Context) {
 	var category models.Category
 	if err := c.ShouldBindJSON(&category); err != nil {
@@ -68,15 +70,15 @@ func (h *ProductHandler) CreateCategory(c *gin.Context) {
 
 // UpdateCategory updates a product category
 // @Summary Update category
-// @Description Update product category details (admin only)
-// @Tags products
+// @Description Update product category details (platform admin only)
+// @Tags platform
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Category ID"
 // @Param request body models.Category true "Updated category"
 // @Success 200 {object} models.Category
-// @Router /admin/categories/{id} [put]
+// @Router /platform/categories/{id} [put]
 func (h *ProductHandler) UpdateCategory(c *gin.Context) {
 	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -110,12 +112,12 @@ func (h *ProductHandler) UpdateCategory(c *gin.Context) {
 
 // DeleteCategory soft deletes a category
 // @Summary Delete category
-// @Description Deactivate a product category (admin only)
-// @Tags products
+// @Description Deactivate a product category (platform admin only)
+// @Tags platform
 // @Security BearerAuth
 // @Param id path int true "Category ID"
 // @Success 200 {object} map[string]string
-// @Router /admin/categories/{id} [delete]
+// @Router /platform/categories/{id} [delete]
 func (h *ProductHandler) DeleteCategory(c *gin.Context) {
 	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -153,8 +155,10 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	offset := (page - 1) * limit
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
 
 	var products []models.Product
 	var total int64
@@ -183,7 +187,7 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 
 // GetProductsForConsumer returns products visible to consumer
 // @Summary Get products for consumer
-// @Description Get list of products from linked suppliers
+// @Description Get list of products from linked suppliers, with the consumer's effective price and quantity breaks
 // @Tags products
 // @Produce json
 // @Security BearerAuth
@@ -244,12 +248,35 @@ func (h *ProductHandler) GetProductsForConsumer(c *gin.Context) {
 		return
 	}
 
+	// Show each product at the price this consumer would pay for its smallest order
+	now := time.Now()
+	books := make(map[uint]models.PriceBook, len(supplierIDs))
+	for _, supplierID := range supplierIDs {
+		book, err := loadPriceBook(h.db, supplierID, consumer.ID, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prices"})
+			return
+		}
+		books[supplierID] = book
+	}
+	for i := range products {
+		book := books[products[i].SupplierID]
+		price := book.Quote(products[i], products[i].SmallestOrder()).UnitPrice
+		products[i].EffectivePrice = &price
+		products[i].PriceBreaks = book.Breaks(products[i])
+
+		// and when the next order from its supplier would be delivered
+		if slot, ok := products[i].Supplier.UpcomingDelivery(now); ok {
+			products[i].Supplier.NextDelivery = &slot
+		}
+	}
+
 	c.JSON(http.StatusOK, products)
 }
 
 // CreateProduct creates a new product
 // @Summary Create product
-// @Description Create a new product (admin only)
+// @Description Create a new product (admin only). Currency is KZT, RUB or USD and defaults to KZT.
 // @Tags products
 // @Accept json
 // @Produce json
@@ -258,8 +285,10 @@ func (h *ProductHandler) GetProductsForConsumer(c *gin.Context) {
 // @Success 201 {object} models.Product
 // @Router /admin/products [post]
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
 
 	var product models.Product
 	if err := c.ShouldBindJSON(&product); err != nil {
@@ -267,6 +296,18 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if msg := checkOrderingConstraints(product); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if product.Currency == "" {
+		product.Currency = money.KZT
+	}
+	if !money.Supported(product.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "currencies": money.Currencies()})
+		return
+	}
+
 	product.SupplierID = supplierID
 	product.IsActive = true
 
@@ -292,6 +333,11 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 // @Success 200 {object} models.Product
 // @Router /admin/products/{id} [put]
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
@@ -305,17 +351,32 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	}
 
 	var product models.Product
-	if err := h.db.First(&product, uint(productID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&product, uint(productID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
+	if msg := checkOrderingConstraints(updateData); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if updateData.Currency != "" && !money.Supported(updateData.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "currencies": money.Currencies()})
+		return
+	}
+
 	// Update fields
+	if updateData.Currency != "" {
+		product.Currency = updateData.Currency
+	}
 	product.Name = updateData.Name
 	product.Description = updateData.Description
 	product.Price = updateData.Price
 	product.Stock = updateData.Stock
 	product.MinStock = updateData.MinStock
+	product.MinOrderQuantity = updateData.MinOrderQuantity
+	product.OrderMultiple = updateData.OrderMultiple
+	product.MaxOrderQuantity = updateData.MaxOrderQuantity
 	product.Unit = updateData.Unit
 	product.CategoryID = updateData.CategoryID
 	product.IsActive = updateData.IsActive
@@ -339,6 +400,11 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 // @Success 200 {object} map[string]string
 // @Router /admin/products/{id} [delete]
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
@@ -346,7 +412,7 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	}
 
 	var product models.Product
-	if err := h.db.First(&product, uint(productID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&product, uint(productID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
@@ -372,6 +438,11 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Router /admin/products/{id}/images [post]
 func (h *ProductHandler) UploadProductImages(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
@@ -379,7 +450,7 @@ func (h *ProductHandler) UploadProductImages(c *gin.Context) {
 	}
 
 	var product models.Product
-	if err := h.db.First(&product, uint(productID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&product, uint(productID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
@@ -406,3 +477,17 @@ func (h *ProductHandler) UploadProductImages(c *gin.Context) {
 		"image_urls": imageURLs,
 	})
 }
+
+// checkOrderingConstraints returns why a product's ordering constraints are
+// inconsistent, or "".
+func checkOrderingConstraints(product models.Product) string {
+	switch {
+	case product.MinOrderQuantity < 0 || product.OrderMultiple < 0 || product.MaxOrderQuantity < 0:
+		return "Ordering constraints cannot be negative"
+	case product.MaxOrderQuantity > 0 && product.MaxOrderQuantity < product.MinOrderQuantity:
+		return "max_order_quantity cannot be below min_order_quantity"
+	case product.OrderMultiple > 1 && product.MaxOrderQuantity > 0 && product.MaxOrderQuantity < product.OrderMultiple:
+		return "max_order_quantity must allow at least one pack"
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"csci361/config"
+	"csci361/middleware"
+	"csci361/models"
+	ws "csci361/websocket"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+var errInvalidTicket = errors.New("invalid WebSocket ticket")
+
+// ChatGateway connects WebSocket clients to the chat service. It lets
+// connections in with a ticket from IssueWebSocketTicket and carries out
+// what they ask for in the chats their user takes part in.
+type ChatGateway struct {
+	db     *gorm.DB
+	secret string
+	chats  *ChatService
+}
+
+func NewChatGateway(db *gorm.DB, cfg *config.Config, chats *ChatService) *ChatGateway {
+	return &ChatGateway{db: db, secret: cfg.JWTSecret, chats: chats}
+}
+
+// Authenticate accepts a ticket whose user is still active and whose session
+// has not been revoked. Staff connections also receive their supplier's
+// events.
+func (g *ChatGateway) Authenticate(r *http.Request) (ws.Identity, error) {
+	claims, err := middleware.ParseToken(r.URL.Query().Get("ticket"), g.secret)
+	if err != nil || claims.TokenType != middleware.TokenTypeWebSocket {
+		return ws.Identity{}, errInvalidTicket
+	}
+
+	var user models.User
+	if err := g.db.Select("id", "role", "supplier_id", "is_active").First(&user, claims.UserID).Error; err != nil || !user.IsActive {
+		return ws.Identity{}, errInvalidTicket
+	}
+
+	var session models.Session
+	if err := g.db.Select("id", "revoked_at").Where("uuid = ? AND user_id = ?", claims.SessionID, user.ID).
+		First(&session).Error; err != nil || session.RevokedAt != nil {
+		return ws.Identity{}, errInvalidTicket
+	}
+
+	identity := ws.Identity{UserID: user.ID, Role: user.Role, SessionID: claims.SessionID}
+	if user.Role != models.RoleConsumer {
+		identity.SupplierID = user.SupplierID
+	}
+	return identity, nil
+}
+
+// CanJoin reports whether the user is the chat's consumer or active staff of
+// its supplier.
+func (g *ChatGateway) CanJoin(identity ws.Identity, chatID uint) bool {
+	_, _, err := g.member(identity, chatID)
+	return err == nil
+}
+
+func (g *ChatGateway) Send(identity ws.Identity, chatID uint, key, content, messageType string) (uint, error) {
+	chat, _, err := g.member(identity, chatID)
+	if err != nil {
+		return 0, err
+	}
+
+	message, _, err := g.chats.Send(chat, identity.UserID, SendMessageRequest{
+		Content:     content,
+		MessageType: messageType,
+		ClientKey:   key,
+	})
+	switch err {
+	case nil:
+		return message.ID, nil
+	case errEmptyMessage:
+		return 0, &ws.Error{Code: ws.CodeInvalid, Message: "Message content is required"}
+	case errMessageTooLong:
+		return 0, &ws.Error{Code: ws.CodeInvalid, Message: fmt.Sprintf("Messages may be at most %d characters", maxMessageLength)}
+	case errInvalidMessageType:
+		return 0, &ws.Error{Code: ws.CodeInvalid, Message: "message_type must be text, image, audio or document"}
+	case errInvalidClientKey:
+		return 0, &ws.Error{Code: ws.CodeInvalid, Message: "id must be at most 64 characters"}
+	case errClientKeyReused:
+		return 0, &ws.Error{Code: ws.CodeConflict, Message: "id was already used in another chat"}
+	case errChatArchived:
+		return 0, &ws.Error{Code: ws.CodeConflict, Message: "Chat is archived"}
+	}
+	return 0, err
+}
+
+func (g *ChatGateway) MarkRead(identity ws.Identity, chatID uint, upToID *uint) error {
+	chat, consumerUserID, err := g.member(identity, chatID)
+	if err != nil {
+		return err
+	}
+	_, err = g.chats.MarkRead(chat, consumerUserID, identity.UserID, upToID)
+	return err
+}
+
+func (g *ChatGateway) Typing(identity ws.Identity, chatID uint, isTyping bool) error {
+	chat, _, err := g.member(identity, chatID)
+	if err != nil {
+		return err
+	}
+	g.chats.Typing(chat, identity.UserID, isTyping)
+	return nil
+}
+
+// member loads the chat and the user ID of its consumer if the user takes
+// part in it. Membership is looked up on every call, so a deactivated user
+// cannot act in a chat any more; the handlers that deactivate users also
+// close their connections, ending their subscriptions.
+func (g *ChatGateway) member(identity ws.Identity, chatID uint) (models.Chat, uint, error) {
+	notFound := &ws.Error{Code: ws.CodeNotFound, Message: "Chat not found"}
+
+	var chat models.Chat
+	if err := g.db.First(&chat, chatID).Error; err != nil {
+		return chat, 0, notFound
+	}
+
+	var user models.User
+	if err := g.db.Select("id", "role", "supplier_id", "is_active").First(&user, identity.UserID).Error; err != nil || !user.IsActive {
+		return chat, 0, notFound
+	}
+
+	var consumer models.Consumer
+	if err := g.db.Select("id", "user_id").First(&consumer, chat.ConsumerID).Error; err != nil {
+		return chat, 0, notFound
+	}
+
+	member := false
+	switch user.Role {
+	case models.RoleConsumer:
+		member = consumer.UserID == user.ID
+	case models.RoleOwner, models.RoleAdmin, models.RoleSales:
+		member = user.SupplierID != nil && *user.SupplierID == chat.SupplierID
+	}
+	if !member {
+		return chat, 0, notFound
+	}
+	return chat, consumer.UserID, nil
+}
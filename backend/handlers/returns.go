@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"csci361/events"
+	"csci361/models"
+	"csci361/money"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReturnHandler struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+func NewReturnHandler(db *gorm.DB, bus *events.Bus) *ReturnHandler {
+	return &ReturnHandler{db: db, bus: bus}
+}
+
+type CreateReturnRequest struct {
+	IncidentID *uint  `json:"incident_id"`
+	Reason     string `json:"reason" binding:"required"`
+	Items      []struct {
+		OrderItemID uint `json:"order_item_id" binding:"required"`
+		Quantity    int  `json:"quantity" binding:"required,min=1"`
+	} `json:"items" binding:"required,min=1,dive"`
+}
+
+var (
+	errReturnQuantity = errors.New("return quantity exceeds what was received")
+	errReturnLine     = errors.New("line does not belong to this order")
+	errReturnStatus   = errors.New("return is not in the expected status")
+)
+
+// CreateReturn requests a return of delivered goods
+// @Summary Request return
+// @Description Ask the supplier to take back goods of an order (consumer only). Quantities may not exceed what was received minus earlier returns.
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Param request body CreateReturnRequest true "Lines to return"
+// @Success 201 {object} models.ReturnRequest
+// @Router /consumer/orders/{id}/returns [post]
+func (h *ReturnHandler) CreateReturn(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req CreateReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var consumer models.Consumer
+	if err := h.db.Where("user_id = ?", userID).First(&consumer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Scopes(ownedByConsumer(consumer.ID)).First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if req.IncidentID != nil {
+		var incident models.Incident
+		if err := h.db.Where("order_id = ?", order.ID).First(&incident, *req.IncidentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found for this order"})
+			return
+		}
+	}
+
+	rma := models.ReturnRequest{
+		OrderID:       order.ID,
+		SupplierID:    order.SupplierID,
+		ConsumerID:    consumer.ID,
+		IncidentID:    req.IncidentID,
+		Status:        models.ReturnStatusRequested,
+		Reason:        req.Reason,
+		RequestedByID: userID.(uint),
+	}
+
+	var total money.Amount
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Serialise returns of the same order so quantities cannot be
+		// returned twice.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+
+		returnable, err := returnableQuantities(tx, order)
+		if err != nil {
+			return err
+		}
+
+		var items []models.OrderItem
+		if err := tx.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+			return err
+		}
+		prices := make(map[uint]money.Amount, len(items))
+		for _, item := range items {
+			prices[item.ID] = item.UnitPrice
+		}
+
+		for _, line := range req.Items {
+			price, ok := prices[line.OrderItemID]
+			if !ok {
+				return errReturnLine
+			}
+			if line.Quantity > returnable[line.OrderItemID] {
+				return errReturnQuantity
+			}
+			returnable[line.OrderItemID] -= line.Quantity
+
+			lineTotal := price.Mul(line.Quantity)
+			total += lineTotal
+			rma.Items = append(rma.Items, models.ReturnItem{
+				OrderItemID: line.OrderItemID,
+				Quantity:    line.Quantity,
+				UnitPrice:   price,
+				Total:       lineTotal,
+			})
+		}
+
+		return tx.Create(&rma).Error
+	})
+
+	switch err {
+	case nil:
+	case errReturnLine:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order item not found in this order"})
+		return
+	case errReturnQuantity:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity exceeds what was received and not yet returned"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create return"})
+		return
+	}
+
+	actorID := userID.(uint)
+	h.bus.Publish(events.Event{
+		Type:       events.ReturnRequested,
+		SupplierID: rma.SupplierID,
+		ConsumerID: rma.ConsumerID,
+		OrderID:    rma.OrderID,
+		ReturnID:   rma.ID,
+		ActorID:    &actorID,
+		ActorRole:  models.RoleConsumer,
+		ToStatus:   rma.Status,
+		Reason:     rma.Reason,
+		Amount:     total,
+		Currency:   order.Currency,
+	})
+
+	h.db.Preload("Items").Preload("Items.OrderItem").Preload("Items.OrderItem.Product").First(&rma, rma.ID)
+
+	c.JSON(http.StatusCreated, rma)
+}
+
+// GetConsumerReturns returns the consumer's return requests
+// @Summary Get my returns
+// @Description List return requests of the authenticated consumer
+// @Tags returns
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status"
+// @Success 200 {array} models.ReturnRequest
+// @Router /consumer/returns [get]
+func (h *ReturnHandler) GetConsumerReturns(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var consumer models.Consumer
+	if err := h.db.Where("user_id = ?", userID).First(&consumer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+		return
+	}
+
+	h.listReturns(c, ownedByConsumer(consumer.ID))
+}
+
+// GetSupplierReturns returns the supplier's return requests
+// @Summary Get supplier returns
+// @Description List return requests for the supplier's orders
+// @Tags returns
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status"
+// @Success 200 {array} models.ReturnRequest
+// @Router /sales/returns [get]
+func (h *ReturnHandler) GetSupplierReturns(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	h.listReturns(c, ownedBySupplier(supplierID))
+}
+
+// ApproveReturn accepts a return request
+// @Summary Approve return
+// @Description Approve a requested return so the consumer can send the goods back
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Return ID"
+// @Param request body map[string]string false "Decision note"
+// @Success 200 {object} models.ReturnRequest
+// @Router /sales/returns/{id}/approve [put]
+func (h *ReturnHandler) ApproveReturn(c *gin.Context) {
+	h.decideReturn(c, models.ReturnStatusApproved)
+}
+
+// RejectReturn declines a return request
+// @Summary Reject return
+// @Description Reject a requested return; a note explaining why is required
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Return ID"
+// @Param request body map[string]string true "Decision note"
+// @Success 200 {object} models.ReturnRequest
+// @Router /sales/returns/{id}/reject [put]
+func (h *ReturnHandler) RejectReturn(c *gin.Context) {
+	h.decideReturn(c, models.ReturnStatusRejected)
+}
+
+// ReceiveReturn records that returned goods arrived
+// @Summary Receive return
+// @Description Record receipt of the goods of an approved return. The goods are restocked, a credit note is issued and a linked incident is resolved.
+// @Tags returns
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Return ID"
+// @Success 200 {object} models.ReturnRequest
+// @Router /sales/returns/{id}/receive [post]
+func (h *ReturnHandler) ReceiveReturn(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	returnID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return
+	}
+
+	var rma models.ReturnRequest
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).Preload("Items").Preload("Items.OrderItem").
+		First(&rma, uint(returnID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+	now := time.Now()
+
+	var note models.CreditNote
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ReturnRequest{}).
+			Where("id = ? AND status = ?", rma.ID, models.ReturnStatusApproved).
+			Updates(map[string]interface{}{"status": models.ReturnStatusReceived, "received_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errReturnStatus
+		}
+
+		var amount money.Amount
+		for _, item := range rma.Items {
+			amount += item.Total
+			if item.OrderItem == nil {
+				continue
+			}
+			if err := tx.Model(&models.Product{}).
+				Where("id = ?", item.OrderItem.ProductID).
+				Update("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+				return err
+			}
+		}
+
+		var order models.Order
+		if err := tx.Select("id", "currency").First(&order, rma.OrderID).Error; err != nil {
+			return err
+		}
+
+		note = models.CreditNote{
+			Number:          fmt.Sprintf("CN-PENDING-%d", rma.ID),
+			ReturnRequestID: rma.ID,
+			OrderID:         rma.OrderID,
+			SupplierID:      rma.SupplierID,
+			ConsumerID:      rma.ConsumerID,
+			Amount:          amount,
+			Currency:        order.Currency,
+			IssuedByID:      &actorID,
+			IssuedAt:        now,
+		}
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		note.Number = fmt.Sprintf("CN-%06d", note.ID)
+		if err := tx.Model(&note).Update("number", note.Number).Error; err != nil {
+			return err
+		}
+
+		if rma.IncidentID != nil {
+			return resolveIncidentForReturn(tx, *rma.IncidentID, actorID, note)
+		}
+		return nil
+	})
+
+	switch err {
+	case nil:
+	case errReturnStatus:
+		c.JSON(http.StatusConflict, gin.H{"error": "Only approved returns can be received"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to receive return"})
+		return
+	}
+
+	role, _ := c.Get("role")
+	h.bus.Publish(events.Event{
+		Type:       events.ReturnReceived,
+		SupplierID: rma.SupplierID,
+		ConsumerID: rma.ConsumerID,
+		OrderID:    rma.OrderID,
+		ReturnID:   rma.ID,
+		ActorID:    &actorID,
+		ActorRole:  role.(string),
+		ToStatus:   models.ReturnStatusReceived,
+		Reason:     note.Number,
+		Amount:     note.Amount,
+		Currency:   note.Currency,
+	})
+
+	h.db.Preload("Items").Preload("CreditNote").First(&rma, rma.ID)
+
+	c.JSON(http.StatusOK, rma)
+}
+
+// GetConsumerCreditNotes returns the consumer's credit notes
+// @Summary Get my credit notes
+// @Description List credit notes issued to the authenticated consumer
+// @Tags returns
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.CreditNote
+// @Router /consumer/credit-notes [get]
+func (h *ReturnHandler) GetConsumerCreditNotes(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var consumer models.Consumer
+	if err := h.db.Where("user_id = ?", userID).First(&consumer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+		return
+	}
+
+	h.listCreditNotes(c, ownedByConsumer(consumer.ID))
+}
+
+// GetSupplierCreditNotes returns the supplier's credit notes
+// @Summary Get credit notes
+// @Description List credit notes issued by the supplier
+// @Tags returns
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.CreditNote
+// @Router /admin/credit-notes [get]
+func (h *ReturnHandler) GetSupplierCreditNotes(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	h.listCreditNotes(c, ownedBySupplier(supplierID))
+}
+
+// Helper functions
+
+func (h *ReturnHandler) listReturns(c *gin.Context, scope func(*gorm.DB) *gorm.DB) {
+	query := h.db.Scopes(scope)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var returns []models.ReturnRequest
+	if err := query.Preload("Items").
+		Preload("Items.OrderItem").
+		Preload("Items.OrderItem.Product").
+		Preload("CreditNote").
+		Order("created_at DESC").
+		Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, returns)
+}
+
+func (h *ReturnHandler) listCreditNotes(c *gin.Context, scope func(*gorm.DB) *gorm.DB) {
+	var notes []models.CreditNote
+	if err := h.db.Scopes(scope).Order("issued_at DESC").Find(&notes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credit notes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
+
+func (h *ReturnHandler) decideReturn(c *gin.Context, status string) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	returnID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&req)
+	if status == models.ReturnStatusRejected && req.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A note explaining the rejection is required"})
+		return
+	}
+
+	var rma models.ReturnRequest
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&rma, uint(returnID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+
+	result := h.db.Model(&models.ReturnRequest{}).
+		Where("id = ? AND status = ?", rma.ID, models.ReturnStatusRequested).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"decision_note": req.Note,
+			"decided_by_id": actorID,
+			"decided_at":    time.Now(),
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Return has already been decided", "status": rma.Status})
+		return
+	}
+
+	role, _ := c.Get("role")
+	h.bus.Publish(events.Event{
+		Type:       events.ReturnDecided,
+		SupplierID: rma.SupplierID,
+		ConsumerID: rma.ConsumerID,
+		OrderID:    rma.OrderID,
+		ReturnID:   rma.ID,
+		ActorID:    &actorID,
+		ActorRole:  role.(string),
+		FromStatus: rma.Status,
+		ToStatus:   status,
+		Reason:     req.Note,
+	})
+
+	h.db.Preload("Items").First(&rma, rma.ID)
+
+	c.JSON(http.StatusOK, rma)
+}
+
+// returnableQuantities returns, per order item, how many units the consumer
+// received and has not already asked to return. Orders delivered before
+// shipments were tracked count their full quantities as received.
+func returnableQuantities(tx *gorm.DB, order models.Order) (map[uint]int, error) {
+	var received []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	if err := tx.Model(&models.ShipmentItem{}).
+		Select("shipment_items.order_item_id, SUM(COALESCE(shipment_items.received_quantity, shipment_items.quantity)) AS quantity").
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id").
+		Where("shipments.order_id = ? AND shipments.status = ?", order.ID, models.ShipmentStatusDelivered).
+		Group("shipment_items.order_item_id").
+		Scan(&received).Error; err != nil {
+		return nil, err
+	}
+
+	returnable := map[uint]int{}
+	if len(received) == 0 && order.Status == models.OrderStatusDelivered {
+		var items []models.OrderItem
+		if err := tx.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			returnable[item.ID] += item.Quantity
+		}
+	}
+	for _, row := range received {
+		returnable[row.OrderItemID] += row.Quantity
+	}
+
+	var returned []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	if err := tx.Model(&models.ReturnItem{}).
+		Select("return_items.order_item_id, SUM(return_items.quantity) AS quantity").
+		Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id").
+		Where("return_requests.order_id = ? AND return_requests.status <> ?", order.ID, models.ReturnStatusRejected).
+		Group("return_items.order_item_id").
+		Scan(&returned).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range returned {
+		returnable[row.OrderItemID] -= row.Quantity
+	}
+
+	return returnable, nil
+}
+
+// resolveIncidentForReturn closes the complaint a return was opened for.
+func resolveIncidentForReturn(tx *gorm.DB, incidentID, actorID uint, note models.CreditNote) error {
+	var incident models.Incident
+	if err := tx.First(&incident, incidentID).Error; err != nil {
+		return err
+	}
+	if incident.Status == "resolved" || incident.Status == "closed" {
+		return nil
+	}
+
+	now := time.Now()
+	if err := tx.Model(&incident).Updates(map[string]interface{}{
+		"status":      "resolved",
+		"resolved_at": now,
+	}).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&models.IncidentLog{
+		IncidentID: incident.ID,
+		UserID:     actorID,
+		Action:     "resolved",
+		OldValue:   incident.Status,
+		NewValue:   "resolved",
+		Notes:      fmt.Sprintf("Goods returned, credit note %s issued for %s %s", note.Number, note.Amount, note.Currency),
+	}).Error
+}
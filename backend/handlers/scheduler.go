@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"csci361/events"
+	"csci361/models"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StandingOrderScheduler places the orders of standing orders as they fall
+// due. Several instances may run against one database: each run is claimed
+// by moving the standing order's next run forward before its order is placed.
+type StandingOrderScheduler struct {
+	db   *gorm.DB
+	bus  *events.Bus
+	live LivePublisher
+}
+
+func NewStandingOrderScheduler(db *gorm.DB, bus *events.Bus, live LivePublisher) *StandingOrderScheduler {
+	return &StandingOrderScheduler{db: db, bus: bus, live: live}
+}
+
+// Run places due standing orders every interval until ctx is done.
+func (s *StandingOrderScheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.RunDue(now)
+		}
+	}
+}
+
+// RunDue places the order of every active standing order due at now and
+// returns how many it ran. Runs missed while the scheduler was down are
+// made up once, not once per missed run.
+func (s *StandingOrderScheduler) RunDue(now time.Time) int {
+	now = now.UTC()
+
+	var due []models.StandingOrder
+	if err := s.db.Where("status = ? AND next_run_at <= ?", models.StandingOrderActive, now).
+		Preload("Items").Preload("Items.Product").
+		Order("next_run_at").
+		Find(&due).Error; err != nil {
+		log.Printf("Failed to load due standing orders: %v", err)
+		return 0
+	}
+
+	ran := 0
+	for _, order := range due {
+		claimed, err := s.claim(order, now)
+		if err != nil {
+			log.Printf("Failed to claim standing order %d: %v", order.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.run(order, now); err != nil {
+			log.Printf("Standing order %d failed: %v", order.ID, err)
+		}
+		ran++
+	}
+	return ran
+}
+
+// claim moves the standing order's next run past now. It is false if another
+// scheduler got there first.
+func (s *StandingOrderScheduler) claim(order models.StandingOrder, now time.Time) (bool, error) {
+	next, err := order.NextRun(now)
+	if err != nil {
+		return false, err
+	}
+
+	result := s.db.Model(&models.StandingOrder{}).
+		Where("id = ? AND status = ? AND next_run_at <= ?", order.ID, models.StandingOrderActive, now).
+		Updates(map[string]interface{}{"next_run_at": next, "last_run_at": now})
+	return result.RowsAffected == 1, result.Error
+}
+
+// run places the standing order's order through the same path as a consumer
+// would, records the outcome and tells the consumer about it. Items that
+// cannot be ordered are left out if the standing order allows it.
+func (s *StandingOrderScheduler) run(order models.StandingOrder, now time.Time) error {
+	var consumer models.Consumer
+	if err := s.db.First(&consumer, order.ConsumerID).Error; err != nil {
+		return err
+	}
+
+	req := CreateOrderRequest{SupplierID: order.SupplierID, Notes: order.Notes}
+	names := map[uint]string{}
+	for _, item := range order.Items {
+		req.Items = append(req.Items, OrderLineRequest{ProductID: item.ProductID, Quantity: item.Quantity})
+		names[item.ProductID] = item.Product.Name
+	}
+
+	placed, rejection, placeErr := placeOrder(s.db, s.bus, consumer, req, nil, models.ActorSystem, now)
+	var left []string
+	if placeErr == nil && rejection != nil && len(rejection.Lines) > 0 && order.SkipUnavailable {
+		rejected := map[int]bool{}
+		for _, line := range rejection.Lines {
+			rejected[line.Index] = true
+			left = append(left, fmt.Sprintf("%s: %s", names[line.ProductID], line.Message))
+		}
+		var remaining []OrderLineRequest
+		for i, line := range req.Items {
+			if !rejected[i] {
+				remaining = append(remaining, line)
+			}
+		}
+		if len(remaining) > 0 {
+			req.Items = remaining
+			placed, rejection, placeErr = placeOrder(s.db, s.bus, consumer, req, nil, models.ActorSystem, now)
+		}
+	}
+
+	result := models.StandingOrderRun{
+		StandingOrderID: order.ID,
+		ScheduledFor:    *order.NextRunAt,
+		Status:          models.StandingOrderRunPlaced,
+	}
+	notification := models.Notification{UserID: consumer.UserID, Type: "success"}
+
+	switch {
+	case placeErr == errNotLinked:
+		result.Status, result.Message = models.StandingOrderRunFailed, "No longer linked to the supplier"
+	case placeErr != nil:
+		result.Status, result.Message = models.StandingOrderRunFailed, "The order could not be placed"
+	case rejection != nil:
+		result.Status, result.Message = models.StandingOrderRunFailed, describeRejection(rejection, names)
+	case len(left) > 0:
+		result.Status, result.Message = models.StandingOrderRunPartial, "Left out "+strings.Join(left, "; ")
+	}
+	if result.Status != models.StandingOrderRunFailed {
+		result.OrderID = &placed.ID
+	}
+
+	switch result.Status {
+	case models.StandingOrderRunPlaced:
+		notification.Title = fmt.Sprintf("Standing order %q placed", order.Name)
+		notification.Content = fmt.Sprintf("Order #%d of %s %s was placed.", placed.ID, placed.Total, placed.Currency)
+	case models.StandingOrderRunPartial:
+		notification.Type = "warning"
+		notification.Title = fmt.Sprintf("Standing order %q placed in part", order.Name)
+		notification.Content = fmt.Sprintf("Order #%d of %s %s was placed. %s.", placed.ID, placed.Total, placed.Currency, result.Message)
+	default:
+		notification.Type = "error"
+		notification.Title = fmt.Sprintf("Standing order %q was not placed", order.Name)
+		notification.Content = result.Message + "."
+	}
+
+	if err := s.db.Create(&result).Error; err != nil {
+		return err
+	}
+	if err := saveNotifications(s.db, s.live, notification); err != nil {
+		return err
+	}
+	if placeErr != errNotLinked {
+		return placeErr
+	}
+	return nil
+}
+
+// describeRejection says in a sentence why an order was rejected.
+func describeRejection(rejection *orderRejection, names map[uint]string) string {
+	if len(rejection.Lines) == 0 {
+		return rejection.Message
+	}
+	var lines []string
+	for _, line := range rejection.Lines {
+		lines = append(lines, fmt.Sprintf("%s: %s", names[line.ProductID], line.Message))
+	}
+	return rejection.Message + ": " + strings.Join(lines, "; ")
+}
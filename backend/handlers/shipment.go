@@ -0,0 +1,565 @@
+package handlers
+
+import (
+	"csci361/events"
+	"csci361/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ShipmentHandler struct {
+	db  *gorm.DB
+	bus *events.Bus
+}
+
+func NewShipmentHandler(db *gorm.DB, bus *events.Bus) *ShipmentHandler {
+	return &ShipmentHandler{db: db, bus: bus}
+}
+
+type CreateShipmentRequest struct {
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+	Notes          string `json:"notes"`
+	Items          []struct {
+		OrderItemID uint `json:"order_item_id" binding:"required"`
+		Quantity    int  `json:"quantity" binding:"required,min=1"`
+	} `json:"items" binding:"required,min=1,dive"`
+}
+
+type ConfirmReceiptRequest struct {
+	Items []struct {
+		ShipmentItemID   uint `json:"shipment_item_id" binding:"required"`
+		ReceivedQuantity int  `json:"received_quantity" binding:"min=0"`
+		DamagedQuantity  int  `json:"damaged_quantity" binding:"min=0"`
+	} `json:"items" binding:"dive"`
+	Notes string `json:"notes"`
+}
+
+var (
+	errOrderNotShippable   = errors.New("order cannot be shipped in its current status")
+	errShipmentQuantity    = errors.New("shipment quantity exceeds what is left to ship")
+	errShipmentLine        = errors.New("line does not belong to this order or shipment")
+	errShipmentDelivered   = errors.New("shipment already delivered")
+	errShipmentConfirmed   = errors.New("shipment receipt already confirmed")
+	errShipmentReceiptLine = errors.New("received and damaged quantities exceed the shipped quantity")
+)
+
+// CreateShipment dispatches part or all of an order
+// @Summary Create shipment
+// @Description Dispatch a batch of goods for a confirmed order. Quantities are per order line and may not exceed what is left to ship. The order becomes partially_shipped or shipped.
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Param request body CreateShipmentRequest true "Shipment details"
+// @Success 201 {object} models.Shipment
+// @Router /sales/orders/{id}/shipments [post]
+func (h *ShipmentHandler) CreateShipment(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req CreateShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	actorID := userID.(uint)
+	now := time.Now()
+
+	shipment := models.Shipment{
+		OrderID:        order.ID,
+		SupplierID:     supplierID,
+		Status:         models.ShipmentStatusDispatched,
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+		Notes:          req.Notes,
+		CreatedByID:    &actorID,
+		DispatchedAt:   &now,
+	}
+
+	var evt *events.Event
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the order so two shipments cannot both take the last units.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusConfirmed && order.Status != models.OrderStatusPartiallyShipped {
+			return errOrderNotShippable
+		}
+
+		remaining, err := remainingToShip(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range req.Items {
+			left, ok := remaining[line.OrderItemID]
+			if !ok {
+				return errShipmentLine
+			}
+			if line.Quantity > left {
+				return errShipmentQuantity
+			}
+			remaining[line.OrderItemID] = left - line.Quantity
+			shipment.Items = append(shipment.Items, models.ShipmentItem{
+				OrderItemID: line.OrderItemID,
+				Quantity:    line.Quantity,
+			})
+		}
+
+		if err := tx.Create(&shipment).Error; err != nil {
+			return err
+		}
+
+		evt, err = syncOrderStatus(tx, &order, actorID, role.(string), shipmentReason(shipment))
+		return err
+	})
+
+	switch err {
+	case nil:
+	case errOrderNotShippable:
+		c.JSON(http.StatusConflict, gin.H{"error": "Only confirmed orders can be shipped", "status": order.Status})
+		return
+	case errShipmentLine:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order item not found in this order"})
+		return
+	case errShipmentQuantity:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity exceeds what is left to ship"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipment"})
+		return
+	}
+
+	if evt != nil {
+		h.bus.Publish(*evt)
+	}
+
+	h.db.Preload("Items").Preload("Items.OrderItem").First(&shipment, shipment.ID)
+
+	c.JSON(http.StatusCreated, shipment)
+}
+
+// GetOrderShipments returns the shipments of an order
+// @Summary Get order shipments
+// @Description List the shipments of an order with their lines
+// @Tags shipments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Success 200 {array} models.Shipment
+// @Router /sales/orders/{id}/shipments [get]
+func (h *ShipmentHandler) GetOrderShipments(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	scope, ok := callerOrderScope(h.db, c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Scopes(scope).First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var shipments []models.Shipment
+	if err := h.db.Where("order_id = ?", order.ID).
+		Preload("Items").
+		Preload("Items.OrderItem").
+		Preload("Items.OrderItem.Product").
+		Order("created_at ASC, id ASC").
+		Find(&shipments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shipments)
+}
+
+// MarkShipmentDelivered records proof of delivery for a shipment
+// @Summary Mark shipment delivered
+// @Description Record that a shipment was handed over and who received it (supplier staff)
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Shipment ID"
+// @Param request body map[string]string true "Receiver name"
+// @Success 200 {object} models.Shipment
+// @Router /sales/shipments/{id}/delivered [put]
+func (h *ShipmentHandler) MarkShipmentDelivered(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	shipmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	var req struct {
+		ReceivedBy string `json:"received_by" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var shipment models.Shipment
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&shipment, uint(shipmentID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var evt *events.Event
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Shipment{}).
+			Where("id = ? AND status = ?", shipment.ID, models.ShipmentStatusDispatched).
+			Updates(map[string]interface{}{
+				"status":       models.ShipmentStatusDelivered,
+				"delivered_at": now,
+				"received_by":  req.ReceivedBy,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errShipmentDelivered
+		}
+
+		var order models.Order
+		if err := tx.First(&order, shipment.OrderID).Error; err != nil {
+			return err
+		}
+
+		var err error
+		evt, err = syncOrderStatus(tx, &order, userID.(uint), role.(string), "Delivered to "+req.ReceivedBy)
+		return err
+	})
+
+	switch err {
+	case nil:
+	case errShipmentDelivered:
+		c.JSON(http.StatusConflict, gin.H{"error": "Shipment is already delivered"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipment"})
+		return
+	}
+
+	if evt != nil {
+		h.bus.Publish(*evt)
+	}
+
+	h.db.Preload("Items").First(&shipment, shipment.ID)
+
+	c.JSON(http.StatusOK, shipment)
+}
+
+// ConfirmReceipt lets the consumer confirm a shipment arrived
+// @Summary Confirm shipment receipt
+// @Description Confirm receipt of a shipment (consumer only). Lines that are not listed were received in full. Short or damaged quantities open an incident linked to the order.
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Shipment ID"
+// @Param request body ConfirmReceiptRequest true "Received quantities"
+// @Success 200 {object} models.Shipment
+// @Router /consumer/shipments/{id}/confirm [post]
+func (h *ShipmentHandler) ConfirmReceipt(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	shipmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	var req ConfirmReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var consumer models.Consumer
+	if err := h.db.Where("user_id = ?", userID).First(&consumer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+		return
+	}
+
+	var shipment models.Shipment
+	err = h.db.Joins("JOIN orders ON orders.id = shipments.order_id").
+		Where("orders.consumer_id = ?", consumer.ID).
+		Preload("Items").
+		Preload("Items.OrderItem").
+		Preload("Items.OrderItem.Product").
+		First(&shipment, uint(shipmentID)).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+
+	var evt *events.Event
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Shipment{}).
+			Where("id = ? AND confirmed_at IS NULL", shipment.ID).
+			Updates(map[string]interface{}{
+				"status":        models.ShipmentStatusDelivered,
+				"confirmed_at":  now,
+				"delivered_at":  gorm.Expr("COALESCE(delivered_at, ?)", now),
+				"receipt_notes": req.Notes,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errShipmentConfirmed
+		}
+
+		byID := make(map[uint]*models.ShipmentItem, len(shipment.Items))
+		for i := range shipment.Items {
+			item := &shipment.Items[i]
+			received := item.Quantity
+			item.ReceivedQuantity = &received
+			byID[item.ID] = item
+		}
+		for _, line := range req.Items {
+			item, ok := byID[line.ShipmentItemID]
+			if !ok {
+				return errShipmentLine
+			}
+			if line.ReceivedQuantity > item.Quantity || line.DamagedQuantity > line.ReceivedQuantity {
+				return errShipmentReceiptLine
+			}
+			received := line.ReceivedQuantity
+			item.ReceivedQuantity = &received
+			item.DamagedQuantity = line.DamagedQuantity
+		}
+
+		var problems []string
+		for _, item := range shipment.Items {
+			if err := tx.Model(&models.ShipmentItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+				"received_quantity": *item.ReceivedQuantity,
+				"damaged_quantity":  item.DamagedQuantity,
+			}).Error; err != nil {
+				return err
+			}
+			if short := item.Quantity - *item.ReceivedQuantity; short > 0 {
+				problems = append(problems, fmt.Sprintf("%s: %d of %d missing", productName(item), short, item.Quantity))
+			}
+			if item.DamagedQuantity > 0 {
+				problems = append(problems, fmt.Sprintf("%s: %d damaged", productName(item), item.DamagedQuantity))
+			}
+		}
+
+		var order models.Order
+		if err := tx.First(&order, shipment.OrderID).Error; err != nil {
+			return err
+		}
+
+		if len(problems) > 0 {
+			incident, err := openDeliveryIncident(tx, order, userID.(uint), shipment, problems, req.Notes)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Shipment{}).Where("id = ?", shipment.ID).
+				Update("incident_id", incident.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		evt, err = syncOrderStatus(tx, &order, userID.(uint), role.(string), "Receipt confirmed by consumer")
+		return err
+	})
+
+	switch err {
+	case nil:
+	case errShipmentConfirmed:
+		c.JSON(http.StatusConflict, gin.H{"error": "Receipt was already confirmed"})
+		return
+	case errShipmentLine:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shipment item not found in this shipment"})
+		return
+	case errShipmentReceiptLine:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Received quantity cannot exceed the shipped quantity, nor damaged the received quantity"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm receipt"})
+		return
+	}
+
+	if evt != nil {
+		h.bus.Publish(*evt)
+	}
+
+	h.db.Preload("Items").First(&shipment, shipment.ID)
+
+	c.JSON(http.StatusOK, shipment)
+}
+
+// Helper functions
+
+// remainingToShip returns, per order item, the quantity not yet dispatched.
+func remainingToShip(tx *gorm.DB, orderID uint) (map[uint]int, error) {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	var shipped []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	if err := tx.Model(&models.ShipmentItem{}).
+		Select("shipment_items.order_item_id, SUM(shipment_items.quantity) AS quantity").
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id").
+		Where("shipments.order_id = ?", orderID).
+		Group("shipment_items.order_item_id").
+		Scan(&shipped).Error; err != nil {
+		return nil, err
+	}
+
+	remaining := make(map[uint]int, len(items))
+	for _, item := range items {
+		remaining[item.ID] += item.Quantity
+	}
+	for _, row := range shipped {
+		remaining[row.OrderItemID] -= row.Quantity
+	}
+	return remaining, nil
+}
+
+// syncOrderStatus moves the order to the status its shipments imply. It
+// returns the event to publish after commit, or nil if nothing changed.
+func syncOrderStatus(tx *gorm.DB, order *models.Order, actorID uint, role, reason string) (*events.Event, error) {
+	var ordered int64
+	if err := tx.Model(&models.OrderItem{}).
+		Where("order_id = ?", order.ID).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&ordered).Error; err != nil {
+		return nil, err
+	}
+
+	var totals struct {
+		Dispatched int
+		Delivered  int
+	}
+	if err := tx.Model(&models.ShipmentItem{}).
+		Select("COALESCE(SUM(shipment_items.quantity), 0) AS dispatched, "+
+			"COALESCE(SUM(CASE WHEN shipments.status = ? THEN shipment_items.quantity ELSE 0 END), 0) AS delivered",
+			models.ShipmentStatusDelivered).
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id").
+		Where("shipments.order_id = ?", order.ID).
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	next := models.DeriveOrderStatus(order.Status, int(ordered), totals.Dispatched, totals.Delivered)
+	if next == order.Status {
+		return nil, nil
+	}
+
+	evt, err := transitionOrder(tx, order, next, actorID, role, reason)
+	if err != nil {
+		return nil, err
+	}
+	return &evt, nil
+}
+
+// openDeliveryIncident opens an incident for short or damaged goods in the
+// conversation between the consumer and the supplier, creating it if needed.
+func openDeliveryIncident(tx *gorm.DB, order models.Order, userID uint, shipment models.Shipment, problems []string, notes string) (models.Incident, error) {
+	chat := models.Chat{SupplierID: order.SupplierID, ConsumerID: order.ConsumerID}
+	if err := tx.Where("supplier_id = ? AND consumer_id = ?", order.SupplierID, order.ConsumerID).
+		Attrs(models.Chat{Status: "active"}).
+		FirstOrCreate(&chat).Error; err != nil {
+		return models.Incident{}, err
+	}
+
+	description := strings.Join(problems, "\n")
+	if notes != "" {
+		description += "\n\n" + notes
+	}
+
+	orderID := order.ID
+	incident := models.Incident{
+		ConsumerID:  order.ConsumerID,
+		SupplierID:  order.SupplierID,
+		OrderID:     &orderID,
+		ChatID:      chat.ID,
+		Title:       fmt.Sprintf("Delivery problem on order #%d (shipment #%d)", order.ID, shipment.ID),
+		Description: description,
+		Priority:    "high",
+		Status:      "open",
+	}
+	if err := tx.Create(&incident).Error; err != nil {
+		return models.Incident{}, err
+	}
+
+	return incident, tx.Create(&models.IncidentLog{
+		IncidentID: incident.ID,
+		UserID:     userID,
+		Action:     "created",
+		NewValue:   "open",
+		Notes:      "Opened from shipment receipt",
+	}).Error
+}
+
+func shipmentReason(shipment models.Shipment) string {
+	reason := fmt.Sprintf("Shipment #%d dispatched", shipment.ID)
+	if shipment.Carrier != "" {
+		reason += " via " + shipment.Carrier
+	}
+	if shipment.TrackingNumber != "" {
+		reason += ", tracking " + shipment.TrackingNumber
+	}
+	return reason
+}
+
+func productName(item models.ShipmentItem) string {
+	if item.OrderItem != nil && item.OrderItem.Product.Name != "" {
+		return item.OrderItem.Product.Name
+	}
+	return fmt.Sprintf("Order item #%d", item.OrderItemID)
+}
@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"csci361/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StandingOrderHandler struct {
+	db *gorm.DB
+}
+
+func NewStandingOrderHandler(db *gorm.DB) *StandingOrderHandler {
+	return &StandingOrderHandler{db: db}
+}
+
+// StandingOrderRequest defines a standing order. The schedule is given either
+// as a cron expression or as weekdays with a time of day.
+type StandingOrderRequest struct {
+	SupplierID      uint               `json:"supplier_id" binding:"required"`
+	Name            string             `json:"name" binding:"required"`
+	Notes           string             `json:"notes"`
+	Items           []OrderLineRequest `json:"items" binding:"required,min=1,dive"`
+	Cron            string             `json:"cron"`     // e.g. "0 8 * * 1" for Mondays at 08:00
+	Weekdays        []string           `json:"weekdays"` // mon..sun, with At
+	At              string             `json:"at"`       // HH:MM
+	Timezone        string             `json:"timezone"` // IANA name; the supplier's if empty
+	SkipUnavailable *bool              `json:"skip_unavailable"`
+}
+
+var errStandingOrder = errors.New("invalid standing order")
+
+// GetStandingOrders returns the consumer's standing orders
+// @Summary Get standing orders
+// @Description List the consumer's standing orders with their items and next run
+// @Tags standing-orders
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.StandingOrder
+// @Router /consumer/standing-orders [get]
+func (h *StandingOrderHandler) GetStandingOrders(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	var orders []models.StandingOrder
+	if err := h.db.Scopes(ownedByConsumer(consumer.ID)).
+		Preload("Items").Preload("Items.Product").Preload("Supplier").
+		Order("created_at DESC").
+		Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch standing orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// CreateStandingOrder creates a standing order
+// @Summary Create standing order
+// @Description Define a basket that is ordered from a supplier on a schedule (consumer only)
+// @Tags standing-orders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body StandingOrderRequest true "Standing order"
+// @Success 201 {object} models.StandingOrder
+// @Failure 400 {object} map[string]string
+// @Router /consumer/standing-orders [post]
+func (h *StandingOrderHandler) CreateStandingOrder(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	var req StandingOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, msg := h.standingOrderFromRequest(consumer.ID, req, time.Now())
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		// GORM skips false on create because of the column default
+		return tx.Model(&order).Update("skip_unavailable", order.SkipUnavailable).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create standing order"})
+		return
+	}
+
+	h.db.Preload("Items").Preload("Items.Product").Preload("Supplier").First(&order, order.ID)
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// UpdateStandingOrder replaces a standing order
+// @Summary Update standing order
+// @Description Replace the basket, schedule and settings of a standing order. The next run is only recomputed when the schedule or time zone changes, and never moves earlier (consumer only).
+// @Tags standing-orders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Standing order ID"
+// @Param request body StandingOrderRequest true "Standing order"
+// @Success 200 {object} models.StandingOrder
+// @Failure 400 {object} map[string]string
+// @Router /consumer/standing-orders/{id} [put]
+func (h *StandingOrderHandler) UpdateStandingOrder(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	order, ok := h.findStandingOrder(c, consumer.ID)
+	if !ok {
+		return
+	}
+
+	var req StandingOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, msg := h.standingOrderFromRequest(consumer.ID, req, time.Now())
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"supplier_id":      updated.SupplierID,
+		"name":             updated.Name,
+		"notes":            updated.Notes,
+		"schedule":         updated.Schedule,
+		"timezone":         updated.Timezone,
+		"skip_unavailable": updated.SkipUnavailable,
+	}
+	// A paused standing order gets its next run when it is resumed. An active
+	// one keeps its next run unless the schedule changed, and a skipped run
+	// stays skipped: the new schedule starts no earlier than the stored run.
+	rescheduled := updated.Schedule != order.Schedule || updated.Timezone != order.Timezone
+	if order.Status == models.StandingOrderActive && (rescheduled || order.NextRunAt == nil) {
+		if order.NextRunAt != nil && updated.NextRunAt.Before(*order.NextRunAt) {
+			// Schedules have minute precision, so this is the first run at or after the stored one
+			next, err := updated.NextRun(order.NextRunAt.Add(-time.Minute))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updated.NextRunAt = &next
+		}
+		updates["next_run_at"] = updated.NextRunAt
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("standing_order_id = ?", order.ID).Delete(&models.StandingOrderItem{}).Error; err != nil {
+			return err
+		}
+		for i := range updated.Items {
+			updated.Items[i].StandingOrderID = order.ID
+		}
+		return tx.Create(&updated.Items).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update standing order"})
+		return
+	}
+
+	h.db.Preload("Items").Preload("Items.Product").Preload("Supplier").First(&order, order.ID)
+
+	c.JSON(http.StatusOK, order)
+}
+
+// DeleteStandingOrder deletes a standing order
+// @Summary Delete standing order
+// @Description Stop and delete a standing order. Orders it already placed are kept (consumer only).
+// @Tags standing-orders
+// @Security BearerAuth
+// @Param id path int true "Standing order ID"
+// @Success 200 {object} map[string]string
+// @Router /consumer/standing-orders/{id} [delete]
+func (h *StandingOrderHandler) DeleteStandingOrder(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	order, ok := h.findStandingOrder(c, consumer.ID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(&order).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete standing order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Standing order deleted successfully"})
+}
+
+// PauseStandingOrder pauses a standing order
+// @Summary Pause standing order
+// @Description Stop placing orders until the standing order is resumed (consumer only)
+// @Tags standing-orders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Standing order ID"
+// @Success 200 {object} models.StandingOrder
+// @Router /consumer/standing-orders/{id}/pause [post]
+func (h *StandingOrderHandler) PauseStandingOrder(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	order, ok := h.findStandingOrder(c, consumer.ID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Model(&order).Updates(map[string]interface{}{
+		"status":      models.StandingOrderPaused,
+		"next_run_at": nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pause standing order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ResumeStandingOrder resumes a paused standing order
+// @Summary Resume standing order
+// @Description Place orders again from the next scheduled time; runs missed while paused are not made up (consumer only)
+// @Tags standing-orders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Standing order ID"
+// @Success 200 {object} models.StandingOrder
+// @Router /consumer/standing-orders/{id}/resume [post]
+func (h *StandingOrderHandler) ResumeStandingOrder(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	order, ok := h.findStandingOrder(c, consumer.ID)
+	if !ok {
+		return
+	}
+
+	next, err := order.NextRun(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid schedule"})
+		return
+	}
+
+	if err := h.db.Model(&order).Updates(map[string]interface{}{
+		"status":      models.StandingOrderActive,
+		"next_run_at": next,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume standing order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// SkipStandingOrderRun skips the next run of a standing order
+// @Summary Skip next run
+// @Description Skip the next scheduled run of an active standing order; the one after it goes ahead (consumer only)
+// @Tags standing-orders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Standing order ID"
+// @Success 200 {object} models.StandingOrder
+// @Failure 409 {object} map[string]string
+// @Router /consumer/standing-orders/{id}/skip [post]
+func (h *StandingOrderHandler) SkipStandingOrderRun(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	order, ok := h.findStandingOrder(c, consumer.ID)
+	if !ok {
+		return
+	}
+
+	if order.Status != models.StandingOrderActive || order.NextRunAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only an active standing order has a run to skip"})
+		return
+	}
+
+	skipped := *order.NextRunAt
+	next, err := order.NextRun(skipped)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid schedule"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Only skip the run the consumer saw; the scheduler may have taken it
+		result := tx.Model(&order).
+			Where("next_run_at = ?", skipped).
+			Update("next_run_at", next)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStandingOrder
+		}
+		return tx.Create(&models.StandingOrderRun{
+			StandingOrderID: order.ID,
+			ScheduledFor:    skipped,
+			Status:          models.StandingOrderRunSkipped,
+		}).Error
+	})
+
+	switch err {
+	case nil:
+	case errStandingOrder:
+		c.JSON(http.StatusConflict, gin.H{"error": "The run has already started"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to skip run"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// GetStandingOrderRuns returns the runs of a standing order
+// @Summary Get standing order runs
+// @Description List what the runs of a standing order did, newest first (consumer only)
+// @Tags standing-orders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Standing order ID"
+// @Success 200 {array} models.StandingOrderRun
+// @Router /consumer/standing-orders/{id}/runs [get]
+func (h *StandingOrderHandler) GetStandingOrderRuns(c *gin.Context) {
+	consumer, ok := h.currentConsumer(c)
+	if !ok {
+		return
+	}
+
+	order, ok := h.findStandingOrder(c, consumer.ID)
+	if !ok {
+		return
+	}
+
+	var runs []models.StandingOrderRun
+	if err := h.db.Where("standing_order_id = ?", order.ID).
+		Order("scheduled_for DESC, id DESC").
+		Limit(100).
+		Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// Helper functions
+
+func (h *StandingOrderHandler) currentConsumer(c *gin.Context) (models.Consumer, bool) {
+	userID, _ := c.Get("user_id")
+
+	var consumer models.Consumer
+	if err := h.db.Where("user_id = ?", userID).First(&consumer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+		return consumer, false
+	}
+	return consumer, true
+}
+
+func (h *StandingOrderHandler) findStandingOrder(c *gin.Context, consumerID uint) (models.StandingOrder, bool) {
+	var order models.StandingOrder
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid standing order ID"})
+		return order, false
+	}
+
+	if err := h.db.Scopes(ownedByConsumer(consumerID)).First(&order, uint(orderID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Standing order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+// standingOrderFromRequest validates req and returns the active standing
+// order it describes with its first run after now, or why it is invalid.
+// Availability and stock are only checked when a run places its order.
+func (h *StandingOrderHandler) standingOrderFromRequest(consumerID uint, req StandingOrderRequest, now time.Time) (models.StandingOrder, string) {
+	order := models.StandingOrder{
+		ConsumerID:      consumerID,
+		SupplierID:      req.SupplierID,
+		Name:            req.Name,
+		Notes:           req.Notes,
+		Timezone:        req.Timezone,
+		Status:          models.StandingOrderActive,
+		SkipUnavailable: true,
+	}
+	if req.SkipUnavailable != nil {
+		order.SkipUnavailable = *req.SkipUnavailable
+	}
+
+	var link models.ConsumerSupplierLink
+	if err := h.db.Where("consumer_id = ? AND supplier_id = ? AND status = ?",
+		consumerID, req.SupplierID, "approved").First(&link).Error; err != nil {
+		return order, "Not linked to this supplier"
+	}
+	var supplier models.Supplier
+	if err := h.db.First(&supplier, req.SupplierID).Error; err != nil {
+		return order, "Not linked to this supplier"
+	}
+
+	switch {
+	case req.Cron != "" && len(req.Weekdays) > 0:
+		return order, "Give either cron or weekdays, not both"
+	case req.Cron != "":
+		if _, err := models.ParseSchedule(req.Cron); err != nil {
+			return order, err.Error()
+		}
+		order.Schedule = req.Cron
+	default:
+		schedule, err := models.WeeklySchedule(req.Weekdays, req.At)
+		if err != nil {
+			return order, err.Error()
+		}
+		order.Schedule = schedule
+	}
+
+	if order.Timezone == "" {
+		order.Timezone = supplier.Location().String()
+	}
+	if _, err := time.LoadLocation(order.Timezone); err != nil {
+		return order, "Unknown time zone"
+	}
+
+	seen := map[uint]bool{}
+	productIDs := make([]uint, 0, len(req.Items))
+	for _, item := range req.Items {
+		if seen[item.ProductID] {
+			return order, "Each product may appear once"
+		}
+		seen[item.ProductID] = true
+		productIDs = append(productIDs, item.ProductID)
+		order.Items = append(order.Items, models.StandingOrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	var owned int64
+	h.db.Model(&models.Product{}).
+		Where("id IN ? AND supplier_id = ?", productIDs, req.SupplierID).
+		Count(&owned)
+	if int(owned) != len(productIDs) {
+		return order, "Standing order contains products of another supplier or unknown products"
+	}
+
+	next, err := order.NextRun(now)
+	if err != nil {
+		return order, err.Error()
+	}
+	order.NextRunAt = &next
+	return order, ""
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"csci361/events"
+	"csci361/models"
+	ws "csci361/websocket"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RegisterSubscribers wires the notification, live update and analytics
+// reactions to domain events.
+func RegisterSubscribers(bus *events.Bus, db *gorm.DB, live LivePublisher) {
+	bus.Subscribe(events.OrderCreated, notifyOrderCreated(db, live))
+	bus.Subscribe(events.OrderCreated, pushOrderEvent(db, live))
+	bus.Subscribe(events.OrderCreated, recordOrderMetrics(db))
+	bus.Subscribe(events.OrderStatusChanged, notifyOrderStatusChanged(db, live))
+	bus.Subscribe(events.OrderStatusChanged, pushOrderEvent(db, live))
+	bus.Subscribe(events.OrderStatusChanged, recordOrderMetrics(db))
+	bus.Subscribe(events.OrderUpdated, notifyOrderUpdated(db, live))
+	bus.Subscribe(events.OrderUpdated, pushOrderEvent(db, live))
+	bus.Subscribe(events.ReturnRequested, notifyReturnRequested(db, live))
+	bus.Subscribe(events.ReturnDecided, notifyReturnToConsumer(db, live))
+	bus.Subscribe(events.ReturnReceived, notifyReturnToConsumer(db, live))
+	bus.Subscribe(events.ReturnReceived, recordReturnMetrics(db))
+}
+
+// notifyOrderCreated tells the supplier's staff about a new order.
+func notifyOrderCreated(db *gorm.DB, live LivePublisher) events.Handler {
+	return func(evt events.Event) error {
+		return notifySupplierStaff(db, live, evt.SupplierID, models.Notification{
+			Title:   fmt.Sprintf("New order #%d", evt.OrderID),
+			Content: fmt.Sprintf("A new order of %s %s is waiting for confirmation.", evt.Amount, evt.Currency),
+			Type:    "info",
+		})
+	}
+}
+
+// notifyOrderUpdated tells the supplier's staff that a consumer changed a
+// pending order.
+func notifyOrderUpdated(db *gorm.DB, live LivePublisher) events.Handler {
+	return func(evt events.Event) error {
+		return notifySupplierStaff(db, live, evt.SupplierID, models.Notification{
+			Title:   fmt.Sprintf("Order #%d was changed", evt.OrderID),
+			Content: evt.Reason,
+			Type:    "info",
+		})
+	}
+}
+
+// notifyOrderStatusChanged tells the other side of the order about a status
+// change: the consumer when staff moved it, the staff when the consumer did.
+func notifyOrderStatusChanged(db *gorm.DB, live LivePublisher) events.Handler {
+	return func(evt events.Event) error {
+		notification := models.Notification{
+			Title:   fmt.Sprintf("Order #%d is %s", evt.OrderID, evt.ToStatus),
+			Content: evt.Reason,
+			Type:    "info",
+		}
+		if evt.ToStatus == models.OrderStatusCancelled {
+			notification.Type = "warning"
+		}
+
+		if evt.ActorRole == models.RoleConsumer {
+			return notifySupplierStaff(db, live, evt.SupplierID, notification)
+		}
+
+		var consumer models.Consumer
+		if err := db.Select("id", "user_id").First(&consumer, evt.ConsumerID).Error; err != nil {
+			return err
+		}
+		notification.UserID = consumer.UserID
+		return saveNotifications(db, live, notification)
+	}
+}
+
+// notifyReturnRequested tells the supplier's staff that a consumer wants to
+// send goods back.
+func notifyReturnRequested(db *gorm.DB, live LivePublisher) events.Handler {
+	return func(evt events.Event) error {
+		return notifySupplierStaff(db, live, evt.SupplierID, models.Notification{
+			Title:   fmt.Sprintf("Return requested for order #%d", evt.OrderID),
+			Content: fmt.Sprintf("Return #%d of %s %s: %s", evt.ReturnID, evt.Amount, evt.Currency, evt.Reason),
+			Type:    "warning",
+		})
+	}
+}
+
+// notifyReturnToConsumer tells the consumer how their return progressed.
+func notifyReturnToConsumer(db *gorm.DB, live LivePublisher) events.Handler {
+	return func(evt events.Event) error {
+		notification := models.Notification{
+			Title:   fmt.Sprintf("Return #%d is %s", evt.ReturnID, evt.ToStatus),
+			Content: evt.Reason,
+			Type:    "info",
+		}
+		switch evt.ToStatus {
+		case models.ReturnStatusRejected:
+			notification.Type = "warning"
+		case models.ReturnStatusReceived:
+			notification.Type = "success"
+			notification.Content = fmt.Sprintf("Credit note %s issued for %s %s.", evt.Reason, evt.Amount, evt.Currency)
+		}
+
+		var consumer models.Consumer
+		if err := db.Select("id", "user_id").First(&consumer, evt.ConsumerID).Error; err != nil {
+			return err
+		}
+		notification.UserID = consumer.UserID
+		return saveNotifications(db, live, notification)
+	}
+}
+
+// pushOrderEvent passes order events on to the live connections of the
+// order's consumer and of the supplier's staff.
+func pushOrderEvent(db *gorm.DB, live LivePublisher) events.Handler {
+	return func(evt events.Event) error {
+		var consumer models.Consumer
+		if err := db.Select("id", "user_id").First(&consumer, evt.ConsumerID).Error; err != nil {
+			return err
+		}
+
+		event := ws.Event{
+			Event: evt.Type,
+			Data: map[string]interface{}{
+				"order_id":    evt.OrderID,
+				"from_status": evt.FromStatus,
+				"to_status":   evt.ToStatus,
+				"total":       evt.Amount,
+				"currency":    evt.Currency,
+			},
+		}
+		if evt.ActorID != nil {
+			event.UserID = *evt.ActorID
+		}
+		live.PublishToSupplier(evt.SupplierID, event)
+		live.PublishToUser(consumer.UserID, event)
+		return nil
+	}
+}
+
+// recordOrderMetrics keeps daily per-supplier order counters and amounts in
+// the analytics table: orders_<status> and gmv_<status>, the latter per
+// currency.
+func recordOrderMetrics(db *gorm.DB) events.Handler {
+	return func(evt events.Event) error {
+		day := evt.OccurredAt.Truncate(24 * time.Hour)
+
+		if err := addDailyMetrics(db, evt.SupplierID, day, "", map[string]interface{}{
+			"orders_" + evt.ToStatus: 1,
+		}); err != nil {
+			return err
+		}
+		return addDailyMetrics(db, evt.SupplierID, day, evt.Currency, map[string]interface{}{
+			"gmv_" + evt.ToStatus: evt.Amount,
+		})
+	}
+}
+
+// recordReturnMetrics keeps daily per-supplier counters of received returns
+// and the amount credited for them.
+func recordReturnMetrics(db *gorm.DB) events.Handler {
+	return func(evt events.Event) error {
+		day := evt.OccurredAt.Truncate(24 * time.Hour)
+
+		if err := addDailyMetrics(db, evt.SupplierID, day, "", map[string]interface{}{
+			"returns_received": 1,
+		}); err != nil {
+			return err
+		}
+		return addDailyMetrics(db, evt.SupplierID, day, evt.Currency, map[string]interface{}{
+			"credit_notes": evt.Amount,
+		})
+	}
+}
+
+func addDailyMetrics(db *gorm.DB, supplierID uint, day time.Time, currency string, values map[string]interface{}) error {
+	for metric, value := range values {
+		row := models.Analytics{SupplierID: supplierID, Date: day, MetricType: metric, Currency: currency}
+		if err := db.Where("supplier_id = ? AND date = ? AND metric_type = ? AND currency = ?", supplierID, day, metric, currency).
+			FirstOrCreate(&row).Error; err != nil {
+			return err
+		}
+		if err := db.Model(&row).Update("value", gorm.Expr("value + ?", value)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notifySupplierStaff(db *gorm.DB, live LivePublisher, supplierID uint, template models.Notification) error {
+	var staff []models.User
+	if err := db.Select("id").
+		Where("supplier_id = ? AND is_active = ? AND role IN ?", supplierID, true,
+			[]string{models.RoleOwner, models.RoleAdmin, models.RoleSales}).
+		Find(&staff).Error; err != nil {
+		return err
+	}
+
+	notifications := make([]models.Notification, 0, len(staff))
+	for _, user := range staff {
+		notification := template
+		notification.UserID = user.ID
+		notifications = append(notifications, notification)
+	}
+	return saveNotifications(db, live, notifications...)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"csci361/models"
+	"csci361/money"
 	"net/http"
 	"strconv"
 	"time"
@@ -27,15 +28,11 @@ func NewSupplierHandler(db *gorm.DB) *SupplierHandler {
 // @Success 200 {array} models.ConsumerSupplierLink
 // @Router /sales/link-requests [get]
 func (h *SupplierHandler) GetLinkRequests(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	var linkRequests []models.ConsumerSupplierLink
 	err := h.db.Where("supplier_id = ? AND status = ?", supplierID, "pending").
 		Preload("Consumer").
@@ -63,6 +60,11 @@ func (h *SupplierHandler) GetLinkRequests(c *gin.Context) {
 // @Success 200 {object} models.ConsumerSupplierLink
 // @Router /sales/link-requests/{id} [put]
 func (h *SupplierHandler) HandleLinkRequest(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
@@ -79,7 +81,7 @@ func (h *SupplierHandler) HandleLinkRequest(c *gin.Context) {
 	}
 
 	var link models.ConsumerSupplierLink
-	if err := h.db.First(&link, uint(linkID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&link, uint(linkID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Link request not found"})
 		return
 	}
@@ -139,7 +141,7 @@ func (h *SupplierHandler) GetAllSuppliers(c *gin.Context) {
 
 // VerifySupplier marks a supplier as verified
 // @Summary Verify supplier
-// @Description Verify supplier account (platform admin only)
+// @Description Verify supplier account (platform admin only). Suppliers that never requested verification, such as those created before requests existed, can be verified as well.
 // @Tags suppliers
 // @Security BearerAuth
 // @Param id path int true "Supplier ID"
@@ -159,7 +161,13 @@ func (h *SupplierHandler) VerifySupplier(c *gin.Context) {
 	}
 
 	supplier.IsVerified = true
-	if err := h.db.Save(&supplier).Error; err != nil {
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&supplier).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditSupplierVerified, "supplier", supplier.ID, supplier.CompanyName)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify supplier"})
 		return
 	}
@@ -167,6 +175,229 @@ func (h *SupplierHandler) VerifySupplier(c *gin.Context) {
 	c.JSON(http.StatusOK, supplier)
 }
 
+// RequestVerification submits the caller's supplier for platform verification
+// @Summary Request supplier verification
+// @Description Submit the supplier for verification by the platform (owner only, email must be verified)
+// @Tags suppliers
+// @Security BearerAuth
+// @Success 200 {object} models.Supplier
+// @Failure 403 {object} map[string]string
+// @Router /owner/verification-request [post]
+func (h *SupplierHandler) RequestVerification(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var owner models.User
+	if err := h.db.First(&owner, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if owner.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address before requesting supplier verification"})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := h.db.First(&supplier, supplierID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	if supplier.IsVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier is already verified"})
+		return
+	}
+
+	now := time.Now()
+	supplier.VerificationRequestedAt = &now
+	if err := h.db.Save(&supplier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, supplier)
+}
+
+// UpdateSecurityPolicy changes the supplier's staff security settings
+// @Summary Update security policy
+// @Description Require or stop requiring two-factor authentication for all staff of the supplier
+// @Tags suppliers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.Supplier
+// @Failure 400 {object} map[string]string
+// @Router /owner/security-policy [put]
+func (h *SupplierHandler) UpdateSecurityPolicy(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		RequireMFA *bool `json:"require_mfa" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var owner models.User
+	if err := h.db.First(&owner, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Keeps owners from locking themselves out of their own supplier
+	if *req.RequireMFA && owner.MFAEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enable two-factor authentication on your own account first"})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := h.db.First(&supplier, supplierID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	if err := h.db.Model(&supplier).Update("require_mfa", *req.RequireMFA).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update security policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, supplier)
+}
+
+// UpdateInvoiceSettings sets the VAT rate shown on new invoices (owner only)
+// @Summary Update invoice settings
+// @Description Set the VAT percentage included in catalog prices. Invoices already issued keep their rate.
+// @Tags suppliers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body map[string]float64 true "VAT rate"
+// @Success 200 {object} models.Supplier
+// @Failure 400 {object} map[string]string
+// @Router /owner/invoice-settings [put]
+func (h *SupplierHandler) UpdateInvoiceSettings(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		VATRate *float64 `json:"vat_rate" binding:"required,min=0,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := h.db.First(&supplier, supplierID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	if err := h.db.Model(&supplier).Update("vat_rate", *req.VATRate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invoice settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, supplier)
+}
+
+// OrderingRulesRequest replaces a supplier's ordering rules. Omitted fields
+// are cleared.
+type OrderingRulesRequest struct {
+	MinOrderValue    money.Amount `json:"min_order_value" binding:"min=0"`
+	MinOrderCurrency string       `json:"min_order_currency"` // KZT if empty; orders in other currencies are converted
+	DeliveryDays     []string     `json:"delivery_days"`      // mon..sun; empty if deliveries are not scheduled
+	OrderCutoff      string       `json:"order_cutoff"`       // HH:MM; end of the cutoff day if empty
+	CutoffDaysBefore int          `json:"cutoff_days_before" binding:"min=0,max=14"`
+	Timezone         string       `json:"timezone"` // IANA name; Asia/Almaty if empty
+}
+
+// UpdateOrderingRules sets the minimum order value and delivery schedule
+// @Summary Update ordering rules
+// @Description Set the minimum order value and the delivery days with their order cutoff (admin/owner only). Orders in another currency than the minimum's are converted at the current exchange rates. Orders for a delivery day close cutoff_days_before days earlier at order_cutoff, in the supplier's time zone.
+// @Tags suppliers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body OrderingRulesRequest true "Ordering rules"
+// @Success 200 {object} models.Supplier
+// @Failure 400 {object} map[string]string
+// @Router /admin/ordering-rules [put]
+func (h *SupplierHandler) UpdateOrderingRules(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
+	var req OrderingRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	days, err := models.ParseDeliveryDays(req.DeliveryDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.OrderCutoff != "" {
+		if _, _, err := models.ParseCutoff(req.OrderCutoff); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.MinOrderCurrency == "" {
+		req.MinOrderCurrency = money.KZT
+	}
+	if !money.Supported(req.MinOrderCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "currencies": money.Currencies()})
+		return
+	}
+	if req.Timezone == "" {
+		req.Timezone = "Asia/Almaty"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := h.db.First(&supplier, supplierID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	if err := h.db.Model(&supplier).Updates(map[string]interface{}{
+		"min_order_value":    req.MinOrderValue,
+		"min_order_currency": req.MinOrderCurrency,
+		"delivery_days":      days,
+		"order_cutoff":       req.OrderCutoff,
+		"cutoff_days_before": req.CutoffDaysBefore,
+		"timezone":           req.Timezone,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ordering rules"})
+		return
+	}
+
+	if slot, ok := supplier.UpcomingDelivery(time.Now()); ok {
+		supplier.NextDelivery = &slot
+	}
+	c.JSON(http.StatusOK, supplier)
+}
+
 // SuspendSupplier suspends a supplier account
 // @Summary Suspend supplier
 // @Description Suspend supplier account (platform admin only)
@@ -189,7 +420,13 @@ func (h *SupplierHandler) SuspendSupplier(c *gin.Context) {
 	}
 
 	supplier.IsActive = false
-	if err := h.db.Save(&supplier).Error; err != nil {
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&supplier).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditSupplierSuspended, "supplier", supplier.ID, supplier.CompanyName)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend supplier"})
 		return
 	}
@@ -206,15 +443,11 @@ func (h *SupplierHandler) SuspendSupplier(c *gin.Context) {
 // @Success 200 {object} models.Subscription
 // @Router /admin/subscription [get]
 func (h *SupplierHandler) GetSubscription(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	var subscription models.Subscription
 	if err := h.db.Where("supplier_id = ?", supplierID).First(&subscription).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
@@ -235,15 +468,11 @@ func (h *SupplierHandler) GetSubscription(c *gin.Context) {
 // @Success 200 {object} models.Subscription
 // @Router /admin/subscription [put]
 func (h *SupplierHandler) UpdateSubscription(c *gin.Context) {
-	_, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
 		return
 	}
 
-	// TODO: Get supplier ID from user relationship
-	supplierID := uint(1) // Placeholder
-
 	var updateData struct {
 		PlanName     string `json:"plan_name"`
 		BillingCycle string `json:"billing_cycle"`
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// newOpaqueToken returns a random URL-safe token together with the hash that
+// should be stored in the database. Only the hash is ever persisted.
+func newOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 of an opaque token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -10,11 +10,12 @@ import (
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	db   *gorm.DB
+	live LivePublisher
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(db *gorm.DB, live LivePublisher) *UserHandler {
+	return &UserHandler{db: db, live: live}
 }
 
 // GetProfile returns current user profile
@@ -131,7 +132,7 @@ func (h *UserHandler) UploadAvatar(c *gin.Context) {
 
 // GetUsers returns list of users (admin only)
 // @Summary Get users list
-// @Description Get list of all users (admin/owner only)
+// @Description Get list of users of the caller's supplier (admin/owner only)
 // @Tags users
 // @Produce json
 // @Security BearerAuth
@@ -141,6 +142,11 @@ func (h *UserHandler) UploadAvatar(c *gin.Context) {
 // @Failure 403 {object} map[string]string
 // @Router /admin/users [get]
 func (h *UserHandler) GetUsers(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	offset := (page - 1) * limit
@@ -148,8 +154,8 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 	var users []models.User
 	var total int64
 
-	h.db.Model(&models.User{}).Count(&total)
-	if err := h.db.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	h.db.Model(&models.User{}).Where("supplier_id = ?", supplierID).Count(&total)
+	if err := h.db.Where("supplier_id = ?", supplierID).Offset(offset).Limit(limit).Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
@@ -168,92 +174,89 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 	})
 }
 
-// CreateUser creates a new user (admin only)
-// @Summary Create new user
-// @Description Create a new user account (admin/owner only)
-// @Tags users
-// @Accept json
-// @Produce json
-// @Security BearerAuth
-// @Param request body models.User true "User information"
-// @Success 201 {object} models.User
-// @Failure 400 {object} map[string]string
-// @Router /admin/users [post]
-func (h *UserHandler) CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Check if user already exists
-	var existingUser models.User
-	if err := h.db.Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User already exists"})
-		return
-	}
-
-	// Set default values
-	user.IsActive = true
-
-	if err := h.db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
-	}
-
-	user.Password = "" // Remove password from response
-	c.JSON(http.StatusCreated, user)
+// UpdateUserRequest changes a staff member's details. Only the fields sent
+// are changed.
+type UpdateUserRequest struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Phone     *string `json:"phone"`
+	IsActive  *bool   `json:"is_active"`
 }
 
 // UpdateUser updates user information (admin only)
 // @Summary Update user
-// @Description Update user information (admin/owner only)
+// @Description Update user information (admin/owner only). The owner and the caller cannot be deactivated.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "User ID"
-// @Param request body models.User true "Updated user information"
+// @Param request body UpdateUserRequest true "Updated user information"
 // @Success 200 {object} models.User
 // @Failure 400 {object} map[string]string
 // @Router /admin/users/{id} [put]
 func (h *UserHandler) UpdateUser(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	var updateData models.User
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	var user models.User
-	if err := h.db.First(&user, uint(userID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&user, uint(userID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Update allowed fields
-	user.FirstName = updateData.FirstName
-	user.LastName = updateData.LastName
-	user.Phone = updateData.Phone
-	user.IsActive = updateData.IsActive
+	// Update the fields sent
+	if req.FirstName != nil {
+		user.FirstName = *req.FirstName
+	}
+	if req.LastName != nil {
+		user.LastName = *req.LastName
+	}
+	if req.Phone != nil {
+		user.Phone = *req.Phone
+	}
+	deactivated := req.IsActive != nil && !*req.IsActive && user.IsActive
+	if deactivated {
+		if msg := deactivationRefused(c, user); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+	if req.IsActive != nil {
+		user.IsActive = *req.IsActive
+	}
 
 	if err := h.db.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
 
+	if deactivated {
+		revokeUserSessions(h.db, user.ID)
+		h.live.DisconnectUser(user.ID)
+	}
+
 	user.Password = "" // Remove password from response
 	c.JSON(http.StatusOK, user)
 }
 
 // DeleteUser deactivates a user (admin only)
 // @Summary Delete user
-// @Description Deactivate a user account (admin/owner only)
+// @Description Deactivate a user account (admin/owner only). The owner and the caller cannot be deactivated.
 // @Tags users
 // @Security BearerAuth
 // @Param id path int true "User ID"
@@ -261,6 +264,11 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Router /admin/users/{id} [delete]
 func (h *UserHandler) DeleteUser(c *gin.Context) {
+	supplierID, ok := currentSupplierID(c)
+	if !ok {
+		return
+	}
+
 	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
@@ -268,11 +276,16 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := h.db.First(&user, uint(userID)).Error; err != nil {
+	if err := h.db.Scopes(ownedBySupplier(supplierID)).First(&user, uint(userID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
+	if msg := deactivationRefused(c, user); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
 	// Soft delete by setting IsActive to false
 	user.IsActive = false
 	if err := h.db.Save(&user).Error; err != nil {
@@ -280,5 +293,22 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// Sign the user out everywhere
+	revokeUserSessions(h.db, user.ID)
+	h.live.DisconnectUser(user.ID)
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// deactivationRefused returns why the caller may not deactivate user, or an
+// empty string if they may. Nobody can lock out the supplier's owner or
+// themselves.
+func deactivationRefused(c *gin.Context, user models.User) string {
+	if userID, _ := c.Get("user_id"); userID == user.ID {
+		return "You cannot deactivate your own account"
+	}
+	if user.Role == models.RoleOwner {
+		return "The supplier's owner cannot be deactivated"
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"csci361/config"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Message represents an outgoing email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer selected by cfg.MailDriver.
+func New(cfg *config.Config) Mailer {
+	switch cfg.MailDriver {
+	case "file":
+		return NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	default:
+		return NewLogMailer()
+	}
+}
+
+// LogMailer writes messages to the application log instead of sending them.
+// It is meant for local development.
+type LogMailer struct{}
+
+// NewLogMailer creates a new log-only mailer.
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs the message.
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in a directory, so
+// links in development emails can be opened without a mail server.
+type FileMailer struct {
+	dir  string
+	from string
+	seq  uint64
+}
+
+// NewFileMailer creates a mailer that writes messages into dir.
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send writes the message to a new file.
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	seq := atomic.AddUint64(&m.seq, 1)
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%04d-%s.eml", time.Now().Format("20060102-150405"), seq, recipient)
+
+	content := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		m.from, msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644)
+}
@@ -1,15 +1,9 @@
 package main
 
 import (
-	"csci361/config"
-	"csci361/database"
-	"csci361/middleware"
-	"csci361/routes"
+	"csci361/cli"
 	"log"
-	"net/http"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"os"
 )
 
 // @title Supply Chain Platform API
@@ -32,49 +26,7 @@ import (
 // @name Authorization
 
 func main() {
-	// Load configuration
-	cfg := config.Load()
-
-	// Initialize database
-	db := database.Initialize(cfg)
-
-	// Run migrations
-	database.Migrate(db)
-
-	// Initialize Gin router
-	if cfg.Environment == "production" {
-		gin.SetMode(gin.ReleaseMode)
-	}
-
-	r := gin.Default()
-
-	// CORS configuration
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowOrigins = []string{"http://localhost:3000", "https://*.vercel.app"}
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"}
-	corsConfig.AllowCredentials = true
-	r.Use(cors.New(corsConfig))
-
-	// Global middleware
-	r.Use(middleware.RequestLogger())
-	r.Use(middleware.ErrorHandler())
-
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "supply-chain-platform",
-			"version": "1.0.0",
-		})
-	})
-
-	// Initialize routes
-	routes.Initialize(r, db, cfg)
-
-	// Start server
-	log.Printf("Server starting on port %s", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if err := cli.Run(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
 }
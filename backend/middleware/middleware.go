@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"csci361/config"
+	"csci361/models"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 func RequestLogger() gin.HandlerFunc {
@@ -44,14 +46,42 @@ func ErrorHandler() gin.HandlerFunc {
 	}
 }
 
+// Token types carried in the "typ" claim.
+const (
+	TokenTypeAccess    = "access"
+	TokenTypeRefresh   = "refresh"
+	TokenTypeWebSocket = "ws" // short-lived ticket to open a WebSocket
+)
+
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	TokenType string `json:"typ"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// ParseToken validates a signed token and returns its claims.
+func ParseToken(tokenString, secret string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// AuthMiddleware accepts access tokens whose user is still active and whose
+// session has not been revoked.
+func AuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -64,12 +94,8 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := ParseToken(tokenString, cfg.JWTSecret)
+		if err != nil || claims.TokenType != TokenTypeAccess {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid token",
 			})
@@ -77,13 +103,95 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
+		var user models.User
+		if err := db.Select("id", "email", "role", "is_active").First(&user, claims.UserID).Error; err != nil || !user.IsActive {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "User is inactive or does not exist",
+			})
+			c.Abort()
+			return
+		}
+
+		var session models.Session
+		if err := db.Select("id", "revoked_at").Where("uuid = ? AND user_id = ?", claims.SessionID, user.ID).
+			First(&session).Error; err != nil || session.RevokedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Session has been revoked",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("email", user.Email)
+		c.Set("role", user.Role)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
 
+// TenantMiddleware resolves the supplier that the authenticated staff member
+// belongs to and stores its ID in the context under "supplier_id". Staff who
+// have not enrolled in MFA are turned away when their supplier requires it.
+// It must run after AuthMiddleware.
+func TenantMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "User not authenticated",
+			})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := db.Select("id", "supplier_id", "mfa_enabled_at").First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "User not found",
+			})
+			c.Abort()
+			return
+		}
+
+		if user.SupplierID == nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "User is not linked to a supplier",
+			})
+			c.Abort()
+			return
+		}
+
+		if user.MFAEnabledAt == nil {
+			var supplier models.Supplier
+			if err := db.Select("id", "require_mfa").First(&supplier, *user.SupplierID).Error; err == nil && supplier.RequireMFA {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":                   "Your organization requires two-factor authentication",
+					"mfa_enrollment_required": true,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("supplier_id", *user.SupplierID)
+		c.Next()
+	}
+}
+
+// StaffTenantMiddleware applies TenantMiddleware to supplier staff and lets
+// consumers through, for routes that both sides of a conversation share.
+func StaffTenantMiddleware(db *gorm.DB) gin.HandlerFunc {
+	tenant := TenantMiddleware(db)
+	return func(c *gin.Context) {
+		if role, _ := c.Get("role"); role == models.RoleConsumer {
+			c.Next()
+			return
+		}
+		tenant(c)
+	}
+}
+
 func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("role")
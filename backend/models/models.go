@@ -1,6 +1,7 @@
 package models
 
 import (
+	"csci361/money"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,24 +14,39 @@ const (
 	RoleAdmin    = "admin"
 	RoleSales    = "sales"
 	RoleConsumer = "consumer"
+
+	// RolePlatformAdmin operates the platform itself and is not tied to a
+	// supplier. The first one is created with the create-platform-admin command.
+	RolePlatformAdmin = "platform_admin"
 )
 
+// ActorSystem is the actor role recorded for changes the platform makes by
+// itself, such as orders placed by a standing order.
+const ActorSystem = "system"
+
+// DefaultPlanName is the subscription plan given to newly registered suppliers.
+const DefaultPlanName = "basic"
+
 // User represents the base user model.
 type User struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	UUID       string         `json:"uuid" gorm:"uniqueIndex;not null"`
-	Email      string         `json:"email" gorm:"uniqueIndex;not null"`
-	Password   string         `json:"-" gorm:"not null"`
-	Role       string         `json:"role" gorm:"not null"`
-	SupplierID *uint          `json:"supplier_id"` // Foreign key for supplier employees (owner, admin, sales)
-	FirstName  string         `json:"first_name"`
-	LastName   string         `json:"last_name"`
-	Phone      string         `json:"phone"`
-	Avatar     string         `json:"avatar"`
-	IsActive   bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	UUID            string         `json:"uuid" gorm:"uniqueIndex;not null"`
+	Email           string         `json:"email" gorm:"uniqueIndex;not null"`
+	Password        string         `json:"-" gorm:"not null"`
+	Role            string         `json:"role" gorm:"not null"`
+	SupplierID      *uint          `json:"supplier_id"` // Foreign key for supplier employees (owner, admin, sales)
+	FirstName       string         `json:"first_name"`
+	LastName        string         `json:"last_name"`
+	Phone           string         `json:"phone"`
+	Avatar          string         `json:"avatar"`
+	IsActive        bool           `json:"is_active" gorm:"default:true"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at"` // Nil until the user confirms their email
+	MFASecret       string         `json:"-"`                 // Base32 TOTP secret, set during enrollment
+	MFAEnabledAt    *time.Time     `json:"mfa_enabled_at"`    // Nil while two-factor authentication is off
+	MFALastStep     int64          `json:"-"`                 // Last accepted TOTP step, so codes cannot be replayed
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
@@ -38,25 +54,145 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Session represents a logged-in device. TokenID holds the ID of the only
+// refresh token that may currently be exchanged for a new token pair.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UUID       string     `json:"uuid" gorm:"uniqueIndex;not null"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	TokenID    string     `json:"-" gorm:"not null"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Relations
+	User User `json:"-"`
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	s.UUID = uuid.New().String()
+	return nil
+}
+
+// User token purposes.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+)
+
+// UserToken represents a single-use token issued to a user, such as a
+// password reset link or a login MFA challenge. Only the hash is stored.
+type UserToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"not null"` // password_reset, email_verification, mfa_challenge
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	Attempts  int        `json:"attempts" gorm:"default:0"` // Failed code attempts against an MFA challenge
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relations
+	User User `json:"-"`
+}
+
+// MFARecoveryCode is a single-use code that can replace a TOTP code when the
+// user has lost their authenticator. Only the hash is stored.
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relations
+	User User `json:"-"`
+}
+
+// Invitation represents a pending invitation for a staff member to join a supplier.
+type Invitation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	SupplierID  uint       `json:"supplier_id" gorm:"not null;index"`
+	InvitedByID uint       `json:"invited_by_id" gorm:"not null"`
+	Email       string     `json:"email" gorm:"not null;index"`
+	Role        string     `json:"role" gorm:"not null"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex;not null"`
+	Status      string     `json:"status" gorm:"default:'pending'"` // pending, accepted, revoked
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relations
+	Supplier  Supplier `json:"-"`
+	InvitedBy User     `json:"invited_by" gorm:"foreignKey:InvitedByID"`
+}
+
+// Audit log actions.
+const (
+	AuditPlatformAdminCreated     = "platform_admin.created"
+	AuditPlatformAdminDeactivated = "platform_admin.deactivated"
+	AuditSupplierVerified         = "supplier.verified"
+	AuditSupplierSuspended        = "supplier.suspended"
+	AuditExchangeRateSet          = "exchange_rate.set"
+)
+
+// AuditLog records an administrative action. ActorID is nil for actions
+// performed from the command line.
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ActorID    *uint     `json:"actor_id" gorm:"index"`
+	Action     string    `json:"action" gorm:"not null;index"`
+	TargetType string    `json:"target_type"` // user, supplier
+	TargetID   uint      `json:"target_id"`
+	Details    string    `json:"details"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relations
+	Actor *User `json:"actor,omitempty" gorm:"foreignKey:ActorID"`
+}
+
 // Supplier represents a supplier company/organization.
 type Supplier struct {
-	ID              uint           `json:"id" gorm:"primaryKey"`
-	UUID            string         `json:"uuid" gorm:"uniqueIndex;not null"`
-	CompanyName     string         `json:"company_name" gorm:"not null"`
-	BusinessLicense string         `json:"business_license"`
-	Address         string         `json:"address"`
-	City            string         `json:"city"`
-	Country         string         `json:"country"`
-	PostalCode      string         `json:"postal_code"`
-	Description     string         `json:"description"`
-	Website         string         `json:"website"`
-	IsVerified      bool           `json:"is_verified" gorm:"default:false"`
-	IsActive        bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                      uint       `json:"id" gorm:"primaryKey"`
+	UUID                    string     `json:"uuid" gorm:"uniqueIndex;not null"`
+	CompanyName             string     `json:"company_name" gorm:"not null"`
+	BusinessLicense         string     `json:"business_license"`
+	Address                 string     `json:"address"`
+	City                    string     `json:"city"`
+	Country                 string     `json:"country"`
+	PostalCode              string     `json:"postal_code"`
+	Description             string     `json:"description"`
+	Website                 string     `json:"website"`
+	IsVerified              bool       `json:"is_verified" gorm:"default:false"`
+	IsActive                bool       `json:"is_active" gorm:"default:true"`
+	OwnerID                 *uint      `json:"owner_id"`                         // User who registered the supplier
+	RequireMFA              bool       `json:"require_mfa" gorm:"default:false"` // Staff must enroll in two-factor authentication
+	VerificationRequestedAt *time.Time `json:"verification_requested_at"`        // Set when the owner submits the supplier for platform verification
+	// VATRate is the VAT percentage included in catalog prices, shown on invoices
+	VATRate float64 `json:"vat_rate" gorm:"default:12"`
+	// Ordering rules; see ordering.go
+	MinOrderValue    money.Amount   `json:"min_order_value" gorm:"default:0"` // in MinOrderCurrency; 0 is no minimum
+	MinOrderCurrency string         `json:"min_order_currency" gorm:"default:'KZT'"`
+	DeliveryDays     string         `json:"delivery_days"` // e.g. "mon,wed,fri"; empty if deliveries are not scheduled
+	OrderCutoff      string         `json:"order_cutoff"`  // time of day orders close, e.g. "14:00"
+	CutoffDaysBefore int            `json:"cutoff_days_before" gorm:"default:1"`
+	Timezone         string         `json:"timezone" gorm:"default:'Asia/Almaty'"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Next delivery still open to orders, shown in the consumer catalog; not stored
+	NextDelivery *DeliverySlot `json:"next_delivery,omitempty" gorm:"-"`
 
 	// Relations
+	Owner        *User         `json:"owner,omitempty" gorm:"foreignKey:OwnerID"`
 	Users        []User        `json:"users" gorm:"foreignKey:SupplierID"`
 	Products     []Product     `json:"products"`
 	Orders       []Order       `json:"orders"`
@@ -72,7 +208,7 @@ func (s *Supplier) BeforeCreate(tx *gorm.DB) error {
 type Consumer struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	UUID        string         `json:"uuid" gorm:"uniqueIndex;not null"`
-	UserID      uint           `json:"user_id" gorm:"not null"`
+	UserID      uint           `json:"user_id" gorm:"not null;uniqueIndex"`
 	Preferences string         `json:"preferences" gorm:"type:text"`
 	Gender      string         `json:"gender"`
 	DateOfBirth *time.Time     `json:"date_of_birth"`
@@ -93,17 +229,19 @@ func (c *Consumer) BeforeCreate(tx *gorm.DB) error {
 // ConsumerSupplierLink represents approved connections between consumers and suppliers.
 type ConsumerSupplierLink struct {
 	ID          uint       `json:"id" gorm:"primaryKey"`
-	SupplierID  uint       `json:"supplier_id" gorm:"not null"`
-	ConsumerID  uint       `json:"consumer_id" gorm:"not null"`
+	SupplierID  uint       `json:"supplier_id" gorm:"not null;uniqueIndex:idx_consumer_supplier_links_pair,priority:2"`
+	ConsumerID  uint       `json:"consumer_id" gorm:"not null;uniqueIndex:idx_consumer_supplier_links_pair,priority:1"`
 	Status      string     `json:"status" gorm:"default:'pending'"` // pending, approved, denied, blocked
 	RequestedAt time.Time  `json:"requested_at"`
 	ApprovedAt  *time.Time `json:"approved_at"`
+	PriceListID *uint      `json:"price_list_id"` // Negotiated prices; nil means catalog prices
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 
 	// Relations
-	Supplier Supplier `json:"supplier"`
-	Consumer Consumer `json:"consumer"`
+	Supplier  Supplier   `json:"supplier"`
+	Consumer  Consumer   `json:"consumer"`
+	PriceList *PriceList `json:"price_list,omitempty"`
 }
 
 // Category represents product categories.
@@ -124,22 +262,31 @@ type Category struct {
 
 // Product represents supplier products/inventory.
 type Product struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	UUID        string         `json:"uuid" gorm:"uniqueIndex;not null"`
-	SupplierID  uint           `json:"supplier_id" gorm:"not null"`
-	CategoryID  uint           `json:"category_id" gorm:"not null"`
-	Name        string         `json:"name" gorm:"not null"`
-	Description string         `json:"description"`
-	SKU         string         `json:"sku" gorm:"uniqueIndex"`
-	Price       float64        `json:"price" gorm:"not null"`
-	Unit        string         `json:"unit"` // kg, piece, liter, etc.
-	Stock       int            `json:"stock" gorm:"default:0"`
-	MinStock    int            `json:"min_stock" gorm:"default:0"`
-	Images      string         `json:"images" gorm:"type:text"` // JSON array of image URLs
-	IsActive    bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	UUID        string       `json:"uuid" gorm:"uniqueIndex;not null"`
+	SupplierID  uint         `json:"supplier_id" gorm:"not null"`
+	CategoryID  uint         `json:"category_id" gorm:"not null"`
+	Name        string       `json:"name" gorm:"not null"`
+	Description string       `json:"description"`
+	SKU         string       `json:"sku" gorm:"uniqueIndex"`
+	Price       money.Amount `json:"price" gorm:"not null"`
+	Currency    string       `json:"currency" gorm:"not null;default:'KZT'"`
+	Unit        string       `json:"unit"` // kg, piece, liter, etc.
+	Stock       int          `json:"stock" gorm:"default:0"`
+	MinStock    int          `json:"min_stock" gorm:"default:0"`
+	// Ordering constraints; 0 means no constraint
+	MinOrderQuantity int            `json:"min_order_quantity" gorm:"default:0"`
+	OrderMultiple    int            `json:"order_multiple" gorm:"default:0"` // case or pack size
+	MaxOrderQuantity int            `json:"max_order_quantity" gorm:"default:0"`
+	Images           string         `json:"images" gorm:"type:text"` // JSON array of image URLs
+	IsActive         bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Pricing for the consumer viewing the catalog; not stored
+	EffectivePrice *money.Amount `json:"effective_price,omitempty" gorm:"-"`
+	PriceBreaks    []PriceBreak  `json:"price_breaks,omitempty" gorm:"-"`
 
 	// Relations
 	Supplier   Supplier    `json:"supplier"`
@@ -154,23 +301,28 @@ func (p *Product) BeforeCreate(tx *gorm.DB) error {
 
 // Order represents customer orders.
 type Order struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	UUID       string         `json:"uuid" gorm:"uniqueIndex;not null"`
-	SupplierID uint           `json:"supplier_id" gorm:"not null"`
-	ConsumerID uint           `json:"consumer_id" gorm:"not null"`
-	Status     string         `json:"status" gorm:"default:'pending'"` // pending, confirmed, shipped, delivered, cancelled
-	Total      float64        `json:"total" gorm:"not null"`
-	Currency   string         `json:"currency" gorm:"default:'KZT'"`
-	Notes      string         `json:"notes"`
-	OrderDate  time.Time      `json:"order_date"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID         uint         `json:"id" gorm:"primaryKey"`
+	UUID       string       `json:"uuid" gorm:"uniqueIndex;not null"`
+	SupplierID uint         `json:"supplier_id" gorm:"not null"`
+	ConsumerID uint         `json:"consumer_id" gorm:"not null"`
+	Status     string       `json:"status" gorm:"default:'pending'"` // pending, confirmed, partially_shipped, shipped, delivered, cancelled
+	Total      money.Amount `json:"total" gorm:"not null"`
+	Currency   string       `json:"currency" gorm:"default:'KZT'"` // Currency of its products
+	Notes      string       `json:"notes"`
+	OrderDate  time.Time    `json:"order_date"`
+	// DeliveryDate is the day the order is to be delivered, if chosen
+	DeliveryDate *time.Time     `json:"delivery_date" gorm:"type:date"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relations
-	Supplier   Supplier    `json:"supplier"`
-	Consumer   Consumer    `json:"consumer"`
-	OrderItems []OrderItem `json:"order_items"`
+	Supplier      Supplier             `json:"supplier"`
+	Consumer      Consumer             `json:"consumer"`
+	OrderItems    []OrderItem          `json:"order_items"`
+	StatusHistory []OrderStatusHistory `json:"status_history,omitempty"`
+	Shipments     []Shipment           `json:"shipments,omitempty"`
+	Invoice       *Invoice             `json:"invoice,omitempty"`
 }
 
 func (o *Order) BeforeCreate(tx *gorm.DB) error {
@@ -178,20 +330,343 @@ func (o *Order) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// OrderStatusHistory records one status change of an order. FromStatus is
+// empty for the entry written when the order is placed; edits of a pending
+// order are recorded with the same from and to status and a Details summary.
+type OrderStatusHistory struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	OrderID    uint      `json:"order_id" gorm:"not null;index"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status" gorm:"not null"`
+	ActorID    *uint     `json:"actor_id"`
+	ActorRole  string    `json:"actor_role"`
+	Reason     string    `json:"reason" gorm:"type:text"`
+	Details    string    `json:"details" gorm:"type:text"` // what changed when the lines were edited
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relations
+	Actor *User `json:"actor,omitempty"`
+}
+
 // OrderItem represents individual items in an order.
 type OrderItem struct {
-	ID        uint    `json:"id" gorm:"primaryKey"`
-	OrderID   uint    `json:"order_id" gorm:"not null"`
-	ProductID uint    `json:"product_id" gorm:"not null"`
-	Quantity  int     `json:"quantity" gorm:"not null"`
-	UnitPrice float64 `json:"unit_price" gorm:"not null"`
-	Total     float64 `json:"total" gorm:"not null"`
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	OrderID   uint         `json:"order_id" gorm:"not null"`
+	ProductID uint         `json:"product_id" gorm:"not null"`
+	Quantity  int          `json:"quantity" gorm:"not null"`
+	UnitPrice money.Amount `json:"unit_price" gorm:"not null"`
+	Total     money.Amount `json:"total" gorm:"not null"`
 
 	// Relations
 	Order   Order   `json:"order"`
 	Product Product `json:"product"`
 }
 
+// Standing order statuses.
+const (
+	StandingOrderActive = "active"
+	StandingOrderPaused = "paused"
+)
+
+// StandingOrder is a basket a consumer re-orders from a supplier on a
+// schedule. Each run places a real order through the normal pricing and stock
+// path.
+type StandingOrder struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	ConsumerID uint   `json:"consumer_id" gorm:"not null;index"`
+	SupplierID uint   `json:"supplier_id" gorm:"not null"`
+	Name       string `json:"name" gorm:"not null"`
+	Notes      string `json:"notes"`                                   // copied to every order
+	Schedule   string `json:"schedule" gorm:"not null"`                // cron expression, see schedule.go
+	Timezone   string `json:"timezone" gorm:"default:'Asia/Almaty'"`   // the schedule is read in this time zone
+	Status     string `json:"status" gorm:"default:'active';not null"` // active, paused
+	// SkipUnavailable orders the remaining items when some cannot be ordered;
+	// otherwise the run places nothing
+	SkipUnavailable bool           `json:"skip_unavailable" gorm:"default:true"`
+	NextRunAt       *time.Time     `json:"next_run_at" gorm:"index"`
+	LastRunAt       *time.Time     `json:"last_run_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relations
+	Supplier Supplier            `json:"supplier"`
+	Items    []StandingOrderItem `json:"items"`
+}
+
+// StandingOrderItem is one product and quantity of a standing order.
+type StandingOrderItem struct {
+	ID              uint `json:"id" gorm:"primaryKey"`
+	StandingOrderID uint `json:"standing_order_id" gorm:"not null;index"`
+	ProductID       uint `json:"product_id" gorm:"not null"`
+	Quantity        int  `json:"quantity" gorm:"not null"`
+
+	// Relations
+	Product Product `json:"product"`
+}
+
+// Standing order run outcomes.
+const (
+	StandingOrderRunPlaced  = "placed"  // every item was ordered
+	StandingOrderRunPartial = "partial" // some items were left out
+	StandingOrderRunFailed  = "failed"  // nothing was ordered
+	StandingOrderRunSkipped = "skipped" // the consumer skipped the run
+)
+
+// StandingOrderRun records what one scheduled run of a standing order did.
+type StandingOrderRun struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	StandingOrderID uint      `json:"standing_order_id" gorm:"not null;index"`
+	ScheduledFor    time.Time `json:"scheduled_for" gorm:"not null"`
+	Status          string    `json:"status" gorm:"not null"`
+	OrderID         *uint     `json:"order_id"`
+	Message         string    `json:"message" gorm:"type:text"` // why items were left out or nothing was ordered
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Shipment statuses.
+const (
+	ShipmentStatusDispatched = "dispatched"
+	ShipmentStatusDelivered  = "delivered"
+)
+
+// Shipment is one batch of goods sent for an order. An order may be shipped
+// in several batches; its status is derived from its shipments.
+type Shipment struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UUID           string     `json:"uuid" gorm:"uniqueIndex;not null"`
+	OrderID        uint       `json:"order_id" gorm:"not null;index"`
+	SupplierID     uint       `json:"supplier_id" gorm:"not null"`
+	Status         string     `json:"status" gorm:"not null"` // dispatched, delivered
+	Carrier        string     `json:"carrier"`
+	TrackingNumber string     `json:"tracking_number"`
+	Notes          string     `json:"notes" gorm:"type:text"`
+	CreatedByID    *uint      `json:"created_by_id"`
+	DispatchedAt   *time.Time `json:"dispatched_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	ReceivedBy     string     `json:"received_by"`  // proof of delivery: who signed for the goods
+	ConfirmedAt    *time.Time `json:"confirmed_at"` // when the consumer confirmed receipt
+	ReceiptNotes   string     `json:"receipt_notes" gorm:"type:text"`
+	IncidentID     *uint      `json:"incident_id"` // opened for short or damaged goods
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relations
+	Items []ShipmentItem `json:"items"`
+}
+
+func (s *Shipment) BeforeCreate(tx *gorm.DB) error {
+	s.UUID = uuid.New().String()
+	return nil
+}
+
+// ShipmentItem is the quantity of one order line sent in a shipment, and what
+// the consumer reported receiving.
+type ShipmentItem struct {
+	ID               uint `json:"id" gorm:"primaryKey"`
+	ShipmentID       uint `json:"shipment_id" gorm:"not null;index"`
+	OrderItemID      uint `json:"order_item_id" gorm:"not null;index"`
+	Quantity         int  `json:"quantity" gorm:"not null"`
+	ReceivedQuantity *int `json:"received_quantity"`
+	DamagedQuantity  int  `json:"damaged_quantity" gorm:"default:0"`
+
+	// Relations
+	OrderItem *OrderItem `json:"order_item,omitempty"`
+}
+
+// Return request statuses.
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+)
+
+// ReturnRequest is a consumer's request to send goods of an order back
+// (RMA). Once the supplier receives the goods they are restocked and a
+// credit note is issued.
+type ReturnRequest struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UUID          string     `json:"uuid" gorm:"uniqueIndex;not null"`
+	OrderID       uint       `json:"order_id" gorm:"not null;index"`
+	SupplierID    uint       `json:"supplier_id" gorm:"not null;index"`
+	ConsumerID    uint       `json:"consumer_id" gorm:"not null;index"`
+	IncidentID    *uint      `json:"incident_id"`
+	Status        string     `json:"status" gorm:"not null"` // requested, approved, rejected, received
+	Reason        string     `json:"reason" gorm:"type:text"`
+	DecisionNote  string     `json:"decision_note" gorm:"type:text"`
+	RequestedByID uint       `json:"requested_by_id" gorm:"not null"`
+	DecidedByID   *uint      `json:"decided_by_id"`
+	DecidedAt     *time.Time `json:"decided_at"`
+	ReceivedAt    *time.Time `json:"received_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relations
+	Order      *Order       `json:"order,omitempty"`
+	Items      []ReturnItem `json:"items"`
+	CreditNote *CreditNote  `json:"credit_note,omitempty"`
+}
+
+func (r *ReturnRequest) BeforeCreate(tx *gorm.DB) error {
+	r.UUID = uuid.New().String()
+	return nil
+}
+
+// ReturnItem is the quantity of one order line being returned, at the price
+// it was ordered at.
+type ReturnItem struct {
+	ID              uint         `json:"id" gorm:"primaryKey"`
+	ReturnRequestID uint         `json:"return_request_id" gorm:"not null;index"`
+	OrderItemID     uint         `json:"order_item_id" gorm:"not null;index"`
+	Quantity        int          `json:"quantity" gorm:"not null"`
+	UnitPrice       money.Amount `json:"unit_price" gorm:"not null"`
+	Total           money.Amount `json:"total" gorm:"not null"`
+
+	// Relations
+	OrderItem *OrderItem `json:"order_item,omitempty"`
+}
+
+// CreditNote is the amount owed back to a consumer for a received return.
+type CreditNote struct {
+	ID              uint         `json:"id" gorm:"primaryKey"`
+	Number          string       `json:"number" gorm:"uniqueIndex;not null"`
+	ReturnRequestID uint         `json:"return_request_id" gorm:"uniqueIndex;not null"`
+	OrderID         uint         `json:"order_id" gorm:"not null;index"`
+	SupplierID      uint         `json:"supplier_id" gorm:"not null;index"`
+	ConsumerID      uint         `json:"consumer_id" gorm:"not null;index"`
+	Amount          money.Amount `json:"amount" gorm:"not null"`
+	Currency        string       `json:"currency" gorm:"default:'KZT'"`
+	IssuedByID      *uint        `json:"issued_by_id"`
+	IssuedAt        time.Time    `json:"issued_at" gorm:"not null"`
+	CreatedAt       time.Time    `json:"created_at"`
+}
+
+// PriceList holds prices a supplier negotiated with some of its consumers.
+// It is assigned per ConsumerSupplierLink.
+type PriceList struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	SupplierID  uint      `json:"supplier_id" gorm:"not null;index"`
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Relations
+	Items []PriceListItem `json:"items"`
+}
+
+// PriceListItem is the unit price of a product from MinQuantity units up.
+// Several items for one product form quantity breaks.
+type PriceListItem struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	PriceListID uint         `json:"price_list_id" gorm:"not null;uniqueIndex:idx_price_list_items_break,priority:1"`
+	ProductID   uint         `json:"product_id" gorm:"not null;uniqueIndex:idx_price_list_items_break,priority:2"`
+	MinQuantity int          `json:"min_quantity" gorm:"not null;default:1;uniqueIndex:idx_price_list_items_break,priority:3"`
+	Price       money.Amount `json:"price" gorm:"not null"`
+}
+
+// Discount types
+const (
+	DiscountTypePercent = "percent"
+	DiscountTypeFixed   = "fixed"
+)
+
+// Discount lowers the unit price of a supplier's products, optionally only
+// for one product, one price list, from a minimum quantity or within a time
+// window (a promotion).
+type Discount struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	SupplierID  uint         `json:"supplier_id" gorm:"not null;index"`
+	Name        string       `json:"name" gorm:"not null"`
+	Type        string       `json:"type" gorm:"not null"`             // percent or fixed
+	Value       float64      `json:"value" gorm:"not null"`            // percentage off, for percent discounts
+	Amount      money.Amount `json:"amount" gorm:"not null;default:0"` // amount off each unit, for fixed discounts
+	Currency    string       `json:"currency"`                         // of Amount; only products priced in it get a fixed discount
+	ProductID   *uint        `json:"product_id"`                       // nil applies to every product
+	PriceListID *uint        `json:"price_list_id"`                    // nil applies to every consumer
+	MinQuantity int          `json:"min_quantity" gorm:"default:1"`
+	StartsAt    *time.Time   `json:"starts_at"`
+	EndsAt      *time.Time   `json:"ends_at"`
+	IsActive    bool         `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// Invoice statuses
+const (
+	InvoiceStatusIssued = "issued"
+	InvoiceStatusVoid   = "void"
+)
+
+// Invoice is issued once per order when it is confirmed. Numbers are
+// sequential per supplier without gaps. The supplier's legal details, the
+// consumer and the lines are copied so later edits do not change an issued
+// invoice.
+type Invoice struct {
+	ID              uint         `json:"id" gorm:"primaryKey"`
+	UUID            string       `json:"uuid" gorm:"uniqueIndex;not null"`
+	SupplierID      uint         `json:"supplier_id" gorm:"not null;uniqueIndex:idx_invoices_supplier_sequence,priority:1"`
+	Sequence        int64        `json:"sequence" gorm:"not null;uniqueIndex:idx_invoices_supplier_sequence,priority:2"`
+	Number          string       `json:"number" gorm:"not null"`
+	OrderID         uint         `json:"order_id" gorm:"not null;uniqueIndex"`
+	ConsumerID      uint         `json:"consumer_id" gorm:"not null;index"`
+	Status          string       `json:"status" gorm:"not null"` // issued, void
+	Currency        string       `json:"currency" gorm:"default:'KZT'"`
+	Subtotal        money.Amount `json:"subtotal" gorm:"not null"`
+	TaxTotal        money.Amount `json:"tax_total" gorm:"not null"`
+	Total           money.Amount `json:"total" gorm:"not null"`
+	SupplierName    string       `json:"supplier_name"`
+	SupplierLicense string       `json:"supplier_license"`
+	SupplierAddress string       `json:"supplier_address"`
+	ConsumerName    string       `json:"consumer_name"`
+	ConsumerEmail   string       `json:"consumer_email"`
+	ConsumerPhone   string       `json:"consumer_phone"`
+	IssuedAt        time.Time    `json:"issued_at" gorm:"not null"`
+	VoidedAt        *time.Time   `json:"voided_at"`
+	CreatedAt       time.Time    `json:"created_at"`
+
+	// Relations
+	Lines []InvoiceLine `json:"lines"`
+	Taxes []InvoiceTax  `json:"taxes"`
+}
+
+func (i *Invoice) BeforeCreate(tx *gorm.DB) error {
+	i.UUID = uuid.New().String()
+	return nil
+}
+
+// InvoiceLine is one order line as invoiced. Amounts include tax.
+type InvoiceLine struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint         `json:"invoice_id" gorm:"not null;index"`
+	OrderItemID uint         `json:"order_item_id"`
+	Description string       `json:"description"`
+	SKU         string       `json:"sku"`
+	Unit        string       `json:"unit"`
+	Quantity    int          `json:"quantity" gorm:"not null"`
+	UnitPrice   money.Amount `json:"unit_price" gorm:"not null"`
+	Total       money.Amount `json:"total" gorm:"not null"`
+}
+
+// InvoiceTax is the tax included in an invoice at one rate.
+type InvoiceTax struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	InvoiceID uint         `json:"invoice_id" gorm:"not null;index"`
+	Name      string       `json:"name"`
+	Rate      float64      `json:"rate"`
+	Base      money.Amount `json:"base"`
+	Amount    money.Amount `json:"amount"`
+}
+
+// InvoiceSequence holds the last invoice number used by a supplier. Its row is
+// locked while an invoice is issued, so numbers are handed out in order.
+type InvoiceSequence struct {
+	SupplierID uint  `json:"supplier_id" gorm:"primaryKey;autoIncrement:false"`
+	LastNumber int64 `json:"last_number" gorm:"not null;default:0"`
+}
+
 // Chat represents chat conversations between consumers and suppliers.
 type Chat struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
@@ -218,7 +693,8 @@ type Message struct {
 	ID          uint                `json:"id" gorm:"primaryKey"`
 	UUID        string              `json:"uuid" gorm:"uniqueIndex;not null"`
 	ChatID      uint                `json:"chat_id" gorm:"not null"`
-	SenderID    uint                `json:"sender_id" gorm:"not null"`
+	SenderID    uint                `json:"sender_id" gorm:"not null;uniqueIndex:idx_messages_sender_client_key"`
+	ClientKey   *string             `json:"client_key,omitempty" gorm:"size:64;uniqueIndex:idx_messages_sender_client_key"` // sender's idempotency key
 	Content     string              `json:"content" gorm:"type:text"`
 	MessageType string              `json:"message_type" gorm:"default:'text'"` // text, image, audio, document
 	IsRead      bool                `json:"is_read" gorm:"default:false"`
@@ -297,18 +773,18 @@ type IncidentLog struct {
 
 // Subscription represents supplier subscription plans.
 type Subscription struct {
-	ID           uint       `json:"id" gorm:"primaryKey"`
-	SupplierID   uint       `json:"supplier_id" gorm:"uniqueIndex;not null"`
-	PlanName     string     `json:"plan_name" gorm:"not null"`
-	Status       string     `json:"status" gorm:"default:'active'"` // active, suspended, cancelled
-	StartDate    time.Time  `json:"start_date"`
-	EndDate      *time.Time `json:"end_date"`
-	Price        float64    `json:"price"`
-	Currency     string     `json:"currency" gorm:"default:'KZT'"`
-	BillingCycle string     `json:"billing_cycle" gorm:"default:'monthly'"` // monthly, yearly
-	Features     string     `json:"features" gorm:"type:text"`              // JSON array of features
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID           uint         `json:"id" gorm:"primaryKey"`
+	SupplierID   uint         `json:"supplier_id" gorm:"uniqueIndex;not null"`
+	PlanName     string       `json:"plan_name" gorm:"not null"`
+	Status       string       `json:"status" gorm:"default:'active'"` // active, suspended, cancelled
+	StartDate    time.Time    `json:"start_date"`
+	EndDate      *time.Time   `json:"end_date"`
+	Price        money.Amount `json:"price"`
+	Currency     string       `json:"currency" gorm:"default:'KZT'"`
+	BillingCycle string       `json:"billing_cycle" gorm:"default:'monthly'"` // monthly, yearly
+	Features     string       `json:"features" gorm:"type:text"`              // JSON array of features
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
 
 	// Relations
 	Supplier Supplier `json:"supplier"`
@@ -316,18 +792,31 @@ type Subscription struct {
 
 // Analytics represents KPI and metrics data.
 type Analytics struct {
-	ID         uint      `json:"id" gorm:"primaryKey"`
-	SupplierID uint      `json:"supplier_id" gorm:"not null"`
-	Date       time.Time `json:"date" gorm:"index"`
-	MetricType string    `json:"metric_type" gorm:"not null"` // order_count, gmv, avg_order_value, etc.
-	Value      float64   `json:"value"`
-	Currency   string    `json:"currency"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         uint         `json:"id" gorm:"primaryKey"`
+	SupplierID uint         `json:"supplier_id" gorm:"not null;uniqueIndex:idx_analytics_supplier_date_metric,priority:1"`
+	Date       time.Time    `json:"date" gorm:"index;uniqueIndex:idx_analytics_supplier_date_metric,priority:2"`
+	MetricType string       `json:"metric_type" gorm:"not null;uniqueIndex:idx_analytics_supplier_date_metric,priority:3"` // orders_<status>, gmv_<status>, etc.
+	Value      money.Amount `json:"value" gorm:"not null;default:0"`
+	Currency   string       `json:"currency" gorm:"not null;default:'';uniqueIndex:idx_analytics_supplier_date_metric,priority:4"` // empty for counters
+	CreatedAt  time.Time    `json:"created_at"`
 
 	// Relations
 	Supplier Supplier `json:"supplier"`
 }
 
+// ExchangeRate is the value of one unit of Currency in BaseCurrency from
+// EffectiveDate until the next rate. Analytics uses it to report amounts of
+// suppliers selling in different currencies in one base currency.
+type ExchangeRate struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Currency      string    `json:"currency" gorm:"not null;uniqueIndex:idx_exchange_rates_pair_date,priority:1"`
+	BaseCurrency  string    `json:"base_currency" gorm:"not null;uniqueIndex:idx_exchange_rates_pair_date,priority:2"`
+	Rate          float64   `json:"rate" gorm:"type:decimal(20,10);not null"`
+	EffectiveDate time.Time `json:"effective_date" gorm:"type:date;not null;uniqueIndex:idx_exchange_rates_pair_date,priority:3"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
 // Notification represents system notifications.
 type Notification struct {
 	ID        uint       `json:"id" gorm:"primaryKey"`
@@ -0,0 +1,97 @@
+package models
+
+import "errors"
+
+// Order statuses.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusConfirmed = "confirmed"
+	// OrderStatusPartiallyShipped means some, but not all, ordered quantities
+	// have been dispatched.
+	OrderStatusPartiallyShipped = "partially_shipped"
+	OrderStatusShipped          = "shipped"
+	OrderStatusDelivered        = "delivered"
+	OrderStatusCancelled        = "cancelled"
+)
+
+var (
+	// ErrInvalidOrderTransition is returned for a status change the order
+	// lifecycle does not allow, such as delivered -> pending.
+	ErrInvalidOrderTransition = errors.New("invalid order status transition")
+	// ErrOrderTransitionForbidden is returned when the transition exists but
+	// the caller's role may not trigger it.
+	ErrOrderTransitionForbidden = errors.New("role may not perform this order status transition")
+)
+
+// supplierStaff are the supplier roles that process orders.
+var supplierStaff = []string{RoleSales, RoleAdmin, RoleOwner}
+
+// orderTransitions lists, for every status, the statuses it may move to and
+// the roles allowed to make that move. Delivered and cancelled are final.
+// The shipping statuses are not set by hand: they follow from the order's
+// shipments (see DeriveOrderStatus).
+var orderTransitions = map[string]map[string][]string{
+	OrderStatusPending: {
+		OrderStatusConfirmed: supplierStaff,
+		OrderStatusCancelled: append([]string{RoleConsumer}, supplierStaff...),
+	},
+	OrderStatusConfirmed: {
+		OrderStatusPartiallyShipped: supplierStaff,
+		OrderStatusShipped:          supplierStaff,
+		OrderStatusCancelled:        supplierStaff,
+	},
+	OrderStatusPartiallyShipped: {
+		OrderStatusShipped: supplierStaff,
+	},
+	OrderStatusShipped: {
+		OrderStatusDelivered: append([]string{RoleConsumer}, supplierStaff...),
+	},
+}
+
+// IsShipmentStatus reports whether status is derived from shipments rather
+// than set directly.
+func IsShipmentStatus(status string) bool {
+	return status == OrderStatusPartiallyShipped || status == OrderStatusShipped || status == OrderStatusDelivered
+}
+
+// DeriveOrderStatus returns the status an order should have given how many
+// units were ordered, dispatched and delivered. Orders with nothing
+// dispatched keep their current status.
+func DeriveOrderStatus(current string, ordered, dispatched, delivered int) string {
+	switch {
+	case dispatched == 0:
+		return current
+	case dispatched < ordered:
+		return OrderStatusPartiallyShipped
+	case delivered < ordered:
+		return OrderStatusShipped
+	default:
+		return OrderStatusDelivered
+	}
+}
+
+// CanTransition reports whether role may move the order from its current
+// status to the given one.
+func (o *Order) CanTransition(to, role string) error {
+	roles, ok := orderTransitions[o.Status][to]
+	if !ok {
+		return ErrInvalidOrderTransition
+	}
+	for _, allowed := range roles {
+		if allowed == role {
+			return nil
+		}
+	}
+	return ErrOrderTransitionForbidden
+}
+
+// NextStatuses returns the statuses role may move the order to.
+func (o *Order) NextStatuses(role string) []string {
+	var next []string
+	for _, to := range []string{OrderStatusConfirmed, OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled} {
+		if o.CanTransition(to, role) == nil {
+			next = append(next, to)
+		}
+	}
+	return next
+}
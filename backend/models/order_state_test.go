@@ -0,0 +1,47 @@
+package models
+
+import "testing"
+
+func TestOrderCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to, role string
+		want           error
+	}{
+		{OrderStatusPending, OrderStatusConfirmed, RoleSales, nil},
+		{OrderStatusPending, OrderStatusConfirmed, RoleConsumer, ErrOrderTransitionForbidden},
+		{OrderStatusPending, OrderStatusCancelled, RoleConsumer, nil},
+		{OrderStatusConfirmed, OrderStatusCancelled, RoleConsumer, ErrOrderTransitionForbidden},
+		{OrderStatusConfirmed, OrderStatusShipped, RoleAdmin, nil},
+		{OrderStatusPartiallyShipped, OrderStatusShipped, RoleSales, nil},
+		{OrderStatusShipped, OrderStatusDelivered, RoleConsumer, nil},
+		{OrderStatusPending, OrderStatusShipped, RoleSales, ErrInvalidOrderTransition},
+		{OrderStatusDelivered, OrderStatusPending, RoleOwner, ErrInvalidOrderTransition},
+		{OrderStatusCancelled, OrderStatusConfirmed, RoleSales, ErrInvalidOrderTransition},
+	}
+
+	for _, tt := range tests {
+		order := Order{Status: tt.from}
+		if got := order.CanTransition(tt.to, tt.role); got != tt.want {
+			t.Errorf("%s -> %s as %s: got %v, want %v", tt.from, tt.to, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestDeriveOrderStatus(t *testing.T) {
+	tests := []struct {
+		current                        string
+		ordered, dispatched, delivered int
+		want                           string
+	}{
+		{OrderStatusConfirmed, 10, 0, 0, OrderStatusConfirmed},
+		{OrderStatusConfirmed, 10, 4, 0, OrderStatusPartiallyShipped},
+		{OrderStatusPartiallyShipped, 10, 10, 4, OrderStatusShipped},
+		{OrderStatusShipped, 10, 10, 10, OrderStatusDelivered},
+	}
+
+	for _, tt := range tests {
+		if got := DeriveOrderStatus(tt.current, tt.ordered, tt.dispatched, tt.delivered); got != tt.want {
+			t.Errorf("%+v: got %s", tt, got)
+		}
+	}
+}
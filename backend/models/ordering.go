@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // supplier time zones must resolve in minimal containers
+)
+
+// Weekdays as written in Supplier.DeliveryDays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// DeliverySlot is a delivery date and the moment orders for it close.
+type DeliverySlot struct {
+	Date    string    `json:"date"` // YYYY-MM-DD in the supplier's time zone
+	OrderBy time.Time `json:"order_by"`
+}
+
+// ParseDeliveryDays reads a list such as "mon, wed,FRI" into the canonical
+// "mon,wed,fri" form, ordered Monday first.
+func ParseDeliveryDays(days []string) (string, error) {
+	seen := map[time.Weekday]bool{}
+	for _, day := range days {
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+		if !ok {
+			return "", fmt.Errorf("unknown delivery day %q", day)
+		}
+		seen[weekday] = true
+	}
+
+	var names []string
+	for _, name := range []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"} {
+		if seen[weekdays[name]] {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ","), nil
+}
+
+// ParseCutoff checks a time of day written as HH:MM.
+func ParseCutoff(cutoff string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", cutoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("order cutoff must be HH:MM")
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// SchedulesDeliveries reports whether the supplier only delivers on set days.
+func (s Supplier) SchedulesDeliveries() bool {
+	return s.DeliveryDays != ""
+}
+
+// Location is the supplier's time zone, UTC if unknown.
+func (s Supplier) Location() *time.Location {
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// DeliversOn reports whether date, a day in the supplier's time zone, is one
+// of its delivery days.
+func (s Supplier) DeliversOn(date time.Time) bool {
+	for _, name := range strings.Split(s.DeliveryDays, ",") {
+		if weekday, ok := weekdays[name]; ok && weekday == date.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderBy returns when orders for delivery on date close: CutoffDaysBefore
+// days earlier at OrderCutoff, or at the end of that day if no cutoff time is
+// set.
+func (s Supplier) OrderBy(date time.Time) time.Time {
+	day := date.AddDate(0, 0, -s.CutoffDaysBefore)
+	hour, minute, err := ParseCutoff(s.OrderCutoff)
+	if err != nil {
+		day, hour, minute = day.AddDate(0, 0, 1), 0, 0
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, s.Location())
+}
+
+// Slot describes delivery on date.
+func (s Supplier) Slot(date time.Time) DeliverySlot {
+	return DeliverySlot{Date: date.Format("2006-01-02"), OrderBy: s.OrderBy(date)}
+}
+
+// UpcomingDelivery returns the earliest delivery still open to orders placed at
+// now. It is false if the supplier does not schedule deliveries.
+func (s Supplier) UpcomingDelivery(now time.Time) (DeliverySlot, bool) {
+	if !s.SchedulesDeliveries() {
+		return DeliverySlot{}, false
+	}
+
+	local := now.In(s.Location())
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.Location())
+	// A cutoff can lie at most a couple of weeks ahead of its delivery day.
+	for i := 0; i < 7+s.CutoffDaysBefore+1; i++ {
+		date := day.AddDate(0, 0, i)
+		if s.DeliversOn(date) && now.Before(s.OrderBy(date)) {
+			return s.Slot(date), true
+		}
+	}
+	return DeliverySlot{}, false
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeliveryDays(t *testing.T) {
+	got, err := ParseDeliveryDays([]string{"FRI", " mon", "wed", "mon"})
+	if err != nil || got != "mon,wed,fri" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if got, err := ParseDeliveryDays(nil); err != nil || got != "" {
+		t.Fatalf("no days: got %q, %v", got, err)
+	}
+	if _, err := ParseDeliveryDays([]string{"monday"}); err == nil {
+		t.Fatal("expected an unknown day to be rejected")
+	}
+}
+
+func TestUpcomingDelivery(t *testing.T) {
+	// Deliveries on Tuesday and Friday, ordered by 14:00 the day before.
+	supplier := Supplier{DeliveryDays: "tue,fri", OrderCutoff: "14:00", CutoffDaysBefore: 1, Timezone: "Asia/Almaty"}
+	almaty := supplier.Location()
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		want    string
+		orderBy time.Time
+	}{
+		// 2025-11-17 is a Monday.
+		{"before the cutoff", time.Date(2025, 11, 17, 13, 59, 0, 0, almaty), "2025-11-18", time.Date(2025, 11, 17, 14, 0, 0, 0, almaty)},
+		{"at the cutoff", time.Date(2025, 11, 17, 14, 0, 0, 0, almaty), "2025-11-21", time.Date(2025, 11, 20, 14, 0, 0, 0, almaty)},
+		{"on the delivery day", time.Date(2025, 11, 21, 9, 0, 0, 0, almaty), "2025-11-25", time.Date(2025, 11, 24, 14, 0, 0, 0, almaty)},
+		// 09:30 UTC is already 14:30 in Almaty.
+		{"in another time zone", time.Date(2025, 11, 17, 9, 30, 0, 0, time.UTC), "2025-11-21", time.Date(2025, 11, 20, 14, 0, 0, 0, almaty)},
+	}
+
+	for _, tt := range tests {
+		slot, ok := supplier.UpcomingDelivery(tt.now)
+		if !ok || slot.Date != tt.want || !slot.OrderBy.Equal(tt.orderBy) {
+			t.Errorf("%s: got %+v, want %s ordered by %s", tt.name, slot, tt.want, tt.orderBy)
+		}
+	}
+
+	if _, ok := (Supplier{}).UpcomingDelivery(time.Now()); ok {
+		t.Error("expected no delivery slot without delivery days")
+	}
+}
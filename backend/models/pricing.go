@@ -0,0 +1,155 @@
+package models
+
+import (
+	"csci361/money"
+	"sort"
+	"time"
+)
+
+// PriceBreak is the unit price from a minimum quantity up, as shown to a
+// consumer.
+type PriceBreak struct {
+	MinQuantity int          `json:"min_quantity"`
+	Price       money.Amount `json:"price"`
+}
+
+// PriceQuote is the unit price a consumer pays for a quantity of a product
+// and the rules that produced it.
+type PriceQuote struct {
+	ListPrice   money.Amount `json:"list_price"` // Catalog price
+	UnitPrice   money.Amount `json:"unit_price"`
+	PriceListID *uint        `json:"price_list_id,omitempty"`
+	DiscountID  *uint        `json:"discount_id,omitempty"`
+}
+
+// PriceBook holds the pricing rules that apply to one consumer buying from one
+// supplier: the items of the consumer's price list, if any, and the discounts
+// open to them at time At.
+type PriceBook struct {
+	PriceListID *uint
+	Items       []PriceListItem
+	Discounts   []Discount
+	At          time.Time
+}
+
+// Quote prices quantity units of product. The consumer's price list replaces
+// the catalog price with the break for the largest minimum quantity reached;
+// then the single discount that lowers the price most is applied. Discounts
+// do not stack.
+func (b PriceBook) Quote(product Product, quantity int) PriceQuote {
+	quote := PriceQuote{ListPrice: product.Price, UnitPrice: product.Price}
+
+	best := 0
+	for _, item := range b.Items {
+		if item.ProductID == product.ID && item.MinQuantity <= quantity && item.MinQuantity > best {
+			best = item.MinQuantity
+			quote.UnitPrice = item.Price
+			quote.PriceListID = b.PriceListID
+		}
+	}
+
+	base := quote.UnitPrice
+	for i := range b.Discounts {
+		discount := &b.Discounts[i]
+		if !discount.AppliesTo(product, quantity, b.At) {
+			continue
+		}
+		if price := discount.Apply(base); price < quote.UnitPrice {
+			quote.UnitPrice = price
+			quote.DiscountID = &discount.ID
+		}
+	}
+
+	return quote
+}
+
+// Breaks returns the quantity breaks of product on the consumer's price list,
+// with the best discount of each break applied, ordered by quantity and
+// starting at the product's minimum order. It is empty when the consumer pays
+// one price for every quantity they may order.
+func (b PriceBook) Breaks(product Product) []PriceBreak {
+	first := product.SmallestOrder()
+	quantities := map[int]bool{first: true}
+	for _, item := range b.Items {
+		if item.ProductID == product.ID {
+			quantities[item.MinQuantity] = true
+		}
+	}
+	for _, discount := range b.Discounts {
+		if discount.covers(product) {
+			quantities[discount.MinQuantity] = true
+		}
+	}
+
+	var breaks []PriceBreak
+	for quantity := range quantities {
+		if quantity < first {
+			continue
+		}
+		breaks = append(breaks, PriceBreak{MinQuantity: quantity, Price: b.Quote(product, quantity).UnitPrice})
+	}
+	sort.Slice(breaks, func(i, j int) bool { return breaks[i].MinQuantity < breaks[j].MinQuantity })
+
+	// Keep only quantities where the price actually changes.
+	kept := breaks[:0]
+	for _, brk := range breaks {
+		if len(kept) == 0 || kept[len(kept)-1].Price != brk.Price {
+			kept = append(kept, brk)
+		}
+	}
+	if len(kept) == 1 {
+		return nil
+	}
+	return kept
+}
+
+// SmallestOrder returns the fewest units of product an order may hold, the
+// quantity the catalog quotes its price at.
+func (p Product) SmallestOrder() int {
+	if p.MinOrderQuantity > 1 {
+		return p.MinOrderQuantity
+	}
+	return 1
+}
+
+// AppliesTo reports whether the discount covers quantity units of product at
+// time at.
+func (d Discount) AppliesTo(product Product, quantity int, at time.Time) bool {
+	switch {
+	case !d.IsActive:
+		return false
+	case !d.covers(product):
+		return false
+	case quantity < d.MinQuantity:
+		return false
+	case d.StartsAt != nil && at.Before(*d.StartsAt):
+		return false
+	case d.EndsAt != nil && !at.Before(*d.EndsAt):
+		return false
+	}
+	return true
+}
+
+// covers reports whether the discount is for product: it names no product or
+// this one, and a fixed discount is in the product's currency.
+func (d Discount) covers(product Product) bool {
+	if d.ProductID != nil && *d.ProductID != product.ID {
+		return false
+	}
+	return d.Type != DiscountTypeFixed || d.Currency == product.Currency
+}
+
+// Apply returns price after the discount, rounded to the nearest hundredth
+// and never below zero.
+func (d Discount) Apply(price money.Amount) money.Amount {
+	switch d.Type {
+	case DiscountTypePercent:
+		price = price.Scale(1 - d.Value/100)
+	case DiscountTypeFixed:
+		price -= d.Amount
+	}
+	if price < 0 {
+		return 0
+	}
+	return price
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"csci361/money"
+	"testing"
+	"time"
+)
+
+func TestPriceBookQuote(t *testing.T) {
+	now := time.Date(2025, 11, 15, 12, 0, 0, 0, time.UTC)
+	yesterday, tomorrow := now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+	listID, otherProduct := uint(7), uint(2)
+
+	flour := Product{ID: 1, Price: money.FromFloat(100), Currency: money.KZT}
+	book := PriceBook{
+		PriceListID: &listID,
+		Items: []PriceListItem{
+			{ProductID: 1, MinQuantity: 1, Price: money.FromFloat(90)},
+			{ProductID: 1, MinQuantity: 10, Price: money.FromFloat(80)},
+			{ProductID: 1, MinQuantity: 50, Price: money.FromFloat(70)},
+		},
+		At: now,
+	}
+
+	tests := []struct {
+		name      string
+		discounts []Discount
+		quantity  int
+		want      money.Amount
+		discount  uint
+	}{
+		{"first break", nil, 1, money.FromFloat(90), 0},
+		{"largest break reached", nil, 49, money.FromFloat(80), 0},
+		{"top break", nil, 50, money.FromFloat(70), 0},
+		{"percent off the list price", []Discount{{ID: 1, Type: DiscountTypePercent, Value: 10, IsActive: true}}, 10, money.FromFloat(72), 1},
+		{"best discount wins", []Discount{
+			{ID: 1, Type: DiscountTypePercent, Value: 10, IsActive: true},
+			{ID: 2, Type: DiscountTypeFixed, Amount: money.FromFloat(15), Currency: money.KZT, IsActive: true},
+		}, 10, money.FromFloat(65), 2},
+		{"fixed discount stops at zero", []Discount{{ID: 1, Type: DiscountTypeFixed, Amount: money.FromFloat(500), Currency: money.KZT, IsActive: true}}, 1, 0, 1},
+		{"fixed discount in another currency", []Discount{{ID: 1, Type: DiscountTypeFixed, Amount: money.FromFloat(15), Currency: money.USD, IsActive: true}}, 1, money.FromFloat(90), 0},
+		{"below minimum quantity", []Discount{{ID: 1, Type: DiscountTypePercent, Value: 10, MinQuantity: 20, IsActive: true}}, 10, money.FromFloat(80), 0},
+		{"promotion running", []Discount{{ID: 1, Type: DiscountTypePercent, Value: 50, StartsAt: &yesterday, EndsAt: &tomorrow, IsActive: true}}, 1, money.FromFloat(45), 1},
+		{"promotion not started", []Discount{{ID: 1, Type: DiscountTypePercent, Value: 50, StartsAt: &tomorrow, IsActive: true}}, 1, money.FromFloat(90), 0},
+		{"promotion ended", []Discount{{ID: 1, Type: DiscountTypePercent, Value: 50, EndsAt: &now, IsActive: true}}, 1, money.FromFloat(90), 0},
+		{"inactive", []Discount{{ID: 1, Type: DiscountTypePercent, Value: 50}}, 1, money.FromFloat(90), 0},
+		{"other product", []Discount{{ID: 1, Type: DiscountTypePercent, Value: 50, ProductID: &otherProduct, IsActive: true}}, 1, money.FromFloat(90), 0},
+	}
+
+	for _, tt := range tests {
+		book.Discounts = tt.discounts
+		quote := book.Quote(flour, tt.quantity)
+		if quote.UnitPrice != tt.want || quote.ListPrice != money.FromFloat(100) {
+			t.Errorf("%s: got %v (list %v), want %v", tt.name, quote.UnitPrice, quote.ListPrice, tt.want)
+		}
+		if got := quote.DiscountID; (got == nil) != (tt.discount == 0) || (got != nil && *got != tt.discount) {
+			t.Errorf("%s: unexpected discount %v", tt.name, got)
+		}
+	}
+}
+
+func TestPriceBookWithoutPriceList(t *testing.T) {
+	flour := Product{ID: 1, Price: money.FromFloat(100)}
+	book := PriceBook{At: time.Now()}
+
+	if quote := book.Quote(flour, 5); quote.UnitPrice != money.FromFloat(100) || quote.PriceListID != nil {
+		t.Fatalf("expected the catalog price, got %+v", quote)
+	}
+	if breaks := book.Breaks(flour); breaks != nil {
+		t.Fatalf("expected no breaks, got %+v", breaks)
+	}
+
+	book.Discounts = []Discount{{ID: 1, Type: DiscountTypePercent, Value: 10, MinQuantity: 20, IsActive: true}}
+	breaks := book.Breaks(flour)
+	if len(breaks) != 2 || breaks[0] != (PriceBreak{1, money.FromFloat(100)}) || breaks[1] != (PriceBreak{20, money.FromFloat(90)}) {
+		t.Fatalf("unexpected breaks %+v", breaks)
+	}
+}
+
+func TestPriceBookBreaksStartAtMinimumOrder(t *testing.T) {
+	flour := Product{ID: 1, Price: money.FromFloat(100), MinOrderQuantity: 10}
+	book := PriceBook{
+		Items: []PriceListItem{
+			{ProductID: 1, MinQuantity: 1, Price: money.FromFloat(90)},
+			{ProductID: 1, MinQuantity: 10, Price: money.FromFloat(80)},
+			{ProductID: 1, MinQuantity: 50, Price: money.FromFloat(70)},
+		},
+		At: time.Now(),
+	}
+
+	breaks := book.Breaks(flour)
+	if len(breaks) != 2 || breaks[0] != (PriceBreak{10, money.FromFloat(80)}) || breaks[1] != (PriceBreak{50, money.FromFloat(70)}) {
+		t.Fatalf("expected breaks from the minimum order of 10, got %+v", breaks)
+	}
+
+	book.Items = book.Items[:2]
+	if breaks := book.Breaks(flour); breaks != nil {
+		t.Fatalf("expected no breaks when every orderable quantity costs the same, got %+v", breaks)
+	}
+}
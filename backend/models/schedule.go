@@ -0,0 +1,201 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a five-field cron expression: minute, hour, day of month, month
+// and day of week. Fields take *, numbers, ranges (1-5), lists (1,3,5) and
+// steps (*/15, 8-18/2); the day of week also takes names (mon) and 7 for
+// Sunday. As in cron, when both day fields are restricted a day matching
+// either runs.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// cronField is the range of one cron field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseSchedule reads a five-field cron expression. Expressions that can
+// never run, such as 30 February, are rejected.
+func ParseSchedule(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return Schedule{}, fmt.Errorf("schedule must have %d fields: minute hour day-of-month month day-of-week", len(cronFields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(strings.ToLower(field), cronFields[i])
+		if err != nil {
+			return Schedule{}, err
+		}
+		bits[i] = set
+	}
+
+	s := Schedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	if s.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return Schedule{}, fmt.Errorf("schedule never runs")
+	}
+	return s, nil
+}
+
+// WeeklySchedule returns the cron expression for every one of days at hh:mm.
+func WeeklySchedule(days []string, at string) (string, error) {
+	canonical, err := ParseDeliveryDays(days)
+	if err != nil {
+		return "", err
+	}
+	if canonical == "" {
+		return "", fmt.Errorf("at least one day is required")
+	}
+	hour, minute, err := ParseCutoff(at)
+	if err != nil {
+		return "", fmt.Errorf("time must be HH:MM")
+	}
+
+	var numbers []string
+	for _, day := range strings.Split(canonical, ",") {
+		numbers = append(numbers, strconv.Itoa(int(weekdays[day])))
+	}
+	return fmt.Sprintf("%d %d * * %s", minute, hour, strings.Join(numbers, ",")), nil
+}
+
+// NextRun returns the first time after after that the standing order runs,
+// in UTC.
+func (o StandingOrder) NextRun(after time.Time) (time.Time, error) {
+	schedule, err := ParseSchedule(o.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return schedule.Next(after.In(loc)).UTC(), nil
+}
+
+// Next returns the first time after after that the schedule runs, in after's
+// location, or the zero time if it does not run within five years.
+func (s Schedule) Next(after time.Time) time.Time {
+	start := after.Truncate(time.Minute).Add(time.Minute)
+	loc := start.Location()
+
+	for i := 0; i < 5*366; i++ {
+		day := time.Date(start.Year(), start.Month(), start.Day()+i, 0, 0, 0, 0, loc)
+		if !s.runsOn(day) {
+			continue
+		}
+		for hour := 0; hour < 24; hour++ {
+			if s.hour&(1<<hour) == 0 {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if s.minute&(1<<minute) == 0 {
+					continue
+				}
+				at := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+				if !at.Before(start) {
+					return at
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) runsOn(day time.Time) bool {
+	if s.month&(1<<int(day.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<day.Day()) != 0
+	dowMatch := s.dow&(1<<int(day.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dowMatch
+	case s.dowAny:
+		return domMatch
+	}
+	return domMatch || dowMatch
+}
+
+// parseCronField returns the values a field allows as a bit set.
+func parseCronField(field string, f cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = cronValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = cronValue(bounds[1], f); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range in %s %q", f.name, part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func cronValue(s string, f cronField) (int, error) {
+	if f.name == "day of week" {
+		if weekday, ok := weekdays[s]; ok {
+			return int(weekday), nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s must be between %d and %d, got %q", f.name, f.min, f.max, s)
+	}
+	return v, nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// 2025-11-17 is a Monday.
+	from := time.Date(2025, 11, 17, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 8 * * mon", time.Date(2025, 11, 24, 8, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1", time.Date(2025, 11, 24, 9, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1,4", time.Date(2025, 11, 17, 9, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 11, 17, 9, 15, 0, 0, time.UTC)},
+		{"0 6 1 * *", time.Date(2025, 12, 1, 6, 0, 0, 0, time.UTC)},
+		{"0 6 20 * sun", time.Date(2025, 11, 20, 6, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 11, 23, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{"", "0 8 * *", "60 8 * * *", "0 8 * * someday", "0 8 31 2 *", "0 18-8 * * *", "*/0 * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestWeeklySchedule(t *testing.T) {
+	got, err := WeeklySchedule([]string{"thu", "mon"}, "07:30")
+	if err != nil || got != "30 7 * * 1,4" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, err := WeeklySchedule(nil, "07:30"); err == nil {
+		t.Fatal("expected an error without days")
+	}
+}
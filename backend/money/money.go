@@ -0,0 +1,178 @@
+// Package money holds amounts of money as whole hundredths of a currency unit
+// (tiyn, kopecks, cents), so that line totals and sums are exact. Amounts are
+// written to JSON and SQL as decimal numbers with two places.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Supported currencies
+const (
+	KZT = "KZT"
+	RUB = "RUB"
+	USD = "USD"
+)
+
+var currencies = []string{KZT, RUB, USD}
+
+// Currencies lists the currencies products can be priced in.
+func Currencies() []string {
+	return append([]string(nil), currencies...)
+}
+
+// Supported reports whether code is one of Currencies.
+func Supported(code string) bool {
+	for _, currency := range currencies {
+		if currency == code {
+			return true
+		}
+	}
+	return false
+}
+
+var errSyntax = errors.New("amount must be a decimal number with at most two decimal places")
+
+// Amount is a sum of money in hundredths of a currency unit.
+type Amount int64
+
+// FromFloat rounds f to the nearest hundredth. Use it only where a value is
+// already a float, such as a percentage or an exchange rate.
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * 100))
+}
+
+// Parse reads a decimal number such as "1250", "-3.5" or "12.50". Digits past
+// the second decimal place must be zero; amounts are never rounded on input.
+func Parse(s string) (Amount, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" || !digits(whole) || !digits(fraction) {
+		return 0, errSyntax
+	}
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return 0, errSyntax
+		}
+		fraction = fraction[:2]
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %s is out of range", s)
+	}
+	if negative {
+		units = -units
+	}
+	return Amount(units), nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats a as a decimal number with two places, e.g. "-3.05".
+func (a Amount) String() string {
+	sign := ""
+	units := int64(a)
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/100, units%100)
+}
+
+// Float64 returns a as a float, for metrics and display only.
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+// Mul returns the total of quantity units at price a.
+func (a Amount) Mul(quantity int) Amount {
+	return a * Amount(quantity)
+}
+
+// Scale multiplies a by factor and rounds half away from zero to the nearest
+// hundredth. It is used for percentages, tax and currency conversion.
+func (a Amount) Scale(factor float64) Amount {
+	return Amount(math.Round(float64(a) * factor))
+}
+
+// Div splits a into n parts, rounding half away from zero. Div by zero is zero.
+func (a Amount) Div(n int64) Amount {
+	if n == 0 {
+		return 0
+	}
+	return Amount(math.Round(float64(a) / float64(n)))
+}
+
+// MarshalJSON writes a as a JSON number with two decimal places.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding one.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	amount, err := Parse(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Value stores a as a decimal string, exact in a numeric column.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan reads a numeric column or aggregate. PostgreSQL returns numerics as
+// text; SQLite returns integers and floats.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case int64:
+		*a = Amount(v * 100)
+	case float64:
+		*a = FromFloat(v)
+	case []byte:
+		return a.scanText(string(v))
+	case string:
+		return a.scanText(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T into Amount", src)
+	}
+	return nil
+}
+
+func (a *Amount) scanText(s string) error {
+	amount, err := Parse(s)
+	if err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	*a = amount
+	return nil
+}
+
+// GormDataType is the column type used by AutoMigrate.
+func (Amount) GormDataType() string {
+	return "decimal(20,2)"
+}
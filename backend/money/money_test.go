@@ -0,0 +1,116 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		ok   bool
+	}{
+		{"1250", 125000, true},
+		{"12.5", 1250, true},
+		{"12.50", 1250, true},
+		{"-3.05", -305, true},
+		{"0.10", 10, true},
+		{"7.2500", 725, true}, // numeric columns may carry extra zeros
+		{"12.505", 0, false},
+		{"1e3", 0, false},
+		{".5", 0, false},
+		{"", 0, false},
+		{"12.3.4", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("Parse(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSumsAreExact(t *testing.T) {
+	// 0.1 + 0.2 is 0.30000000000000004 in floats.
+	var total Amount
+	for i := 0; i < 1000; i++ {
+		total += FromFloat(0.1)
+	}
+	if total.String() != "100.00" {
+		t.Fatalf("sum = %s, want 100.00", total)
+	}
+	if got := FromFloat(19.99).Mul(3); got.String() != "59.97" {
+		t.Fatalf("19.99 x 3 = %s", got)
+	}
+}
+
+func TestScaleAndDiv(t *testing.T) {
+	if got := Amount(11200).Scale(12.0 / 112); got != 1200 {
+		t.Fatalf("VAT of 112.00 at 12%% = %s, want 12.00", got)
+	}
+	if got := Amount(5).Scale(0.5); got != 3 {
+		t.Fatalf("half a cent rounds away from zero, got %d", got)
+	}
+	if got := Amount(-5).Scale(0.5); got != -3 {
+		t.Fatalf("half a cent rounds away from zero, got %d", got)
+	}
+	if got := Amount(1000).Div(3); got != 333 {
+		t.Fatalf("10.00 / 3 = %s", got)
+	}
+	if got := Amount(1000).Div(0); got != 0 {
+		t.Fatalf("division by zero = %s", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Price Amount  `json:"price"`
+		Total Amount  `json:"total"`
+		Extra *Amount `json:"extra"`
+	}
+	if err := json.Unmarshal([]byte(`{"price": 12.5, "total": "-0.07", "extra": null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Price != 1250 || v.Total != -7 || v.Extra != nil {
+		t.Fatalf("unmarshalled %+v", v)
+	}
+	out, _ := json.Marshal(v)
+	if string(out) != `{"price":12.50,"total":-0.07,"extra":null}` {
+		t.Fatalf("marshalled %s", out)
+	}
+	if err := json.Unmarshal([]byte(`{"price": 0.333}`), &v); err == nil {
+		t.Fatalf("expected an error for three decimal places")
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{nil, 0},
+		{int64(42), 4200},
+		{float64(0.30000000000000004), 30},
+		{[]byte("123456789.01"), 12345678901},
+		{"-5.10", -510},
+	}
+	for _, tt := range tests {
+		var a Amount
+		if err := a.Scan(tt.src); err != nil {
+			t.Fatalf("Scan(%v): %v", tt.src, err)
+		}
+		if a != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.src, a, tt.want)
+		}
+	}
+	var a Amount
+	if err := a.Scan(true); err == nil {
+		t.Fatalf("expected an error scanning a bool")
+	}
+}
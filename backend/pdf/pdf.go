@@ -0,0 +1,200 @@
+// Package pdf writes simple single-column documents (text and rules on A4
+// pages) as PDF 1.4 using the standard Helvetica fonts, so nothing has to be
+// embedded. Text is encoded as WinAnsi; Cyrillic is transliterated to Latin
+// and other characters outside Latin-1 are replaced with '?'.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// PageWidth and PageHeight are the size of an A4 page in points.
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document is a PDF being built page by page. Coordinates are in points with
+// the origin at the top-left corner of the page.
+type Document struct {
+	title string
+	pages []*bytes.Buffer
+}
+
+// New creates an empty document with the given title in its metadata.
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// AddPage starts a new page; subsequent drawing goes to it.
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount returns the number of pages added so far.
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// Text draws s with its baseline starting at (x, y).
+func (d *Document) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, size, x, PageHeight-y, escape(encode(s)))
+}
+
+// TextRight draws s so that it ends at x, for right-aligned columns.
+func (d *Document) TextRight(x, y, size float64, bold bool, s string) {
+	d.Text(x-TextWidth(s, size), y, size, bold, s)
+}
+
+// Line draws a thin rule from (x1, y1) to (x2, y2).
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n",
+		x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// WriteTo writes the finished document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; each page then takes
+	// two objects, the page and its content stream.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (csci361) >>", escape(encode(d.title))))
+
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// Bytes returns the finished document.
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// TextWidth estimates the width of s in Helvetica at the given size. Digits
+// and common punctuation use their exact metrics, so amounts line up.
+func TextWidth(s string, size float64) float64 {
+	var units float64
+	for _, b := range encode(s) {
+		switch {
+		case b >= '0' && b <= '9':
+			units += 556
+		case b == '.' || b == ',' || b == ' ':
+			units += 278
+		case b == '-':
+			units += 333
+		case b == '%':
+			units += 889
+		case b >= 'A' && b <= 'Z':
+			units += 667
+		default:
+			units += 556
+		}
+	}
+	return units * size / 1000
+}
+
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// encode converts s to WinAnsi bytes.
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\t':
+			out = append(out, ' ')
+		case r < 0x20:
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			out = append(out, byte(r))
+		default:
+			latin, ok := transliterate(r)
+			if !ok {
+				latin = "?"
+			}
+			out = append(out, latin...)
+		}
+	}
+	return out
+}
+
+func transliterate(r rune) (string, bool) {
+	if latin, ok := cyrillic[r]; ok {
+		return latin, true
+	}
+	if r >= 'А' && r <= 'Я' {
+		// Upper-case Russian letters follow their lower-case forms by 0x20
+		if latin, ok := cyrillic[r+0x20]; ok && latin != "" {
+			return strings.ToUpper(latin[:1]) + latin[1:], true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == '(' || c == ')' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'ә': "a", 'ғ': "g", 'қ': "q", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u",
+	'һ': "h", 'і': "i",
+	'Ё': "E", 'Ә': "A", 'Ғ': "G", 'Қ': "Q", 'Ң': "N", 'Ө': "O", 'Ұ': "U", 'Ү': "U",
+	'Һ': "H", 'І': "I",
+}
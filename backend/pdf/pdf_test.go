@@ -0,0 +1,64 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestDocumentStructure(t *testing.T) {
+	doc := New("Invoice INV-000001")
+	doc.AddPage()
+	doc.Text(40, 60, 18, true, "Invoice (copy)")
+	doc.Line(40, 70, 555, 70)
+	doc.AddPage()
+	doc.TextRight(555, 60, 10, false, "1,234.50")
+
+	out := doc.Bytes()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("missing PDF header or trailer")
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Fatalf("expected two pages")
+	}
+	if !bytes.Contains(out, []byte(`(Invoice \(copy\)) Tj`)) {
+		t.Fatalf("parentheses in text are not escaped")
+	}
+
+	// Every xref entry must point at the object it numbers.
+	start := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	xref, _ := strconv.Atoi(string(start[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref does not point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i+1, out[offset:offset+10])
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	cases := map[string]string{
+		"Café":          "Caf\xe9",
+		"ТОО Жасыл":     "TOO Zhasyl",
+		"Объём":         "Obem",
+		"Қазақстан":     "Qazaqstan",
+		"price ≈ 100 €": "price ? 100 ?",
+	}
+	for in, want := range cases {
+		if got := string(encode(in)); got != want {
+			t.Errorf("encode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if got := TextWidth("100.00", 10); got != 5*5.56+2.78 {
+		t.Fatalf("unexpected width %v", got)
+	}
+}
@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"csci361/config"
+	"csci361/models"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var mailTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func newMailTestServer(t *testing.T) (*gin.Engine, *gorm.DB, string, func() string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	r, db := newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret", MailDriver: "file", MailDir: dir})
+
+	// lastToken returns the token from the most recently written email
+	lastToken := func() string {
+		t.Helper()
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(files) == 0 {
+			t.Fatal("no email was sent")
+		}
+		sort.Strings(files)
+		content, _ := os.ReadFile(files[len(files)-1])
+		match := mailTokenPattern.FindSubmatch(content)
+		if match == nil {
+			t.Fatalf("no token in email: %s", content)
+		}
+		return string(match[1])
+	}
+
+	return r, db, dir, lastToken
+}
+
+func TestEmailVerificationGatesSupplierVerification(t *testing.T) {
+	r, _, _, lastToken := newMailTestServer(t)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/register", "", gin.H{
+		"email":        "owner@example.com",
+		"password":     testPassword,
+		"role":         models.RoleOwner,
+		"first_name":   "Aida",
+		"last_name":    "Nurlanova",
+		"company_name": "Steppe Foods",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	verifyToken := lastToken()
+	access := login(t, r, "owner@example.com")
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/owner/verification-request", access, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("unverified request: expected 403, got %d", w.Code)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/verify-email", "", gin.H{"token": verifyToken}); w.Code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/verify-email", "", gin.H{"token": verifyToken}); w.Code != http.StatusBadRequest {
+		t.Fatalf("verify reuse: expected 400, got %d", w.Code)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/owner/verification-request", access, nil); w.Code != http.StatusOK {
+		t.Fatalf("verified request: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPlatformAdminVerifiesSupplierWithoutRequest(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	db.Model(&f.supplier).Update("is_verified", false)
+	root := createUser(t, db, "root@example.com", models.RolePlatformAdmin, nil)
+
+	// Suppliers registered before verification requests existed have none
+	path := fmt.Sprintf("/api/v1/platform/suppliers/%d/verify", f.supplier.ID)
+	w := doJSON(r, http.MethodPut, path, login(t, r, root.Email), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var supplier models.Supplier
+	db.First(&supplier, f.supplier.ID)
+	if !supplier.IsVerified || supplier.VerificationRequestedAt != nil {
+		t.Fatalf("expected the supplier to be verified, got %+v", supplier)
+	}
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	r, db, dir, lastToken := newMailTestServer(t)
+	user := createUser(t, db, "consumer@example.com", models.RoleConsumer, nil)
+	oldAccess := login(t, r, user.Email)
+
+	// Unknown emails get the same answer and no mail
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/forgot-password", "", gin.H{"email": "nobody@example.com"}); w.Code != http.StatusOK {
+		t.Fatalf("unknown email: expected 200, got %d", w.Code)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.eml")); len(files) != 0 {
+		t.Fatalf("expected no email for unknown address, got %d", len(files))
+	}
+
+	var resetTokens []string
+	for i := 0; i < 2; i++ {
+		if w := doJSON(r, http.MethodPost, "/api/v1/auth/forgot-password", "", gin.H{"email": user.Email}); w.Code != http.StatusOK {
+			t.Fatalf("forgot: expected 200, got %d", w.Code)
+		}
+		resetTokens = append(resetTokens, lastToken())
+	}
+	earlierToken, resetToken := resetTokens[0], resetTokens[1]
+	if earlierToken == resetToken {
+		t.Fatal("expected a new token in each email")
+	}
+
+	body := gin.H{"token": resetToken, "password": "new-password-456"}
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/reset-password", "", body); w.Code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/reset-password", "", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("reset reuse: expected 400, got %d", w.Code)
+	}
+	// Links sent before the one used stop working too
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/reset-password", "", gin.H{"token": earlierToken, "password": "other-password-789"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("earlier link after reset: expected 400, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", oldAccess, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("old session after reset: expected 401, got %d", w.Code)
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": user.Email, "password": "new-password-456"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login with new password: expected 200, got %d", w.Code)
+	}
+}
+
+func TestForgotPasswordIsRateLimitedPerEmail(t *testing.T) {
+	r, db, dir, _ := newMailTestServer(t)
+	user := createUser(t, db, "consumer@example.com", models.RoleConsumer, nil)
+
+	for i := 0; i < 5; i++ {
+		if w := doJSON(r, http.MethodPost, "/api/v1/auth/forgot-password", "", gin.H{"email": user.Email}); w.Code != http.StatusOK {
+			t.Fatalf("forgot #%d: expected 200, got %d", i, w.Code)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 3 {
+		t.Fatalf("expected 3 emails, got %d", len(files))
+	}
+}
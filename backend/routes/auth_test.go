@@ -0,0 +1,233 @@
+package routes
+
+import (
+	"csci361/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterOwnerCreatesLinkedSupplier(t *testing.T) {
+	r, db := newTestServer(t)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/register", "", gin.H{
+		"email":        "owner@example.com",
+		"password":     testPassword,
+		"role":         models.RoleOwner,
+		"first_name":   "Aida",
+		"last_name":    "Nurlanova",
+		"company_name": "Steppe Foods",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var user models.User
+	if err := db.Where("email = ?", "owner@example.com").First(&user).Error; err != nil {
+		t.Fatalf("user not created: %v", err)
+	}
+	if user.SupplierID == nil {
+		t.Fatal("owner is not linked to a supplier")
+	}
+
+	var supplier models.Supplier
+	if err := db.First(&supplier, *user.SupplierID).Error; err != nil {
+		t.Fatalf("supplier not created: %v", err)
+	}
+	if supplier.OwnerID == nil || *supplier.OwnerID != user.ID {
+		t.Fatalf("supplier owner_id = %v, want %d", supplier.OwnerID, user.ID)
+	}
+
+	var subscription models.Subscription
+	if err := db.Where("supplier_id = ?", supplier.ID).First(&subscription).Error; err != nil {
+		t.Fatalf("default subscription not created: %v", err)
+	}
+}
+
+func TestRegisterRejectsStaffRoles(t *testing.T) {
+	r, db := newTestServer(t)
+
+	for _, role := range []string{models.RoleAdmin, models.RoleSales} {
+		w := doJSON(r, http.MethodPost, "/api/v1/auth/register", "", gin.H{
+			"email":        role + "@example.com",
+			"password":     testPassword,
+			"role":         role,
+			"first_name":   "Staff",
+			"last_name":    "Member",
+			"company_name": "Steppe Foods",
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", role, w.Code, w.Body.String())
+		}
+	}
+
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no users, got %d", count)
+	}
+}
+
+func TestRegisterOwnerWithoutCompanyCreatesNothing(t *testing.T) {
+	r, db := newTestServer(t)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/register", "", gin.H{
+		"email":      "owner@example.com",
+		"password":   testPassword,
+		"role":       models.RoleOwner,
+		"first_name": "Aida",
+		"last_name":  "Nurlanova",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no users, got %d", count)
+	}
+}
+
+func loginTokens(t *testing.T, r *gin.Engine, email string) (string, string) {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": email, "password": testPassword})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login %s: expected 200, got %d: %s", email, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("login %s: bad response: %v", email, err)
+	}
+	return resp.Token, resp.RefreshToken
+}
+
+func TestRefreshTokenRotationAndReuseDetection(t *testing.T) {
+	r, db := newTestServer(t)
+	user := createUser(t, db, "consumer@example.com", models.RoleConsumer, nil)
+
+	access, refresh := loginTokens(t, r, user.Email)
+
+	// A refresh token is not an access token
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", refresh, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh token used as access token: expected 401, got %d", w.Code)
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/refresh", "", gin.H{"refresh_token": refresh})
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var rotated struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &rotated)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == refresh {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// Replaying the old refresh token revokes the session
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/refresh", "", gin.H{"refresh_token": refresh}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reuse: expected 401, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/refresh", "", gin.H{"refresh_token": rotated.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("after reuse: expected 401, got %d", w.Code)
+	}
+	for _, token := range []string{access, rotated.Token} {
+		if w := doJSON(r, http.MethodGet, "/api/v1/profile", token, nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("access after reuse: expected 401, got %d", w.Code)
+		}
+	}
+}
+
+func TestLogoutAndLogoutAll(t *testing.T) {
+	r, db := newTestServer(t)
+	user := createUser(t, db, "consumer@example.com", models.RoleConsumer, nil)
+
+	first, _ := loginTokens(t, r, user.Email)
+	second, secondRefresh := loginTokens(t, r, user.Email)
+	third, _ := loginTokens(t, r, user.Email)
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/logout", first, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", first, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("after logout: expected 401, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", second, nil); w.Code != http.StatusOK {
+		t.Fatalf("other device after logout: expected 200, got %d", w.Code)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/logout-all", third, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout-all: expected 200, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", second, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("after logout-all: expected 401, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/refresh", "", gin.H{"refresh_token": secondRefresh}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout-all: expected 401, got %d", w.Code)
+	}
+}
+
+func TestDeactivatedUserIsRejected(t *testing.T) {
+	r, db := newTestServer(t)
+	user := createUser(t, db, "consumer@example.com", models.RoleConsumer, nil)
+
+	access, refresh := loginTokens(t, r, user.Email)
+	db.Model(&user).Update("is_active", false)
+
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", access, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("access: expected 401, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/refresh", "", gin.H{"refresh_token": refresh}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh: expected 401, got %d", w.Code)
+	}
+}
+
+func TestUpdateUserChangesOnlySentFields(t *testing.T) {
+	r, db := newTestServer(t)
+	a := seedOrderingTenant(t, db, "alpha")
+	admin := createUser(t, db, "alpha-admin@example.com", models.RoleAdmin, &a.supplier.ID)
+	token := login(t, r, admin.Email)
+	salesAccess, _ := loginTokens(t, r, a.sales.Email)
+
+	// Renaming someone leaves them active and signed in
+	w := doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%d", a.sales.ID), token, gin.H{"first_name": "Renamed"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var sales models.User
+	db.First(&sales, a.sales.ID)
+	if sales.FirstName != "Renamed" || !sales.IsActive {
+		t.Fatalf("rename: expected an active, renamed user, got %+v", sales)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", salesAccess, nil); w.Code != http.StatusOK {
+		t.Fatalf("after rename: expected the session to survive, got %d", w.Code)
+	}
+
+	// Neither the owner nor the caller can be deactivated
+	for _, id := range []uint{a.owner.ID, admin.ID} {
+		if w := doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%d", id), token, gin.H{"is_active": false}); w.Code != http.StatusBadRequest {
+			t.Fatalf("deactivate %d: expected 400, got %d: %s", id, w.Code, w.Body.String())
+		}
+		if w := doJSON(r, http.MethodDelete, fmt.Sprintf("/api/v1/admin/users/%d", id), token, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("delete %d: expected 400, got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// Deactivating signs the user out
+	if w := doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%d", a.sales.ID), token, gin.H{"is_active": false}); w.Code != http.StatusOK {
+		t.Fatalf("deactivate: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", salesAccess, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("after deactivation: expected 401, got %d", w.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"csci361/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type messagePage struct {
+	Messages []models.Message `json:"messages"`
+	HasMore  bool             `json:"has_more"`
+}
+
+func TestChatMessagesAreOpenToBothSidesOnly(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	seedOrderingTenant(t, db, "beta")
+	root := createUser(t, db, "root@example.com", models.RolePlatformAdmin, nil)
+
+	path := fmt.Sprintf("/api/v1/chats/%d/messages", f.chat.ID)
+	for _, email := range []string{"alpha-consumer@example.com", f.sales.Email, f.owner.Email} {
+		token := login(t, r, email)
+		if w := doJSON(r, http.MethodPost, path, token, gin.H{"content": "Hello from " + email}); w.Code != http.StatusCreated {
+			t.Fatalf("%s send: expected 201, got %d: %s", email, w.Code, w.Body.String())
+		}
+		if w := doJSON(r, http.MethodGet, path, token, nil); w.Code != http.StatusOK {
+			t.Fatalf("%s read: expected 200, got %d: %s", email, w.Code, w.Body.String())
+		}
+	}
+
+	for _, email := range []string{"beta-consumer@example.com", "beta-sales@example.com", "beta-owner@example.com"} {
+		token := login(t, r, email)
+		if w := doJSON(r, http.MethodGet, path, token, nil); w.Code != http.StatusNotFound {
+			t.Fatalf("%s read: expected 404, got %d", email, w.Code)
+		}
+		if w := doJSON(r, http.MethodPost, path, token, gin.H{"content": "Hi"}); w.Code != http.StatusNotFound {
+			t.Fatalf("%s send: expected 404, got %d", email, w.Code)
+		}
+	}
+	if w := doJSON(r, http.MethodGet, path, login(t, r, root.Email), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("platform admin: expected 403, got %d", w.Code)
+	}
+
+	token := login(t, r, f.sales.Email)
+	if w := doJSON(r, http.MethodPost, path, token, gin.H{"content": "Hi", "message_type": "system"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("system message: expected 400, got %d", w.Code)
+	}
+	// Length is counted in characters, not bytes
+	if w := doJSON(r, http.MethodPost, path, token, gin.H{"content": strings.Repeat("я", 4000)}); w.Code != http.StatusCreated {
+		t.Fatalf("longest message: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, path, token, gin.H{"content": strings.Repeat("я", 4001)}); w.Code != http.StatusBadRequest {
+		t.Fatalf("too long message: expected 400, got %d", w.Code)
+	}
+	db.Model(&f.chat).Update("status", "archived")
+	if w := doJSON(r, http.MethodPost, path, token, gin.H{"content": "Hi"}); w.Code != http.StatusConflict {
+		t.Fatalf("archived chat: expected 409, got %d", w.Code)
+	}
+}
+
+func TestChatMessagesPageByCursorAndAreReadExplicitly(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	path := fmt.Sprintf("/api/v1/chats/%d/messages", f.chat.ID)
+	var ids []uint
+	for i := 1; i <= 5; i++ {
+		w := doJSON(r, http.MethodPost, path, consumerToken, gin.H{"content": fmt.Sprintf("Message %d", i)})
+		var message models.Message
+		json.Unmarshal(w.Body.Bytes(), &message)
+		ids = append(ids, message.ID)
+	}
+
+	page := func(query string) messagePage {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, path+query, salesToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", query, w.Code, w.Body.String())
+		}
+		var p messagePage
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return p
+	}
+	pageIDs := func(p messagePage) []uint {
+		var got []uint
+		for _, m := range p.Messages {
+			got = append(got, m.ID)
+		}
+		return got
+	}
+
+	latest := page("?limit=2")
+	if fmt.Sprint(pageIDs(latest)) != fmt.Sprint(ids[3:]) || !latest.HasMore {
+		t.Fatalf("expected the latest two messages oldest first, got %v (has_more %v)", pageIDs(latest), latest.HasMore)
+	}
+	older := page(fmt.Sprintf("?limit=2&before=%d", ids[3]))
+	if fmt.Sprint(pageIDs(older)) != fmt.Sprint(ids[1:3]) || !older.HasMore {
+		t.Fatalf("expected the two messages before, got %v", pageIDs(older))
+	}
+	oldest := page(fmt.Sprintf("?limit=2&before=%d", ids[1]))
+	if fmt.Sprint(pageIDs(oldest)) != fmt.Sprint(ids[:1]) || oldest.HasMore {
+		t.Fatalf("expected the first message and no more, got %v (has_more %v)", pageIDs(oldest), oldest.HasMore)
+	}
+	newer := page(fmt.Sprintf("?limit=3&after=%d", ids[0]))
+	if fmt.Sprint(pageIDs(newer)) != fmt.Sprint(ids[1:4]) || !newer.HasMore {
+		t.Fatalf("expected the three messages after, got %v", pageIDs(newer))
+	}
+	for _, query := range []string{"?before=1&after=1", "?limit=0", "?before=abc"} {
+		if w := doJSON(r, http.MethodGet, path+query, salesToken, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s: expected 400, got %d", query, w.Code)
+		}
+	}
+
+	var unread int64
+	db.Model(&models.Message{}).Where("chat_id = ? AND is_read = ?", f.chat.ID, false).Count(&unread)
+	if unread != 5 {
+		t.Fatalf("reading must not mark messages read, %d of 5 unread", unread)
+	}
+
+	// The consumer has nothing from staff to read
+	readPath := fmt.Sprintf("/api/v1/chats/%d/read", f.chat.ID)
+	w := doJSON(r, http.MethodPost, readPath, consumerToken, nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"marked":0}` {
+		t.Fatalf("consumer read: expected nothing marked, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPost, readPath, salesToken, gin.H{"up_to_id": ids[2]})
+	if w.Body.String() != `{"marked":3}` {
+		t.Fatalf("expected three messages marked, got %s", w.Body.String())
+	}
+	w = doJSON(r, http.MethodPost, readPath, salesToken, nil)
+	if w.Body.String() != `{"marked":2}` {
+		t.Fatalf("expected the remaining two messages marked, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,210 @@
+package routes
+
+import (
+	"csci361/handlers"
+	"csci361/models"
+	"csci361/money"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOrdersArePricedExactlyInOneCurrency(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	ownerToken := login(t, r, f.owner.Email)
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+
+	product := gin.H{"name": "Coffee", "sku": "alpha-COFFEE", "price": "19.99", "currency": "EUR", "unit": "kg", "stock": 10, "category_id": f.product.CategoryID}
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/products", ownerToken, product); w.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported currency: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	product["currency"], product["price"] = "USD", 19.999
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/products", ownerToken, product); w.Code != http.StatusBadRequest {
+		t.Fatalf("price with three decimals: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	product["price"] = 19.99
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/products", ownerToken, product)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create product: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var coffee models.Product
+	json.Unmarshal(w.Body.Bytes(), &coffee)
+	if coffee.Currency != money.USD || coffee.Price != money.FromFloat(19.99) {
+		t.Fatalf("unexpected product %s %s", coffee.Price, coffee.Currency)
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items": []gin.H{
+			{"product_id": f.product.ID, "quantity": 1},
+			{"product_id": coffee.ID, "quantity": 1},
+		},
+	})
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"code":"currency_mismatch"`) {
+		t.Fatalf("mixed currencies: expected 422 currency_mismatch, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": coffee.ID, "quantity": 3}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create order: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"total":59.97`) {
+		t.Fatalf("expected the exact total 59.97 in %s", w.Body.String())
+	}
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	if order.Currency != money.USD || order.Total != money.FromFloat(59.97) {
+		t.Fatalf("unexpected order total %s %s", order.Total, order.Currency)
+	}
+
+	var stored models.Order
+	db.First(&stored, order.ID)
+	if stored.Total != money.FromFloat(59.97) {
+		t.Fatalf("stored total %s", stored.Total)
+	}
+}
+
+func TestAnalyticsReportsGMVInBaseCurrency(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	ownerToken := login(t, r, f.owner.Email)
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+
+	root := createUser(t, db, "root@example.com", models.RolePlatformAdmin, nil)
+	rootToken := login(t, r, root.Email)
+
+	coffee := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Coffee", SKU: "alpha-COFFEE", Price: money.FromFloat(19.99), Currency: money.USD, Stock: 10, IsActive: true}
+	tea := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Tea", SKU: "alpha-TEA", Price: money.FromFloat(300), Currency: money.RUB, Stock: 10, IsActive: true}
+	mustCreate(t, db, &coffee)
+	mustCreate(t, db, &tea)
+
+	for _, line := range []gin.H{
+		{"product_id": f.product.ID, "quantity": 2},
+		{"product_id": coffee.ID, "quantity": 1},
+		{"product_id": tea.ID, "quantity": 1},
+	} {
+		if w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+			"supplier_id": f.supplier.ID,
+			"items":       []gin.H{line},
+		}); w.Code != http.StatusCreated {
+			t.Fatalf("create order: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	kpis := func() handlers.KPIResponse {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, "/api/v1/admin/analytics", ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("dashboard: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp handlers.DashboardResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.KPIs
+	}
+
+	got := kpis()
+	if got.Currency != money.KZT || got.GMV != money.FromFloat(300) || strings.Join(got.MissingRates, ",") != "RUB,USD" {
+		t.Fatalf("without rates: expected 300.00 KZT and RUB,USD missing, got %s %s %v", got.GMV, got.Currency, got.MissingRates)
+	}
+	if got.GMVByCurrency[money.USD] != money.FromFloat(19.99) || got.GMVByCurrency[money.RUB] != money.FromFloat(300) {
+		t.Fatalf("unexpected GMV by currency %v", got.GMVByCurrency)
+	}
+
+	if w := doJSON(r, http.MethodPut, "/api/v1/platform/exchange-rates", ownerToken, gin.H{"currency": "USD", "rate": 500}); w.Code != http.StatusForbidden {
+		t.Fatalf("owner setting a rate: expected 403, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, "/api/v1/platform/exchange-rates", rootToken, gin.H{"currency": "KZT", "rate": 1}); w.Code != http.StatusBadRequest {
+		t.Fatalf("rate for the base currency: expected 400, got %d", w.Code)
+	}
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	for _, rate := range []gin.H{
+		{"currency": "USD", "rate": 450},
+		{"currency": "USD", "rate": 500}, // replaces today's rate
+		{"currency": "RUB", "rate": 6.5, "effective_date": tomorrow},
+	} {
+		if w := doJSON(r, http.MethodPut, "/api/v1/platform/exchange-rates", rootToken, rate); w.Code != http.StatusOK {
+			t.Fatalf("set rate: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// Every change of a rate is audited
+	var audits []models.AuditLog
+	db.Where("action = ?", models.AuditExchangeRateSet).Order("id").Find(&audits)
+	today := time.Now().UTC().Format("2006-01-02")
+	if len(audits) != 3 || audits[1].Details != "1 USD = 500 KZT from "+today || audits[2].Details != "1 RUB = 6.5 KZT from "+tomorrow ||
+		audits[0].TargetID != audits[1].TargetID || audits[0].ActorID == nil || *audits[0].ActorID != root.ID {
+		t.Fatalf("expected an audit entry per rate change, got %+v", audits)
+	}
+
+	// The fixture order and 200 KZT, plus 19.99 USD at 500; RUB has no rate
+	// in effect yet.
+	got = kpis()
+	if got.GMV != money.FromFloat(10295) || strings.Join(got.MissingRates, ",") != "RUB" {
+		t.Fatalf("with a USD rate: expected 10295.00 and RUB missing, got %s %v", got.GMV, got.MissingRates)
+	}
+
+	w := doJSON(r, http.MethodGet, "/api/v1/platform/exchange-rates?currency=USD", rootToken, nil)
+	var rates struct {
+		BaseCurrency string                `json:"base_currency"`
+		Rates        []models.ExchangeRate `json:"rates"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &rates)
+	if rates.BaseCurrency != money.KZT || len(rates.Rates) != 1 || rates.Rates[0].Rate != 500 {
+		t.Fatalf("unexpected rates %+v", rates)
+	}
+}
+
+func TestMinimumOrderValueIsComparedInItsCurrency(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	ownerToken := login(t, r, f.owner.Email)
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+
+	if w := doJSON(r, http.MethodPut, "/api/v1/admin/ordering-rules", ownerToken, gin.H{"min_order_value": 1, "min_order_currency": "EUR"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported currency: expected 400, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, "/api/v1/admin/ordering-rules", ownerToken, gin.H{"min_order_value": 1, "min_order_currency": "USD"}); w.Code != http.StatusOK {
+		t.Fatalf("set ordering rules: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	tea := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Tea", SKU: "alpha-TEA", Price: money.FromFloat(300), Currency: money.RUB, Stock: 10, IsActive: true}
+	mustCreate(t, db, &tea)
+	order := func(productID uint, quantity int) (int, string) {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+			"supplier_id": f.supplier.ID,
+			"items":       []gin.H{{"product_id": productID, "quantity": quantity}},
+		})
+		return w.Code, w.Body.String()
+	}
+
+	// Without rates a KZT order cannot be compared with a USD minimum
+	if code, body := order(f.product.ID, 5); code != http.StatusUnprocessableEntity || !strings.Contains(body, `"code":"min_order_value_unconvertible"`) {
+		t.Fatalf("no rate: expected 422, got %d: %s", code, body)
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	mustCreate(t, db, &models.ExchangeRate{Currency: money.USD, BaseCurrency: money.KZT, Rate: 500, EffectiveDate: today})
+	mustCreate(t, db, &models.ExchangeRate{Currency: money.RUB, BaseCurrency: money.KZT, Rate: 6.5, EffectiveDate: today})
+
+	// 400 KZT is 0.80 USD, 500 KZT is 1 USD
+	if code, body := order(f.product.ID, 4); code != http.StatusUnprocessableEntity ||
+		!strings.Contains(body, `"code":"below_min_order_value"`) || !strings.Contains(body, `"min_order_currency":"USD"`) {
+		t.Fatalf("below minimum: expected 422, got %d: %s", code, body)
+	}
+	if code, body := order(f.product.ID, 5); code != http.StatusCreated {
+		t.Fatalf("KZT order at the minimum: expected 201, got %d: %s", code, body)
+	}
+	// 300 RUB is 1950 KZT, 3.90 USD
+	if code, body := order(tea.ID, 1); code != http.StatusCreated {
+		t.Fatalf("RUB order above the minimum: expected 201, got %d: %s", code, body)
+	}
+}
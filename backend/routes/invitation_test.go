@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"csci361/models"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestInvitationLifecycle(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+	a := seedTenant(t, db, "alpha", category)
+	b := seedTenant(t, db, "beta", category)
+	token := login(t, r, a.owner.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/invitations", token, gin.H{"email": "new.rep@example.com", "role": "sales"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var invitation models.Invitation
+	if err := db.Where("email = ?", "new.rep@example.com").First(&invitation).Error; err != nil {
+		t.Fatalf("invitation not stored: %v", err)
+	}
+	if invitation.SupplierID != a.supplier.ID || invitation.TokenHash == "" {
+		t.Fatalf("unexpected invitation: %+v", invitation)
+	}
+
+	// Another supplier cannot revoke it
+	path := fmt.Sprintf("/api/v1/admin/invitations/%d", invitation.ID)
+	if w := doJSON(r, http.MethodDelete, path, login(t, r, b.owner.Email), nil); w.Code != http.StatusNotFound {
+		t.Fatalf("revoke by other tenant: expected 404, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, path, token, nil); w.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAcceptInvitationIsSingleUse(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+	a := seedTenant(t, db, "alpha", category)
+
+	raw := "invitation-token"
+	sum := sha256.Sum256([]byte(raw))
+	invitation := models.Invitation{
+		SupplierID:  a.supplier.ID,
+		InvitedByID: a.owner.ID,
+		Email:       "new.admin@example.com",
+		Role:        models.RoleAdmin,
+		TokenHash:   hex.EncodeToString(sum[:]),
+		Status:      "pending",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	mustCreate(t, db, &invitation)
+
+	body := gin.H{"token": raw, "password": testPassword, "first_name": "New", "last_name": "Admin"}
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/invitations/accept", "", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("accept: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var user models.User
+	if err := db.Where("email = ?", invitation.Email).First(&user).Error; err != nil {
+		t.Fatalf("user not created: %v", err)
+	}
+	if user.SupplierID == nil || *user.SupplierID != a.supplier.ID || user.Role != models.RoleAdmin {
+		t.Fatalf("user not linked to inviting supplier: %+v", user)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(testPassword)) != nil {
+		t.Fatal("password was not stored as a bcrypt hash")
+	}
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/invitations/accept", "", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("second accept: expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"csci361/models"
+	"csci361/money"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInvoicesAreNumberedPerSupplierWithoutGaps(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	other := seedOrderingTenant(t, db, "beta")
+	db.Model(&f.supplier).Updates(map[string]interface{}{"business_license": "BIN 123456789012", "address": "1 Abay Ave", "city": "Almaty"})
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	placeOrder := func(token string, product models.Product) models.Order {
+		w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", token, gin.H{
+			"supplier_id": product.SupplierID,
+			"items":       []gin.H{{"product_id": product.ID, "quantity": 2}},
+		})
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return order
+	}
+	setStatus := func(token string, order models.Order, status string) {
+		w := doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID), token, gin.H{"status": status})
+		if w.Code != http.StatusOK {
+			t.Fatalf("order %d to %s: expected 200, got %d: %s", order.ID, status, w.Code, w.Body.String())
+		}
+	}
+
+	first, second, third := placeOrder(consumerToken, f.product), placeOrder(consumerToken, f.product), placeOrder(consumerToken, f.product)
+	setStatus(salesToken, first, "confirmed")
+	setStatus(salesToken, second, "confirmed")
+	setStatus(salesToken, second, "cancelled")
+	setStatus(salesToken, third, "confirmed")
+
+	betaOrder := placeOrder(login(t, r, "beta-consumer@example.com"), other.product)
+	setStatus(login(t, r, other.sales.Email), betaOrder, "confirmed")
+	pending := placeOrder(consumerToken, f.product)
+
+	var invoices []models.Invoice
+	w := doJSON(r, http.MethodGet, "/api/v1/sales/invoices", salesToken, nil)
+	json.Unmarshal(w.Body.Bytes(), &invoices)
+	if len(invoices) != 3 {
+		t.Fatalf("expected 3 invoices, got %d: %s", len(invoices), w.Body.String())
+	}
+	sort.Slice(invoices, func(i, j int) bool { return invoices[i].Sequence < invoices[j].Sequence })
+	for i, order := range []models.Order{first, second, third} {
+		invoice := invoices[i]
+		if invoice.Number != fmt.Sprintf("INV-%06d", i+1) || invoice.OrderID != order.ID {
+			t.Fatalf("invoice %d: got %s for order %d", i, invoice.Number, invoice.OrderID)
+		}
+	}
+	if invoices[1].Status != models.InvoiceStatusVoid || invoices[0].Status != models.InvoiceStatusIssued {
+		t.Fatalf("expected only the cancelled order's invoice to be void, got %s and %s", invoices[0].Status, invoices[1].Status)
+	}
+
+	invoice := invoices[0]
+	if invoice.Total != money.FromFloat(200) || invoice.TaxTotal != money.FromFloat(21.43) || invoice.Subtotal != money.FromFloat(178.57) || len(invoice.Taxes) != 1 {
+		t.Fatalf("unexpected amounts: total %v tax %v subtotal %v", invoice.Total, invoice.TaxTotal, invoice.Subtotal)
+	}
+	if invoice.SupplierLicense != "BIN 123456789012" || invoice.SupplierAddress != "1 Abay Ave, Almaty" || len(invoice.Lines) != 1 {
+		t.Fatalf("supplier details or lines not copied: %+v", invoice)
+	}
+
+	var betaInvoice models.Invoice
+	db.Where("order_id = ?", betaOrder.ID).First(&betaInvoice)
+	if betaInvoice.Number != "INV-000001" {
+		t.Fatalf("expected beta's numbering to start at INV-000001, got %q", betaInvoice.Number)
+	}
+	var count int64
+	db.Model(&models.Invoice{}).Where("order_id = ?", pending.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("a pending order was invoiced")
+	}
+
+	// Changing the supplier later does not change issued invoices.
+	db.Model(&f.supplier).Update("business_license", "changed")
+	pdfPath := fmt.Sprintf("/api/v1/consumer/invoices/%d/pdf", invoice.ID)
+	w = doJSON(r, http.MethodGet, pdfPath, consumerToken, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("consumer download: got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("License: BIN 123456789012")) {
+		t.Fatal("PDF does not show the license the invoice was issued with")
+	}
+	if w := doJSON(r, http.MethodGet, pdfPath, login(t, r, "beta-consumer@example.com"), nil); w.Code != http.StatusNotFound {
+		t.Fatalf("another consumer's download: expected 404, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, fmt.Sprintf("/api/v1/sales/invoices/%d/pdf", betaInvoice.ID), salesToken, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("another supplier's download: expected 404, got %d", w.Code)
+	}
+}
+
+func TestOwnerExportsInvoicesForPeriod(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+	ownerToken := login(t, r, f.owner.Email)
+
+	for i := 0; i < 2; i++ {
+		w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+			"supplier_id": f.supplier.ID,
+			"items":       []gin.H{{"product_id": f.product.ID, "quantity": 1}},
+		})
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID), salesToken, gin.H{"status": "confirmed"})
+	}
+
+	if w := doJSON(r, http.MethodGet, "/api/v1/owner/reports/invoices", ownerToken, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("export without a period: expected 400, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/owner/reports/invoices", salesToken, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("export by sales: expected 403, got %d", w.Code)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	w := doJSON(r, http.MethodGet, "/api/v1/owner/reports/invoices?start_date="+today+"&end_date="+today, ownerToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip: %v", err)
+	}
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	if fmt.Sprint(names) != "[INV-000001.pdf INV-000002.pdf invoices.csv]" {
+		t.Fatalf("unexpected archive contents: %v", names)
+	}
+}
@@ -0,0 +1,248 @@
+package routes
+
+import (
+	"csci361/models"
+	"csci361/totp"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// totpCode returns the code for the current step shifted by offset steps.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("failed to compute code: %v", err)
+	}
+	return code
+}
+
+// enrollMFA runs setup and enable for the user behind token and returns the
+// secret and recovery codes.
+func enrollMFA(t *testing.T, r *gin.Engine, token string) (string, []string) {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/mfa/setup", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var setup struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &setup)
+	if setup.Secret == "" || setup.ProvisioningURI == "" {
+		t.Fatalf("setup: missing secret or URI: %s", w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/mfa/enable", token, gin.H{"code": totpCode(t, setup.Secret, 0)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var enable struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &enable)
+	if len(enable.RecoveryCodes) != 10 {
+		t.Fatalf("enable: expected 10 recovery codes, got %d", len(enable.RecoveryCodes))
+	}
+
+	return setup.Secret, enable.RecoveryCodes
+}
+
+// startMFALogin logs in with a password and returns the MFA challenge token.
+func startMFALogin(t *testing.T, r *gin.Engine, email string) string {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": email, "password": testPassword})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !resp.MFARequired || resp.MFAToken == "" || resp.Token != "" {
+		t.Fatalf("login: expected an MFA challenge, got %s", w.Body.String())
+	}
+	return resp.MFAToken
+}
+
+func TestMFATwoStepLogin(t *testing.T) {
+	r, db := newTestServer(t)
+	user := createUser(t, db, "owner@example.com", models.RoleOwner, nil)
+
+	secret, _ := enrollMFA(t, r, login(t, r, user.Email))
+
+	mfaToken := startMFALogin(t, r, user.Email)
+
+	// Codes no newer than the one used to enable MFA are rejected, even
+	// though they are still inside the accepted clock skew
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": totpCode(t, secret, -1)})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed code: expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": totpCode(t, secret, 1)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w := doJSON(r, http.MethodGet, "/api/v1/profile", resp.Token, nil); w.Code != http.StatusOK {
+		t.Fatalf("profile: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A challenge is single use
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": totpCode(t, secret, 1)})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("reused challenge: expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMFAChallengeIsDiscardedAfterTooManyWrongCodes(t *testing.T) {
+	r, db := newTestServer(t)
+	user := createUser(t, db, "owner@example.com", models.RoleOwner, nil)
+
+	secret, _ := enrollMFA(t, r, login(t, r, user.Email))
+	mfaToken := startMFALogin(t, r, user.Email)
+
+	for i := 0; i < 5; i++ {
+		doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": "000000"})
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": totpCode(t, secret, 1)})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after too many attempts, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMFALoginLocksAfterTooManyWrongCodesAcrossChallenges(t *testing.T) {
+	r, db := newTestServer(t)
+	user := createUser(t, db, "owner@example.com", models.RoleOwner, nil)
+
+	secret, _ := enrollMFA(t, r, login(t, r, user.Email))
+
+	// Logging in again starts a new challenge but does not reset the count
+	var mfaToken string
+	for i := 0; i < 10; i++ {
+		if i%5 == 0 {
+			mfaToken = startMFALogin(t, r, user.Email)
+		}
+		w := doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": "000000"})
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: expected 401, got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": user.Email, "password": testPassword})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login after 10 wrong codes: expected 429, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A challenge started before the lockout is refused as well
+	db.Model(&models.UserToken{}).Where("user_id = ?", user.ID).Update("attempts", 0)
+	mfaToken = startMFALogin(t, r, user.Email)
+	db.Model(&models.UserToken{}).Where("user_id = ? AND used_at IS NOT NULL", user.ID).Update("attempts", 5)
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": totpCode(t, secret, 1)})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("verify after 10 wrong codes: expected 429, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The lockout ends an hour after the failed challenges were started
+	db.Model(&models.UserToken{}).Where("user_id = ? AND used_at IS NOT NULL", user.ID).
+		Update("created_at", time.Now().Add(-2*time.Hour))
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{"mfa_token": mfaToken, "code": totpCode(t, secret, 1)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify after the lockout: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMFARecoveryCodesAreSingleUse(t *testing.T) {
+	r, db := newTestServer(t)
+	user := createUser(t, db, "owner@example.com", models.RoleOwner, nil)
+
+	_, codes := enrollMFA(t, r, login(t, r, user.Email))
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{
+		"mfa_token":     startMFALogin(t, r, user.Email),
+		"recovery_code": codes[0],
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("first use: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/mfa/verify", "", gin.H{
+		"mfa_token":     startMFALogin(t, r, user.Email),
+		"recovery_code": codes[0],
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("second use: expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOwnerCanRequireMFAForStaff(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+	a := seedTenant(t, db, "alpha", category)
+
+	ownerToken := login(t, r, a.owner.Email)
+
+	w := doJSON(r, http.MethodPut, "/api/v1/owner/security-policy", ownerToken, gin.H{"require_mfa": true})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("owner without MFA: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	enrollMFA(t, r, ownerToken)
+
+	w = doJSON(r, http.MethodPut, "/api/v1/owner/security-policy", ownerToken, gin.H{"require_mfa": true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable policy: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Staff can still log in but must enroll before using supplier routes
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": a.sales.Email, "password": testPassword})
+	var resp struct {
+		Token                 string `json:"token"`
+		MFAEnrollmentRequired bool   `json:"mfa_enrollment_required"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !resp.MFAEnrollmentRequired {
+		t.Fatalf("expected mfa_enrollment_required, got %s", w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/sales/orders", resp.Token, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("unenrolled staff: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	secret, _ := enrollMFA(t, r, resp.Token)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/sales/orders", resp.Token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enrolled staff: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// MFA cannot be turned off while the policy is on
+	w = doJSON(r, http.MethodPost, "/api/v1/auth/mfa/disable", resp.Token, gin.H{"password": testPassword, "code": totpCode(t, secret, 1)})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("disable under policy: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var sales models.User
+	db.First(&sales, a.sales.ID)
+	if sales.MFAEnabledAt == nil {
+		t.Fatal("expected MFA to stay enabled")
+	}
+}
@@ -0,0 +1,308 @@
+package routes
+
+import (
+	"csci361/handlers"
+	"csci361/models"
+	"csci361/money"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// seedOrderingTenant returns a tenant whose consumer is approved to order.
+func seedOrderingTenant(t *testing.T, db *gorm.DB, name string) tenantFixture {
+	t.Helper()
+
+	category := models.Category{Name: name + " category", IsActive: true}
+	mustCreate(t, db, &category)
+
+	f := seedTenant(t, db, name, category)
+	db.Model(&f.link).Update("status", "approved")
+	return f
+}
+
+func TestCreateOrderUsesCatalogPricesAndReservesStock(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	token := login(t, r, "alpha-consumer@example.com")
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", token, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 4, "unit_price": 1}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	if order.Total != money.FromFloat(400) || len(order.OrderItems) != 1 || order.OrderItems[0].UnitPrice != money.FromFloat(100) {
+		t.Fatalf("order was not priced from the catalog: %+v", order)
+	}
+
+	var product models.Product
+	db.First(&product, f.product.ID)
+	if product.Stock != 6 {
+		t.Fatalf("expected stock 6 after reservation, got %d", product.Stock)
+	}
+}
+
+func TestCreateOrderRejectsInvalidLines(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	other := seedOrderingTenant(t, db, "beta")
+	token := login(t, r, "alpha-consumer@example.com")
+
+	var ordersBefore int64
+	db.Model(&models.Order{}).Count(&ordersBefore)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", token, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items": []gin.H{
+			{"product_id": f.product.ID, "quantity": 11},
+			{"product_id": other.product.ID, "quantity": 1},
+			{"product_id": 9999, "quantity": 1},
+		},
+	})
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Lines []handlers.OrderLineError `json:"lines"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	want := []string{"out_of_stock", "wrong_supplier", "product_not_found"}
+	if len(resp.Lines) != len(want) {
+		t.Fatalf("expected %d line errors, got %+v", len(want), resp.Lines)
+	}
+	for i, code := range want {
+		if resp.Lines[i].Index != i || resp.Lines[i].Code != code {
+			t.Errorf("line %d: got %+v, want code %s", i, resp.Lines[i], code)
+		}
+	}
+	if resp.Lines[0].Available == nil || *resp.Lines[0].Available != 10 {
+		t.Errorf("expected available stock 10 on the first line, got %+v", resp.Lines[0])
+	}
+
+	var product models.Product
+	db.First(&product, f.product.ID)
+	var ordersAfter int64
+	db.Model(&models.Order{}).Count(&ordersAfter)
+	if product.Stock != 10 || ordersAfter != ordersBefore {
+		t.Fatalf("rejected order changed data: stock %d, orders %d -> %d", product.Stock, ordersBefore, ordersAfter)
+	}
+}
+
+func TestOrderStatusLifecycle(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 3}},
+	})
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+
+	path := fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID)
+	if w := doJSON(r, http.MethodPut, path, salesToken, gin.H{"status": "shipped"}); w.Code != http.StatusConflict {
+		t.Fatalf("shipping by hand: expected 409, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, path, salesToken, gin.H{"status": "confirmed"}); w.Code != http.StatusOK {
+		t.Fatalf("confirm: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	shipment := createShipment(t, r, salesToken, order.ID, gin.H{"order_item_id": order.OrderItems[0].ID, "quantity": 3})
+	w = doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/shipments/%d/delivered", shipment.ID), salesToken, gin.H{"received_by": "A. Cook"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("deliver: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPut, path, salesToken, gin.H{"status": "pending"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("delivered -> pending: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, fmt.Sprintf("/api/v1/consumer/orders/%d/history", order.ID), consumerToken, nil)
+	var history []models.OrderStatusHistory
+	json.Unmarshal(w.Body.Bytes(), &history)
+	want := []string{"pending", "confirmed", "shipped", "delivered"}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d history entries, got %s", len(want), w.Body.String())
+	}
+	for i, status := range want {
+		if history[i].ToStatus != status || history[i].ActorID == nil {
+			t.Errorf("entry %d: got %+v, want %s with an actor", i, history[i], status)
+		}
+	}
+
+	var notified int64
+	db.Model(&models.Notification{}).Where("user_id = ?", f.consumer.UserID).Count(&notified)
+	if notified != 3 {
+		t.Errorf("expected the consumer to get 3 notifications, got %d", notified)
+	}
+
+	var delivered models.Analytics
+	if err := db.Where("supplier_id = ? AND metric_type = ?", f.supplier.ID, "orders_delivered").First(&delivered).Error; err != nil || delivered.Value != money.FromFloat(1) {
+		t.Errorf("expected an orders_delivered metric of 1, got %+v (%v)", delivered, err)
+	}
+	var gmv models.Analytics
+	if err := db.Where("supplier_id = ? AND metric_type = ?", f.supplier.ID, "gmv_delivered").First(&gmv).Error; err != nil || gmv.Value != order.Total {
+		t.Errorf("expected a gmv_delivered metric of %v, got %+v (%v)", order.Total, gmv, err)
+	}
+}
+
+func TestCancellingOrderRestocksProducts(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 7}},
+	})
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+
+	path := fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID)
+	w = doJSON(r, http.MethodPut, path, salesToken, gin.H{"status": "cancelled", "reason": "Out of delivery area"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var product models.Product
+	db.First(&product, f.product.ID)
+	if product.Stock != 10 {
+		t.Fatalf("expected stock back at 10, got %d", product.Stock)
+	}
+
+	if w := doJSON(r, http.MethodPut, path, salesToken, gin.H{"status": "cancelled"}); w.Code != http.StatusConflict {
+		t.Fatalf("second cancel: expected 409, got %d", w.Code)
+	}
+	db.First(&product, f.product.ID)
+	if product.Stock != 10 {
+		t.Fatalf("second cancel restocked again: %d", product.Stock)
+	}
+}
+
+func TestConsumerEditsPendingOrder(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	sugar := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Sugar", SKU: "alpha-SUGAR", Price: money.FromFloat(50), Stock: 5, IsActive: true}
+	mustCreate(t, db, &sugar)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 4}},
+	})
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+
+	// The catalog price changes after the order was placed.
+	db.Model(&f.product).Update("price", 120)
+
+	path := fmt.Sprintf("/api/v1/consumer/orders/%d", order.ID)
+	w = doJSON(r, http.MethodPut, path, consumerToken, gin.H{
+		"items":  []gin.H{{"product_id": f.product.ID, "quantity": 10}, {"product_id": sugar.ID, "quantity": 6}},
+		"reason": "Bigger event",
+	})
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for too much sugar, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPut, path, consumerToken, gin.H{
+		"items":  []gin.H{{"product_id": f.product.ID, "quantity": 10}, {"product_id": sugar.ID, "quantity": 2}},
+		"reason": "Bigger event",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &order)
+	if order.Total != money.FromFloat(10*100+2*50) || len(order.OrderItems) != 2 {
+		t.Fatalf("unexpected order after edit: total %s, %d items", order.Total, len(order.OrderItems))
+	}
+
+	var flour, sugarAfter models.Product
+	db.First(&flour, f.product.ID)
+	db.First(&sugarAfter, sugar.ID)
+	if flour.Stock != 0 || sugarAfter.Stock != 3 {
+		t.Fatalf("unexpected stock after edit: flour %d, sugar %d", flour.Stock, sugarAfter.Stock)
+	}
+
+	// Dropping a line releases its stock.
+	w = doJSON(r, http.MethodPut, path, consumerToken, gin.H{"items": []gin.H{{"product_id": sugar.ID, "quantity": 2}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	db.First(&flour, f.product.ID)
+	if flour.Stock != 10 {
+		t.Fatalf("expected flour stock back at 10, got %d", flour.Stock)
+	}
+
+	w = doJSON(r, http.MethodGet, fmt.Sprintf("/api/v1/sales/orders/%d/history", order.ID), salesToken, nil)
+	var history []models.OrderStatusHistory
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if len(history) != 3 || history[1].Reason != "Bigger event" || history[1].Details == "" {
+		t.Fatalf("expected the edits in the history, got %s", w.Body.String())
+	}
+
+	doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID), salesToken, gin.H{"status": "confirmed"})
+	w = doJSON(r, http.MethodPut, path, consumerToken, gin.H{"items": []gin.H{{"product_id": sugar.ID, "quantity": 1}}})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("editing a confirmed order: expected 409, got %d", w.Code)
+	}
+}
+
+func TestConsumerCancelsOnlyPendingOrders(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	place := func() models.Order {
+		w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+			"supplier_id": f.supplier.ID,
+			"items":       []gin.H{{"product_id": f.product.ID, "quantity": 2}},
+		})
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return order
+	}
+
+	pending := place()
+	w := doJSON(r, http.MethodPost, fmt.Sprintf("/api/v1/consumer/orders/%d/cancel", pending.ID), consumerToken, gin.H{"reason": "Ordered by mistake"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel pending: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var staffNotified int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND title LIKE ?", f.sales.ID, "%cancelled").Count(&staffNotified)
+	if staffNotified != 1 {
+		t.Errorf("expected sales staff to be notified of the cancellation, got %d", staffNotified)
+	}
+
+	confirmed := place()
+	doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", confirmed.ID), salesToken, gin.H{"status": "confirmed"})
+	w = doJSON(r, http.MethodPost, fmt.Sprintf("/api/v1/consumer/orders/%d/cancel", confirmed.ID), consumerToken, gin.H{"reason": "Too late"})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("cancel confirmed: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var product models.Product
+	db.First(&product, f.product.ID)
+	if product.Stock != 8 {
+		t.Fatalf("expected only the confirmed order to hold stock (8 left), got %d", product.Stock)
+	}
+}
@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"csci361/models"
+	"csci361/money"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateOrderEnforcesProductConstraints(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	ownerToken := login(t, r, f.owner.Email)
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/products", ownerToken, gin.H{
+		"name": "Eggs", "sku": "alpha-EGGS", "price": 5, "stock": 100, "category_id": f.product.CategoryID,
+		"min_order_quantity": 12, "max_order_quantity": 6,
+	}); w.Code != http.StatusBadRequest {
+		t.Fatalf("maximum below minimum: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	eggs := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Eggs", SKU: "alpha-EGGS", Price: money.FromFloat(5), Stock: 100, OrderMultiple: 12, IsActive: true}
+	milk := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Milk", SKU: "alpha-MILK", Price: money.FromFloat(3), Stock: 100, MaxOrderQuantity: 20, IsActive: true}
+	mustCreate(t, db, &eggs)
+	mustCreate(t, db, &milk)
+	db.Model(&f.product).Update("min_order_quantity", 2)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items": []gin.H{
+			{"product_id": f.product.ID, "quantity": 1},
+			{"product_id": eggs.ID, "quantity": 18},
+			{"product_id": milk.ID, "quantity": 21},
+		},
+	})
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Lines []struct {
+			ProductID   uint   `json:"product_id"`
+			Code        string `json:"code"`
+			MinQuantity *int   `json:"min_quantity"`
+			Multiple    *int   `json:"order_multiple"`
+			MaxQuantity *int   `json:"max_quantity"`
+		} `json:"lines"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Lines) != 3 {
+		t.Fatalf("expected a violation per line, got %s", w.Body.String())
+	}
+	if l := resp.Lines[0]; l.Code != "below_min_quantity" || l.MinQuantity == nil || *l.MinQuantity != 2 {
+		t.Errorf("unexpected minimum violation %+v", l)
+	}
+	if l := resp.Lines[1]; l.Code != "not_pack_multiple" || l.Multiple == nil || *l.Multiple != 12 {
+		t.Errorf("unexpected pack violation %+v", l)
+	}
+	if l := resp.Lines[2]; l.Code != "above_max_quantity" || l.MaxQuantity == nil || *l.MaxQuantity != 20 {
+		t.Errorf("unexpected maximum violation %+v", l)
+	}
+
+	w = doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items": []gin.H{
+			{"product_id": f.product.ID, "quantity": 2},
+			{"product_id": eggs.ID, "quantity": 24},
+			{"product_id": milk.ID, "quantity": 20},
+		},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("order within the constraints: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/consumer/products", consumerToken, nil)
+	var products []models.Product
+	json.Unmarshal(w.Body.Bytes(), &products)
+	for _, product := range products {
+		if product.ID == eggs.ID && product.OrderMultiple != 12 {
+			t.Errorf("catalog does not expose the pack size: %+v", product)
+		}
+	}
+}
+
+func TestMinimumOrderValueAndDeliverySchedule(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	ownerToken := login(t, r, f.owner.Email)
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+
+	almaty, _ := time.LoadLocation("Asia/Almaty")
+	today := time.Now().In(almaty)
+	date := func(days int) string { return today.AddDate(0, 0, days).Format("2006-01-02") }
+	weekday := func(days int) string {
+		return strings.ToLower(today.AddDate(0, 0, days).Weekday().String()[:3])
+	}
+
+	// Deliveries every day but the one three days from now, ordered by the
+	// end of the day before.
+	var days []string
+	for i := 0; i < 7; i++ {
+		if i != 3 {
+			days = append(days, weekday(i))
+		}
+	}
+	if w := doJSON(r, http.MethodPut, "/api/v1/admin/ordering-rules", ownerToken, gin.H{"delivery_days": []string{"someday"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown delivery day: expected 400, got %d", w.Code)
+	}
+	w := doJSON(r, http.MethodPut, "/api/v1/admin/ordering-rules", ownerToken, gin.H{
+		"min_order_value":    500,
+		"delivery_days":      days,
+		"cutoff_days_before": 1,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set ordering rules: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var supplier models.Supplier
+	json.Unmarshal(w.Body.Bytes(), &supplier)
+	if supplier.MinOrderValue != money.FromFloat(500) || supplier.NextDelivery == nil || supplier.NextDelivery.Date != date(1) {
+		t.Fatalf("unexpected ordering rules %s", w.Body.String())
+	}
+
+	order := func(quantity int, deliveryDate string) (int, string) {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+			"supplier_id":   f.supplier.ID,
+			"items":         []gin.H{{"product_id": f.product.ID, "quantity": quantity}},
+			"delivery_date": deliveryDate,
+		})
+		return w.Code, w.Body.String()
+	}
+
+	if code, body := order(2, ""); code != http.StatusUnprocessableEntity || !strings.Contains(body, `"code":"below_min_order_value"`) {
+		t.Fatalf("below minimum order value: expected 422, got %d: %s", code, body)
+	}
+	if code, body := order(5, date(3)); code != http.StatusUnprocessableEntity || !strings.Contains(body, `"code":"not_delivery_day"`) {
+		t.Fatalf("no delivery that day: expected 422, got %d: %s", code, body)
+	}
+	if code, body := order(5, date(0)); code != http.StatusUnprocessableEntity || !strings.Contains(body, `"code":"delivery_cutoff_passed"`) ||
+		!strings.Contains(body, `"date":"`+date(1)+`"`) {
+		t.Fatalf("cutoff passed: expected 422 with the next delivery, got %d: %s", code, body)
+	}
+
+	code, body := order(5, "")
+	if code != http.StatusCreated {
+		t.Fatalf("create order: expected 201, got %d: %s", code, body)
+	}
+	var created models.Order
+	json.Unmarshal([]byte(body), &created)
+	if created.DeliveryDate == nil || created.DeliveryDate.Format("2006-01-02") != date(1) {
+		t.Fatalf("expected delivery on the next open day %s, got %v", date(1), created.DeliveryDate)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/consumer/products", consumerToken, nil)
+	var products []models.Product
+	json.Unmarshal(w.Body.Bytes(), &products)
+	if len(products) == 0 || products[0].Supplier.NextDelivery == nil || products[0].Supplier.NextDelivery.Date != date(1) {
+		t.Fatalf("catalog does not show the next delivery: %s", w.Body.String())
+	}
+}
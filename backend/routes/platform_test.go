@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"csci361/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlatformAdminManagementIsAudited(t *testing.T) {
+	r, db := newTestServer(t)
+
+	root := createUser(t, db, "root@example.com", models.RolePlatformAdmin, nil)
+	token := login(t, r, root.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/platform/admins", token, gin.H{
+		"email":      "second@example.com",
+		"password":   testPassword,
+		"first_name": "Second",
+		"last_name":  "Admin",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var second models.User
+	json.Unmarshal(w.Body.Bytes(), &second)
+
+	secondToken := login(t, r, second.Email)
+
+	w = doJSON(r, http.MethodDelete, fmt.Sprintf("/api/v1/platform/admins/%d", root.ID), token, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("self deactivation: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodDelete, fmt.Sprintf("/api/v1/platform/admins/%d", second.ID), token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("deactivate: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodGet, "/api/v1/platform/admins", secondToken, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("deactivated admin: expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/platform/audit-logs", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("audit logs: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		AuditLogs []models.AuditLog `json:"audit_logs"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if len(resp.AuditLogs) != 2 {
+		t.Fatalf("expected 2 audit entries, got %+v", resp.AuditLogs)
+	}
+	for i, action := range []string{models.AuditPlatformAdminDeactivated, models.AuditPlatformAdminCreated} {
+		entry := resp.AuditLogs[i]
+		if entry.Action != action || entry.TargetID != second.ID || entry.ActorID == nil || *entry.ActorID != root.ID {
+			t.Fatalf("entry %d: unexpected %+v", i, entry)
+		}
+	}
+}
+
+func TestPlatformRoutesRequirePlatformAdmin(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+	a := seedTenant(t, db, "alpha", category)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/platform/admins", login(t, r, a.owner.Email), gin.H{
+		"email":      "sneaky@example.com",
+		"password":   testPassword,
+		"first_name": "Sneaky",
+		"last_name":  "Owner",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCategoriesAreManagedByPlatformAdmins(t *testing.T) {
+	r, db := newTestServer(t)
+	a := seedOrderingTenant(t, db, "alpha")
+	ownerToken := login(t, r, a.owner.Email)
+	root := createUser(t, db, "root@example.com", models.RolePlatformAdmin, nil)
+	rootToken := login(t, r, root.Email)
+
+	// Categories are shared, so a supplier cannot change them for everyone
+	path := fmt.Sprintf("/api/v1/platform/categories/%d", a.product.CategoryID)
+	if w := doJSON(r, http.MethodPost, "/api/v1/platform/categories", ownerToken, gin.H{"name": "Mine"}); w.Code != http.StatusForbidden {
+		t.Fatalf("owner creating a category: expected 403, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, path, ownerToken, gin.H{"name": "Renamed", "is_active": true}); w.Code != http.StatusForbidden {
+		t.Fatalf("owner renaming a category: expected 403, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, path, ownerToken, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("owner deleting a category: expected 403, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, fmt.Sprintf("/api/v1/admin/categories/%d", a.product.CategoryID), ownerToken, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("old admin route: expected 404, got %d", w.Code)
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/platform/categories", rootToken, gin.H{"name": "Dairy"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPut, path, rootToken, gin.H{"name": "Renamed", "is_active": true}); w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodDelete, path, rootToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var category models.Category
+	db.First(&category, a.product.CategoryID)
+	if category.Name != "Renamed" || category.IsActive {
+		t.Fatalf("expected the category renamed and deactivated, got %+v", category)
+	}
+}
@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"csci361/models"
+	"csci361/money"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPriceListsAndDiscountsPriceCatalogAndOrders(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	other := seedOrderingTenant(t, db, "beta")
+	ownerToken := login(t, r, f.owner.Email)
+
+	// A second consumer of alpha without negotiated prices
+	plainUser := createUser(t, db, "plain@example.com", models.RoleConsumer, nil)
+	plain := models.Consumer{UserID: plainUser.ID}
+	mustCreate(t, db, &plain)
+	mustCreate(t, db, &models.ConsumerSupplierLink{SupplierID: f.supplier.ID, ConsumerID: plain.ID, Status: "approved", RequestedAt: time.Now()})
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/price-lists", ownerToken, gin.H{
+		"name":  "Stolen",
+		"items": []gin.H{{"product_id": other.product.ID, "price": 1}},
+	}); w.Code != http.StatusBadRequest {
+		t.Fatalf("price list with another supplier's product: expected 400, got %d", w.Code)
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/price-lists", ownerToken, gin.H{
+		"name": "Restaurants",
+		"items": []gin.H{
+			{"product_id": f.product.ID, "price": 90},
+			{"product_id": f.product.ID, "min_quantity": 5, "price": 80},
+		},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create price list: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var list models.PriceList
+	json.Unmarshal(w.Body.Bytes(), &list)
+
+	assignPath := fmt.Sprintf("/api/v1/admin/consumer-links/%d/price-list", other.link.ID)
+	if w := doJSON(r, http.MethodPut, assignPath, ownerToken, gin.H{"price_list_id": list.ID}); w.Code != http.StatusNotFound {
+		t.Fatalf("assigning to another supplier's link: expected 404, got %d", w.Code)
+	}
+	assignPath = fmt.Sprintf("/api/v1/admin/consumer-links/%d/price-list", f.link.ID)
+	if w := doJSON(r, http.MethodPut, assignPath, ownerToken, gin.H{"price_list_id": list.ID}); w.Code != http.StatusOK {
+		t.Fatalf("assign: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	for _, discount := range []gin.H{
+		{"name": "Regulars", "type": "percent", "value": 10, "price_list_id": list.ID},
+		{"name": "Expired sale", "type": "percent", "value": 50, "ends_at": yesterday},
+	} {
+		if w := doJSON(r, http.MethodPost, "/api/v1/admin/discounts", ownerToken, discount); w.Code != http.StatusCreated {
+			t.Fatalf("create discount: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	catalogPrice := func(token string) models.Product {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, "/api/v1/consumer/products", token, nil)
+		var products []models.Product
+		json.Unmarshal(w.Body.Bytes(), &products)
+		for _, product := range products {
+			if product.ID == f.product.ID {
+				return product
+			}
+		}
+		t.Fatalf("product missing from catalog: %s", w.Body.String())
+		return models.Product{}
+	}
+
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	product := catalogPrice(consumerToken)
+	if product.EffectivePrice == nil || *product.EffectivePrice != money.FromFloat(81) || product.Price != money.FromFloat(100) {
+		t.Fatalf("expected 81 (list 90 less 10%%), got %v", product.EffectivePrice)
+	}
+	if len(product.PriceBreaks) != 2 || product.PriceBreaks[1] != (models.PriceBreak{MinQuantity: 5, Price: money.FromFloat(72)}) {
+		t.Fatalf("unexpected price breaks %+v", product.PriceBreaks)
+	}
+
+	plainToken := login(t, r, "plain@example.com")
+	if product := catalogPrice(plainToken); *product.EffectivePrice != money.FromFloat(100) || product.PriceBreaks != nil {
+		t.Fatalf("consumer without a price list: expected 100 and no breaks, got %v %+v", *product.EffectivePrice, product.PriceBreaks)
+	}
+
+	order := func(token string, quantity int) models.Order {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", token, gin.H{
+			"supplier_id": f.supplier.ID,
+			"items":       []gin.H{{"product_id": f.product.ID, "quantity": quantity}},
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("order: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return order
+	}
+
+	if o := order(consumerToken, 5); o.OrderItems[0].UnitPrice != money.FromFloat(72) || o.Total != money.FromFloat(360) {
+		t.Fatalf("expected 5 x 72 = 360, got %v x %v", o.Total, o.OrderItems[0].UnitPrice)
+	}
+	if o := order(plainToken, 1); o.OrderItems[0].UnitPrice != money.FromFloat(100) {
+		t.Fatalf("expected the catalog price for a consumer without a price list, got %v", o.OrderItems[0].UnitPrice)
+	}
+
+	// Deleting the list takes the consumer back to catalog prices.
+	if w := doJSON(r, http.MethodDelete, fmt.Sprintf("/api/v1/admin/price-lists/%d", list.ID), ownerToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete price list: expected 200, got %d", w.Code)
+	}
+	if product := catalogPrice(consumerToken); *product.EffectivePrice != money.FromFloat(100) {
+		t.Fatalf("expected the catalog price after deleting the list, got %v", *product.EffectivePrice)
+	}
+}
+
+func TestFixedDiscountsOnlyApplyInTheirCurrency(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	ownerToken := login(t, r, f.owner.Email)
+
+	coffee := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Coffee", SKU: "alpha-COFFEE", Price: money.FromFloat(19.99), Currency: money.USD, Stock: 10, IsActive: true}
+	mustCreate(t, db, &coffee)
+
+	for _, tt := range []struct {
+		name     string
+		discount gin.H
+	}{
+		{"no amount", gin.H{"name": "Sale", "type": "fixed", "value": 5}},
+		{"other currency than the product", gin.H{"name": "Sale", "type": "fixed", "amount": "5", "currency": "KZT", "product_id": coffee.ID}},
+		{"unsupported currency", gin.H{"name": "Sale", "type": "fixed", "amount": "5", "currency": "EUR"}},
+		{"percentage over 100", gin.H{"name": "Sale", "type": "percent", "value": 101}},
+	} {
+		if w := doJSON(r, http.MethodPost, "/api/v1/admin/discounts", ownerToken, tt.discount); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", tt.name, w.Code)
+		}
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/discounts", ownerToken, gin.H{"name": "Sale", "type": "fixed", "amount": "0.10"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create discount: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var discount models.Discount
+	json.Unmarshal(w.Body.Bytes(), &discount)
+	if discount.Amount != money.FromFloat(0.1) || discount.Currency != money.KZT {
+		t.Fatalf("expected 0.10 KZT off, got %v %s", discount.Amount, discount.Currency)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/consumer/products", login(t, r, "alpha-consumer@example.com"), nil)
+	var products []models.Product
+	json.Unmarshal(w.Body.Bytes(), &products)
+	prices := map[uint]money.Amount{}
+	for _, product := range products {
+		prices[product.ID] = *product.EffectivePrice
+	}
+	if prices[f.product.ID] != f.product.Price-money.FromFloat(0.1) {
+		t.Fatalf("expected 0.10 off the KZT product, got %v", prices[f.product.ID])
+	}
+	if prices[coffee.ID] != coffee.Price {
+		t.Fatalf("a KZT discount must not lower a USD price, got %v", prices[coffee.ID])
+	}
+}
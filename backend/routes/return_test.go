@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"csci361/handlers"
+	"csci361/models"
+	"csci361/money"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReturnRestocksAndIssuesCreditNote(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	seedOrderingTenant(t, db, "beta")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+	ownerToken := login(t, r, f.owner.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 5}},
+	})
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	line := order.OrderItems[0].ID
+	returnsPath := fmt.Sprintf("/api/v1/consumer/orders/%d/returns", order.ID)
+
+	if w := doJSON(r, http.MethodPost, returnsPath, consumerToken, gin.H{
+		"reason": "Not delivered yet",
+		"items":  []gin.H{{"order_item_id": line, "quantity": 1}},
+	}); w.Code != http.StatusBadRequest {
+		t.Fatalf("returning undelivered goods: expected 400, got %d", w.Code)
+	}
+
+	doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID), salesToken, gin.H{"status": "confirmed"})
+	shipment := createShipment(t, r, salesToken, order.ID, gin.H{"order_item_id": line, "quantity": 5})
+	w = doJSON(r, http.MethodPost, fmt.Sprintf("/api/v1/consumer/shipments/%d/confirm", shipment.ID), consumerToken, gin.H{
+		"items": []gin.H{{"shipment_item_id": shipment.Items[0].ID, "received_quantity": 4, "damaged_quantity": 3}},
+	})
+	json.Unmarshal(w.Body.Bytes(), &shipment)
+	if shipment.IncidentID == nil {
+		t.Fatalf("expected the short delivery to open an incident: %s", w.Body.String())
+	}
+
+	otherToken := login(t, r, "beta-consumer@example.com")
+	if w := doJSON(r, http.MethodPost, returnsPath, otherToken, gin.H{
+		"reason": "Damaged",
+		"items":  []gin.H{{"order_item_id": line, "quantity": 1}},
+	}); w.Code != http.StatusNotFound {
+		t.Fatalf("another consumer's return: expected 404, got %d", w.Code)
+	}
+
+	if w := doJSON(r, http.MethodPost, returnsPath, consumerToken, gin.H{
+		"reason": "Damaged",
+		"items":  []gin.H{{"order_item_id": line, "quantity": 5}},
+	}); w.Code != http.StatusBadRequest {
+		t.Fatalf("returning more than received: expected 400, got %d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodPost, returnsPath, consumerToken, gin.H{
+		"incident_id": *shipment.IncidentID,
+		"reason":      "Crushed boxes",
+		"items":       []gin.H{{"order_item_id": line, "quantity": 3}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create return: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var rma models.ReturnRequest
+	json.Unmarshal(w.Body.Bytes(), &rma)
+	if rma.Status != models.ReturnStatusRequested || len(rma.Items) != 1 || rma.Items[0].Total != money.FromFloat(300) {
+		t.Fatalf("unexpected return: %+v", rma)
+	}
+
+	receivePath := fmt.Sprintf("/api/v1/sales/returns/%d/receive", rma.ID)
+	if w := doJSON(r, http.MethodPost, receivePath, salesToken, nil); w.Code != http.StatusConflict {
+		t.Fatalf("receiving an unapproved return: expected 409, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/returns/%d/approve", rma.ID), salesToken, gin.H{}); w.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodPost, receivePath, salesToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("receive: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &rma)
+	if rma.CreditNote == nil || rma.CreditNote.Amount != money.FromFloat(300) || rma.CreditNote.Number == "" {
+		t.Fatalf("expected a credit note of 300, got %+v", rma.CreditNote)
+	}
+	if w := doJSON(r, http.MethodPost, receivePath, salesToken, nil); w.Code != http.StatusConflict {
+		t.Fatalf("receiving twice: expected 409, got %d", w.Code)
+	}
+
+	var product models.Product
+	db.First(&product, f.product.ID)
+	if product.Stock != 8 {
+		t.Fatalf("expected stock 8 after restocking 3, got %d", product.Stock)
+	}
+
+	var incident models.Incident
+	db.First(&incident, *shipment.IncidentID)
+	if incident.Status != "resolved" {
+		t.Fatalf("expected the incident to be resolved, got %s", incident.Status)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/analytics", ownerToken, nil)
+	var dashboard handlers.DashboardResponse
+	json.Unmarshal(w.Body.Bytes(), &dashboard)
+	if dashboard.KPIs.Returns != money.FromFloat(300) || dashboard.KPIs.NetGMV != dashboard.KPIs.GMV-money.FromFloat(300) {
+		t.Fatalf("expected GMV net of 300 returned, got %+v", dashboard.KPIs)
+	}
+}
+
+func TestRejectedReturnFreesQuantity(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 2}},
+	})
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	line := order.OrderItems[0].ID
+	doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID), salesToken, gin.H{"status": "confirmed"})
+	shipment := createShipment(t, r, salesToken, order.ID, gin.H{"order_item_id": line, "quantity": 2})
+	doJSON(r, http.MethodPost, fmt.Sprintf("/api/v1/consumer/shipments/%d/confirm", shipment.ID), consumerToken, gin.H{})
+
+	returnsPath := fmt.Sprintf("/api/v1/consumer/orders/%d/returns", order.ID)
+	request := gin.H{"reason": "Ordered too much", "items": []gin.H{{"order_item_id": line, "quantity": 2}}}
+
+	w = doJSON(r, http.MethodPost, returnsPath, consumerToken, request)
+	var rma models.ReturnRequest
+	json.Unmarshal(w.Body.Bytes(), &rma)
+	if w := doJSON(r, http.MethodPost, returnsPath, consumerToken, request); w.Code != http.StatusBadRequest {
+		t.Fatalf("returning the same goods twice: expected 400, got %d", w.Code)
+	}
+
+	rejectPath := fmt.Sprintf("/api/v1/sales/returns/%d/reject", rma.ID)
+	if w := doJSON(r, http.MethodPut, rejectPath, salesToken, gin.H{}); w.Code != http.StatusBadRequest {
+		t.Fatalf("reject without a note: expected 400, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, rejectPath, salesToken, gin.H{"note": "Goods are not returnable"}); w.Code != http.StatusOK {
+		t.Fatalf("reject: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/returns/%d/approve", rma.ID), salesToken, gin.H{}); w.Code != http.StatusConflict {
+		t.Fatalf("approving a rejected return: expected 409, got %d", w.Code)
+	}
+
+	if w := doJSON(r, http.MethodPost, returnsPath, consumerToken, request); w.Code != http.StatusCreated {
+		t.Fatalf("returning after a rejection: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/sales/returns?status=rejected", salesToken, nil)
+	var returns []models.ReturnRequest
+	json.Unmarshal(w.Body.Bytes(), &returns)
+	if len(returns) != 1 || returns[0].ID != rma.ID {
+		t.Fatalf("expected only the rejected return, got %+v", returns)
+	}
+}
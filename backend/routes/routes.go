@@ -1,30 +1,62 @@
 package routes
 
 import (
+	"context"
 	"csci361/config"
+	"csci361/events"
 	"csci361/handlers"
+	"csci361/mailer"
 	"csci361/middleware"
 	ws "csci361/websocket"
+	"log"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) {
+// Initialize registers the API routes on r. It returns the standing order
+// scheduler for the caller to run for as long as the server is up.
+func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) *handlers.StandingOrderScheduler {
+	// Outgoing email
+	mail := mailer.New(cfg)
+
+	// Initialize WebSocket hub; chat messages reach it through the chat
+	// service whether they were sent over REST or the WebSocket
+	var backplane ws.Backplane = ws.NewMemoryBackplane()
+	if cfg.WSBackplane == "postgres" {
+		// Replicas share events through the database
+		pg, err := ws.NewPostgresBackplane(context.Background(), cfg.DatabaseURL, "ws_events")
+		if err != nil {
+			log.Fatal("Failed to start the WebSocket backplane:", err)
+		}
+		backplane = pg
+	}
+	wsHub := ws.NewHubWithBackplane(backplane)
+	go wsHub.Run()
+	chatService := handlers.NewChatService(db, wsHub)
+
+	// Domain events (notifications, live updates, analytics)
+	bus := events.NewBus()
+	handlers.RegisterSubscribers(bus, db, wsHub)
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, cfg)
-	userHandler := handlers.NewUserHandler(db)
+	authHandler := handlers.NewAuthHandler(db, cfg, mail, wsHub)
+	userHandler := handlers.NewUserHandler(db, wsHub)
 	supplierHandler := handlers.NewSupplierHandler(db)
 	consumerHandler := handlers.NewConsumerHandler(db)
 	productHandler := handlers.NewProductHandler(db)
-	orderHandler := handlers.NewOrderHandler(db)
-	chatHandler := handlers.NewChatHandler(db)
+	orderHandler := handlers.NewOrderHandler(db, bus)
+	shipmentHandler := handlers.NewShipmentHandler(db, bus)
+	returnHandler := handlers.NewReturnHandler(db, bus)
+	invoiceHandler := handlers.NewInvoiceHandler(db)
+	standingOrderHandler := handlers.NewStandingOrderHandler(db)
+	pricingHandler := handlers.NewPricingHandler(db)
+	chatHandler := handlers.NewChatHandler(db, chatService)
 	incidentHandler := handlers.NewIncidentHandler(db)
-	analyticsHandler := handlers.NewAnalyticsHandler(db)
-
-	// Initialize WebSocket hub
-	wsHub := ws.NewHub()
-	go wsHub.Run()
+	analyticsHandler := handlers.NewAnalyticsHandler(db, cfg.BaseCurrency)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(db, cfg.BaseCurrency)
+	invitationHandler := handlers.NewInvitationHandler(db, cfg, mail)
+	platformHandler := handlers.NewPlatformHandler(db, wsHub)
 
 	// API v1 routes
 	v1 := r.Group("/api/v1")
@@ -35,18 +67,50 @@ func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) {
 		public.POST("/auth/register", authHandler.Register)
 		public.POST("/auth/login", authHandler.Login)
 		public.POST("/auth/refresh", authHandler.RefreshToken)
+		public.POST("/auth/forgot-password", authHandler.ForgotPassword)
+		public.POST("/auth/reset-password", authHandler.ResetPassword)
+		public.POST("/auth/verify-email", authHandler.VerifyEmail)
+		public.POST("/auth/mfa/verify", authHandler.VerifyMFA)
+		public.POST("/auth/invitations/accept", invitationHandler.AcceptInvitation)
 		public.GET("/categories", productHandler.GetCategories)
 	}
 
 	// Protected routes (authentication required)
 	protected := v1.Group("/")
-	protected.Use(middleware.AuthMiddleware(cfg))
+	protected.Use(middleware.AuthMiddleware(cfg, db))
 	{
+		// Session routes
+		protected.POST("/auth/logout", authHandler.Logout)
+		protected.POST("/auth/logout-all", authHandler.LogoutAll)
+		protected.POST("/auth/verify-email/resend", authHandler.ResendVerification)
+		protected.POST("/auth/mfa/setup", authHandler.SetupMFA)
+		protected.POST("/auth/mfa/enable", authHandler.EnableMFA)
+		protected.POST("/auth/mfa/disable", authHandler.DisableMFA)
+		protected.POST("/auth/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+
 		// User profile routes
 		protected.GET("/profile", userHandler.GetProfile)
 		protected.PUT("/profile", userHandler.UpdateProfile)
 		protected.POST("/profile/avatar", userHandler.UploadAvatar)
 
+		// Chat messages, for the consumer and the supplier's staff of a chat
+		chats := protected.Group("/chats")
+		chats.Use(middleware.RoleMiddleware("consumer", "owner", "admin", "sales"))
+		chats.Use(middleware.StaffTenantMiddleware(db))
+		{
+			chats.GET("/:chat_id/messages", chatHandler.GetChatMessages)
+			chats.POST("/:chat_id/messages", chatHandler.SendMessage)
+			chats.POST("/:chat_id/read", chatHandler.MarkChatRead)
+		}
+
+		// Tickets to open the chat WebSocket with
+		realtime := protected.Group("/ws")
+		realtime.Use(middleware.RoleMiddleware("consumer", "owner", "admin", "sales"))
+		realtime.Use(middleware.StaffTenantMiddleware(db))
+		{
+			realtime.POST("/ticket", authHandler.IssueWebSocketTicket)
+		}
+
 		// Consumer routes
 		consumer := protected.Group("/consumer")
 		consumer.Use(middleware.RoleMiddleware("consumer"))
@@ -58,6 +122,30 @@ func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) {
 			consumer.GET("/products", productHandler.GetProductsForConsumer)
 			consumer.GET("/orders", orderHandler.GetConsumerOrders)
 			consumer.POST("/orders", orderHandler.CreateOrder)
+			consumer.PUT("/orders/:id", orderHandler.UpdateOrder)
+			consumer.POST("/orders/:id/cancel", orderHandler.CancelOrder)
+			consumer.GET("/orders/:id/history", orderHandler.GetOrderHistory)
+			consumer.GET("/orders/:id/shipments", shipmentHandler.GetOrderShipments)
+			consumer.POST("/shipments/:id/confirm", shipmentHandler.ConfirmReceipt)
+
+			// Standing orders
+			consumer.GET("/standing-orders", standingOrderHandler.GetStandingOrders)
+			consumer.POST("/standing-orders", standingOrderHandler.CreateStandingOrder)
+			consumer.PUT("/standing-orders/:id", standingOrderHandler.UpdateStandingOrder)
+			consumer.DELETE("/standing-orders/:id", standingOrderHandler.DeleteStandingOrder)
+			consumer.POST("/standing-orders/:id/pause", standingOrderHandler.PauseStandingOrder)
+			consumer.POST("/standing-orders/:id/resume", standingOrderHandler.ResumeStandingOrder)
+			consumer.POST("/standing-orders/:id/skip", standingOrderHandler.SkipStandingOrderRun)
+			consumer.GET("/standing-orders/:id/runs", standingOrderHandler.GetStandingOrderRuns)
+
+			// Returns
+			consumer.POST("/orders/:id/returns", returnHandler.CreateReturn)
+			consumer.GET("/returns", returnHandler.GetConsumerReturns)
+			consumer.GET("/credit-notes", returnHandler.GetConsumerCreditNotes)
+
+			// Invoices
+			consumer.GET("/invoices", invoiceHandler.GetConsumerInvoices)
+			consumer.GET("/invoices/:id/pdf", invoiceHandler.DownloadConsumerInvoice)
 			consumer.GET("/chats", chatHandler.GetConsumerChats)
 			consumer.POST("/incidents", incidentHandler.CreateIncident)
 		}
@@ -65,12 +153,27 @@ func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) {
 		// Sales routes (for supplier sales staff)
 		sales := protected.Group("/sales")
 		sales.Use(middleware.RoleMiddleware("sales"))
+		sales.Use(middleware.TenantMiddleware(db))
 		{
 			sales.GET("/link-requests", supplierHandler.GetLinkRequests)
 			sales.PUT("/link-requests/:id", supplierHandler.HandleLinkRequest)
 			sales.GET("/consumers", consumerHandler.GetLinkedConsumers)
 			sales.GET("/orders", orderHandler.GetSupplierOrders)
 			sales.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+			sales.GET("/orders/:id/history", orderHandler.GetOrderHistory)
+			sales.GET("/orders/:id/shipments", shipmentHandler.GetOrderShipments)
+			sales.POST("/orders/:id/shipments", shipmentHandler.CreateShipment)
+			sales.PUT("/shipments/:id/delivered", shipmentHandler.MarkShipmentDelivered)
+
+			// Returns
+			sales.GET("/returns", returnHandler.GetSupplierReturns)
+			sales.PUT("/returns/:id/approve", returnHandler.ApproveReturn)
+			sales.PUT("/returns/:id/reject", returnHandler.RejectReturn)
+			sales.POST("/returns/:id/receive", returnHandler.ReceiveReturn)
+
+			// Invoices
+			sales.GET("/invoices", invoiceHandler.GetSupplierInvoices)
+			sales.GET("/invoices/:id/pdf", invoiceHandler.DownloadSupplierInvoice)
 			sales.GET("/chats", chatHandler.GetSupplierChats)
 			sales.POST("/chats/:id/escalate", chatHandler.EscalateChat)
 			sales.GET("/incidents", incidentHandler.GetSupplierIncidents)
@@ -80,23 +183,54 @@ func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) {
 		// Admin routes (for supplier admins)
 		admin := protected.Group("/admin")
 		admin.Use(middleware.RoleMiddleware("admin", "owner"))
+		admin.Use(middleware.TenantMiddleware(db))
 		{
 			admin.GET("/users", userHandler.GetUsers)
-			admin.POST("/users", userHandler.CreateUser)
 			admin.PUT("/users/:id", userHandler.UpdateUser)
 			admin.DELETE("/users/:id", userHandler.DeleteUser)
 
+			admin.GET("/invitations", invitationHandler.GetInvitations)
+			admin.POST("/invitations", invitationHandler.CreateInvitation)
+			admin.DELETE("/invitations/:id", invitationHandler.RevokeInvitation)
+
 			admin.GET("/products", productHandler.GetProducts)
 			admin.POST("/products", productHandler.CreateProduct)
 			admin.PUT("/products/:id", productHandler.UpdateProduct)
 			admin.DELETE("/products/:id", productHandler.DeleteProduct)
 			admin.POST("/products/:id/images", productHandler.UploadProductImages)
 
-			admin.POST("/categories", productHandler.CreateCategory)
-			admin.PUT("/categories/:id", productHandler.UpdateCategory)
-			admin.DELETE("/categories/:id", productHandler.DeleteCategory)
-
 			admin.GET("/orders", orderHandler.GetAllOrders)
+			admin.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+			admin.GET("/orders/:id/history", orderHandler.GetOrderHistory)
+			admin.GET("/orders/:id/shipments", shipmentHandler.GetOrderShipments)
+			admin.POST("/orders/:id/shipments", shipmentHandler.CreateShipment)
+			admin.PUT("/shipments/:id/delivered", shipmentHandler.MarkShipmentDelivered)
+
+			// Returns and credit notes
+			admin.GET("/returns", returnHandler.GetSupplierReturns)
+			admin.PUT("/returns/:id/approve", returnHandler.ApproveReturn)
+			admin.PUT("/returns/:id/reject", returnHandler.RejectReturn)
+			admin.POST("/returns/:id/receive", returnHandler.ReceiveReturn)
+			admin.GET("/credit-notes", returnHandler.GetSupplierCreditNotes)
+
+			// Invoices
+			admin.GET("/invoices", invoiceHandler.GetSupplierInvoices)
+			admin.GET("/invoices/:id/pdf", invoiceHandler.DownloadSupplierInvoice)
+
+			// Pricing
+			admin.GET("/price-lists", pricingHandler.GetPriceLists)
+			admin.POST("/price-lists", pricingHandler.CreatePriceList)
+			admin.PUT("/price-lists/:id", pricingHandler.UpdatePriceList)
+			admin.DELETE("/price-lists/:id", pricingHandler.DeletePriceList)
+			admin.PUT("/consumer-links/:id/price-list", pricingHandler.AssignPriceList)
+			admin.GET("/discounts", pricingHandler.GetDiscounts)
+			admin.POST("/discounts", pricingHandler.CreateDiscount)
+			admin.PUT("/discounts/:id", pricingHandler.UpdateDiscount)
+			admin.DELETE("/discounts/:id", pricingHandler.DeleteDiscount)
+
+			// Ordering rules: minimum order value and delivery schedule
+			admin.PUT("/ordering-rules", supplierHandler.UpdateOrderingRules)
+
 			admin.GET("/analytics", analyticsHandler.GetDashboard)
 			admin.GET("/analytics/kpis", analyticsHandler.GetKPIs)
 
@@ -111,10 +245,15 @@ func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) {
 		// Owner-only routes
 		owner := protected.Group("/owner")
 		owner.Use(middleware.RoleMiddleware("owner"))
+		owner.Use(middleware.TenantMiddleware(db))
 		{
+			owner.POST("/verification-request", supplierHandler.RequestVerification)
+			owner.PUT("/security-policy", supplierHandler.UpdateSecurityPolicy)
+			owner.PUT("/invoice-settings", supplierHandler.UpdateInvoiceSettings)
 			owner.GET("/reports/complaints", analyticsHandler.GetComplaintsReport)
 			owner.GET("/reports/transcripts", chatHandler.ExportTranscripts)
 			owner.GET("/reports/incidents", incidentHandler.ExportIncidents)
+			owner.GET("/reports/invoices", invoiceHandler.ExportInvoices)
 		}
 
 		// Platform admin routes (for platform administrators)
@@ -126,11 +265,23 @@ func Initialize(r *gin.Engine, db *gorm.DB, cfg *config.Config) {
 			platform.PUT("/suppliers/:id/suspend", supplierHandler.SuspendSupplier)
 			platform.GET("/subscriptions", supplierHandler.GetAllSubscriptions)
 			platform.GET("/analytics/platform", analyticsHandler.GetPlatformAnalytics)
+			// Categories are shared by every supplier
+			platform.POST("/categories", productHandler.CreateCategory)
+			platform.PUT("/categories/:id", productHandler.UpdateCategory)
+			platform.DELETE("/categories/:id", productHandler.DeleteCategory)
+			platform.GET("/exchange-rates", exchangeRateHandler.GetExchangeRates)
+			platform.PUT("/exchange-rates", exchangeRateHandler.SetExchangeRate)
+			platform.GET("/admins", platformHandler.GetPlatformAdmins)
+			platform.POST("/admins", platformHandler.CreatePlatformAdmin)
+			platform.DELETE("/admins/:id", platformHandler.DeactivatePlatformAdmin)
+			platform.GET("/audit-logs", platformHandler.GetAuditLogs)
 		}
-
-		// WebSocket endpoint
-		protected.GET("/ws", func(c *gin.Context) {
-			ws.HandleWebSocket(wsHub, c.Writer, c.Request, db)
-		})
 	}
+
+	// WebSocket endpoint; browsers cannot send an Authorization header here,
+	// so connections authenticate with a ticket from /ws/ticket
+	v1.GET("/ws", gin.WrapF(ws.Handler(wsHub, handlers.NewChatGateway(db, cfg, chatService), cfg.AllowedOrigins)))
+
+	// Places standing orders as they fall due
+	return handlers.NewStandingOrderScheduler(db, bus, wsHub)
 }
@@ -0,0 +1,306 @@
+package routes
+
+import (
+	"bytes"
+	"csci361/config"
+	"csci361/database"
+	"csci361/models"
+	"csci361/money"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testPassword = "password123"
+
+// tenantFixture holds the rows created for one supplier company.
+type tenantFixture struct {
+	supplier models.Supplier
+	owner    models.User
+	sales    models.User
+	staff    models.User
+	consumer models.Consumer
+	product  models.Product
+	order    models.Order
+	chat     models.Chat
+	incident models.Incident
+	link     models.ConsumerSupplierLink
+}
+
+func newTestServer(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	return newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret"})
+}
+
+func newTestServerWithConfig(t *testing.T, cfg *config.Config) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	r := gin.New()
+	Initialize(r, db, cfg)
+
+	return r, db
+}
+
+func createUser(t *testing.T, db *gorm.DB, email, role string, supplierID *uint) models.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	user := models.User{
+		Email:      email,
+		Password:   string(hash),
+		Role:       role,
+		SupplierID: supplierID,
+		IsActive:   true,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user %s: %v", email, err)
+	}
+	return user
+}
+
+func seedTenant(t *testing.T, db *gorm.DB, name string, category models.Category) tenantFixture {
+	t.Helper()
+	var f tenantFixture
+
+	f.supplier = models.Supplier{CompanyName: name, IsActive: true, IsVerified: true}
+	mustCreate(t, db, &f.supplier)
+
+	f.owner = createUser(t, db, name+"-owner@example.com", models.RoleOwner, &f.supplier.ID)
+	f.sales = createUser(t, db, name+"-sales@example.com", models.RoleSales, &f.supplier.ID)
+	f.staff = createUser(t, db, name+"-staff@example.com", models.RoleSales, &f.supplier.ID)
+
+	consumerUser := createUser(t, db, name+"-consumer@example.com", models.RoleConsumer, nil)
+	f.consumer = models.Consumer{UserID: consumerUser.ID}
+	mustCreate(t, db, &f.consumer)
+
+	f.link = models.ConsumerSupplierLink{
+		SupplierID:  f.supplier.ID,
+		ConsumerID:  f.consumer.ID,
+		Status:      "pending",
+		RequestedAt: time.Now(),
+	}
+	mustCreate(t, db, &f.link)
+
+	f.product = models.Product{
+		SupplierID: f.supplier.ID,
+		CategoryID: category.ID,
+		Name:       name + " flour",
+		SKU:        name + "-FLOUR",
+		Price:      money.FromFloat(100),
+		Stock:      10,
+		IsActive:   true,
+	}
+	mustCreate(t, db, &f.product)
+
+	f.order = models.Order{
+		SupplierID: f.supplier.ID,
+		ConsumerID: f.consumer.ID,
+		Status:     "pending",
+		Total:      money.FromFloat(100),
+		OrderDate:  time.Now(),
+	}
+	mustCreate(t, db, &f.order)
+
+	f.chat = models.Chat{SupplierID: f.supplier.ID, ConsumerID: f.consumer.ID, Status: "active"}
+	mustCreate(t, db, &f.chat)
+
+	f.incident = models.Incident{
+		SupplierID: f.supplier.ID,
+		ConsumerID: f.consumer.ID,
+		ChatID:     f.chat.ID,
+		Title:      "Damaged goods",
+		Priority:   "medium",
+		Status:     "open",
+	}
+	mustCreate(t, db, &f.incident)
+
+	return f
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("failed to create %T: %v", value, err)
+	}
+}
+
+func doJSON(r *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func login(t *testing.T, r *gin.Engine, email string) string {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, "/api/v1/auth/login", "", gin.H{"email": email, "password": testPassword})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login %s: expected 200, got %d: %s", email, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("login %s: bad response: %v", email, err)
+	}
+	return resp.Token
+}
+
+// TestMutationRoutesAreTenantIsolated checks that every ID-addressed mutation
+// route returns 404 when the row belongs to another supplier, and that the
+// owning supplier can still perform the same request.
+func TestMutationRoutesAreTenantIsolated(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+
+	a := seedTenant(t, db, "alpha", category)
+	b := seedTenant(t, db, "beta", category)
+
+	tokens := map[string]string{
+		"alpha-sales": login(t, r, a.sales.Email),
+		"alpha-owner": login(t, r, a.owner.Email),
+		"beta-sales":  login(t, r, b.sales.Email),
+		"beta-owner":  login(t, r, b.owner.Email),
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		role   string
+		body   interface{}
+	}{
+		{"update order status", http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", a.order.ID), "sales", gin.H{"status": "confirmed"}},
+		{"handle link request", http.MethodPut, fmt.Sprintf("/api/v1/sales/link-requests/%d", a.link.ID), "sales", gin.H{"action": "approve"}},
+		{"update incident", http.MethodPut, fmt.Sprintf("/api/v1/sales/incidents/%d", a.incident.ID), "sales", gin.H{"priority": "high"}},
+		{"escalate chat", http.MethodPost, fmt.Sprintf("/api/v1/sales/chats/%d/escalate", a.chat.ID), "sales", nil},
+		{"read chat messages", http.MethodGet, fmt.Sprintf("/api/v1/chats/%d/messages", a.chat.ID), "sales", nil},
+		{"send chat message", http.MethodPost, fmt.Sprintf("/api/v1/chats/%d/messages", a.chat.ID), "owner", gin.H{"content": "Hello"}},
+		{"update product", http.MethodPut, fmt.Sprintf("/api/v1/admin/products/%d", a.product.ID), "owner", gin.H{"name": "renamed", "price": 120, "category_id": category.ID, "is_active": true}},
+		{"upload product images", http.MethodPost, fmt.Sprintf("/api/v1/admin/products/%d/images", a.product.ID), "owner", nil},
+		{"assign incident", http.MethodPut, fmt.Sprintf("/api/v1/admin/incidents/%d/assign", a.incident.ID), "owner", gin.H{"assigned_to": a.sales.ID}},
+		{"resolve incident", http.MethodPut, fmt.Sprintf("/api/v1/admin/incidents/%d/resolve", a.incident.ID), "owner", gin.H{"notes": "refunded"}},
+		{"update user", http.MethodPut, fmt.Sprintf("/api/v1/admin/users/%d", a.staff.ID), "owner", gin.H{"first_name": "Renamed", "is_active": true}},
+		{"delete product", http.MethodDelete, fmt.Sprintf("/api/v1/admin/products/%d", a.product.ID), "owner", nil},
+		{"delete user", http.MethodDelete, fmt.Sprintf("/api/v1/admin/users/%d", a.staff.ID), "owner", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doJSON(r, tc.method, tc.path, tokens["beta-"+tc.role], tc.body)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("other tenant: expected 404, got %d: %s", w.Code, w.Body.String())
+			}
+
+			w = doJSON(r, tc.method, tc.path, tokens["alpha-"+tc.role], tc.body)
+			if w.Code == http.StatusNotFound || w.Code == http.StatusForbidden || w.Code == http.StatusUnauthorized {
+				t.Fatalf("owning tenant: expected access, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAssignIncidentRejectsOtherTenantAssignee(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+
+	a := seedTenant(t, db, "alpha", category)
+	b := seedTenant(t, db, "beta", category)
+	token := login(t, r, a.owner.Email)
+
+	path := fmt.Sprintf("/api/v1/admin/incidents/%d/assign", a.incident.ID)
+	w := doJSON(r, http.MethodPut, path, token, gin.H{"assigned_to": b.sales.ID})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestConsumerCannotReferenceOtherConsumersChat(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+
+	a := seedTenant(t, db, "alpha", category)
+	b := seedTenant(t, db, "beta", category)
+
+	var consumerUser models.User
+	db.First(&consumerUser, b.consumer.UserID)
+	token := login(t, r, consumerUser.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/incidents", token, gin.H{
+		"supplier_id": a.supplier.ID,
+		"chat_id":     a.chat.ID,
+		"title":       "Not mine",
+		"description": "Trying to attach to someone else's chat",
+	})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTenantScopedListsOnlyShowOwnRows(t *testing.T) {
+	r, db := newTestServer(t)
+
+	category := models.Category{Name: "Groceries", IsActive: true}
+	mustCreate(t, db, &category)
+
+	seedTenant(t, db, "alpha", category)
+	b := seedTenant(t, db, "beta", category)
+	token := login(t, r, b.owner.Email)
+
+	w := doJSON(r, http.MethodGet, "/api/v1/admin/products", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Products []models.Product `json:"products"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad response: %v", err)
+	}
+	if len(resp.Products) != 1 || resp.Products[0].SupplierID != b.supplier.ID {
+		t.Fatalf("expected only beta's product, got %+v", resp.Products)
+	}
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"csci361/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createShipment(t *testing.T, r *gin.Engine, token string, orderID uint, items ...gin.H) models.Shipment {
+	t.Helper()
+
+	w := doJSON(r, http.MethodPost, fmt.Sprintf("/api/v1/sales/orders/%d/shipments", orderID), token, gin.H{
+		"carrier":         "KazPost",
+		"tracking_number": "KZ123",
+		"items":           items,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create shipment: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var shipment models.Shipment
+	json.Unmarshal(w.Body.Bytes(), &shipment)
+	return shipment
+}
+
+func orderStatus(t *testing.T, r *gin.Engine, token string, orderID uint) string {
+	t.Helper()
+
+	w := doJSON(r, http.MethodGet, fmt.Sprintf("/api/v1/consumer/orders/%d/history", orderID), token, nil)
+	var history []models.OrderStatusHistory
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if len(history) == 0 {
+		t.Fatalf("no history for order %d: %s", orderID, w.Body.String())
+	}
+	return history[len(history)-1].ToStatus
+}
+
+func TestPartialShipmentsDriveOrderStatus(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 6}},
+	})
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	line := order.OrderItems[0].ID
+
+	shipPath := fmt.Sprintf("/api/v1/sales/orders/%d/shipments", order.ID)
+	if w := doJSON(r, http.MethodPost, shipPath, salesToken, gin.H{"items": []gin.H{{"order_item_id": line, "quantity": 1}}}); w.Code != http.StatusConflict {
+		t.Fatalf("shipping a pending order: expected 409, got %d", w.Code)
+	}
+	doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID), salesToken, gin.H{"status": "confirmed"})
+
+	first := createShipment(t, r, salesToken, order.ID, gin.H{"order_item_id": line, "quantity": 4})
+	if status := orderStatus(t, r, consumerToken, order.ID); status != models.OrderStatusPartiallyShipped {
+		t.Fatalf("after first batch: expected partially_shipped, got %s", status)
+	}
+
+	if w := doJSON(r, http.MethodPost, shipPath, salesToken, gin.H{"items": []gin.H{{"order_item_id": line, "quantity": 3}}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("over-shipping: expected 400, got %d", w.Code)
+	}
+
+	second := createShipment(t, r, salesToken, order.ID, gin.H{"order_item_id": line, "quantity": 2})
+	if status := orderStatus(t, r, consumerToken, order.ID); status != models.OrderStatusShipped {
+		t.Fatalf("after second batch: expected shipped, got %s", status)
+	}
+
+	for _, shipment := range []models.Shipment{first, second} {
+		w := doJSON(r, http.MethodPost, fmt.Sprintf("/api/v1/consumer/shipments/%d/confirm", shipment.ID), consumerToken, gin.H{})
+		if w.Code != http.StatusOK {
+			t.Fatalf("confirm shipment %d: expected 200, got %d: %s", shipment.ID, w.Code, w.Body.String())
+		}
+	}
+	if status := orderStatus(t, r, consumerToken, order.ID); status != models.OrderStatusDelivered {
+		t.Fatalf("after receipt: expected delivered, got %s", status)
+	}
+
+	var incidents int64
+	db.Model(&models.Incident{}).Where("order_id = ?", order.ID).Count(&incidents)
+	if incidents != 0 {
+		t.Fatalf("a complete delivery opened %d incidents", incidents)
+	}
+}
+
+func TestShortDeliveryOpensIncident(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	seedOrderingTenant(t, db, "beta")
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	salesToken := login(t, r, f.sales.Email)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": f.supplier.ID,
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 5}},
+	})
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	doJSON(r, http.MethodPut, fmt.Sprintf("/api/v1/sales/orders/%d/status", order.ID), salesToken, gin.H{"status": "confirmed"})
+
+	shipment := createShipment(t, r, salesToken, order.ID, gin.H{"order_item_id": order.OrderItems[0].ID, "quantity": 5})
+	confirmPath := fmt.Sprintf("/api/v1/consumer/shipments/%d/confirm", shipment.ID)
+
+	otherToken := login(t, r, "beta-consumer@example.com")
+	if w := doJSON(r, http.MethodPost, confirmPath, otherToken, gin.H{}); w.Code != http.StatusNotFound {
+		t.Fatalf("another consumer confirming: expected 404, got %d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodPost, confirmPath, consumerToken, gin.H{
+		"items": []gin.H{{"shipment_item_id": shipment.Items[0].ID, "received_quantity": 4, "damaged_quantity": 1}},
+		"notes": "One box crushed, one missing",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &shipment)
+	if shipment.IncidentID == nil || shipment.ConfirmedAt == nil {
+		t.Fatalf("expected a confirmed shipment with an incident, got %+v", shipment)
+	}
+
+	var incident models.Incident
+	db.First(&incident, *shipment.IncidentID)
+	if incident.OrderID == nil || *incident.OrderID != order.ID || incident.SupplierID != f.supplier.ID {
+		t.Fatalf("incident is not linked to the order: %+v", incident)
+	}
+
+	if w := doJSON(r, http.MethodPost, confirmPath, consumerToken, gin.H{}); w.Code != http.StatusConflict {
+		t.Fatalf("second confirmation: expected 409, got %d", w.Code)
+	}
+}
@@ -0,0 +1,261 @@
+package routes
+
+import (
+	"csci361/events"
+	"csci361/handlers"
+	"csci361/models"
+	"csci361/money"
+	ws "csci361/websocket"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// makeDue moves the next run of a standing order into the past.
+func makeDue(t *testing.T, db *gorm.DB, id uint) time.Time {
+	t.Helper()
+	due := time.Now().UTC().Add(-time.Minute).Truncate(time.Minute)
+	if err := db.Model(&models.StandingOrder{}).Where("id = ?", id).Update("next_run_at", due).Error; err != nil {
+		t.Fatalf("failed to make standing order due: %v", err)
+	}
+	return due
+}
+
+func TestStandingOrderPlacesOrdersOnSchedule(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	other := seedOrderingTenant(t, db, "beta")
+	token := login(t, r, "alpha-consumer@example.com")
+
+	bus := events.NewBus()
+	hub := ws.NewHub()
+	handlers.RegisterSubscribers(bus, db, hub)
+	scheduler := handlers.NewStandingOrderScheduler(db, bus, hub)
+
+	rare := models.Product{SupplierID: f.supplier.ID, CategoryID: f.product.CategoryID, Name: "Saffron", SKU: "alpha-SAFFRON", Price: money.FromFloat(50), Stock: 1, IsActive: true}
+	mustCreate(t, db, &rare)
+
+	basket := gin.H{
+		"supplier_id": f.supplier.ID,
+		"name":        "Weekly restock",
+		"weekdays":    []string{"mon"},
+		"at":          "08:00",
+		"items": []gin.H{
+			{"product_id": f.product.ID, "quantity": 2},
+			{"product_id": rare.ID, "quantity": 3},
+		},
+	}
+
+	invalid := []gin.H{
+		{"supplier_id": f.supplier.ID, "name": "Both", "cron": "0 8 * * 1", "weekdays": []string{"mon"}, "at": "08:00", "items": basket["items"]},
+		{"supplier_id": f.supplier.ID, "name": "Never", "cron": "0 8 31 2 *", "items": basket["items"]},
+		{"supplier_id": f.supplier.ID, "name": "Stolen", "cron": "0 8 * * 1", "items": []gin.H{{"product_id": other.product.ID, "quantity": 1}}},
+		{"supplier_id": other.supplier.ID, "name": "Unlinked", "cron": "0 8 * * 1", "items": []gin.H{{"product_id": other.product.ID, "quantity": 1}}},
+	}
+	for _, req := range invalid {
+		if w := doJSON(r, http.MethodPost, "/api/v1/consumer/standing-orders", token, req); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", req["name"], w.Code, w.Body.String())
+		}
+	}
+
+	// Without a time zone the schedule is read in the supplier's
+	db.Model(&f.supplier).Update("timezone", "Europe/Moscow")
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/standing-orders", token, basket)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create standing order: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var standing models.StandingOrder
+	json.Unmarshal(w.Body.Bytes(), &standing)
+	if standing.Schedule != "0 8 * * 1" || standing.Timezone != "Europe/Moscow" || standing.NextRunAt == nil || !standing.NextRunAt.After(time.Now()) ||
+		standing.NextRunAt.In(mustLoadLocation(t, "Europe/Moscow")).Weekday() != time.Monday {
+		t.Fatalf("unexpected standing order %s", w.Body.String())
+	}
+	if scheduler.RunDue(time.Now()) != 0 {
+		t.Fatal("expected nothing to run before the standing order is due")
+	}
+
+	// The saffron is short, so the rest of the basket is ordered
+	due := makeDue(t, db, standing.ID)
+	if n := scheduler.RunDue(time.Now()); n != 1 {
+		t.Fatalf("expected one run, got %d", n)
+	}
+	if n := scheduler.RunDue(time.Now()); n != 0 {
+		t.Fatalf("expected the run to happen once, got %d more", n)
+	}
+
+	var runs []models.StandingOrderRun
+	w = doJSON(r, http.MethodGet, fmt.Sprintf("/api/v1/consumer/standing-orders/%d/runs", standing.ID), token, nil)
+	json.Unmarshal(w.Body.Bytes(), &runs)
+	if len(runs) != 1 || runs[0].Status != models.StandingOrderRunPartial || runs[0].OrderID == nil || !runs[0].ScheduledFor.Equal(due) {
+		t.Fatalf("expected a partial run, got %s", w.Body.String())
+	}
+
+	var order models.Order
+	db.Preload("OrderItems").Preload("StatusHistory").First(&order, *runs[0].OrderID)
+	if len(order.OrderItems) != 1 || order.OrderItems[0].ProductID != f.product.ID || order.Total != money.FromFloat(200) {
+		t.Fatalf("expected only the available item to be ordered, got %+v", order)
+	}
+	if len(order.StatusHistory) != 1 || order.StatusHistory[0].ActorRole != models.ActorSystem {
+		t.Fatalf("expected the order to be placed by the system, got %+v", order.StatusHistory)
+	}
+
+	var product models.Product
+	db.First(&product, f.product.ID)
+	if product.Stock != 8 {
+		t.Fatalf("expected stock 8 after the run, got %d", product.Stock)
+	}
+
+	var consumerUser models.User
+	db.Where("email = ?", "alpha-consumer@example.com").First(&consumerUser)
+	var notification models.Notification
+	db.Where("user_id = ?", consumerUser.ID).Last(&notification)
+	if notification.Type != "warning" {
+		t.Fatalf("expected the consumer to be warned, got %+v", notification)
+	}
+
+	// Without skipping unavailable items nothing is ordered
+	basket["skip_unavailable"] = false
+	path := fmt.Sprintf("/api/v1/consumer/standing-orders/%d", standing.ID)
+	if w := doJSON(r, http.MethodPut, path, token, basket); w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	makeDue(t, db, standing.ID)
+	scheduler.RunDue(time.Now())
+	var failed models.StandingOrderRun
+	db.Where("standing_order_id = ?", standing.ID).Last(&failed)
+	if failed.Status != models.StandingOrderRunFailed || failed.OrderID != nil || failed.Message == "" {
+		t.Fatalf("expected a failed run, got %+v", failed)
+	}
+	db.First(&product, f.product.ID)
+	if product.Stock != 8 {
+		t.Fatalf("a failed run must not reserve stock, got %d", product.Stock)
+	}
+}
+
+func TestStandingOrderPauseAndSkip(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	seedOrderingTenant(t, db, "beta")
+	token := login(t, r, "alpha-consumer@example.com")
+
+	bus := events.NewBus()
+	scheduler := handlers.NewStandingOrderScheduler(db, bus, ws.NewHub())
+
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/standing-orders", token, gin.H{
+		"supplier_id": f.supplier.ID,
+		"name":        "Daily bread",
+		"cron":        "0 6 * * *",
+		"timezone":    "UTC",
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 1}},
+	})
+	var standing models.StandingOrder
+	json.Unmarshal(w.Body.Bytes(), &standing)
+	path := fmt.Sprintf("/api/v1/consumer/standing-orders/%d", standing.ID)
+
+	if w := doJSON(r, http.MethodPost, path+"/skip", login(t, r, "beta-consumer@example.com"), nil); w.Code != http.StatusNotFound {
+		t.Fatalf("skipping another consumer's standing order: expected 404, got %d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodPost, path+"/skip", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("skip: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var skipped models.StandingOrder
+	json.Unmarshal(w.Body.Bytes(), &skipped)
+	if skipped.NextRunAt == nil || !skipped.NextRunAt.Equal(standing.NextRunAt.Add(24*time.Hour)) {
+		t.Fatalf("expected the next run a day later than %s, got %v", standing.NextRunAt, skipped.NextRunAt)
+	}
+	var run models.StandingOrderRun
+	db.Where("standing_order_id = ?", standing.ID).First(&run)
+	if run.Status != models.StandingOrderRunSkipped || !run.ScheduledFor.Equal(*standing.NextRunAt) {
+		t.Fatalf("expected the skipped run to be recorded, got %+v", run)
+	}
+
+	if w := doJSON(r, http.MethodPost, path+"/pause", token, nil); w.Code != http.StatusOK {
+		t.Fatalf("pause: expected 200, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, path+"/skip", token, nil); w.Code != http.StatusConflict {
+		t.Fatalf("skipping a paused standing order: expected 409, got %d", w.Code)
+	}
+	db.Model(&models.StandingOrder{}).Where("id = ?", standing.ID).Update("next_run_at", time.Now().UTC().Add(-time.Hour))
+	if n := scheduler.RunDue(time.Now()); n != 0 {
+		t.Fatalf("a paused standing order must not run, got %d runs", n)
+	}
+
+	w = doJSON(r, http.MethodPost, path+"/resume", token, nil)
+	var resumed models.StandingOrder
+	json.Unmarshal(w.Body.Bytes(), &resumed)
+	if resumed.Status != models.StandingOrderActive || resumed.NextRunAt == nil || !resumed.NextRunAt.After(time.Now()) {
+		t.Fatalf("expected the standing order to resume in the future, got %s", w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodDelete, path, token, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", w.Code)
+	}
+	w = doJSON(r, http.MethodGet, "/api/v1/consumer/standing-orders", token, nil)
+	var remaining []models.StandingOrder
+	json.Unmarshal(w.Body.Bytes(), &remaining)
+	if len(remaining) != 0 {
+		t.Fatalf("expected no standing orders after deletion, got %s", w.Body.String())
+	}
+}
+
+func TestStandingOrderEditKeepsSkippedRun(t *testing.T) {
+	r, db := newTestServer(t)
+	f := seedOrderingTenant(t, db, "alpha")
+	token := login(t, r, "alpha-consumer@example.com")
+
+	basket := gin.H{
+		"supplier_id": f.supplier.ID,
+		"name":        "Daily bread",
+		"cron":        "0 6 * * *",
+		"timezone":    "UTC",
+		"items":       []gin.H{{"product_id": f.product.ID, "quantity": 1}},
+	}
+	w := doJSON(r, http.MethodPost, "/api/v1/consumer/standing-orders", token, basket)
+	var standing models.StandingOrder
+	json.Unmarshal(w.Body.Bytes(), &standing)
+	path := fmt.Sprintf("/api/v1/consumer/standing-orders/%d", standing.ID)
+
+	if w := doJSON(r, http.MethodPost, path+"/skip", token, nil); w.Code != http.StatusOK {
+		t.Fatalf("skip: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	skipped := standing.NextRunAt.Add(24 * time.Hour)
+
+	// Editing the basket keeps the run skipped
+	basket["name"] = "Daily rolls"
+	w = doJSON(r, http.MethodPut, path, token, basket)
+	if w.Code != http.StatusOK {
+		t.Fatalf("edit: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var edited models.StandingOrder
+	json.Unmarshal(w.Body.Bytes(), &edited)
+	if edited.NextRunAt == nil || !edited.NextRunAt.Equal(skipped) {
+		t.Fatalf("edit: expected the next run to stay at %s, got %v", skipped, edited.NextRunAt)
+	}
+
+	// A new schedule does not bring back the skipped run
+	basket["cron"] = "0 7 * * *"
+	w = doJSON(r, http.MethodPut, path, token, basket)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reschedule: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &edited)
+	if want := skipped.Add(time.Hour); edited.NextRunAt == nil || !edited.NextRunAt.Equal(want) {
+		t.Fatalf("reschedule: expected the next run at %s, got %v", want, edited.NextRunAt)
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
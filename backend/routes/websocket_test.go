@@ -0,0 +1,423 @@
+package routes
+
+import (
+	"csci361/config"
+	"csci361/models"
+	ws "csci361/websocket"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const testOrigin = "http://app.example.com"
+
+// wsTicket returns a WebSocket ticket for the holder of token.
+func wsTicket(t *testing.T, r *gin.Engine, token string) string {
+	t.Helper()
+	w := doJSON(r, http.MethodPost, "/api/v1/ws/ticket", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("ticket: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Ticket string `json:"ticket"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Ticket
+}
+
+// dialWS opens a WebSocket to srv and returns the status code of the
+// handshake; conn is nil if it was refused.
+func dialWS(t *testing.T, srv *httptest.Server, query, origin string) (*websocket.Conn, int) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/ws?" + query
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		if resp == nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return nil, resp.StatusCode
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, resp.StatusCode
+}
+
+// readEvent returns the next event, or fails if none arrives in time.
+func readEvent(t *testing.T, conn *websocket.Conn) ws.Event {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event ws.Event
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	return event
+}
+
+// expectEvent returns the next event other than presence, and fails unless
+// it is of the given kind.
+func expectEvent(t *testing.T, conn *websocket.Conn, kind string) ws.Event {
+	t.Helper()
+	for {
+		event := readEvent(t, conn)
+		if event.Event == ws.EventPresence && kind != ws.EventPresence {
+			continue
+		}
+		if event.Event != kind {
+			t.Fatalf("expected a %s event, got %+v", kind, event)
+		}
+		return event
+	}
+}
+
+// expectNoEvent fails if an event arrives within a short wait. The
+// connection cannot be read from afterwards.
+func expectNoEvent(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var event ws.Event
+	if err := conn.ReadJSON(&event); err == nil {
+		t.Fatalf("expected no event, got %+v", event)
+	}
+}
+
+// expectClosed reads past queued events and fails unless the server closes
+// the connection in time.
+func expectClosed(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var event ws.Event
+		err := conn.ReadJSON(&event)
+		if _, closed := err.(*websocket.CloseError); closed {
+			return
+		}
+		if err != nil {
+			t.Fatalf("expected the connection to be closed, got %v", err)
+		}
+	}
+}
+
+// connectChat opens a WebSocket for the user subscribed to a chat.
+func connectChat(t *testing.T, r *gin.Engine, srv *httptest.Server, email string, chatID uint) *websocket.Conn {
+	t.Helper()
+	ticket := wsTicket(t, r, login(t, r, email))
+	conn, code := dialWS(t, srv, fmt.Sprintf("ticket=%s&chat_id=%d", ticket, chatID), testOrigin)
+	if conn == nil {
+		t.Fatalf("%s: handshake refused with %d", email, code)
+	}
+	return conn
+}
+
+// dataField returns a field of an event's data.
+func dataField(event ws.Event, field string) interface{} {
+	data, _ := event.Data.(map[string]interface{})
+	return data[field]
+}
+
+func TestWebSocketRequiresTicketAndAllowedOrigin(t *testing.T) {
+	r, db := newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret", AllowedOrigins: []string{testOrigin}})
+	seedOrderingTenant(t, db, "alpha")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	token := login(t, r, "alpha-consumer@example.com")
+	ticket := wsTicket(t, r, token)
+
+	cases := []struct {
+		name   string
+		query  string
+		origin string
+		want   int
+	}{
+		{"no ticket", "", testOrigin, http.StatusUnauthorized},
+		{"access token as ticket", "ticket=" + token, testOrigin, http.StatusUnauthorized},
+		{"forged ticket", "ticket=" + ticket + "x", testOrigin, http.StatusUnauthorized},
+		{"other origin", "ticket=" + ticket, "http://evil.example.com", http.StatusForbidden},
+		{"allowed origin", "ticket=" + ticket, testOrigin, http.StatusSwitchingProtocols},
+	}
+	for _, tc := range cases {
+		if _, code := dialWS(t, srv, tc.query, tc.origin); code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, code)
+		}
+	}
+
+	// Tickets die with their session
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/logout", token, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d", w.Code)
+	}
+	if _, code := dialWS(t, srv, "ticket="+ticket, testOrigin); code != http.StatusUnauthorized {
+		t.Fatalf("ticket of a revoked session: expected 401, got %d", code)
+	}
+}
+
+func TestWebSocketDeliversOnlyToChatMembers(t *testing.T) {
+	r, db := newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret", AllowedOrigins: []string{testOrigin}})
+	a := seedOrderingTenant(t, db, "alpha")
+	b := seedOrderingTenant(t, db, "beta")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	consumer := connectChat(t, r, srv, "alpha-consumer@example.com", a.chat.ID)
+	if event := expectEvent(t, consumer, ws.EventAck); event.ChatID != a.chat.ID {
+		t.Fatalf("consumer: expected to be subscribed, got %+v", event)
+	}
+	sales := connectChat(t, r, srv, a.sales.Email, a.chat.ID)
+	expectEvent(t, sales, ws.EventAck)
+
+	// Other tenants can neither subscribe to nor write into the chat
+	intruder := connectChat(t, r, srv, b.sales.Email, a.chat.ID)
+	if event := expectEvent(t, intruder, ws.EventError); event.ChatID != a.chat.ID || dataField(event, "code") != ws.CodeNotFound {
+		t.Fatalf("intruder: expected subscribing to be refused, got %+v", event)
+	}
+	frames := []ws.Frame{
+		{V: ws.ProtocolVersion, Op: ws.OpSubscribe, ID: "1", ChatID: a.chat.ID},
+		{V: ws.ProtocolVersion, Op: ws.OpTyping, ID: "2", ChatID: a.chat.ID, IsTyping: true},
+		{V: ws.ProtocolVersion, Op: ws.OpSend, ID: "3", ChatID: a.chat.ID, Content: "Hello"},
+		{V: ws.ProtocolVersion, Op: ws.OpRead, ID: "4", ChatID: a.chat.ID},
+		{V: ws.ProtocolVersion, Op: ws.OpSend, ID: "5", Content: "Hello everyone"},
+		{Op: ws.OpTyping, ID: "6", ChatID: b.chat.ID},
+	}
+	for _, frame := range frames {
+		intruder.WriteJSON(frame)
+		if event := expectEvent(t, intruder, ws.EventError); event.ID != frame.ID {
+			t.Fatalf("intruder: expected frame %s to be refused, got %+v", frame.ID, event)
+		}
+	}
+
+	// Members hear each other; the first event the consumer gets after the
+	// sales rep came online is theirs, so nothing of the intruder's got through
+	sales.WriteJSON(ws.Frame{V: ws.ProtocolVersion, Op: ws.OpTyping, ChatID: a.chat.ID, IsTyping: true})
+	event := expectEvent(t, consumer, ws.EventTyping)
+	if event.ChatID != a.chat.ID || event.UserID != a.sales.ID || dataField(event, "is_typing") != true {
+		t.Fatalf("consumer: expected the typing indicator of sales, got %+v", event)
+	}
+	expectNoEvent(t, intruder)
+}
+
+func TestWebSocketAndRESTPostMessagesTheSameWay(t *testing.T) {
+	r, db := newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret", AllowedOrigins: []string{testOrigin}})
+	f := seedOrderingTenant(t, db, "alpha")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	consumer := connectChat(t, r, srv, "alpha-consumer@example.com", f.chat.ID)
+	expectEvent(t, consumer, ws.EventAck)
+	sales := connectChat(t, r, srv, f.sales.Email, f.chat.ID)
+	// Sales was created before the consumer's user, so has the lower ID
+	if event := expectEvent(t, sales, ws.EventAck); fmt.Sprint(dataField(event, "online")) != fmt.Sprintf("[%d %d]", f.sales.ID, f.consumer.UserID) {
+		t.Fatalf("sales: expected both members online, got %+v", event)
+	}
+	if event := readEvent(t, consumer); event.Event != ws.EventPresence || event.UserID != f.sales.ID || dataField(event, "online") != true {
+		t.Fatalf("consumer: expected sales to come online, got %+v", event)
+	}
+
+	// A send over the socket is stored, delivered and acknowledged once,
+	// however often it is retried
+	send := ws.Frame{V: ws.ProtocolVersion, Op: ws.OpSend, ID: "c-1", ChatID: f.chat.ID, Content: "Any flour left?"}
+	consumer.WriteJSON(send)
+	created := expectEvent(t, sales, ws.EventMessageCreated)
+	if created.UserID != f.consumer.UserID || dataField(created, "content") != "Any flour left?" || dataField(created, "client_key") != "c-1" {
+		t.Fatalf("sales: expected the consumer's message, got %+v", created)
+	}
+	expectEvent(t, consumer, ws.EventMessageCreated)
+	ack := expectEvent(t, consumer, ws.EventAck)
+	if ack.ID != "c-1" || dataField(ack, "message_id") != dataField(created, "id") {
+		t.Fatalf("consumer: expected the send to be acknowledged, got %+v", ack)
+	}
+	consumer.WriteJSON(send)
+	if retry := expectEvent(t, consumer, ws.EventAck); dataField(retry, "message_id") != dataField(ack, "message_id") {
+		t.Fatalf("consumer: expected the retry to be acknowledged with the same message, got %+v", retry)
+	}
+	var stored int64
+	db.Model(&models.Message{}).Where("chat_id = ? AND client_key = ?", f.chat.ID, "c-1").Count(&stored)
+	if stored != 1 {
+		t.Fatalf("expected the message to be stored once, got %d", stored)
+	}
+
+	// A send over REST reaches the socket too, and is idempotent in the same way
+	path := fmt.Sprintf("/api/v1/chats/%d/messages", f.chat.ID)
+	salesToken := login(t, r, f.sales.Email)
+	reply := gin.H{"content": "Plenty", "client_key": "s-1"}
+	w := doJSON(r, http.MethodPost, path, salesToken, reply)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("REST send: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var message models.Message
+	json.Unmarshal(w.Body.Bytes(), &message)
+	if w := doJSON(r, http.MethodPost, path, salesToken, reply); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), fmt.Sprintf(`"id":%d,`, message.ID)) {
+		t.Fatalf("REST retry: expected 200 with the same message, got %d: %s", w.Code, w.Body.String())
+	}
+	created = expectEvent(t, consumer, ws.EventMessageCreated)
+	if dataField(created, "id") != float64(message.ID) || created.UserID != f.sales.ID {
+		t.Fatalf("consumer: expected the message sent over REST, got %+v", created)
+	}
+
+	// Reading over the socket is delivered to the other side
+	consumer.WriteJSON(ws.Frame{V: ws.ProtocolVersion, Op: ws.OpRead, ID: "c-2", ChatID: f.chat.ID})
+	expectEvent(t, sales, ws.EventMessageCreated) // their own reply
+	if read := expectEvent(t, sales, ws.EventMessageRead); read.UserID != f.consumer.UserID || dataField(read, "marked") != float64(1) {
+		t.Fatalf("sales: expected the consumer to have read one message, got %+v", read)
+	}
+	expectEvent(t, consumer, ws.EventMessageRead)
+	expectEvent(t, consumer, ws.EventAck)
+
+	consumer.WriteJSON(ws.Frame{V: ws.ProtocolVersion, Op: ws.OpSend, ChatID: f.chat.ID, Content: "No key"})
+	if event := expectEvent(t, consumer, ws.EventError); dataField(event, "code") != ws.CodeInvalid {
+		t.Fatalf("expected a send without id to be refused, got %+v", event)
+	}
+	consumer.WriteJSON(ws.Frame{V: ws.ProtocolVersion, Op: ws.OpSend, ID: "c-long", ChatID: f.chat.ID, Content: strings.Repeat("я", 4001)})
+	if event := expectEvent(t, consumer, ws.EventError); event.ID != "c-long" || dataField(event, "code") != ws.CodeInvalid {
+		t.Fatalf("expected a too long message to be refused, got %+v", event)
+	}
+	db.Model(&f.chat).Update("status", "archived")
+	consumer.WriteJSON(ws.Frame{V: ws.ProtocolVersion, Op: ws.OpSend, ID: "c-3", ChatID: f.chat.ID, Content: "Hello?"})
+	if event := expectEvent(t, consumer, ws.EventError); event.ID != "c-3" || dataField(event, "code") != ws.CodeConflict {
+		t.Fatalf("expected a send to an archived chat to be refused, got %+v", event)
+	}
+
+	// Leaving is announced
+	sales.Close()
+	if event := readEvent(t, consumer); event.Event != ws.EventPresence || event.UserID != f.sales.ID || dataField(event, "online") != false {
+		t.Fatalf("consumer: expected sales to go offline, got %+v", event)
+	}
+}
+
+func TestWebSocketCarriesManyChatsAndUserAndSupplierEvents(t *testing.T) {
+	r, db := newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret", AllowedOrigins: []string{testOrigin}})
+	a := seedOrderingTenant(t, db, "alpha")
+	b := seedOrderingTenant(t, db, "beta")
+	second := models.Chat{SupplierID: a.supplier.ID, ConsumerID: a.consumer.ID}
+	mustCreate(t, db, &second)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	connect := func(email string) *websocket.Conn {
+		conn, code := dialWS(t, srv, "ticket="+wsTicket(t, r, login(t, r, email)), testOrigin)
+		if conn == nil {
+			t.Fatalf("%s: handshake refused with %d", email, code)
+		}
+		return conn
+	}
+	consumerToken := login(t, r, "alpha-consumer@example.com")
+	consumer := connect("alpha-consumer@example.com")
+	sales := connect(a.sales.Email)
+	intruder := connect(b.sales.Email)
+
+	// One socket follows every chat of the sales rep
+	for _, chat := range []models.Chat{a.chat, second} {
+		sales.WriteJSON(ws.Frame{V: ws.ProtocolVersion, Op: ws.OpSubscribe, ID: fmt.Sprint(chat.ID), ChatID: chat.ID})
+		if event := expectEvent(t, sales, ws.EventAck); event.ChatID != chat.ID {
+			t.Fatalf("sales: expected to be subscribed to chat %d, got %+v", chat.ID, event)
+		}
+	}
+	w := doJSON(r, http.MethodPost, fmt.Sprintf("/api/v1/chats/%d/messages", second.ID), consumerToken, gin.H{"content": "Second thread"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("send: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if event := expectEvent(t, sales, ws.EventMessageCreated); event.ChatID != second.ID {
+		t.Fatalf("sales: expected the message of chat %d, got %+v", second.ID, event)
+	}
+
+	// Orders reach the consumer and the supplier's staff outside any chat
+	w = doJSON(r, http.MethodPost, "/api/v1/consumer/orders", consumerToken, gin.H{
+		"supplier_id": a.supplier.ID,
+		"items":       []gin.H{{"product_id": a.product.ID, "quantity": 1}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("order: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+
+	event := expectEvent(t, consumer, "order.created")
+	if event.ChatID != 0 || dataField(event, "order_id") != float64(order.ID) {
+		t.Fatalf("consumer: expected the new order, got %+v", event)
+	}
+	if event := expectEvent(t, sales, ws.EventNotification); dataField(event, "user_id") != float64(a.sales.ID) {
+		t.Fatalf("sales: expected their notification, got %+v", event)
+	}
+	if event := expectEvent(t, sales, "order.created"); dataField(event, "order_id") != float64(order.ID) {
+		t.Fatalf("sales: expected the new order, got %+v", event)
+	}
+	expectNoEvent(t, intruder)
+}
+
+func TestWebSocketClosesConnectionsOfDeactivatedUsers(t *testing.T) {
+	r, db := newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret", AllowedOrigins: []string{testOrigin}})
+	a := seedOrderingTenant(t, db, "alpha")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	consumer := connectChat(t, r, srv, "alpha-consumer@example.com", a.chat.ID)
+	expectEvent(t, consumer, ws.EventAck)
+	sales := connectChat(t, r, srv, a.sales.Email, a.chat.ID)
+	expectEvent(t, sales, ws.EventAck)
+	if event := expectEvent(t, consumer, ws.EventPresence); event.UserID != a.sales.ID || dataField(event, "online") != true {
+		t.Fatalf("consumer: expected sales to come online, got %+v", event)
+	}
+
+	w := doJSON(r, http.MethodDelete, fmt.Sprintf("/api/v1/admin/users/%d", a.sales.ID), login(t, r, a.owner.Email), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("deactivate: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The connection closes, ending its chat and supplier subscriptions
+	expectClosed(t, sales)
+	if event := expectEvent(t, consumer, ws.EventPresence); event.UserID != a.sales.ID || dataField(event, "online") != false {
+		t.Fatalf("consumer: expected sales to go offline, got %+v", event)
+	}
+
+}
+
+func TestWebSocketClosesConnectionsOfSignedOutSessions(t *testing.T) {
+	r, db := newTestServerWithConfig(t, &config.Config{JWTSecret: "test-secret", AllowedOrigins: []string{testOrigin}})
+	a := seedOrderingTenant(t, db, "alpha")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	dial := func(token string) *websocket.Conn {
+		t.Helper()
+		conn, code := dialWS(t, srv, fmt.Sprintf("ticket=%s&chat_id=%d", wsTicket(t, r, token), a.chat.ID), testOrigin)
+		if conn == nil {
+			t.Fatalf("handshake refused with %d", code)
+		}
+		expectEvent(t, conn, ws.EventAck)
+		return conn
+	}
+	laptopToken, _ := loginTokens(t, r, a.sales.Email)
+	phoneToken, phoneRefresh := loginTokens(t, r, a.sales.Email)
+	laptop := dial(laptopToken)
+	phone := dial(phoneToken)
+
+	// Signing out closes only that session's connection
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/logout", laptopToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	expectClosed(t, laptop)
+	path := fmt.Sprintf("/api/v1/chats/%d/messages", a.chat.ID)
+	if w := doJSON(r, http.MethodPost, path, login(t, r, "alpha-consumer@example.com"), gin.H{"content": "Still there?"}); w.Code != http.StatusCreated {
+		t.Fatalf("send: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if event := expectEvent(t, phone, ws.EventMessageCreated); dataField(event, "content") != "Still there?" {
+		t.Fatalf("phone: expected the message, got %+v", event)
+	}
+
+	// Replaying a rotated refresh token revokes the session and closes it
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/refresh", "", gin.H{"refresh_token": phoneRefresh}); w.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/auth/refresh", "", gin.H{"refresh_token": phoneRefresh}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reuse: expected 401, got %d", w.Code)
+	}
+	expectClosed(t, phone)
+}
@@ -0,0 +1,63 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for the SHA1 seed, truncated to 6 digits.
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range cases {
+		got, err := Code(secret, Step(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tc.unix, err)
+		}
+		if got != tc.code {
+			t.Errorf("Code(%d) = %s, want %s", tc.unix, got, tc.code)
+		}
+	}
+}
+
+func TestValidateAcceptsAdjacentStepsOnly(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	for offset, want := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, _ := Code(secret, Step(now)+offset)
+		step, ok := Validate(secret, code, now)
+		if ok != want {
+			t.Errorf("offset %d: valid = %v, want %v", offset, ok, want)
+		}
+		if ok && step != Step(now)+offset {
+			t.Errorf("offset %d: matched step %d", offset, step)
+		}
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("SCP Platform", "owner@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/SCP%20Platform:owner@example.com?") {
+		t.Fatalf("unexpected label: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=SCP+Platform") {
+		t.Fatalf("missing parameters: %s", uri)
+	}
+}
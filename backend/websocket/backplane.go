@@ -0,0 +1,44 @@
+package ws
+
+import "sync"
+
+// Backplane carries the events published on a hub to the hubs of every
+// instance, so a client gets them whichever instance it is connected to.
+type Backplane interface {
+	// Publish sends a payload to the receivers of every instance, this
+	// instance's included.
+	Publish(payload []byte) error
+	// Receive registers a function that is called with every payload
+	// published.
+	Receive(receive func(payload []byte))
+}
+
+// MemoryBackplane connects the hubs of a single process. It is what NewHub
+// uses when there is only one instance, and lets tests run hubs side by
+// side.
+type MemoryBackplane struct {
+	receivers []func(payload []byte)
+	mu        sync.RWMutex
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{}
+}
+
+// Publish hands the payload to every receiver before returning.
+func (b *MemoryBackplane) Publish(payload []byte) error {
+	b.mu.RLock()
+	receivers := b.receivers
+	b.mu.RUnlock()
+
+	for _, receive := range receivers {
+		receive(payload)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Receive(receive func(payload []byte)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receivers = append(b.receivers, receive)
+}
@@ -0,0 +1,369 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Kinds of topics.
+const (
+	TopicChat     = "chat"     // members of a chat who subscribed to it
+	TopicUser     = "user"     // every connection of the user
+	TopicSupplier = "supplier" // every connection of the supplier's staff
+)
+
+// Topic is a channel events are published on.
+type Topic struct {
+	Kind string `json:"kind"`
+	ID   uint   `json:"id"`
+}
+
+func ChatTopic(chatID uint) Topic {
+	return Topic{Kind: TopicChat, ID: chatID}
+}
+
+func UserTopic(userID uint) Topic {
+	return Topic{Kind: TopicUser, ID: userID}
+}
+
+func SupplierTopic(supplierID uint) Topic {
+	return Topic{Kind: TopicSupplier, ID: supplierID}
+}
+
+func (t Topic) String() string {
+	return fmt.Sprintf("%s:%d", t.Kind, t.ID)
+}
+
+// Hub maintains the set of active clients, indexed by the topics they
+// subscribed to, so an event only visits its recipients. Every connection
+// is subscribed to its user's topic, and staff connections to their
+// supplier's.
+//
+// Published events travel over the backplane, so the hubs of every instance
+// deliver them to their own clients. Presence is only known per instance.
+type Hub struct {
+	clients    map[*Client]bool           // registered clients
+	topics     map[Topic]map[*Client]bool // clients by topic
+	unregister chan *Client               // unregister requests from clients
+	mu         sync.RWMutex               // guards the maps above and Client.topics
+	backplane  Backplane
+}
+
+// envelope is how a published event travels over the backplane. A Close
+// envelope disconnects the topic's clients instead, or only those of a
+// session if it names one.
+type envelope struct {
+	Topic   Topic           `json:"topic"`
+	Event   json.RawMessage `json:"event,omitempty"`
+	Close   bool            `json:"close,omitempty"`
+	Session string          `json:"session,omitempty"`
+}
+
+// NewHub creates a websocket hub for a single instance.
+func NewHub() *Hub {
+	return NewHubWithBackplane(NewMemoryBackplane())
+}
+
+// NewHubWithBackplane creates a websocket hub that shares events with the
+// hubs of other instances over the backplane.
+func NewHubWithBackplane(backplane Backplane) *Hub {
+	h := &Hub{
+		clients:    make(map[*Client]bool),
+		topics:     make(map[Topic]map[*Client]bool),
+		unregister: make(chan *Client),
+		backplane:  backplane,
+	}
+	backplane.Receive(h.receive)
+	return h
+}
+
+// Run starts the hub event loop.
+func (h *Hub) Run() {
+	for client := range h.unregister {
+		h.disconnect(client)
+	}
+}
+
+// register adds a client to the hub before its pumps start.
+func (h *Hub) register(client *Client) {
+	h.mu.Lock()
+	h.clients[client] = true
+	h.join(client, UserTopic(client.identity.UserID))
+	if client.identity.SupplierID != nil {
+		h.join(client, SupplierTopic(*client.identity.SupplierID))
+	}
+	h.mu.Unlock()
+	log.Printf("Client connected: UserID %d", client.identity.UserID)
+}
+
+// disconnect removes a client from the hub and tells the chats it was
+// subscribed to if its user went offline.
+func (h *Hub) disconnect(client *Client) {
+	h.mu.Lock()
+	if !h.clients[client] {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.clients, client)
+	var chats []uint
+	for topic := range client.topics {
+		h.unindex(topic, client)
+		if topic.Kind == TopicChat {
+			chats = append(chats, topic.ID)
+		}
+	}
+	close(client.send)
+	h.mu.Unlock()
+	log.Printf("Client disconnected: UserID %d", client.identity.UserID)
+
+	for _, chatID := range chats {
+		h.announce(chatID, client.identity.UserID, false)
+	}
+}
+
+// Subscribe adds a client to a topic and reports whether it was not
+// subscribed yet.
+func (h *Hub) Subscribe(client *Client, topic Topic) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.clients[client] || client.topics[topic] {
+		return false
+	}
+	h.join(client, topic)
+	return true
+}
+
+// Unsubscribe removes a client from a topic and reports whether it was
+// subscribed.
+func (h *Hub) Unsubscribe(client *Client, topic Topic) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !client.topics[topic] {
+		return false
+	}
+	delete(client.topics, topic)
+	h.unindex(topic, client)
+	return true
+}
+
+// join subscribes a client to a topic; h.mu must be held for writing.
+func (h *Hub) join(client *Client, topic Topic) {
+	client.topics[topic] = true
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Client]bool)
+	}
+	h.topics[topic][client] = true
+}
+
+// unindex drops a client from a topic's index; h.mu must be held for writing.
+func (h *Hub) unindex(topic Topic, client *Client) {
+	delete(h.topics[topic], client)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// Publish sends an event to the clients subscribed to a topic on every
+// instance. If the backplane fails, only this instance's clients get it.
+func (h *Hub) Publish(topic Topic, event Event) {
+	if topic.Kind == TopicChat {
+		event.ChatID = topic.ID
+	}
+	payload, ok := encode(event)
+	if !ok {
+		return
+	}
+
+	message, err := json.Marshal(envelope{Topic: topic, Event: payload})
+	if err == nil {
+		err = h.backplane.Publish(message)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event on %s, delivering it here only: %v", event.Event, topic, err)
+		h.deliver(topic, payload)
+	}
+}
+
+// receive delivers an event that came over the backplane.
+func (h *Hub) receive(message []byte) {
+	var env envelope
+	if err := json.Unmarshal(message, &env); err != nil {
+		log.Printf("Discarding malformed backplane message: %v", err)
+		return
+	}
+	if env.Close && env.Session != "" {
+		h.closeSession(env.Session)
+		return
+	}
+	if env.Close {
+		h.closeTopic(env.Topic)
+		return
+	}
+	h.deliver(env.Topic, env.Event)
+}
+
+// deliver sends an encoded event to this instance's clients subscribed to
+// a topic.
+func (h *Hub) deliver(topic Topic, payload []byte) {
+	h.broadcast(payload, func() map[*Client]bool { return h.topics[topic] })
+}
+
+// PublishToChat sends an event to the clients subscribed to a chat.
+func (h *Hub) PublishToChat(chatID uint, event Event) {
+	h.Publish(ChatTopic(chatID), event)
+}
+
+// PublishToSupplier sends an event to every connection of a supplier's staff.
+func (h *Hub) PublishToSupplier(supplierID uint, event Event) {
+	h.Publish(SupplierTopic(supplierID), event)
+}
+
+// PublishToUser sends an event to every connection of a user.
+func (h *Hub) PublishToUser(userID uint, event Event) {
+	h.Publish(UserTopic(userID), event)
+}
+
+// DisconnectUser closes every connection of a user on every instance, and
+// with them their chat subscriptions. Clients have to authenticate again,
+// so a user who was deactivated or signed out everywhere receives nothing
+// more. If the backplane fails, only this instance's connections close.
+func (h *Hub) DisconnectUser(userID uint) {
+	topic := UserTopic(userID)
+	message, err := json.Marshal(envelope{Topic: topic, Close: true})
+	if err == nil {
+		err = h.backplane.Publish(message)
+	}
+	if err != nil {
+		log.Printf("Failed to publish disconnect on %s, closing connections here only: %v", topic, err)
+		h.closeTopic(topic)
+	}
+}
+
+// DisconnectSession closes the connections opened in one sign-in session on
+// every instance, leaving the user's other sessions connected. If the
+// backplane fails, only this instance's connections close.
+func (h *Hub) DisconnectSession(sessionID string) {
+	message, err := json.Marshal(envelope{Close: true, Session: sessionID})
+	if err == nil {
+		err = h.backplane.Publish(message)
+	}
+	if err != nil {
+		log.Printf("Failed to publish disconnect of session %s, closing connections here only: %v", sessionID, err)
+		h.closeSession(sessionID)
+	}
+}
+
+// closeSession disconnects this instance's clients opened in a session.
+func (h *Hub) closeSession(sessionID string) {
+	h.mu.RLock()
+	var clients []*Client
+	for client := range h.clients {
+		if client.identity.SessionID == sessionID {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		h.disconnect(client)
+	}
+}
+
+// closeTopic disconnects this instance's clients subscribed to a topic.
+func (h *Hub) closeTopic(topic Topic) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.topics[topic]))
+	for client := range h.topics[topic] {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		h.disconnect(client)
+	}
+}
+
+// sendTo sends an event to one client if it is still connected.
+func (h *Hub) sendTo(client *Client, event Event) {
+	payload, ok := encode(event)
+	if !ok {
+		return
+	}
+	h.broadcast(payload, func() map[*Client]bool {
+		if !h.clients[client] {
+			return nil
+		}
+		return map[*Client]bool{client: true}
+	})
+}
+
+// encode stamps an event with the protocol version and marshals it.
+func encode(event Event) ([]byte, bool) {
+	event.V = ProtocolVersion
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event.Event, err)
+		return nil, false
+	}
+	return payload, true
+}
+
+// broadcast queues an encoded event for the clients recipients returns,
+// which is called with h.mu held for reading. Clients whose send buffer is
+// full are disconnected.
+func (h *Hub) broadcast(payload []byte, recipients func() map[*Client]bool) {
+	var slow []*Client
+	h.mu.RLock()
+	for client := range recipients() {
+		select {
+		case client.send <- payload:
+		default:
+			slow = append(slow, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range slow {
+		h.disconnect(client)
+	}
+}
+
+// online returns the users with a client on this instance subscribed to a
+// chat, by ID.
+func (h *Hub) online(chatID uint) []uint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	seen := map[uint]bool{}
+	users := []uint{}
+	for client := range h.topics[ChatTopic(chatID)] {
+		if !seen[client.identity.UserID] {
+			seen[client.identity.UserID] = true
+			users = append(users, client.identity.UserID)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+// announce tells a chat that a user came online, or went offline if none of
+// their clients is subscribed to it any more.
+func (h *Hub) announce(chatID, userID uint, online bool) {
+	if !online {
+		for _, id := range h.online(chatID) {
+			if id == userID {
+				return
+			}
+		}
+	}
+	h.PublishToChat(chatID, Event{
+		Event:  EventPresence,
+		UserID: userID,
+		Data:   map[string]bool{"online": online},
+	})
+}
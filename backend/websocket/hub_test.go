@@ -0,0 +1,181 @@
+package ws
+
+import (
+	"context"
+	"csci361/database"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// connect registers a client of the user without a connection behind it;
+// what the hub sends it piles up in its send buffer.
+func connect(hub *Hub, userID uint) *Client {
+	return connectSession(hub, userID, "")
+}
+
+// connectSession is connect for a client opened in a sign-in session.
+func connectSession(hub *Hub, userID uint, sessionID string) *Client {
+	client := &Client{
+		hub:      hub,
+		send:     make(chan []byte, 16),
+		identity: Identity{UserID: userID, SessionID: sessionID},
+		topics:   make(map[Topic]bool),
+	}
+	hub.register(client)
+	return client
+}
+
+// expectEvent returns the next event queued for the client, and fails
+// unless it is of the given kind.
+func expectEvent(t *testing.T, client *Client, kind string) Event {
+	t.Helper()
+	select {
+	case payload := <-client.send:
+		var event Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatalf("user %d: malformed event: %v", client.identity.UserID, err)
+		}
+		if event.Event != kind {
+			t.Fatalf("user %d: expected a %s event, got %+v", client.identity.UserID, kind, event)
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("user %d: expected a %s event, got none", client.identity.UserID, kind)
+	}
+	return Event{}
+}
+
+// expectNoEvent fails if an event is queued for the client within a short
+// wait.
+func expectNoEvent(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case payload := <-client.send:
+		t.Fatalf("user %d: expected no event, got %s", client.identity.UserID, payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// expectClosed fails unless the hub closes the client's connection in time.
+func expectClosed(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case _, open := <-client.send:
+		if open {
+			t.Fatalf("user %d: expected the connection to be closed, got an event", client.identity.UserID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("user %d: the connection was not closed", client.identity.UserID)
+	}
+}
+
+// testFanOut checks that events published on either hub reach the clients
+// of both, and only those subscribed to the topic.
+func testFanOut(t *testing.T, a, b *Hub) {
+	here := connect(a, 1)
+	there := connect(b, 2)
+	bystander := connect(b, 3)
+	a.Subscribe(here, ChatTopic(10))
+	b.Subscribe(there, ChatTopic(10))
+
+	a.PublishToChat(10, Event{Event: EventTyping, UserID: 1, Data: map[string]bool{"is_typing": true}})
+	for _, client := range []*Client{here, there} {
+		if event := expectEvent(t, client, EventTyping); event.V != ProtocolVersion || event.ChatID != 10 || event.UserID != 1 {
+			t.Fatalf("user %d: expected the typing indicator of chat 10, got %+v", client.identity.UserID, event)
+		}
+	}
+
+	b.PublishToUser(1, Event{Event: EventNotification})
+	expectEvent(t, here, EventNotification)
+
+	// Events larger than a NOTIFY payload get through as well
+	content := strings.Repeat("Доставка в понедельник. ", 1000)
+	a.PublishToChat(10, Event{Event: EventMessageCreated, Data: map[string]string{"content": content}})
+	for _, client := range []*Client{here, there} {
+		if event := expectEvent(t, client, EventMessageCreated); event.Data.(map[string]interface{})["content"] != content {
+			t.Fatalf("user %d: the message arrived truncated", client.identity.UserID)
+		}
+	}
+
+	b.Unsubscribe(there, ChatTopic(10))
+	a.PublishToChat(10, Event{Event: EventTyping, UserID: 1})
+	expectEvent(t, here, EventTyping)
+	expectNoEvent(t, there)
+	expectNoEvent(t, bystander)
+
+	// Signing out of a session closes its connections on the other instance
+	phone := connectSession(b, 2, "phone")
+	a.DisconnectSession("phone")
+	expectClosed(t, phone)
+	expectNoEvent(t, there)
+
+	// Disconnecting a user closes their connections on the other instance
+	a.DisconnectUser(2)
+	expectClosed(t, there)
+	expectNoEvent(t, bystander)
+}
+
+func TestHubsShareEventsInMemory(t *testing.T) {
+	backplane := NewMemoryBackplane()
+	testFanOut(t, NewHubWithBackplane(backplane), NewHubWithBackplane(backplane))
+}
+
+// TestHubsShareEventsThroughPostgres runs two hubs with a backplane each
+// against one database, as two instances would. Set TEST_DATABASE_URL to
+// run it.
+func TestHubsShareEventsThroughPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	// Events are stored in the ws_events table
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	channel := fmt.Sprintf("ws_test_%d", time.Now().UnixNano())
+	hubs := make([]*Hub, 2)
+	for i := range hubs {
+		backplane, err := NewPostgresBackplane(context.Background(), dsn, channel)
+		if err != nil {
+			t.Fatalf("backplane: %v", err)
+		}
+		t.Cleanup(backplane.Close)
+		hubs[i] = NewHubWithBackplane(backplane)
+	}
+	testFanOut(t, hubs[0], hubs[1])
+}
+
+func TestHubDeliversLocallyWhenTheBackplaneFails(t *testing.T) {
+	hub := NewHubWithBackplane(failingBackplane{})
+	client := connect(hub, 1)
+
+	hub.PublishToUser(1, Event{Event: EventNotification})
+	expectEvent(t, client, EventNotification)
+}
+
+// failingBackplane refuses everything published on it.
+type failingBackplane struct{}
+
+func (failingBackplane) Publish(payload []byte) error {
+	return fmt.Errorf("backplane is down")
+}
+
+func (failingBackplane) Receive(receive func(payload []byte)) {}
@@ -0,0 +1,178 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// eventRetention is how long published events are kept in ws_events for the
+// other instances to read.
+const eventRetention = 5 * time.Minute
+
+// reconnectDelay is how long the listener waits before connecting again
+// after losing its connection.
+const reconnectDelay = time.Second
+
+// PostgresBackplane carries events between the instances sharing a
+// PostgreSQL database. NOTIFY payloads are limited to 8000 bytes, so each
+// event is stored in the ws_events table and only its ID is notified; the
+// listeners load it from there. Events published while an instance is
+// reconnecting are lost to its clients.
+type PostgresBackplane struct {
+	dsn     string
+	channel string
+
+	publisher *pgx.Conn  // connection events are published on, opened when needed
+	purgedAt  time.Time  // when expired events were last deleted
+	mu        sync.Mutex // guards publisher and purgedAt
+
+	receivers []func(payload []byte)
+	rmu       sync.RWMutex // guards receivers
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPostgresBackplane starts listening on channel, and returns once
+// events published on it will be received.
+func NewPostgresBackplane(ctx context.Context, dsn, channel string) (*PostgresBackplane, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	b := &PostgresBackplane{dsn: dsn, channel: channel, ctx: ctx, cancel: cancel}
+
+	listener, err := b.listen()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go b.run(listener)
+	return b, nil
+}
+
+// Publish stores a payload and notifies every instance listening on the
+// channel of it.
+func (b *PostgresBackplane) Publish(payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.publisher == nil || b.publisher.IsClosed() {
+		conn, err := pgx.Connect(b.ctx, b.dsn)
+		if err != nil {
+			return err
+		}
+		b.publisher = conn
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+	defer cancel()
+	_, err := b.publisher.Exec(ctx, `WITH event AS (INSERT INTO ws_events (payload) VALUES ($2) RETURNING id)
+		SELECT pg_notify($1, id::text) FROM event`, b.channel, string(payload))
+	if err != nil {
+		b.publisher.Close(context.Background())
+		b.publisher = nil
+		return err
+	}
+
+	if time.Since(b.purgedAt) > eventRetention {
+		b.purgedAt = time.Now()
+		if _, err := b.publisher.Exec(ctx, "DELETE FROM ws_events WHERE created_at < now() - make_interval(secs => $1)", eventRetention.Seconds()); err != nil {
+			log.Printf("WebSocket backplane failed to delete expired events: %v", err)
+		}
+	}
+	return nil
+}
+
+func (b *PostgresBackplane) Receive(receive func(payload []byte)) {
+	b.rmu.Lock()
+	defer b.rmu.Unlock()
+	b.receivers = append(b.receivers, receive)
+}
+
+// Close stops listening and closes the backplane's connections.
+func (b *PostgresBackplane) Close() {
+	b.cancel()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.publisher != nil {
+		b.publisher.Close(context.Background())
+		b.publisher = nil
+	}
+}
+
+// listen opens a connection listening on the channel.
+func (b *PostgresBackplane) listen() (*pgx.Conn, error) {
+	conn, err := pgx.Connect(b.ctx, b.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(b.ctx, "LISTEN "+pgx.Identifier{b.channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// run passes notifications on to the receivers until the backplane is
+// closed, reconnecting whenever the connection is lost.
+func (b *PostgresBackplane) run(listener *pgx.Conn) {
+	defer func() {
+		if listener != nil {
+			listener.Close(context.Background())
+		}
+	}()
+
+	for {
+		if listener == nil {
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+			}
+
+			var err error
+			if listener, err = b.listen(); err != nil {
+				log.Printf("WebSocket backplane failed to reconnect: %v", err)
+				continue
+			}
+			log.Println("WebSocket backplane reconnected")
+		}
+
+		notification, err := listener.WaitForNotification(b.ctx)
+		if err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			log.Printf("WebSocket backplane lost its connection: %v", err)
+			listener.Close(context.Background())
+			listener = nil
+			continue
+		}
+
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			log.Printf("WebSocket backplane ignored notification %q", notification.Payload)
+			continue
+		}
+		var payload string
+		if err := listener.QueryRow(b.ctx, "SELECT payload FROM ws_events WHERE id = $1", id).Scan(&payload); err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			// A lost connection is noticed while waiting for the next notification
+			log.Printf("WebSocket backplane failed to load event %d: %v", id, err)
+			continue
+		}
+
+		b.rmu.RLock()
+		receivers := b.receivers
+		b.rmu.RUnlock()
+		for _, receive := range receivers {
+			receive([]byte(payload))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ws
+
+import "net/http"
+
+// ProtocolVersion is the version of the frames below. Frames of any other
+// version are refused.
+const ProtocolVersion = 1
+
+// Operations a client may ask for.
+const (
+	OpSubscribe   = "subscribe"   // receive the events of a chat
+	OpUnsubscribe = "unsubscribe" // stop receiving them
+	OpSend        = "send"        // post a message; id is its idempotency key
+	OpTyping      = "typing"      // tell the chat you are (not) typing
+	OpRead        = "read"        // mark the other side's messages read
+)
+
+// Events the server sends.
+const (
+	EventAck            = "ack"             // the frame with this id was carried out
+	EventError          = "error"           // the frame with this id was refused
+	EventMessageCreated = "message.created" // a message was posted to the chat
+	EventMessageRead    = "message.read"    // messages of the chat were read
+	EventTyping         = "typing"          // a member started or stopped typing
+	EventPresence       = "presence"        // a member came online or went offline
+	EventNotification   = "notification"    // a notification for the user was created
+	// Order events carry the domain event type: order.created, order.updated
+	// and order.status_changed.
+)
+
+// Error codes of error events.
+const (
+	CodeInvalid  = "invalid"
+	CodeNotFound = "not_found"
+	CodeConflict = "conflict"
+	CodeInternal = "internal"
+)
+
+// Frame is what a client sends.
+type Frame struct {
+	V           int    `json:"v"`
+	Op          string `json:"op"`
+	ID          string `json:"id,omitempty"` // chosen by the client, echoed in the ack or error
+	ChatID      uint   `json:"chat_id"`
+	Content     string `json:"content,omitempty"`      // send
+	MessageType string `json:"message_type,omitempty"` // send
+	IsTyping    bool   `json:"is_typing,omitempty"`    // typing
+	UpToID      *uint  `json:"up_to_id,omitempty"`     // read
+}
+
+// Event is what the server sends.
+type Event struct {
+	V      int         `json:"v"`
+	Event  string      `json:"event"`
+	ID     string      `json:"id,omitempty"` // ID of the frame an ack or error answers
+	ChatID uint        `json:"chat_id,omitempty"`
+	UserID uint        `json:"user_id,omitempty"` // who caused the event
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// Error is a refusal the client is told about.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Identity is the user a connection was opened for.
+type Identity struct {
+	UserID     uint
+	Role       string
+	SupplierID *uint  // for supplier staff
+	SessionID  string // sign-in session the connection belongs to
+}
+
+// Service identifies the user of a connection before it is upgraded and
+// carries out the operations they ask for. Operations publish their own
+// events to the hub; errors of type *Error are passed on to the client.
+type Service interface {
+	Authenticate(r *http.Request) (Identity, error)
+	CanJoin(identity Identity, chatID uint) bool
+	// Send posts a message and returns its ID. A key that was used before
+	// returns the message it posted.
+	Send(identity Identity, chatID uint, key, content, messageType string) (uint, error)
+	MarkRead(identity Identity, chatID uint, upToID *uint) error
+	Typing(identity Identity, chatID uint, isTyping bool) error
+}
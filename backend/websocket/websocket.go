@@ -5,199 +5,95 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"gorm.io/gorm"
 )
 
-// Message represents a websocket message.
-type Message struct {
-	Type    string      `json:"type"`              // e.g. "chat_message", "read_receipt", "typing_indicator"
-	ChatID  uint        `json:"chat_id,omitempty"` // chat to which this message belongs
-	UserID  uint        `json:"user_id,omitempty"` // sender / actor
-	Content string      `json:"content,omitempty"` // text content (for chat messages)
-	Data    interface{} `json:"data,omitempty"`    // extra payload (e.g. { "message_id": 123 }, { "is_typing": true })
-}
+// maxFrameSize is the largest frame a client may send, enough for a message
+// of 4000 characters in any script.
+const maxFrameSize = 20 << 10
 
 // Client represents a websocket client.
 type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
-	userID uint
-	role   string
-	chatID uint
-}
-
-// Hub maintains the set of active clients and broadcasts messages to clients.
-type Hub struct {
-	clients    map[*Client]bool // registered clients
-	broadcast  chan []byte      // inbound messages from clients
-	register   chan *Client     // register requests from clients
-	unregister chan *Client     // unregister requests from clients
-	mu         sync.RWMutex     // mutex for thread safety
-}
-
-// NewHub creates a new websocket hub.
-func NewHub() *Hub {
-	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-	}
+	hub      *Hub
+	conn     *websocket.Conn
+	send     chan []byte
+	service  Service
+	identity Identity
+	topics   map[Topic]bool // topics the client is subscribed to, guarded by hub.mu
 }
 
-// Run starts the hub event loop.
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			log.Printf("Client connected: UserID %d, ChatID %d", client.userID, client.chatID)
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				log.Printf("Client disconnected: UserID %d, ChatID %d", client.userID, client.chatID)
+// Handler upgrades connections from the allowed origins whose user the
+// service accepts. A chat_id query parameter subscribes the connection to
+// that chat straight away.
+func Handler(hub *Hub, service Service, allowedOrigins []string) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				// Not a browser; the ticket is all there is to check
+				return true
 			}
-			h.mu.Unlock()
-
-		case message := <-h.broadcast:
-			// Broadcast to everyone (or you can decode and use BroadcastToChat instead).
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+			for _, allowed := range allowedOrigins {
+				if origin == allowed {
+					return true
 				}
 			}
-			h.mu.RUnlock()
-		}
-	}
-}
-
-// BroadcastToChat sends a message to all clients in a specific chat.
-func (h *Hub) BroadcastToChat(chatID uint, message []byte) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	for client := range h.clients {
-		// TODO: Check if client has access to this chat (permissions, membership).
-		if client.chatID != chatID {
-			continue
-		}
-		select {
-		case client.send <- message:
-		default:
-			// If the client's send buffer is full, drop the client.
-			close(client.send)
-			delete(h.clients, client)
-		}
-	}
-}
-
-// SendReadReceipt sends read receipt for messages.
-func (h *Hub) SendReadReceipt(chatID, userID, messageID uint) {
-	msg := Message{
-		Type:   "read_receipt",
-		ChatID: chatID,
-		UserID: userID,
-		Data: map[string]uint{
-			"message_id": messageID,
+			return false
 		},
 	}
 
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Failed to marshal read receipt: %v", err)
-		return
-	}
-
-	h.BroadcastToChat(chatID, payload)
-}
-
-// SendTypingIndicator sends typing indicator to chat participants.
-func (h *Hub) SendTypingIndicator(chatID, userID uint, isTyping bool) {
-	msg := Message{
-		Type:   "typing_indicator",
-		ChatID: chatID,
-		UserID: userID,
-		Data: map[string]bool{
-			"is_typing": isTyping,
-		},
-	}
-
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Failed to marshal typing indicator: %v", err)
-		return
-	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !upgrader.CheckOrigin(r) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
 
-	h.BroadcastToChat(chatID, payload)
-}
+		identity, err := service.Authenticate(r)
+		if err != nil {
+			http.Error(w, "Invalid or expired ticket", http.StatusUnauthorized)
+			return
+		}
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins in development.
-		// TODO: Restrict origins in production.
-		return true
-	},
-}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade failed: %v", err)
+			return
+		}
 
-// HandleWebSocket handles websocket connections.
-func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request, db *gorm.DB) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
-		return
-	}
+		client := &Client{
+			hub:      hub,
+			conn:     conn,
+			send:     make(chan []byte, 256),
+			service:  service,
+			identity: identity,
+			topics:   make(map[Topic]bool),
+		}
 
-	// TODO: Extract user info from JWT token in query params or headers.
-	// Placeholder user/role:
-	userID := uint(1)
-	role := "consumer"
+		client.hub.register(client)
 
-	// ChatID from query parameter, e.g. ws://.../ws?chat_id=123
-	var chatID uint
-	if rawChat := r.URL.Query().Get("chat_id"); rawChat != "" {
-		if val, err := strconv.ParseUint(rawChat, 10, 64); err == nil {
-			chatID = uint(val)
+		// ChatID from query parameter, e.g. ws://.../ws?ticket=...&chat_id=123
+		if rawChat := r.URL.Query().Get("chat_id"); rawChat != "" {
+			if val, err := strconv.ParseUint(rawChat, 10, 32); err == nil {
+				client.handle(Frame{V: ProtocolVersion, Op: OpSubscribe, ChatID: uint(val)})
+			}
 		}
-	}
 
-	client := &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		userID: userID,
-		role:   role,
-		chatID: chatID,
+		// Start goroutines for reading and writing.
+		go client.writePump()
+		go client.readPump()
 	}
-
-	client.hub.register <- client
-
-	// Start goroutines for reading and writing.
-	go client.writePump()
-	go client.readPump()
 }
 
-// readPump pumps messages from the websocket connection to the hub.
+// readPump pumps frames from the websocket connection to the service.
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(5120)
+	c.conn.SetReadLimit(maxFrameSize)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -213,19 +109,84 @@ func (c *Client) readPump() {
 			break
 		}
 
-		log.Printf("Received message from user %d: %s", c.userID, string(message))
-
-		// Here you can decode the message and route based on Type.
-		// For now, echo / broadcast it.
-		// Example: process only chat messages and route via BroadcastToChat:
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err == nil && msg.ChatID != 0 {
-			c.hub.BroadcastToChat(msg.ChatID, message)
-		} else {
-			// Fallback: broadcast to everyone.
-			c.hub.broadcast <- message
+		var frame Frame
+		if err := json.Unmarshal(message, &frame); err != nil {
+			c.refuse(frame, &Error{Code: CodeInvalid, Message: "Frames must be JSON"})
+			continue
+		}
+		c.handle(frame)
+	}
+}
+
+// handle carries out one frame and answers it with an ack or an error.
+func (c *Client) handle(frame Frame) {
+	if frame.V != ProtocolVersion {
+		c.refuse(frame, &Error{Code: CodeInvalid, Message: "Unsupported protocol version"})
+		return
+	}
+	if frame.ChatID == 0 {
+		c.refuse(frame, &Error{Code: CodeInvalid, Message: "chat_id is required"})
+		return
+	}
+
+	var data interface{}
+	switch frame.Op {
+	case OpSubscribe:
+		if !c.service.CanJoin(c.identity, frame.ChatID) {
+			c.refuse(frame, &Error{Code: CodeNotFound, Message: "Chat not found"})
+			return
+		}
+		if c.hub.Subscribe(c, ChatTopic(frame.ChatID)) {
+			c.hub.announce(frame.ChatID, c.identity.UserID, true)
+		}
+		data = map[string][]uint{"online": c.hub.online(frame.ChatID)}
+
+	case OpUnsubscribe:
+		if c.hub.Unsubscribe(c, ChatTopic(frame.ChatID)) {
+			c.hub.announce(frame.ChatID, c.identity.UserID, false)
+		}
+
+	case OpSend:
+		if frame.ID == "" {
+			c.refuse(frame, &Error{Code: CodeInvalid, Message: "id is required to send a message"})
+			return
+		}
+		messageID, err := c.service.Send(c.identity, frame.ChatID, frame.ID, frame.Content, frame.MessageType)
+		if err != nil {
+			c.refuse(frame, err)
+			return
+		}
+		data = map[string]uint{"message_id": messageID}
+
+	case OpTyping:
+		if err := c.service.Typing(c.identity, frame.ChatID, frame.IsTyping); err != nil {
+			c.refuse(frame, err)
+			return
 		}
+
+	case OpRead:
+		if err := c.service.MarkRead(c.identity, frame.ChatID, frame.UpToID); err != nil {
+			c.refuse(frame, err)
+			return
+		}
+
+	default:
+		c.refuse(frame, &Error{Code: CodeInvalid, Message: "Unknown op"})
+		return
+	}
+
+	c.hub.sendTo(c, Event{Event: EventAck, ID: frame.ID, ChatID: frame.ChatID, Data: data})
+}
+
+// refuse answers a frame with an error event. Errors other than *Error are
+// logged and reported without detail.
+func (c *Client) refuse(frame Frame, err error) {
+	clientErr, ok := err.(*Error)
+	if !ok {
+		log.Printf("WebSocket %s from user %d failed: %v", frame.Op, c.identity.UserID, err)
+		clientErr = &Error{Code: CodeInternal, Message: "Something went wrong"}
 	}
+	c.hub.sendTo(c, Event{Event: EventError, ID: frame.ID, ChatID: frame.ChatID, Data: clientErr})
 }
 
 // writePump pumps messages from the hub to the websocket connection.